@@ -11,6 +11,8 @@ import (
 
 type HandleFuncWithError func(http.ResponseWriter, *http.Request) error
 
+// DefaultPort is the API port. It serves HTTPS only when the manager is
+// started with --tls-cert and --tls-key.
 const DefaultPort int = 9500
 
 func HandleError(s *client.Schemas, t HandleFuncWithError) http.Handler {
@@ -28,6 +30,12 @@ func Handler(s *Server) http.Handler {
 	schemas := NewSchema()
 	f := HandleError
 
+	r.Methods("GET").Path("/healthz").HandlerFunc(s.Healthz)
+	r.Methods("GET").Path("/readyz").HandlerFunc(s.Readyz)
+	if DebugEndpoints {
+		r.Methods("GET").Path("/debug/controllers").HandlerFunc(s.DebugControllers)
+	}
+
 	versionsHandler := api.VersionsHandler(schemas, "v1")
 	versionHandler := api.VersionHandler(schemas, "v1")
 	r.Methods("GET").Path("/").Handler(versionsHandler)
@@ -36,50 +44,103 @@ func Handler(s *Server) http.Handler {
 	r.Methods("GET").Path("/v1/apiversions/v1").Handler(versionHandler)
 	r.Methods("GET").Path("/v1/schemas").Handler(api.SchemasHandler(schemas))
 	r.Methods("GET").Path("/v1/schemas/{id}").Handler(api.SchemaHandler(schemas))
+	r.Methods("GET").Path("/v1/openapi.json").Handler(f(schemas, s.OpenAPI))
+	r.Methods("GET").Path("/v1/info").Handler(f(schemas, s.Info))
 
 	r.Methods("GET").Path("/v1/settings").Handler(f(schemas, s.settings.List))
 	r.Methods("GET").Path("/v1/settings/{name}").Handler(f(schemas, s.settings.Get))
-	r.Methods("PUT").Path("/v1/settings/{name}").Handler(f(schemas, s.settings.Set))
+	r.Methods("PUT").Path("/v1/settings/{name}").Handler(f(schemas, Audit("update", "setting", ResourceIDFromVar("name"), s.settings.Set)))
 
 	r.Methods("GET").Path("/v1/volumes").Handler(f(schemas, s.ListVolume))
 	r.Methods("GET").Path("/v1/volumes/{name}").Handler(f(schemas, s.GetVolume))
-	r.Methods("DELETE").Path("/v1/volumes/{name}").Handler(f(schemas, s.DeleteVolume))
-	r.Methods("POST").Path("/v1/volumes").Handler(f(schemas, s.CreateVolume))
+	r.Methods("DELETE").Path("/v1/volumes/{name}").Handler(f(schemas, Audit("delete", "volume", ResourceIDFromVar("name"), s.DeleteVolume)))
+	r.Methods("POST").Path("/v1/volumes").Queries("action", "snapshotGroupCreate").Handler(f(schemas,
+		Audit("snapshotGroupCreate", "volume", ResourceIDFromBody, s.snapshots.CreateGroup)))
+	r.Methods("POST").Path("/v1/volumes").Handler(f(schemas, Audit("create", "volume", ResourceIDFromBody, s.CreateVolume)))
+	r.Methods("POST").Path("/v1/volumes/bulk").Handler(f(schemas, Audit("bulkCreate", "volume", bulkCreateVolumeNames, s.BulkCreateVolumes)))
+	r.Methods("GET").Path("/v1/volumes/{name}/schedule").Handler(f(schemas, s.GetSnapshotSchedule))
+	r.Methods("GET").Path("/v1/volumes/{name}/backups").Handler(f(schemas, s.backups.ListByVolume))
+	r.Methods("GET").Path("/v1/volumes/{name}/monitor").Handler(f(schemas, s.fwd.Handler(HostIDFromVolume(s.man), s.GetMonitorStatus)))
+	r.Methods("GET").Path("/v1/volumes/{name}/watch").Handler(f(schemas, s.fwd.Handler(HostIDFromVolume(s.man), s.WatchVolume)))
+	r.Methods("GET").Path("/v1/volumes/{name}/replicas").Handler(f(schemas, s.fwd.Handler(HostIDFromVolume(s.man), s.ListReplicas)))
+	r.Methods("PUT").Path("/v1/volumes/{name}/replicas/{replicaName}").Handler(f(schemas, s.fwd.Handler(HostIDFromVolume(s.man),
+		Audit("update", "replica", ResourceIDFromVar("replicaName"), s.UpdateReplica))))
+	r.Methods("POST").Path("/v1/volumes/{name}/replicas/{replicaName}/pin").Handler(f(schemas, s.fwd.Handler(HostIDFromVolume(s.man),
+		Audit("pin", "replica", ResourceIDFromVar("replicaName"), s.ReplicaPin))))
 
+	auditVolume := func(operation string, h HandleFuncWithError) HandleFuncWithError {
+		return Audit(operation, "volume", ResourceIDFromVar("name"), h)
+	}
 	volumeActions := map[string]func(http.ResponseWriter, *http.Request) error{
-		"attach":          s.fwd.Handler(HostIDFromAttachReq, s.AttachVolume),
-		"detach":          s.fwd.Handler(HostIDFromVolume(s.man), s.DetachVolume),
-		"snapshotPurge":   s.fwd.Handler(HostIDFromVolume(s.man), s.snapshots.Purge),
-		"snapshotCreate":  s.fwd.Handler(HostIDFromVolume(s.man), s.snapshots.Create),
-		"snapshotList":    s.fwd.Handler(HostIDFromVolume(s.man), s.snapshots.List),
-		"snapshotGet":     s.fwd.Handler(HostIDFromVolume(s.man), s.snapshots.Get),
-		"snapshotDelete":  s.fwd.Handler(HostIDFromVolume(s.man), s.snapshots.Delete),
-		"snapshotRevert":  s.fwd.Handler(HostIDFromVolume(s.man), s.snapshots.Revert),
-		"snapshotBackup":  s.fwd.Handler(HostIDFromVolume(s.man), s.snapshots.Backup),
-		"recurringUpdate": s.fwd.Handler(HostIDFromVolume(s.man), s.UpdateRecurring),
-		"bgTaskQueue":     s.fwd.Handler(HostIDFromVolume(s.man), s.BgTaskQueue),
-		"replicaRemove":   s.fwd.Handler(HostIDFromVolume(s.man), s.ReplicaRemove),
+		"attach":               s.fwd.Handler(HostIDFromAttachReq, auditVolume("attach", s.AttachVolume)),
+		"detach":               s.fwd.Handler(HostIDFromVolume(s.man), auditVolume("detach", s.DetachVolume)),
+		"migrate":              s.fwd.Handler(HostIDFromMigrateReq, auditVolume("migrate", s.MigrateVolume)),
+		"backupRestore":        s.fwd.Handler(HostIDFromVolume(s.man), auditVolume("backupRestore", s.RestoreVolume)),
+		"snapshotPurge":        s.fwd.Handler(HostIDFromVolume(s.man), auditVolume("snapshotPurge", s.snapshots.Purge)),
+		"snapshotCreate":       s.fwd.Handler(HostIDFromVolume(s.man), auditVolume("snapshotCreate", s.snapshots.Create)),
+		"snapshotList":         s.fwd.Handler(HostIDFromVolume(s.man), s.snapshots.List),
+		"snapshotGet":          s.fwd.Handler(HostIDFromVolume(s.man), s.snapshots.Get),
+		"snapshotDiff":         s.fwd.Handler(HostIDFromVolume(s.man), s.snapshots.Diff),
+		"snapshotDelete":       s.fwd.Handler(HostIDFromVolume(s.man), auditVolume("snapshotDelete", s.snapshots.Delete)),
+		"snapshotBulkDelete":   s.fwd.Handler(HostIDFromVolume(s.man), auditVolume("snapshotBulkDelete", s.snapshots.BulkDelete)),
+		"snapshotRevert":       s.fwd.Handler(HostIDFromVolume(s.man), auditVolume("snapshotRevert", s.snapshots.Revert)),
+		"snapshotBackup":       s.fwd.Handler(HostIDFromVolume(s.man), auditVolume("snapshotBackup", s.snapshots.Backup)),
+		"backupCancel":         s.fwd.Handler(HostIDFromVolume(s.man), auditVolume("backupCancel", s.snapshots.CancelBackup)),
+		"recurringUpdate":      s.fwd.Handler(HostIDFromVolume(s.man), auditVolume("recurringUpdate", s.UpdateRecurring)),
+		"bgTaskQueue":          s.fwd.Handler(HostIDFromVolume(s.man), s.BgTaskQueue),
+		"bgTaskCancel":         s.fwd.Handler(HostIDFromVolume(s.man), auditVolume("bgTaskCancel", s.CancelBgTask)),
+		"volumeInfo":           s.fwd.Handler(HostIDFromVolume(s.man), s.VolumeInfo),
+		"volumeIOStats":        s.fwd.Handler(HostIDFromVolume(s.man), s.VolumeIOStats),
+		"replicaRebuildStatus": s.fwd.Handler(HostIDFromVolume(s.man), s.ReplicaRebuildStatus),
+		"export":               s.fwd.Handler(HostIDFromVolume(s.man), auditVolume("export", s.ExportVolume)),
+		"controllerCreate":     s.fwd.Handler(HostIDFromVolume(s.man), auditVolume("controllerCreate", s.CreateController)),
+		"replicaAdd":           s.fwd.Handler(HostIDFromVolume(s.man), auditVolume("replicaAdd", s.ReplicaAdd)),
+		"replicaRemove":        s.fwd.Handler(HostIDFromVolume(s.man), auditVolume("replicaRemove", s.ReplicaRemove)),
+		"replicaPin":           s.fwd.Handler(HostIDFromVolume(s.man), auditVolume("replicaPin", s.ReplicaPin)),
+		"replicaModeUpdate":    s.fwd.Handler(HostIDFromVolume(s.man), auditVolume("replicaModeUpdate", s.ReplicaModeUpdate)),
+		"labelUpdate":          s.fwd.Handler(HostIDFromVolume(s.man), auditVolume("labelUpdate", s.UpdateLabels)),
+		"qosUpdate":            s.fwd.Handler(HostIDFromVolume(s.man), auditVolume("qosUpdate", s.UpdateQoS)),
+		"emergencySnapshot":    s.fwd.Handler(HostIDFromVolume(s.man), auditVolume("emergencySnapshot", s.snapshots.Emergency)),
+		"autoScaleUpdate":      s.fwd.Handler(HostIDFromVolume(s.man), auditVolume("autoScaleUpdate", s.UpdateAutoScale)),
 	}
 	for name, action := range volumeActions {
 		r.Methods("POST").Path("/v1/volumes/{name}").Queries("action", name).Handler(f(schemas, action))
 	}
+	r.Methods("POST").Path("/v1/volumes/{name}/controller").Handler(f(schemas, volumeActions["controllerCreate"]))
 
 	r.Methods("GET").Path("/v1/backupvolumes").Handler(f(schemas, s.backups.ListVolume))
 	r.Methods("GET").Path("/v1/backupvolumes/{volName}").Handler(f(schemas, s.backups.GetVolume))
 	backupActions := map[string]func(http.ResponseWriter, *http.Request) error{
-		"backupList":   s.backups.List,
-		"backupGet":    s.backups.Get,
-		"backupDelete": s.backups.Delete,
+		"backupList":      s.backups.List,
+		"backupGet":       s.backups.Get,
+		"backupDelete":    Audit("backupDelete", "backupVolume", ResourceIDFromVar("volName"), s.backups.Delete),
+		"verifyIntegrity": s.backups.VerifyIntegrity,
+		"integrityReport": s.backups.IntegrityReport,
+
+		"backupVolumeDelete": Audit("backupVolumeDelete", "backupVolume", ResourceIDFromVar("volName"), s.backups.DeleteVolume),
 	}
 	for name, action := range backupActions {
 		r.Methods("POST").Path("/v1/backupvolumes/{volName}").Queries("action", name).Handler(f(schemas, action))
 	}
 
+	r.Methods("GET").Path("/v1/events").Handler(f(schemas, s.ListEvents))
+
 	r.Methods("GET").Path("/v1/hosts").Handler(f(schemas, s.ListHost))
 	r.Methods("GET").Path("/v1/hosts/{id}").Handler(f(schemas, s.GetHost))
+	r.Methods("POST").Path("/v1/hosts/{id}/evict").Handler(f(schemas, s.fwd.Handler(HostIDForEvict(s.man, s.sl),
+		Audit("evict", "host", ResourceIDFromVar("id"), s.EvictHost))))
+
+	r.Methods("GET").Path("/v1/cluster/topology").Handler(f(schemas, s.GetTopology))
 
 	// Internal API
 	r.Methods("POST").Path("/v1/schedule").Handler(f(schemas, s.Schedule))
 
-	return r
+	var h http.Handler = r
+	if s.leader != nil {
+		h = leaderHandler(s.leader, s.proxy, h)
+	}
+	if TraceRequests {
+		h = traceHandler(h)
+	}
+	return h
 }
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+
+	"github.com/rancher/longhorn-manager/types"
+	"github.com/rancher/longhorn-manager/util"
+)
+
+// AuditLogger receives an audit event for every mutating API operation
+var AuditLogger = logrus.StandardLogger()
+
+// AuditPeer tells whether the remote address of a request is another manager,
+// the X-Forwarded-For header of the requests it forwards is trusted. Nil
+// trusts no one, see PeerManagerAddr.
+var AuditPeer func(host string) bool
+
+const (
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+)
+
+type ResourceIDFunc func(req *http.Request) string
+
+func ResourceIDFromVar(name string) ResourceIDFunc {
+	return func(req *http.Request) string {
+		return mux.Vars(req)[name]
+	}
+}
+
+func ResourceIDFromBody(req *http.Request) string {
+	input := struct {
+		Name string `json:"name"`
+	}{}
+	json.NewDecoder(util.CopyReq(req).Body).Decode(&input)
+	return input.Name
+}
+
+// Audit wraps the handler of a mutating operation to log an audit event with
+// the handler's result. Wrap the handler after forwarding, so the operation
+// is only logged by the host that performs it.
+func Audit(operation, resource string, getID ResourceIDFunc, h HandleFuncWithError) HandleFuncWithError {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		resourceID := getID(req)
+		err := h(w, req)
+
+		fields := logrus.Fields{
+			"user":       requestUser(req),
+			"remoteAddr": remoteAddr(req),
+			"operation":  operation,
+			"resource":   resource,
+			"resourceID": resourceID,
+			"result":     AuditResultSuccess,
+		}
+		if err != nil {
+			fields["result"] = AuditResultFailure
+			fields["error"] = err.Error()
+		}
+		AuditLogger.WithFields(fields).Info("audit")
+		return err
+	}
+}
+
+// requestUser is the common name of the TLS client certificate or the basic
+// auth user name, the API has no other notion of users
+func requestUser(req *http.Request) string {
+	if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+		return req.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	if user, _, ok := req.BasicAuth(); ok {
+		return user
+	}
+	return ""
+}
+
+// remoteAddr is the address of the original client if the request has been
+// forwarded by another manager
+func remoteAddr(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	if fwd := req.Header.Get("X-Forwarded-For"); fwd != "" && AuditPeer != nil && AuditPeer(host) {
+		return strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+	return host
+}
+
+// PeerManagerAddr checks the host is the address of one of the managers
+func PeerManagerAddr(man types.VolumeManager, sl types.ServiceLocator) func(host string) bool {
+	return func(host string) bool {
+		hosts, err := man.ListHosts()
+		if err != nil {
+			logrus.Warnf("fail to list hosts to check peer address %v: %v", host, err)
+			return false
+		}
+		for hostID := range hosts {
+			address, err := sl.GetAddress(hostID)
+			if err != nil {
+				continue
+			}
+			if peer, _, err := net.SplitHostPort(address); err == nil && peer == host {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+func TestAudit(t *testing.T) {
+	assert := require.New(t)
+
+	out := &bytes.Buffer{}
+	defer func(logger *logrus.Logger) { AuditLogger = logger }(AuditLogger)
+	AuditLogger = logrus.New()
+	AuditLogger.Out = out
+	AuditLogger.Formatter = &logrus.JSONFormatter{}
+
+	var handlerErr error
+	r := mux.NewRouter()
+	r.Methods("POST").Path("/v1/volumes/{name}").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		Audit("detach", "volume", ResourceIDFromVar("name"), func(w http.ResponseWriter, req *http.Request) error {
+			return handlerErr
+		})(w, req)
+	})
+
+	event := map[string]string{}
+	req := httptest.NewRequest("POST", "/v1/volumes/vol1?action=detach", nil)
+	req.SetBasicAuth("admin", "secret")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Nil(json.Unmarshal(out.Bytes(), &event))
+	assert.Equal("admin", event["user"])
+	assert.Equal("192.0.2.1", event["remoteAddr"])
+	assert.Equal("detach", event["operation"])
+	assert.Equal("volume", event["resource"])
+	assert.Equal("vol1", event["resourceID"])
+	assert.Equal(AuditResultSuccess, event["result"])
+
+	out.Reset()
+	handlerErr = errors.New("cannot detach")
+	req = httptest.NewRequest("POST", "/v1/volumes/vol1?action=detach", nil)
+	req.Header.Set("X-Forwarded-For", "10.0.0.5, 10.0.0.6")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	event = map[string]string{}
+	assert.Nil(json.Unmarshal(out.Bytes(), &event))
+	assert.Equal("", event["user"])
+	// not forwarded by another manager
+	assert.Equal("192.0.2.1", event["remoteAddr"])
+	assert.Equal(AuditResultFailure, event["result"])
+	assert.Equal("cannot detach", event["error"])
+
+	defer func() { AuditPeer = nil }()
+	AuditPeer = PeerManagerAddr(&fakeHostsManager{hosts: []string{"host-1", "host-2"}}, &fakeHostsLocator{})
+	out.Reset()
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	event = map[string]string{}
+	assert.Nil(json.Unmarshal(out.Bytes(), &event))
+	assert.Equal("10.0.0.5", event["remoteAddr"])
+
+	AuditPeer = PeerManagerAddr(&fakeHostsManager{hosts: []string{"host-1"}}, &fakeHostsLocator{})
+	out.Reset()
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	event = map[string]string{}
+	assert.Nil(json.Unmarshal(out.Bytes(), &event))
+	assert.Equal("192.0.2.1", event["remoteAddr"])
+}
+
+type fakeHostsManager struct {
+	types.VolumeManager
+	hosts []string
+}
+
+func (m *fakeHostsManager) ListHosts() (map[string]*types.HostInfo, error) {
+	hosts := map[string]*types.HostInfo{}
+	for _, id := range m.hosts {
+		hosts[id] = &types.HostInfo{UUID: id}
+	}
+	return hosts, nil
+}
+
+// fakeHostsLocator has host-2 at the address of httptest requests
+type fakeHostsLocator struct{}
+
+func (sl *fakeHostsLocator) GetCurrentHostID() string {
+	return "host-1"
+}
+
+func (sl *fakeHostsLocator) GetAddress(hostID string) (string, error) {
+	if hostID == "host-2" {
+		return "192.0.2.1:9500", nil
+	}
+	return "10.0.0.1:9500", nil
+}
+
+func TestResourceIDFromBody(t *testing.T) {
+	assert := require.New(t)
+
+	req := httptest.NewRequest("POST", "/v1/volumes", bytes.NewBufferString(`{"name":"vol1","size":"10g"}`))
+	assert.Equal("vol1", ResourceIDFromBody(req))
+	input := map[string]string{}
+	assert.Nil(json.NewDecoder(req.Body).Decode(&input))
+	assert.Equal("10g", input["size"])
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const shaPrefix = "{SHA}"
+
+// Htpasswd maps the user names to their password hashes
+type Htpasswd map[string]string
+
+// LoadHtpasswd reads an htpasswd file with SHA1 password hashes, as written
+// by `htpasswd -s`
+func LoadHtpasswd(file string) (Htpasswd, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to open htpasswd file %v", file)
+	}
+	defer f.Close()
+
+	users := Htpasswd{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("invalid line in htpasswd file %v: %v", file, line)
+		}
+		if !strings.HasPrefix(parts[1], shaPrefix) {
+			return nil, errors.Errorf("unsupported password hash of user %v in htpasswd file %v, use htpasswd -s", parts[0], file)
+		}
+		users[parts[0]] = parts[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "fail to read htpasswd file %v", file)
+	}
+	if len(users) == 0 {
+		return nil, errors.Errorf("no users in htpasswd file %v", file)
+	}
+	return users, nil
+}
+
+func (users Htpasswd) Authenticate(user, password string) bool {
+	hash, ok := users[user]
+	if !ok {
+		return false
+	}
+	sum := sha1.Sum([]byte(password))
+	expected := shaPrefix + base64.StdEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(expected)) == 1
+}
+
+// LoadPeerCredentials reads the user:password the manager authenticates with
+// to the API of the other managers
+func LoadPeerCredentials(file string) (string, string, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "fail to read peer credentials file %v", file)
+	}
+	parts := strings.SplitN(strings.TrimSpace(string(content)), ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.Errorf("invalid peer credentials file %v, should contain user:password", file)
+	}
+	return parts[0], parts[1], nil
+}
+
+// BasicAuthHandler requires HTTP basic auth of one of the users, except for
+// the health checks. The other managers authenticate with the peer
+// credentials. It's a stopgap until the API supports RBAC/OIDC.
+func BasicAuthHandler(users Htpasswd, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/healthz", "/readyz":
+			h.ServeHTTP(w, req)
+			return
+		}
+		if user, password, ok := req.BasicAuth(); !ok || !users.Authenticate(user, password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="longhorn-manager"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
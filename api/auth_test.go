@@ -0,0 +1,71 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBasicAuthHandler(t *testing.T) {
+	assert := require.New(t)
+
+	f, err := ioutil.TempFile("", "htpasswd")
+	assert.Nil(err)
+	defer os.Remove(f.Name())
+	// htpasswd -nbs admin secret
+	_, err = f.WriteString("# users\nadmin:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n")
+	assert.Nil(err)
+	assert.Nil(f.Close())
+
+	users, err := LoadHtpasswd(f.Name())
+	assert.Nil(err)
+	assert.True(users.Authenticate("admin", "secret"))
+	assert.False(users.Authenticate("admin", "wrong"))
+	assert.False(users.Authenticate("nobody", "secret"))
+
+	h := BasicAuthHandler(users, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	serve := func(path, user, password string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		if user != "" {
+			req.SetBasicAuth(user, password)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(http.StatusUnauthorized, serve("/v1/volumes", "", ""))
+	assert.Equal(http.StatusUnauthorized, serve("/v1/volumes", "admin", "wrong"))
+	assert.Equal(http.StatusOK, serve("/v1/volumes", "admin", "secret"))
+	assert.Equal(http.StatusOK, serve("/healthz", "", ""))
+	assert.Equal(http.StatusOK, serve("/readyz", "", ""))
+	assert.Equal(http.StatusUnauthorized, serve("/v1/schedule", "", ""))
+	assert.Equal(http.StatusOK, serve("/v1/schedule", "admin", "secret"))
+
+	assert.Nil(ioutil.WriteFile(f.Name(), []byte("admin:$apr1$abc$def\n"), 0600))
+	_, err = LoadHtpasswd(f.Name())
+	assert.NotNil(err)
+}
+
+func TestLoadPeerCredentials(t *testing.T) {
+	assert := require.New(t)
+
+	f, err := ioutil.TempFile("", "peer")
+	assert.Nil(err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("admin:sec:ret\n")
+	assert.Nil(err)
+	assert.Nil(f.Close())
+
+	user, password, err := LoadPeerCredentials(f.Name())
+	assert.Nil(err)
+	assert.Equal("admin", user)
+	assert.Equal("sec:ret", password)
+
+	assert.Nil(ioutil.WriteFile(f.Name(), []byte("admin\n"), 0600))
+	_, _, err = LoadPeerCredentials(f.Name())
+	assert.NotNil(err)
+}
@@ -3,17 +3,26 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 	"github.com/rancher/go-rancher/api"
 
+	"github.com/rancher/longhorn-manager/backups"
 	"github.com/rancher/longhorn-manager/types"
+	"github.com/rancher/longhorn-manager/util"
 )
 
 type BackupsHandlers struct {
 	man types.VolumeManager
+
+	integrityLock  sync.Mutex
+	integrityNum   int64
+	integrityTasks map[string]*types.BgTask
 }
 
 func (bh *BackupsHandlers) ListVolume(w http.ResponseWriter, req *http.Request) error {
@@ -35,7 +44,12 @@ func (bh *BackupsHandlers) ListVolume(w http.ResponseWriter, req *http.Request)
 		return errors.Wrapf(err, "error listing backups, backupTarget '%s'", backupTarget)
 	}
 	logrus.Debugf("success: list backup volumes, backupTarget '%s'", backupTarget)
-	apiContext.Write(toBackupVolumeCollection(volumes, apiContext))
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Name < volumes[j].Name })
+	resp := toBackupVolumeCollection(volumes, apiContext)
+	if err := paginate(resp, req); err != nil {
+		return err
+	}
+	apiContext.Write(resp)
 	return nil
 }
 
@@ -65,8 +79,16 @@ func (bh *BackupsHandlers) GetVolume(w http.ResponseWriter, req *http.Request) e
 }
 
 func (bh *BackupsHandlers) List(w http.ResponseWriter, req *http.Request) error {
-	volName := mux.Vars(req)["volName"]
+	return bh.list(req, mux.Vars(req)["volName"])
+}
+
+// ListByVolume lists the backups of the volume, a shortcut for the backupList
+// action of its backup volume
+func (bh *BackupsHandlers) ListByVolume(w http.ResponseWriter, req *http.Request) error {
+	return bh.list(req, mux.Vars(req)["name"])
+}
 
+func (bh *BackupsHandlers) list(req *http.Request, volName string) error {
 	settings, err := bh.man.Settings().GetSettings()
 	if err != nil || settings == nil {
 		return errors.New("cannot backup: unable to read settings")
@@ -83,7 +105,12 @@ func (bh *BackupsHandlers) List(w http.ResponseWriter, req *http.Request) error
 		return errors.Wrapf(err, "error listing backups, backupTarget '%s', volume '%s'", backupTarget, volName)
 	}
 	logrus.Debugf("success: list backups, volume '%s', backupTarget '%s'", volName, backupTarget)
-	api.GetApiContext(req).Write(toBackupCollection(bs))
+	sort.Slice(bs, func(i, j int) bool { return bs[i].Name < bs[j].Name })
+	resp := toBackupCollection(bs)
+	if err := paginate(resp, req); err != nil {
+		return err
+	}
+	api.GetApiContext(req).Write(resp)
 	return nil
 }
 
@@ -163,3 +190,103 @@ func (bh *BackupsHandlers) Delete(w http.ResponseWriter, req *http.Request) erro
 	apiContext.Write(&Empty{})
 	return nil
 }
+
+// DeleteVolume deletes all backups of the volume from the backup target
+func (bh *BackupsHandlers) DeleteVolume(w http.ResponseWriter, req *http.Request) error {
+	volName := mux.Vars(req)["volName"]
+
+	settings, err := bh.man.Settings().GetSettings()
+	if err != nil || settings == nil {
+		return errors.New("cannot backup: unable to read settings")
+	}
+	backupTarget := settings.BackupTarget
+	if backupTarget == "" {
+		return errors.New("cannot backup: backupTarget not set")
+	}
+
+	backups := bh.man.ManagerBackupOps(backupTarget)
+
+	if err := backups.DeleteVolume(volName); err != nil {
+		return errors.Wrapf(err, "error deleting backup volume '%s', backupTarget '%s'", volName, backupTarget)
+	}
+	logrus.Debugf("success: removed backup volume '%s', backupTarget '%s'", volName, backupTarget)
+	api.GetApiContext(req).Write(&Empty{})
+	return nil
+}
+
+// VerifyIntegrity starts checking the backups of the volume in background,
+// unless a check is already running. The check may take very long on big
+// backup targets, so it responds with the task, use integrityReport to get
+// the result.
+func (bh *BackupsHandlers) VerifyIntegrity(w http.ResponseWriter, req *http.Request) error {
+	volName := mux.Vars(req)["volName"]
+
+	settings, err := bh.man.Settings().GetSettings()
+	if err != nil || settings == nil {
+		return errors.New("cannot backup: unable to read settings")
+	}
+	backupTarget := settings.BackupTarget
+	if backupTarget == "" {
+		return errors.New("cannot backup: backupTarget not set")
+	}
+
+	bh.integrityLock.Lock()
+	defer bh.integrityLock.Unlock()
+
+	task := bh.integrityTasks[volName]
+	if task == nil || task.Finished != "" {
+		bh.integrityNum++
+		now := util.FormatTimeZ(time.Now())
+		task = &types.BgTask{
+			Num:       bh.integrityNum,
+			Submitted: now,
+			Started:   now,
+			Task: &types.BackupIntegrityBgTask{
+				BackupTarget: backupTarget,
+				VolumeName:   volName,
+			},
+		}
+		bh.integrityTasks[volName] = task
+		go bh.verifyIntegrity(task, bh.man.ManagerBackupOps(backupTarget), volName)
+	}
+	api.GetApiContext(req).Write(toBgTaskRes(copyIntegrityTask(task)))
+	return nil
+}
+
+func (bh *BackupsHandlers) verifyIntegrity(task *types.BgTask, ops types.ManagerBackupOps, volName string) {
+	report, err := backups.CheckIntegrity(ops, volName)
+	if err != nil {
+		logrus.Errorf("%+v", errors.Wrapf(err, "error verifying integrity of backups, volume '%s'", volName))
+	} else {
+		logrus.Infof("verified integrity of backups, volume '%s': %v of %v backups corrupted, %v missing and %v orphaned blocks",
+			volName, len(report.CorruptedBackups), report.CheckedBackups, len(report.MissingBlocks), len(report.OrphanedBlocks))
+	}
+
+	bh.integrityLock.Lock()
+	defer bh.integrityLock.Unlock()
+	task.Err = err
+	task.Finished = util.FormatTimeZ(time.Now())
+	task.Task.(*types.BackupIntegrityBgTask).Report = report
+}
+
+func (bh *BackupsHandlers) IntegrityReport(w http.ResponseWriter, req *http.Request) error {
+	volName := mux.Vars(req)["volName"]
+
+	bh.integrityLock.Lock()
+	defer bh.integrityLock.Unlock()
+
+	task := bh.integrityTasks[volName]
+	if task == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+	api.GetApiContext(req).Write(toBgTaskRes(copyIntegrityTask(task)))
+	return nil
+}
+
+func copyIntegrityTask(task *types.BgTask) *types.BgTask {
+	t := *task
+	integrityTask := *task.Task.(*types.BackupIntegrityBgTask)
+	t.Task = &integrityTask
+	return &t
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/rancher/longhorn-manager/controller"
+)
+
+// DebugEndpoints enables the /debug endpoints exposing internal state
+var DebugEndpoints = false
+
+// DebugControllers lists the controllers cached by the volume manager with
+// their URLs, to spot the ones left stale by a controller restart
+func (s *Server) DebugControllers(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(controller.Tracked()); err != nil {
+		logrus.Warnf("fail to write tracked controllers: %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/rancher/go-rancher/api"
+)
+
+// ListEvents lists the latest events of the manager, pass the ID of the last
+// event seen in sinceEventID to get the newer ones only
+func (s *Server) ListEvents(rw http.ResponseWriter, req *http.Request) error {
+	apiContext := api.GetApiContext(req)
+
+	var since int64
+	if v := req.URL.Query().Get("sinceEventID"); v != "" {
+		var err error
+		if since, err = strconv.ParseInt(v, 10, 64); err != nil || since < 0 {
+			return errors.Errorf("invalid sinceEventID '%s'", v)
+		}
+	}
+	events, err := s.man.ListEvents(since)
+	if err != nil {
+		return errors.Wrap(err, "fail to list events")
+	}
+	apiContext.Write(toEventCollection(events))
+	return nil
+}
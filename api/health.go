@@ -0,0 +1,29 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func (s *Server) Healthz(rw http.ResponseWriter, req *http.Request) {
+	rw.WriteHeader(http.StatusOK)
+	fmt.Fprintln(rw, "ok")
+}
+
+func (s *Server) Readyz(rw http.ResponseWriter, req *http.Request) {
+	// followers don't start the volume manager, but serve reads
+	isFollower := s.leader != nil && !s.leader.IsLeader()
+	if !isFollower && !s.man.Started() {
+		http.Error(rw, "volume manager not started", http.StatusServiceUnavailable)
+		return
+	}
+	if _, err := s.man.Settings().GetSettings(); err != nil {
+		logrus.Warnf("readiness check failed: unable to get settings: %v", err)
+		http.Error(rw, "unable to get settings", http.StatusServiceUnavailable)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	fmt.Fprintln(rw, "ok")
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
@@ -15,7 +16,22 @@ func (s *Server) ListHost(rw http.ResponseWriter, req *http.Request) error {
 	if err != nil {
 		return errors.Wrap(err, "fail to list host")
 	}
-	apiContext.Write(toHostCollection(hosts))
+	resp := toHostCollection(hosts)
+	if err := paginate(resp, req); err != nil {
+		return err
+	}
+	apiContext.Write(resp)
+	return nil
+}
+
+func (s *Server) GetTopology(rw http.ResponseWriter, req *http.Request) error {
+	apiContext := api.GetApiContext(req)
+
+	topology, err := s.man.GetStorageTopology()
+	if err != nil {
+		return errors.Wrap(err, "fail to get storage topology")
+	}
+	apiContext.Write(toTopologyResource(topology))
 	return nil
 }
 
@@ -30,3 +46,22 @@ func (s *Server) GetHost(rw http.ResponseWriter, req *http.Request) error {
 	apiContext.Write(toHostResource(host))
 	return nil
 }
+
+// EvictHost reattaches the volumes attached to the host to the current host
+func (s *Server) EvictHost(rw http.ResponseWriter, req *http.Request) error {
+	var input EvictInput
+
+	apiContext := api.GetApiContext(req)
+	if err := apiContext.Read(&input); err != nil {
+		return errors.Wrapf(err, "error read evictInput")
+	}
+	if input.TimeoutSeconds < 0 {
+		return errors.Errorf("invalid timeoutSeconds %v", input.TimeoutSeconds)
+	}
+	id := mux.Vars(req)["id"]
+
+	if err := s.man.Evict(id, time.Duration(input.TimeoutSeconds)*time.Second); err != nil {
+		return errors.Wrapf(err, "unable to evict host %v", id)
+	}
+	return s.GetHost(rw, req)
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httputil"
+	"sort"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
@@ -23,6 +25,14 @@ func HostIDFromAttachReq(req *http.Request) (string, error) {
 	return attachInput.HostID, nil
 }
 
+func HostIDFromMigrateReq(req *http.Request) (string, error) {
+	migrateInput := MigrateInput{}
+	if err := json.NewDecoder(req.Body).Decode(&migrateInput); err != nil {
+		return "", errors.Wrap(err, "error parsing request body")
+	}
+	return migrateInput.HostID, nil
+}
+
 func HostIDFromVolume(man types.VolumeManager) func(req *http.Request) (string, error) {
 	return func(req *http.Request) (string, error) {
 		name := mux.Vars(req)["name"]
@@ -37,6 +47,32 @@ func HostIDFromVolume(man types.VolumeManager) func(req *http.Request) (string,
 	}
 }
 
+// HostIDForEvict sends the eviction of the current host to another host, as
+// the evicted volumes get attached to the host handling it
+func HostIDForEvict(man types.VolumeManager, sl types.ServiceLocator) func(req *http.Request) (string, error) {
+	return func(req *http.Request) (string, error) {
+		id := mux.Vars(req)["id"]
+		if id != sl.GetCurrentHostID() {
+			return "", nil
+		}
+		hosts, err := man.ListHosts()
+		if err != nil {
+			return "", errors.Wrap(err, "error listing hosts")
+		}
+		others := []string{}
+		for hostID := range hosts {
+			if hostID != id {
+				others = append(others, hostID)
+			}
+		}
+		if len(others) == 0 {
+			return "", errors.Errorf("no other host to evict host %v to", id)
+		}
+		sort.Strings(others)
+		return others[0], nil
+	}
+}
+
 type Fwd struct {
 	sl    types.ServiceLocator
 	proxy http.Handler
@@ -56,7 +92,9 @@ func (f *Fwd) Handler(getHostID HostIDFunc, h HandleFuncWithError) HandleFuncWit
 			if targetHost != req.Host {
 				req.Host = targetHost
 				req.URL.Host = targetHost
-				req.URL.Scheme = "http"
+				req.URL.Scheme = util.PeerScheme
+				// requests on the unix socket carry no credentials
+				util.SetPeerAuth(req)
 				logrus.Debugf("Forwarding request to %v", targetHost)
 				f.proxy.ServeHTTP(w, req)
 				return nil
@@ -66,6 +104,14 @@ func (f *Fwd) Handler(getHostID HostIDFunc, h HandleFuncWithError) HandleFuncWit
 	}
 }
 
+// ProxyFlushInterval is how often the proxy flushes responses forwarded from
+// the other managers, so the event streams of watch come through
+var ProxyFlushInterval = 100 * time.Millisecond
+
 func Proxy() http.Handler {
-	return &httputil.ReverseProxy{Director: func(r *http.Request) {}}
+	return &httputil.ReverseProxy{
+		Director:      func(r *http.Request) {},
+		Transport:     util.PeerTransport,
+		FlushInterval: ProxyFlushInterval,
+	}
 }
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/longhorn-manager/util"
+)
+
+type peerServiceLocator struct {
+	address string
+}
+
+func (sl *peerServiceLocator) GetCurrentHostID() string {
+	return "host-1"
+}
+
+func (sl *peerServiceLocator) GetAddress(hostID string) (string, error) {
+	return sl.address, nil
+}
+
+func TestFwdTLS(t *testing.T) {
+	assert := require.New(t)
+
+	var user string
+	peer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user, _, _ = req.BasicAuth()
+		w.Write([]byte("forwarded"))
+	}))
+	defer peer.Close()
+
+	cert, err := x509.ParseCertificate(peer.TLS.Certificates[0].Certificate[0])
+	assert.Nil(err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	util.PeerScheme = "https"
+	util.PeerTransport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	util.PeerUser, util.PeerPassword = "admin", "secret"
+	defer func() {
+		util.PeerScheme, util.PeerTransport = "http", http.DefaultTransport
+		util.PeerUser, util.PeerPassword = "", ""
+	}()
+
+	fwd := &Fwd{&peerServiceLocator{strings.TrimPrefix(peer.URL, "https://")}, Proxy()}
+	h := fwd.Handler(func(req *http.Request) (string, error) {
+		return "host-2", nil
+	}, func(w http.ResponseWriter, req *http.Request) error {
+		w.Write([]byte("local"))
+		return nil
+	})
+	w := httptest.NewRecorder()
+	assert.Nil(h(w, httptest.NewRequest("GET", "/v1/volumes/vol1", nil)))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("forwarded", w.Body.String())
+	assert.Equal("admin", user)
+}
+
+func TestFwdStream(t *testing.T) {
+	assert := require.New(t)
+
+	assert.True(Proxy().(*httputil.ReverseProxy).FlushInterval > 0)
+
+	read := make(chan struct{})
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: volume\ndata: {}\n\n"))
+		w.(http.Flusher).Flush()
+		// the stream stays open until the client got the event
+		select {
+		case <-read:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer peer.Close()
+
+	fwd := &Fwd{&peerServiceLocator{strings.TrimPrefix(peer.URL, "http://")}, Proxy()}
+	h := fwd.Handler(func(req *http.Request) (string, error) {
+		return "host-2", nil
+	}, func(w http.ResponseWriter, req *http.Request) error {
+		return nil
+	})
+	front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h(w, req)
+	}))
+	defer front.Close()
+
+	resp, err := http.Get(front.URL + "/v1/volumes/vol1/watch")
+	assert.Nil(err)
+	defer resp.Body.Close()
+	line := make(chan string)
+	go func() {
+		l, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		line <- l
+	}()
+	select {
+	case l := <-line:
+		assert.Equal("event: volume\n", l)
+	case <-time.After(2 * time.Second):
+		assert.Fail("forwarded event not streamed")
+	}
+	close(read)
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/rancher/go-rancher/api"
+	"github.com/rancher/go-rancher/client"
+
+	"github.com/rancher/longhorn-manager/controller"
+)
+
+// Version and Orchestrator describe the manager at GET /v1/info
+var (
+	Version      = ""
+	Orchestrator = ""
+)
+
+type Info struct {
+	client.Resource
+	Version      string `json:"version"`
+	HostID       string `json:"hostId"`
+	Orchestrator string `json:"orchestrator"`
+	APIVersion   string `json:"apiVersion"`
+
+	BackupsRunning int `json:"backupsRunning"`
+	BackupsQueued  int `json:"backupsQueued"` // waiting for --backup-concurrent-limit
+}
+
+func (s *Server) Info(w http.ResponseWriter, req *http.Request) error {
+	apiContext := api.GetApiContext(req)
+	hostID := s.sl.GetCurrentHostID()
+	backupsRunning, backupsQueued := controller.BackupStats()
+	apiContext.Write(&Info{
+		Resource: client.Resource{
+			Id:   hostID,
+			Type: "info",
+		},
+		Version:      Version,
+		HostID:       hostID,
+		Orchestrator: Orchestrator,
+		APIVersion:   "v1",
+
+		BackupsRunning: backupsRunning,
+		BackupsQueued:  backupsQueued,
+	})
+	return nil
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeServiceLocator struct{}
+
+func (sl *fakeServiceLocator) GetCurrentHostID() string {
+	return "host-1"
+}
+
+func (sl *fakeServiceLocator) GetAddress(hostID string) (string, error) {
+	return "10.0.0.1:9500", nil
+}
+
+func TestInfo(t *testing.T) {
+	assert := require.New(t)
+
+	Version, Orchestrator = "0.1.0", "docker"
+	defer func() { Version, Orchestrator = "", "" }()
+
+	s := &Server{sl: &fakeServiceLocator{}}
+	w := httptest.NewRecorder()
+	HandleError(NewSchema(), s.Info).ServeHTTP(w, httptest.NewRequest("GET", "/v1/info", nil))
+	assert.Equal(200, w.Code)
+
+	info := Info{}
+	assert.Nil(json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal("info", info.Type)
+	assert.Equal("0.1.0", info.Version)
+	assert.Equal("host-1", info.HostID)
+	assert.Equal("docker", info.Orchestrator)
+	assert.Equal("v1", info.APIVersion)
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type labelRequirement struct {
+	key   string
+	value string
+	op    string // "=", "!=", "exists" or "!exists"
+}
+
+// labelSelector is a comma separated list of requirements all labels should
+// meet: key=value, key==value, key!=value, key (exists) or !key (doesn't exist)
+type labelSelector []labelRequirement
+
+func parseLabelSelector(s string) (labelSelector, error) {
+	selector := labelSelector{}
+	if strings.TrimSpace(s) == "" {
+		return selector, nil
+	}
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		var r labelRequirement
+		switch {
+		case strings.Contains(term, "!="):
+			parts := strings.SplitN(term, "!=", 2)
+			r = labelRequirement{key: parts[0], value: parts[1], op: "!="}
+		case strings.Contains(term, "=="):
+			parts := strings.SplitN(term, "==", 2)
+			r = labelRequirement{key: parts[0], value: parts[1], op: "="}
+		case strings.Contains(term, "="):
+			parts := strings.SplitN(term, "=", 2)
+			r = labelRequirement{key: parts[0], value: parts[1], op: "="}
+		case strings.HasPrefix(term, "!"):
+			r = labelRequirement{key: strings.TrimPrefix(term, "!"), op: "!exists"}
+		default:
+			r = labelRequirement{key: term, op: "exists"}
+		}
+		r.key, r.value = strings.TrimSpace(r.key), strings.TrimSpace(r.value)
+		if r.key == "" || strings.ContainsAny(r.key+r.value, "=!") {
+			return nil, errors.Errorf("invalid label selector '%s'", s)
+		}
+		selector = append(selector, r)
+	}
+	return selector, nil
+}
+
+// labelSelectorFor selects the labels having all of the values of labels
+func labelSelectorFor(labels map[string]string) labelSelector {
+	selector := labelSelector{}
+	for key, value := range labels {
+		selector = append(selector, labelRequirement{key: key, value: value, op: "="})
+	}
+	return selector
+}
+
+func (selector labelSelector) Matches(labels map[string]string) bool {
+	for _, r := range selector {
+		value, ok := labels[r.key]
+		switch r.op {
+		case "=":
+			if !ok || value != r.value {
+				return false
+			}
+		case "!=":
+			if ok && value == r.value {
+				return false
+			}
+		case "exists":
+			if !ok {
+				return false
+			}
+		case "!exists":
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabelSelector(t *testing.T) {
+	assert := require.New(t)
+
+	labels := map[string]string{"app": "db", "tier": "backend"}
+
+	for s, matches := range map[string]bool{
+		"":                     true,
+		"app=db":               true,
+		"app==db":              true,
+		"app=web":              false,
+		"app!=web":             true,
+		"app!=db":              false,
+		"owner!=alice":         true,
+		"tier":                 true,
+		"owner":                false,
+		"!owner":               true,
+		"!tier":                false,
+		"app=db, tier=backend": true,
+		"app=db,tier=frontend": false,
+	} {
+		selector, err := parseLabelSelector(s)
+		assert.Nil(err, s)
+		assert.Equal(matches, selector.Matches(labels), s)
+	}
+	selector, err := parseLabelSelector("app=db")
+	assert.Nil(err)
+	assert.False(selector.Matches(nil))
+
+	for _, s := range []string{"=db", "app=d=b", "app,,tier", "!"} {
+		_, err := parseLabelSelector(s)
+		assert.NotNil(err, s)
+	}
+}
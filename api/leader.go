@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/rancher/longhorn-manager/util"
+)
+
+const (
+	leaderForwardedHeader = "X-Longhorn-Leader-Forwarded"
+)
+
+// LeaderLocator is set when leader election is enabled, followers serve read
+// requests and forward the rest to the leader
+type LeaderLocator interface {
+	IsLeader() bool
+	Leader() string // <host>:<port> of the leader, empty if unknown
+}
+
+func (s *Server) SetLeaderLocator(l LeaderLocator) {
+	s.leader = l
+}
+
+func isReadOnly(req *http.Request) bool {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return true
+	}
+	return false
+}
+
+// leaderHandler forwards the writes to the leader, unless this is the leader
+func leaderHandler(l LeaderLocator, proxy http.Handler, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if isReadOnly(req) || l.IsLeader() {
+			h.ServeHTTP(w, req)
+			return
+		}
+		leader := l.Leader()
+		if leader == "" || req.Header.Get(leaderForwardedHeader) != "" {
+			http.Error(w, "no leader elected, retry later", http.StatusServiceUnavailable)
+			return
+		}
+		req.Header.Set(leaderForwardedHeader, "true")
+		req.Host = leader
+		req.URL.Host = leader
+		req.URL.Scheme = util.PeerScheme
+		// requests on the unix socket carry no credentials
+		util.SetPeerAuth(req)
+		logrus.Debugf("Forwarding request to leader %v", leader)
+		proxy.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/longhorn-manager/util"
+)
+
+type fakeLeader struct {
+	isLeader bool
+	leader   string
+}
+
+func (l *fakeLeader) IsLeader() bool {
+	return l.isLeader
+}
+
+func (l *fakeLeader) Leader() string {
+	return l.leader
+}
+
+func TestLeaderHandler(t *testing.T) {
+	assert := require.New(t)
+
+	var handled, forwardedTo string
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		handled = req.Method
+	})
+	proxy := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		forwardedTo = req.URL.Host
+	})
+	l := &fakeLeader{leader: "10.0.0.2:9500"}
+	lh := leaderHandler(l, proxy, h)
+
+	lh.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/volumes", nil))
+	assert.Equal("GET", handled)
+	assert.Equal("", forwardedTo)
+
+	handled = ""
+	lh.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/volumes", nil))
+	assert.Equal("", handled)
+	assert.Equal("10.0.0.2:9500", forwardedTo)
+
+	// don't forward again if the leader changed in between
+	forwardedTo = ""
+	req := httptest.NewRequest("POST", "/v1/volumes", nil)
+	req.Header.Set(leaderForwardedHeader, "true")
+	w := httptest.NewRecorder()
+	lh.ServeHTTP(w, req)
+	assert.Equal(http.StatusServiceUnavailable, w.Code)
+	assert.Equal("", forwardedTo)
+
+	l.isLeader = true
+	lh.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/volumes", nil))
+	assert.Equal("POST", handled)
+	assert.Equal("", forwardedTo)
+}
+
+func TestLeaderHandlerPeer(t *testing.T) {
+	assert := require.New(t)
+
+	util.PeerScheme = "https"
+	util.PeerUser, util.PeerPassword = "admin", "secret"
+	defer func() {
+		util.PeerScheme = "http"
+		util.PeerUser, util.PeerPassword = "", ""
+	}()
+
+	var scheme, user string
+	proxy := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		scheme = req.URL.Scheme
+		user, _, _ = req.BasicAuth()
+	})
+	lh := leaderHandler(&fakeLeader{leader: "10.0.0.2:9500"}, proxy, http.NotFoundHandler())
+
+	lh.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/volumes", nil))
+	assert.Equal("https", scheme)
+	assert.Equal("admin", user)
+}
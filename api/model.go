@@ -6,7 +6,9 @@ import (
 	"github.com/rancher/go-rancher/api"
 	"github.com/rancher/go-rancher/client"
 	"github.com/rancher/longhorn-manager/types"
+	"github.com/rancher/longhorn-manager/util"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 )
@@ -14,23 +16,51 @@ import (
 type Volume struct {
 	client.Resource
 
-	Name                string `json:"name,omitempty"`
-	Size                string `json:"size,omitempty"`
-	BaseImage           string `json:"baseImage,omitempty"`
-	FromBackup          string `json:"fromBackup,omitempty"`
-	NumberOfReplicas    int    `json:"numberOfReplicas,omitempty"`
-	StaleReplicaTimeout int    `json:"staleReplicaTimeout,omitempty"`
-	State               string `json:"state,omitempty"`
-	EngineImage         string `json:"engineImage,omitempty"`
-	Endpoint            string `json:"endpoint,omitemtpy"`
-	Created             string `json:"created,omitemtpy"`
+	Name                string   `json:"name,omitempty"`
+	Size                string   `json:"size,omitempty"`
+	BaseImage           string   `json:"baseImage,omitempty"`
+	FromBackup          string   `json:"fromBackup,omitempty"`
+	FromSnapshot        string   `json:"fromSnapshot,omitempty"`
+	FromVolume          string   `json:"fromVolume,omitempty"`
+	SourcePVC           string   `json:"sourcePVC,omitempty"`
+	AccessMode          string   `json:"accessMode,omitempty"`
+	DataLocality        string   `json:"dataLocality,omitempty"`
+	FsType              string   `json:"fsType,omitempty"`
+	MountOptions        []string `json:"mountOptions,omitempty"`
+	NumberOfReplicas    int      `json:"numberOfReplicas,omitempty"`
+	StaleReplicaTimeout int      `json:"staleReplicaTimeout,omitempty"`
+	MaxSnapshots        int      `json:"maxSnapshots,omitempty"`
+	State               string   `json:"state,omitempty"`
+	EngineImage         string   `json:"engineImage,omitempty"`
+	Endpoint            string   `json:"endpoint,omitemtpy"`
+	Created             string   `json:"created,omitemtpy"`
 
 	RecurringJobs []*types.RecurringJob `json:"recurringJobs,omitempty"`
+	Labels        map[string]string     `json:"labels,omitempty"`
+
+	DryRun bool `json:"dryRun,omitempty"`
+
+	AutoScaleReplicas           bool  `json:"autoScaleReplicas,omitempty"`
+	AutoScaleReadIOPSThreshold  int64 `json:"autoScaleReadIOPSThreshold,omitempty"`
+	AutoScaleScaleDownThreshold int64 `json:"autoScaleScaleDownThreshold,omitempty"`
+	MaxAutoScaleReplicas        int   `json:"maxAutoScaleReplicas,omitempty"`
+
+	ReadIOPSMax       int64 `json:"readIOPSMax,omitempty"`
+	WriteIOPSMax      int64 `json:"writeIOPSMax,omitempty"`
+	ReadBandwidthMax  int64 `json:"readBandwidthMax,omitempty"`
+	WriteBandwidthMax int64 `json:"writeBandwidthMax,omitempty"`
 
 	Replicas   []Replica   `json:"replicas,omitempty"`
 	Controller *Controller `json:"controller,omitempty"`
 }
 
+type VolumeReplica struct {
+	client.Resource
+	Replica
+
+	VolumeName string `json:"volumeName,omitempty"`
+}
+
 type Snapshot struct {
 	client.Resource
 	types.SnapshotInfo
@@ -39,9 +69,56 @@ type Snapshot struct {
 type Host struct {
 	client.Resource
 
-	UUID    string `json:"uuid,omitempty"`
-	Name    string `json:"name,omitempty"`
-	Address string `json:"address,omitempty"`
+	UUID    string            `json:"uuid,omitempty"`
+	Name    string            `json:"name,omitempty"`
+	Address string            `json:"address,omitempty"`
+	Tags    map[string]string `json:"tags,omitempty"`
+
+	TotalStorage int64 `json:"totalStorage"`
+	UsedStorage  int64 `json:"usedStorage"`
+	ReplicaCount int   `json:"replicaCount"`
+}
+
+type Event struct {
+	client.Resource
+
+	Timestamp string `json:"timestamp"`
+	EventType string `json:"eventType"` // "type" is the resource type
+	Target    string `json:"resource"`  // e.g. volume/vol1
+	Message   string `json:"message"`
+}
+
+type Topology struct {
+	client.Resource
+	types.StorageTopology
+}
+
+type VolumeControllerInfo struct {
+	client.Resource
+	types.VolumeControllerInfo
+}
+
+type VolumeIOStats struct {
+	client.Resource
+	types.VolumeIOStats
+}
+
+type RebuildStatus struct {
+	client.Resource
+	types.RebuildStatus
+}
+
+type SnapshotSchedule struct {
+	client.Resource
+	Next []string `json:"next"`
+}
+
+type MonitorStatus struct {
+	client.Resource
+	Interval          string `json:"interval"`
+	LastCheckTime     string `json:"lastCheckTime"`
+	LastCheckError    string `json:"lastCheckError"`
+	ConsecutiveErrors int    `json:"consecutiveErrors"`
 }
 
 type BackupVolume struct {
@@ -76,12 +153,45 @@ type Replica struct {
 	Name         string `json:"name,omitempty"`
 	Mode         string `json:"mode,omitempty"`
 	BadTimestamp string `json:"badTimestamp,omitempty"`
+	PinnedHostID string `json:"pinnedHostId,omitempty"`
 }
 
 type AttachInput struct {
 	HostID string `json:"hostId,omitempty"`
 }
 
+type BackupRestoreInput struct {
+	BackupURL string `json:"backupUrl,omitempty"`
+}
+
+type SnapshotPurgeInput struct {
+	RetentionPeriod string `json:"retentionPeriod,omitempty"`
+}
+
+type PurgeResult struct {
+	client.Resource
+	types.PurgeResult
+}
+
+type SnapshotBulkDeleteInput struct {
+	OlderThan string            `json:"olderThan,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+type BulkDeleteResult struct {
+	client.Resource
+	Deleted []string `json:"deleted"`
+	Failed  []string `json:"failed"`
+}
+
+type MigrateInput struct {
+	HostID string `json:"hostId,omitempty"`
+}
+
+type EvictInput struct {
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+}
+
 type Empty struct {
 	client.Resource
 }
@@ -91,16 +201,64 @@ type BgTask struct {
 	types.BgTask
 }
 
+type SnapshotDiffInput struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type SnapshotDiff struct {
+	client.Resource
+	types.SnapshotDiff
+}
+
 type SnapshotInput struct {
 	Name string `json:"name,omitempty"`
 
 	Labels map[string]string `json:"labels,omitempty"`
+
+	// Quiesce freezes I/O of the volume while taking the snapshot
+	Quiesce bool `json:"quiesce,omitempty"`
+}
+
+type SnapshotGroupInput struct {
+	Volumes []string          `json:"volumes"`
+	Name    string            `json:"name,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+type ConsistencyGroupSnapshot struct {
+	client.Resource
+	Name    string   `json:"name"`
+	Volumes []string `json:"volumes"`
+}
+
+type BulkCreateInput struct {
+	Volumes []*Volume `json:"volumes"`
+}
+
+type BulkCreateError struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+type BulkCreateResult struct {
+	client.Resource
+	Created []*Volume         `json:"created"`
+	Failed  []BulkCreateError `json:"failed"`
 }
 
 type BackupInput struct {
 	Name string `json:"name,omitempty"`
 }
 
+type BackupCancelInput struct {
+	BackupURL string `json:"backupUrl"`
+}
+
+type BgTaskCancelInput struct {
+	Num int64 `json:"num"`
+}
+
 type RecurringInput struct {
 	Jobs []types.RecurringJob `json:"jobs,omitempty"`
 }
@@ -109,6 +267,42 @@ type ReplicaRemoveInput struct {
 	Name string `json:"name"`
 }
 
+type ReplicaModeInput struct {
+	Name string `json:"name"`
+	Mode string `json:"mode"`
+}
+
+type LabelsInput struct {
+	Labels map[string]string `json:"labels"`
+}
+
+type ReplicaAddInput struct {
+	HostID string `json:"hostId"`
+}
+
+type ControllerCreateInput struct {
+	Replicas []string `json:"replicas"`
+}
+
+type ReplicaPinInput struct {
+	Name   string `json:"name"`
+	HostID string `json:"hostId"`
+}
+
+type AutoScaleInput struct {
+	Enabled            bool  `json:"enabled"`
+	ReadIOPSThreshold  int64 `json:"readIOPSThreshold"`
+	ScaleDownThreshold int64 `json:"scaleDownThreshold"`
+	MaxReplicas        int   `json:"maxReplicas"`
+}
+
+type QoSInput struct {
+	ReadIOPSMax       int64 `json:"readIOPSMax"`
+	WriteIOPSMax      int64 `json:"writeIOPSMax"`
+	ReadBandwidthMax  int64 `json:"readBandwidthMax"`
+	WriteBandwidthMax int64 `json:"writeBandwidthMax"`
+}
+
 func NewSchema() *client.Schemas {
 	schemas := &client.Schemas{}
 
@@ -117,14 +311,52 @@ func NewSchema() *client.Schemas {
 	schemas.AddType("error", client.ServerApiError{})
 	schemas.AddType("snapshot", Snapshot{})
 	schemas.AddType("attachInput", AttachInput{})
+	schemas.AddType("migrateInput", MigrateInput{})
+	schemas.AddType("evictInput", EvictInput{})
+	schemas.AddType("backupRestoreInput", BackupRestoreInput{})
 	schemas.AddType("snapshotInput", SnapshotInput{})
+	schemas.AddType("snapshotDiffInput", SnapshotDiffInput{})
+	schemas.AddType("blockRange", types.BlockRange{})
+	snapshotDiffSchema(schemas.AddType("snapshotDiff", SnapshotDiff{}))
+	schemas.AddType("snapshotPurgeInput", SnapshotPurgeInput{})
+	schemas.AddType("purgeResult", PurgeResult{})
+	schemas.AddType("snapshotBulkDeleteInput", SnapshotBulkDeleteInput{})
+	schemas.AddType("bulkDeleteResult", BulkDeleteResult{})
+	schemas.AddType("info", Info{})
+	schemas.AddType("snapshotGroupInput", SnapshotGroupInput{})
+	schemas.AddType("consistencyGroupSnapshot", ConsistencyGroupSnapshot{})
+	schemas.AddType("bulkCreateInput", BulkCreateInput{})
+	schemas.AddType("bulkCreateError", BulkCreateError{})
+	schemas.AddType("bulkCreateResult", BulkCreateResult{})
 	schemas.AddType("backup", Backup{})
 	schemas.AddType("backupInput", BackupInput{})
-	schemas.AddType("recurringJob", types.RecurringJob{})
+	schemas.AddType("backupCancelInput", BackupCancelInput{})
+	schemas.AddType("bgTaskCancelInput", BgTaskCancelInput{})
+	recurringJobSchema(schemas.AddType("recurringJob", types.RecurringJob{}))
 	schemas.AddType("bgTask", BgTask{})
 	schemas.AddType("replicaRemoveInput", ReplicaRemoveInput{})
+	schemas.AddType("replicaAddInput", ReplicaAddInput{})
+	schemas.AddType("replicaPinInput", ReplicaPinInput{})
+	schemas.AddType("replicaModeInput", ReplicaModeInput{})
+	schemas.AddType("labelsInput", LabelsInput{})
+	schemas.AddType("controllerCreateInput", ControllerCreateInput{})
+	schemas.AddType("autoScaleInput", AutoScaleInput{})
+	schemas.AddType("qosInput", QoSInput{})
+	schemas.AddType("volumeControllerInfo", VolumeControllerInfo{})
+	schemas.AddType("volumeIOStats", VolumeIOStats{})
+	schemas.AddType("rebuildStatus", RebuildStatus{})
+	schemas.AddType("volumeReplica", VolumeReplica{})
+	snapshotScheduleSchema(schemas.AddType("snapshotSchedule", SnapshotSchedule{}))
+	monitorStatusSchema(schemas.AddType("monitorStatus", MonitorStatus{}))
+
+	schemas.AddType("hostNode", types.HostNode{})
+	schemas.AddType("replicaNode", types.ReplicaNode{})
+	schemas.AddType("topologyEdge", types.TopologyEdge{})
+	volumeNodeSchema(schemas.AddType("volumeNode", types.VolumeNode{}))
+	topologySchema(schemas.AddType("topology", Topology{}))
 
 	hostSchema(schemas.AddType("host", Host{}))
+	eventSchema(schemas.AddType("event", Event{}))
 	volumeSchema(schemas.AddType("volume", Volume{}))
 	backupVolumeSchema(schemas.AddType("backupVolume", BackupVolume{}))
 	settingSchema(schemas.AddType("setting", Setting{}))
@@ -133,12 +365,74 @@ func NewSchema() *client.Schemas {
 	return schemas
 }
 
+func volumeNodeSchema(volumeNode *client.Schema) {
+	replicas := volumeNode.ResourceFields["replicas"]
+	replicas.Type = "array[replicaNode]"
+	volumeNode.ResourceFields["replicas"] = replicas
+}
+
+func snapshotScheduleSchema(schedule *client.Schema) {
+	schedule.CollectionMethods = []string{}
+
+	next := schedule.ResourceFields["next"]
+	next.Type = "array[string]"
+	schedule.ResourceFields["next"] = next
+}
+
+func monitorStatusSchema(status *client.Schema) {
+	status.CollectionMethods = []string{}
+}
+
+func snapshotDiffSchema(diff *client.Schema) {
+	diff.CollectionMethods = []string{}
+
+	blocks := diff.ResourceFields["changedBlocks"]
+	blocks.Type = "array[blockRange]"
+	diff.ResourceFields["changedBlocks"] = blocks
+}
+
+func topologySchema(topology *client.Schema) {
+	topology.CollectionMethods = []string{}
+
+	hosts := topology.ResourceFields["hosts"]
+	hosts.Type = "array[hostNode]"
+	topology.ResourceFields["hosts"] = hosts
+
+	volumes := topology.ResourceFields["volumes"]
+	volumes.Type = "array[volumeNode]"
+	topology.ResourceFields["volumes"] = volumes
+
+	edges := topology.ResourceFields["edges"]
+	edges.Type = "array[topologyEdge]"
+	topology.ResourceFields["edges"] = edges
+}
+
 func recurringSchema(recurring *client.Schema) {
 	jobs := recurring.ResourceFields["jobs"]
 	jobs.Type = "array[recurringJob]"
 	recurring.ResourceFields["jobs"] = jobs
 }
 
+func recurringJobSchema(job *client.Schema) {
+	for _, name := range []string{"name", "cron"} {
+		field := job.ResourceFields[name]
+		field.Required = true
+		job.ResourceFields[name] = field
+	}
+
+	task := job.ResourceFields["task"]
+	task.Required = true
+	task.Type = "enum"
+	task.Options = []string{types.SnapshotTaskName, types.BackupTaskName}
+	job.ResourceFields["task"] = task
+
+	minRetain := int64(1)
+	retain := job.ResourceFields["retain"]
+	retain.Required = true
+	retain.Min = &minRetain
+	job.ResourceFields["retain"] = retain
+}
+
 func settingSchema(setting *client.Schema) {
 	setting.CollectionMethods = []string{"GET"}
 	setting.ResourceMethods = []string{"GET", "PUT"}
@@ -159,9 +453,20 @@ func hostSchema(host *client.Schema) {
 	host.ResourceMethods = []string{"GET"}
 }
 
+func eventSchema(event *client.Schema) {
+	event.CollectionMethods = []string{"GET"}
+	event.ResourceMethods = []string{}
+}
+
 func volumeSchema(volume *client.Schema) {
 	volume.CollectionMethods = []string{"GET", "POST"}
 	volume.ResourceMethods = []string{"GET", "DELETE"}
+	volume.CollectionActions = map[string]client.Action{
+		"snapshotGroupCreate": {
+			Input:  "snapshotGroupInput",
+			Output: "consistencyGroupSnapshot",
+		},
+	}
 	volume.ResourceActions = map[string]client.Action{
 		"attach": {
 			Input:  "attachInput",
@@ -170,7 +475,14 @@ func volumeSchema(volume *client.Schema) {
 		"detach": {
 			Output: "volume",
 		},
-		"snapshotPurge": {},
+		"snapshotPurge": {
+			Input:  "snapshotPurgeInput",
+			Output: "purgeResult",
+		},
+		"snapshotBulkDelete": {
+			Input:  "snapshotBulkDeleteInput",
+			Output: "bulkDeleteResult",
+		},
 
 		"snapshotCreate": {
 			Input:  "snapshotInput",
@@ -180,6 +492,10 @@ func volumeSchema(volume *client.Schema) {
 			Input:  "snapshotInput",
 			Output: "snapshot",
 		},
+		"snapshotDiff": {
+			Input:  "snapshotDiffInput",
+			Output: "snapshotDiff",
+		},
 		"snapshotList": {},
 		"snapshotDelete": {
 			Input:  "snapshotInput",
@@ -190,16 +506,71 @@ func volumeSchema(volume *client.Schema) {
 			Output: "snapshot",
 		},
 		"snapshotBackup": {
-			Input: "snapshotInput",
+			Input:  "snapshotInput",
+			Output: "bgTask",
+		},
+		"backupCancel": {
+			Input:  "backupCancelInput",
+			Output: "volume",
 		},
 		"recurringUpdate": {
 			Input: "recurringInput",
 		},
 		"bgTaskQueue": {},
+		"bgTaskCancel": {
+			Input: "bgTaskCancelInput",
+		},
+		"migrate": {
+			Input:  "migrateInput",
+			Output: "volume",
+		},
+		"backupRestore": {
+			Input:  "backupRestoreInput",
+			Output: "volume",
+		},
+		"volumeInfo": {
+			Output: "volumeControllerInfo",
+		},
+		"volumeIOStats": {
+			Output: "volumeIOStats",
+		},
+		"replicaRebuildStatus": {},
+		"export":               {},
 		"replicaRemove": {
 			Input:  "replicaRemoveInput",
 			Output: "volume",
 		},
+		"replicaAdd": {
+			Input:  "replicaAddInput",
+			Output: "volume",
+		},
+		"controllerCreate": {
+			Input:  "controllerCreateInput",
+			Output: "volume",
+		},
+		"replicaPin": {
+			Input:  "replicaPinInput",
+			Output: "volume",
+		},
+		"replicaModeUpdate": {
+			Input:  "replicaModeInput",
+			Output: "volume",
+		},
+		"labelUpdate": {
+			Input:  "labelsInput",
+			Output: "volume",
+		},
+		"emergencySnapshot": {
+			Output: "snapshot",
+		},
+		"autoScaleUpdate": {
+			Input:  "autoScaleInput",
+			Output: "volume",
+		},
+		"qosUpdate": {
+			Input:  "qosInput",
+			Output: "volume",
+		},
 	}
 	volume.ResourceFields["controller"] = client.Field{
 		Type:     "struct",
@@ -221,6 +592,40 @@ func volumeSchema(volume *client.Schema) {
 	volumeFromBackup.Create = true
 	volume.ResourceFields["fromBackup"] = volumeFromBackup
 
+	volumeFromSnapshot := volume.ResourceFields["fromSnapshot"]
+	volumeFromSnapshot.Create = true
+	volume.ResourceFields["fromSnapshot"] = volumeFromSnapshot
+
+	volumeFromVolume := volume.ResourceFields["fromVolume"]
+	volumeFromVolume.Create = true
+	volume.ResourceFields["fromVolume"] = volumeFromVolume
+
+	volumeSourcePVC := volume.ResourceFields["sourcePVC"]
+	volumeSourcePVC.Create = true
+	volume.ResourceFields["sourcePVC"] = volumeSourcePVC
+
+	volumeAccessMode := volume.ResourceFields["accessMode"]
+	volumeAccessMode.Create = true
+	volumeAccessMode.Type = "enum"
+	volumeAccessMode.Options = []string{string(types.AccessModeReadWriteOnce), string(types.AccessModeReadWriteMany)}
+	volumeAccessMode.Default = string(types.AccessModeReadWriteOnce)
+	volume.ResourceFields["accessMode"] = volumeAccessMode
+
+	volumeDataLocality := volume.ResourceFields["dataLocality"]
+	volumeDataLocality.Create = true
+	volumeDataLocality.Type = "enum"
+	volumeDataLocality.Options = []string{string(types.DataLocalityDisabled), string(types.DataLocalityBestEffort)}
+	volumeDataLocality.Default = string(types.DataLocalityDisabled)
+	volume.ResourceFields["dataLocality"] = volumeDataLocality
+
+	volumeFsType := volume.ResourceFields["fsType"]
+	volumeFsType.Create = true
+	volume.ResourceFields["fsType"] = volumeFsType
+
+	volumeMountOptions := volume.ResourceFields["mountOptions"]
+	volumeMountOptions.Create = true
+	volume.ResourceFields["mountOptions"] = volumeMountOptions
+
 	volumeNumberOfReplicas := volume.ResourceFields["numberOfReplicas"]
 	volumeNumberOfReplicas.Create = true
 	volumeNumberOfReplicas.Required = true
@@ -231,6 +636,21 @@ func volumeSchema(volume *client.Schema) {
 	volumeStaleReplicaTimeout.Create = true
 	volumeStaleReplicaTimeout.Default = 20
 	volume.ResourceFields["staleReplicaTimeout"] = volumeStaleReplicaTimeout
+
+	volumeMaxSnapshots := volume.ResourceFields["maxSnapshots"]
+	volumeMaxSnapshots.Create = true
+	volume.ResourceFields["maxSnapshots"] = volumeMaxSnapshots
+
+	for _, name := range []string{"readIOPSMax", "writeIOPSMax", "readBandwidthMax", "writeBandwidthMax"} {
+		volumeQoS := volume.ResourceFields[name]
+		volumeQoS.Create = true
+		volume.ResourceFields[name] = volumeQoS
+	}
+
+	volumeLabels := volume.ResourceFields["labels"]
+	volumeLabels.Create = true
+	volumeLabels.Update = true
+	volume.ResourceFields["labels"] = volumeLabels
 }
 
 func backupVolumeSchema(backupVolume *client.Schema) {
@@ -246,6 +666,13 @@ func backupVolumeSchema(backupVolume *client.Schema) {
 			Input:  "backupInput",
 			Output: "backupVolume",
 		},
+		"verifyIntegrity": {
+			Output: "bgTask",
+		},
+		"integrityReport": {
+			Output: "bgTask",
+		},
+		"backupVolumeDelete": {},
 	}
 }
 
@@ -263,28 +690,57 @@ func toSettingResource(name, value string) *Setting {
 func toSettingCollection(settings *types.SettingsInfo) *client.GenericCollection {
 	data := []interface{}{
 		toSettingResource("backupTarget", settings.BackupTarget),
+		toSettingResource("backupS3Endpoint", settings.BackupS3Endpoint),
 		toSettingResource("engineImage", settings.EngineImage),
+		toSettingResource("replicaAntiAffinity", settings.ReplicaAntiAffinity),
+		toSettingResource("syslogTarget", settings.SyslogTarget),
+		toSettingResource("faultedVolumeAutoRecovery", strconv.FormatBool(settings.FaultedVolumeAutoRecovery)),
 	}
 	return &client.GenericCollection{Data: data, Collection: client.Collection{ResourceType: "setting"}}
 }
 
+func toReplica(r *types.ReplicaInfo) Replica {
+	mode := ""
+	if r.Running {
+		mode = string(r.Mode)
+	}
+	return Replica{
+		Instance: Instance{
+			Running: r.Running,
+			Address: r.Address,
+			HostID:  r.HostID,
+		},
+		Name:         r.Name,
+		Mode:         mode,
+		BadTimestamp: r.BadTimestamp,
+		PinnedHostID: r.PinnedHostID,
+	}
+}
+
+func toVolumeReplicaResource(volumeName string, r *types.ReplicaInfo) *VolumeReplica {
+	return &VolumeReplica{
+		Resource: client.Resource{
+			Id:      r.Name,
+			Type:    "volumeReplica",
+			Actions: map[string]string{},
+		},
+		Replica:    toReplica(r),
+		VolumeName: volumeName,
+	}
+}
+
+func toVolumeReplicaCollection(volumeName string, replicas []*types.ReplicaInfo) *client.GenericCollection {
+	data := []interface{}{}
+	for _, r := range replicas {
+		data = append(data, toVolumeReplicaResource(volumeName, r))
+	}
+	return &client.GenericCollection{Data: data, Collection: client.Collection{ResourceType: "volumeReplica"}}
+}
+
 func toVolumeResource(v *types.VolumeInfo, apiContext *api.ApiContext) *Volume {
 	replicas := []Replica{}
 	for _, r := range v.Replicas {
-		mode := ""
-		if r.Running {
-			mode = string(r.Mode)
-		}
-		replicas = append(replicas, Replica{
-			Instance: Instance{
-				Running: r.Running,
-				Address: r.Address,
-				HostID:  r.HostID,
-			},
-			Name:         r.Name,
-			Mode:         mode,
-			BadTimestamp: r.BadTimestamp,
-		})
+		replicas = append(replicas, toReplica(r))
 	}
 
 	var controller *Controller
@@ -309,17 +765,41 @@ func toVolumeResource(v *types.VolumeInfo, apiContext *api.ApiContext) *Volume {
 		Size:                strconv.FormatInt(v.Size, 10),
 		BaseImage:           v.BaseImage,
 		FromBackup:          v.FromBackup,
+		FromSnapshot:        v.FromSnapshot,
+		FromVolume:          v.FromVolume,
+		SourcePVC:           v.SourcePVC,
+		AccessMode:          string(v.AccessMode),
+		DataLocality:        string(v.DataLocality),
+		FsType:              v.FsType,
+		MountOptions:        v.MountOptions,
 		NumberOfReplicas:    v.NumberOfReplicas,
 		State:               string(v.State),
 		EngineImage:         v.EngineImage,
 		RecurringJobs:       v.RecurringJobs,
+		Labels:              v.Labels,
 		StaleReplicaTimeout: int(v.StaleReplicaTimeout / time.Minute),
+		MaxSnapshots:        v.MaxSnapshots,
 		Endpoint:            v.Endpoint,
 		Created:             v.Created,
 
+		AutoScaleReplicas:           v.AutoScaleReplicas,
+		AutoScaleReadIOPSThreshold:  v.AutoScaleReadIOPSThreshold,
+		AutoScaleScaleDownThreshold: v.AutoScaleScaleDownThreshold,
+		MaxAutoScaleReplicas:        v.MaxAutoScaleReplicas,
+
+		ReadIOPSMax:       v.ReadIOPSMax,
+		WriteIOPSMax:      v.WriteIOPSMax,
+		ReadBandwidthMax:  v.ReadBandwidthMax,
+		WriteBandwidthMax: v.WriteBandwidthMax,
+
+		DryRun: v.DryRun,
+
 		Controller: controller,
 		Replicas:   replicas,
 	}
+	if v.DryRun {
+		return r
+	}
 
 	actions := map[string]struct{}{}
 
@@ -328,38 +808,76 @@ func toVolumeResource(v *types.VolumeInfo, apiContext *api.ApiContext) *Volume {
 		actions["attach"] = struct{}{}
 		actions["recurringUpdate"] = struct{}{}
 		actions["replicaRemove"] = struct{}{}
+		actions["replicaPin"] = struct{}{}
+		actions["autoScaleUpdate"] = struct{}{}
+		actions["qosUpdate"] = struct{}{}
+		actions["controllerCreate"] = struct{}{}
 	case types.VolumeStateHealthy:
 		actions["detach"] = struct{}{}
+		actions["migrate"] = struct{}{}
+		actions["backupRestore"] = struct{}{}
 		actions["snapshotPurge"] = struct{}{}
 		actions["snapshotCreate"] = struct{}{}
 		actions["snapshotList"] = struct{}{}
 		actions["snapshotGet"] = struct{}{}
+		actions["snapshotDiff"] = struct{}{}
 		actions["snapshotDelete"] = struct{}{}
+		actions["snapshotBulkDelete"] = struct{}{}
 		actions["snapshotRevert"] = struct{}{}
 		actions["snapshotBackup"] = struct{}{}
+		actions["backupCancel"] = struct{}{}
 		actions["recurringUpdate"] = struct{}{}
 		actions["bgTaskQueue"] = struct{}{}
+		actions["bgTaskCancel"] = struct{}{}
+		actions["volumeInfo"] = struct{}{}
+		actions["volumeIOStats"] = struct{}{}
+		actions["replicaRebuildStatus"] = struct{}{}
+		actions["export"] = struct{}{}
+		actions["replicaAdd"] = struct{}{}
 		actions["replicaRemove"] = struct{}{}
+		actions["replicaModeUpdate"] = struct{}{}
+		actions["replicaPin"] = struct{}{}
+		actions["autoScaleUpdate"] = struct{}{}
+		actions["qosUpdate"] = struct{}{}
 	case types.VolumeStateDegraded:
 		actions["detach"] = struct{}{}
 		actions["snapshotPurge"] = struct{}{}
 		actions["snapshotCreate"] = struct{}{}
 		actions["snapshotList"] = struct{}{}
 		actions["snapshotGet"] = struct{}{}
+		actions["snapshotDiff"] = struct{}{}
 		actions["snapshotDelete"] = struct{}{}
+		actions["snapshotBulkDelete"] = struct{}{}
 		actions["snapshotRevert"] = struct{}{}
 		actions["snapshotBackup"] = struct{}{}
+		actions["backupCancel"] = struct{}{}
 		actions["recurringUpdate"] = struct{}{}
 		actions["bgTaskQueue"] = struct{}{}
+		actions["bgTaskCancel"] = struct{}{}
+		actions["volumeInfo"] = struct{}{}
+		actions["volumeIOStats"] = struct{}{}
+		actions["replicaRebuildStatus"] = struct{}{}
+		actions["export"] = struct{}{}
+		actions["replicaAdd"] = struct{}{}
 		actions["replicaRemove"] = struct{}{}
+		actions["replicaModeUpdate"] = struct{}{}
+		actions["replicaPin"] = struct{}{}
+		actions["autoScaleUpdate"] = struct{}{}
+		actions["qosUpdate"] = struct{}{}
+	case types.VolumeStateRestoring:
+		actions["detach"] = struct{}{}
 	case types.VolumeStateCreated:
 		actions["recurringUpdate"] = struct{}{}
 	case types.VolumeStateFaulted:
+		actions["emergencySnapshot"] = struct{}{}
 	}
 
+	actions["labelUpdate"] = struct{}{}
+
 	for action := range actions {
 		r.Actions[action] = apiContext.UrlBuilder.ActionLink(r.Resource, action)
 	}
+	r.Links["replicas"] = apiContext.UrlBuilder.Link(r.Resource, "replicas")
 
 	return r
 }
@@ -404,10 +922,32 @@ func toSnapshotCollection(ss []*types.SnapshotInfo) *client.GenericCollection {
 	return &client.GenericCollection{Data: data, Collection: client.Collection{ResourceType: "snapshot"}}
 }
 
+func toEventCollection(events []*types.EventInfo) *client.GenericCollection {
+	data := []interface{}{}
+	for _, e := range events {
+		data = append(data, &Event{
+			Resource: client.Resource{
+				Id:   e.ID,
+				Type: "event",
+			},
+			Timestamp: e.Timestamp,
+			EventType: e.Type,
+			Target:    e.Resource,
+			Message:   e.Message,
+		})
+	}
+	return &client.GenericCollection{Data: data, Collection: client.Collection{ResourceType: "event"}}
+}
+
 func toHostCollection(hosts map[string]*types.HostInfo) *client.GenericCollection {
+	ids := []string{}
+	for id := range hosts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
 	data := []interface{}{}
-	for _, v := range hosts {
-		data = append(data, toHostResource(v))
+	for _, id := range ids {
+		data = append(data, toHostResource(hosts[id]))
 	}
 	return &client.GenericCollection{Data: data}
 }
@@ -422,6 +962,99 @@ func toHostResource(h *types.HostInfo) *Host {
 		UUID:    h.UUID,
 		Name:    h.Name,
 		Address: h.Address,
+		Tags:    h.Tags,
+
+		TotalStorage: h.TotalStorage,
+		UsedStorage:  h.UsedStorage,
+		ReplicaCount: h.ReplicaCount,
+	}
+}
+
+func toVolumeControllerInfoResource(info *types.VolumeControllerInfo) *VolumeControllerInfo {
+	return &VolumeControllerInfo{
+		Resource: client.Resource{
+			Id:   info.Name,
+			Type: "volumeControllerInfo",
+		},
+		VolumeControllerInfo: *info,
+	}
+}
+
+func toVolumeIOStatsResource(volumeName string, stats *types.VolumeIOStats) *VolumeIOStats {
+	return &VolumeIOStats{
+		Resource: client.Resource{
+			Id:   volumeName,
+			Type: "volumeIOStats",
+		},
+		VolumeIOStats: *stats,
+	}
+}
+
+func toRebuildStatusCollection(statuses []*types.RebuildStatus) *client.GenericCollection {
+	data := []interface{}{}
+	for _, s := range statuses {
+		data = append(data, &RebuildStatus{
+			Resource: client.Resource{
+				Id:   s.ReplicaName,
+				Type: "rebuildStatus",
+			},
+			RebuildStatus: *s,
+		})
+	}
+	return &client.GenericCollection{Data: data, Collection: client.Collection{ResourceType: "rebuildStatus"}}
+}
+
+func toPurgeResultResource(volumeName string, result *types.PurgeResult) *PurgeResult {
+	return &PurgeResult{
+		Resource: client.Resource{
+			Id:   volumeName,
+			Type: "purgeResult",
+		},
+		PurgeResult: *result,
+	}
+}
+
+func toSnapshotScheduleResource(volumeName string, runs []time.Time) *SnapshotSchedule {
+	next := []string{}
+	for _, t := range runs {
+		next = append(next, util.FormatTimeZ(t))
+	}
+	return &SnapshotSchedule{
+		Resource: client.Resource{
+			Id:      volumeName,
+			Type:    "snapshotSchedule",
+			Actions: map[string]string{},
+		},
+		Next: next,
+	}
+}
+
+func toMonitorStatusResource(volumeName string, status *types.MonitorStatus) *MonitorStatus {
+	lastCheckTime := ""
+	if !status.LastCheckTime.IsZero() {
+		lastCheckTime = util.FormatTimeZ(status.LastCheckTime)
+	}
+	return &MonitorStatus{
+		Resource: client.Resource{
+			Id:      volumeName,
+			Type:    "monitorStatus",
+			Actions: map[string]string{},
+		},
+		Interval:          status.Interval.String(),
+		LastCheckTime:     lastCheckTime,
+		LastCheckError:    status.LastCheckError,
+		ConsecutiveErrors: status.ConsecutiveErrors,
+	}
+}
+
+func toTopologyResource(t *types.StorageTopology) *Topology {
+	return &Topology{
+		Resource: client.Resource{
+			Id:      "topology",
+			Type:    "topology",
+			Actions: map[string]string{},
+		},
+		StorageTopology: *t,
 	}
 }
 
@@ -439,9 +1072,13 @@ func toBackupVolumeResource(bv *types.BackupVolumeInfo, apiContext *api.ApiConte
 		BackupVolumeInfo: *bv,
 	}
 	b.Actions = map[string]string{
-		"backupList":   apiContext.UrlBuilder.ActionLink(b.Resource, "backupList"),
-		"backupGet":    apiContext.UrlBuilder.ActionLink(b.Resource, "backupGet"),
-		"backupDelete": apiContext.UrlBuilder.ActionLink(b.Resource, "backupDelete"),
+		"backupList":      apiContext.UrlBuilder.ActionLink(b.Resource, "backupList"),
+		"backupGet":       apiContext.UrlBuilder.ActionLink(b.Resource, "backupGet"),
+		"backupDelete":    apiContext.UrlBuilder.ActionLink(b.Resource, "backupDelete"),
+		"verifyIntegrity": apiContext.UrlBuilder.ActionLink(b.Resource, "verifyIntegrity"),
+		"integrityReport": apiContext.UrlBuilder.ActionLink(b.Resource, "integrityReport"),
+
+		"backupVolumeDelete": apiContext.UrlBuilder.ActionLink(b.Resource, "backupVolumeDelete"),
 	}
 	return b
 }
@@ -485,6 +1122,7 @@ type Server struct {
 	snapshots *SnapshotHandlers
 	settings  *SettingsHandlers
 	backups   *BackupsHandlers
+	leader    LeaderLocator
 }
 
 func NewServer(m types.VolumeManager, sl types.ServiceLocator, proxy http.Handler) *Server {
@@ -500,7 +1138,8 @@ func NewServer(m types.VolumeManager, sl types.ServiceLocator, proxy http.Handle
 			m.Settings(),
 		},
 		backups: &BackupsHandlers{
-			m,
+			man:            m,
+			integrityTasks: map[string]*types.BgTask{},
 		},
 	}
 }
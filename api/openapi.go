@@ -0,0 +1,295 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rancher/go-rancher/client"
+)
+
+// openAPIResources are the schemas served as REST resources under /v1, the
+// rest are only used as action inputs and outputs
+var openAPIResources = []string{"volume", "host", "setting", "backupVolume"}
+
+func (s *Server) OpenAPI(rw http.ResponseWriter, req *http.Request) error {
+	spec, err := schemaToOpenAPI(NewSchema())
+	if err != nil {
+		return errors.Wrap(err, "fail to generate OpenAPI spec")
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	_, err = rw.Write(spec)
+	return err
+}
+
+func schemaToOpenAPI(s *client.Schemas) ([]byte, error) {
+	schemas := map[string]interface{}{}
+	for i := range s.Data {
+		schemas[s.Data[i].Id] = schemaToOpenAPIObject(s, &s.Data[i])
+	}
+
+	paths := map[string]interface{}{}
+	for _, id := range openAPIResources {
+		schema, ok := s.CheckSchema(id)
+		if !ok {
+			return nil, errors.Errorf("cannot find schema '%s'", id)
+		}
+		addOpenAPIPaths(paths, &schema)
+	}
+
+	return json.MarshalIndent(map[string]interface{}{
+		"openapi": "3.0.0",
+		"info": map[string]interface{}{
+			"title":   "Longhorn Manager API",
+			"version": "v1",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+		},
+	}, "", "  ")
+}
+
+func openAPIRef(id string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + id}
+}
+
+func openAPIResponse(description, output string) map[string]interface{} {
+	response := map[string]interface{}{"description": description}
+	if output != "" {
+		response["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": openAPIRef(output)},
+		}
+	}
+	return response
+}
+
+func openAPIOperation(operationID, summary string, params []interface{}, input, output string) map[string]interface{} {
+	op := map[string]interface{}{
+		"operationId": operationID,
+		"summary":     summary,
+		"responses": map[string]interface{}{
+			"200":     openAPIResponse("success", output),
+			"default": openAPIResponse("error", "error"),
+		},
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+	if input != "" {
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": openAPIRef(input)},
+			},
+		}
+	}
+	return op
+}
+
+// openAPIActions is the POST operation of the actions, a path has a single
+// POST operation so the action is a query parameter. The input and output
+// of every action are listed under x-actions, with their own operationId.
+// If create is set, a POST without action creates a resource of that schema.
+func openAPIActions(operationID, summary string, params []interface{}, create string, actions map[string]client.Action) map[string]interface{} {
+	names := []string{}
+	for name := range actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	inputs, outputs := []interface{}{}, []interface{}{}
+	seenInputs, seenOutputs := map[string]bool{}, map[string]bool{}
+	xActions := map[string]interface{}{}
+	if create != "" {
+		inputs = append(inputs, openAPIRef(create))
+		outputs = append(outputs, openAPIRef(create))
+		seenInputs[create], seenOutputs[create] = true, true
+	}
+	for _, name := range names {
+		action := actions[name]
+		xAction := map[string]interface{}{"operationId": operationID + strings.Title(name)}
+		if action.Input != "" {
+			xAction["input"] = openAPIRef(action.Input)
+			if !seenInputs[action.Input] {
+				seenInputs[action.Input] = true
+				inputs = append(inputs, openAPIRef(action.Input))
+			}
+		}
+		if action.Output != "" {
+			xAction["output"] = openAPIRef(action.Output)
+			if !seenOutputs[action.Output] {
+				seenOutputs[action.Output] = true
+				outputs = append(outputs, openAPIRef(action.Output))
+			}
+		}
+		xActions[name] = xAction
+	}
+
+	actionParam := map[string]interface{}{
+		"name":     "action",
+		"in":       "query",
+		"required": create == "",
+		"schema":   map[string]interface{}{"type": "string", "enum": names},
+	}
+	op := map[string]interface{}{
+		"operationId": operationID + "Action",
+		"summary":     summary,
+		"parameters":  append(append([]interface{}{}, params...), actionParam),
+		"responses": map[string]interface{}{
+			"200":     openAPIOneOfResponse("success", outputs),
+			"default": openAPIResponse("error", "error"),
+		},
+		"x-actions": xActions,
+	}
+	if create != "" {
+		op["summary"] = "create " + create + " without action, " + summary
+		op["x-create"] = map[string]interface{}{
+			"operationId": "create" + strings.Title(create),
+			"input":       openAPIRef(create),
+			"output":      openAPIRef(create),
+		}
+	}
+	if len(inputs) > 0 {
+		op["requestBody"] = map[string]interface{}{
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": map[string]interface{}{"oneOf": inputs}},
+			},
+		}
+	}
+	return op
+}
+
+func openAPIOneOfResponse(description string, outputs []interface{}) map[string]interface{} {
+	response := map[string]interface{}{"description": description}
+	if len(outputs) > 0 {
+		response["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": map[string]interface{}{"oneOf": outputs}},
+		}
+	}
+	return response
+}
+
+// addOpenAPIPaths adds the collection and resource paths of schema. Actions
+// are POST requests to the resource (or collection) URL with the `action`
+// query parameter.
+func addOpenAPIPaths(paths map[string]interface{}, schema *client.Schema) {
+	collectionPath := "/v1/" + strings.ToLower(schema.PluralName)
+	resourcePath := collectionPath + "/{id}"
+	idParam := []interface{}{map[string]interface{}{
+		"name":     "id",
+		"in":       "path",
+		"required": true,
+		"schema":   map[string]interface{}{"type": "string"},
+	}}
+
+	collection := map[string]interface{}{}
+	for _, method := range schema.CollectionMethods {
+		switch method {
+		case "GET":
+			collection["get"] = openAPIOperation("list"+strings.Title(schema.PluralName), "list "+schema.PluralName, nil, "", "")
+		case "POST":
+			collection["post"] = openAPIOperation("create"+strings.Title(schema.Id), "create "+schema.Id, nil, schema.Id, schema.Id)
+		}
+	}
+	if len(schema.CollectionActions) > 0 {
+		create := ""
+		if _, ok := collection["post"]; ok {
+			create = schema.Id
+		}
+		collection["post"] = openAPIActions(schema.PluralName, "actions on "+schema.PluralName, nil, create, schema.CollectionActions)
+	}
+	if len(collection) > 0 {
+		paths[collectionPath] = collection
+	}
+
+	resource := map[string]interface{}{}
+	for _, method := range schema.ResourceMethods {
+		switch method {
+		case "GET":
+			resource["get"] = openAPIOperation("get"+strings.Title(schema.Id), "get "+schema.Id, idParam, "", schema.Id)
+		case "PUT":
+			resource["put"] = openAPIOperation("update"+strings.Title(schema.Id), "update "+schema.Id, idParam, schema.Id, schema.Id)
+		case "DELETE":
+			resource["delete"] = openAPIOperation("delete"+strings.Title(schema.Id), "delete "+schema.Id, idParam, "", "")
+		}
+	}
+	if len(schema.ResourceActions) > 0 {
+		resource["post"] = openAPIActions(schema.Id, "actions on "+schema.Id, idParam, "", schema.ResourceActions)
+	}
+	if len(resource) > 0 {
+		paths[resourcePath] = resource
+	}
+}
+
+func schemaToOpenAPIObject(s *client.Schemas, schema *client.Schema) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for name, field := range schema.ResourceFields {
+		properties[name] = fieldToOpenAPI(s, &field)
+		if field.Required {
+			required = append(required, name)
+		}
+	}
+	object := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		object["required"] = required
+	}
+	return object
+}
+
+func fieldToOpenAPI(s *client.Schemas, field *client.Field) map[string]interface{} {
+	property := fieldTypeToOpenAPI(s, field.Type)
+	if field.Type == "enum" {
+		property["enum"] = field.Options
+	}
+	if field.Default != nil {
+		property["default"] = field.Default
+		property["example"] = field.Default
+	}
+	if field.Min != nil {
+		property["minimum"] = *field.Min
+	}
+	if field.Max != nil {
+		property["maximum"] = *field.Max
+	}
+	if field.Nullable {
+		property["nullable"] = true
+	}
+	if field.Description != "" {
+		property["description"] = field.Description
+	}
+	return property
+}
+
+func fieldTypeToOpenAPI(s *client.Schemas, fieldType string) map[string]interface{} {
+	switch {
+	case fieldType == "string" || fieldType == "enum":
+		return map[string]interface{}{"type": "string"}
+	case fieldType == "int":
+		return map[string]interface{}{"type": "integer"}
+	case fieldType == "float":
+		return map[string]interface{}{"type": "number"}
+	case fieldType == "bool":
+		return map[string]interface{}{"type": "boolean"}
+	case strings.HasPrefix(fieldType, "map["):
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": fieldTypeToOpenAPI(s, strings.TrimSuffix(strings.TrimPrefix(fieldType, "map["), "]")),
+		}
+	case strings.HasPrefix(fieldType, "array["):
+		return map[string]interface{}{
+			"type":  "array",
+			"items": fieldTypeToOpenAPI(s, strings.TrimSuffix(strings.TrimPrefix(fieldType, "array["), "]")),
+		}
+	}
+	if _, ok := s.CheckSchema(fieldType); ok {
+		return openAPIRef(fieldType)
+	}
+	return map[string]interface{}{"type": "object"}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaToOpenAPI(t *testing.T) {
+	assert := require.New(t)
+
+	data, err := schemaToOpenAPI(NewSchema())
+	assert.Nil(err)
+
+	spec := struct {
+		OpenAPI    string                            `json:"openapi"`
+		Paths      map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Type       string                            `json:"type"`
+				Properties map[string]map[string]interface{} `json:"properties"`
+				Required   []string                          `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}{}
+	assert.Nil(json.Unmarshal(data, &spec))
+	assert.Equal("3.0.0", spec.OpenAPI)
+
+	volume, ok := spec.Components.Schemas["volume"]
+	assert.True(ok)
+	assert.Equal("object", volume.Type)
+	assert.Contains(volume.Required, "name")
+	assert.Equal("integer", volume.Properties["numberOfReplicas"]["type"])
+	assert.Equal(float64(2), volume.Properties["numberOfReplicas"]["example"])
+	assert.Equal("array", volume.Properties["replicas"]["type"])
+	assert.Equal([]interface{}{"rwo", "rwx"}, volume.Properties["accessMode"]["enum"])
+
+	job := spec.Components.Schemas["recurringJob"]
+	assert.Equal([]interface{}{"snapshot", "backup"}, job.Properties["task"]["enum"])
+	assert.Equal(float64(1), job.Properties["retain"]["minimum"])
+	assert.Contains(job.Required, "retain")
+
+	assert.Contains(spec.Paths["/v1/volumes"], "get")
+	assert.Contains(spec.Paths["/v1/volumes"], "post")
+	assert.Contains(spec.Paths["/v1/volumes/{id}"], "delete")
+	assert.Contains(spec.Paths["/v1/settings/{id}"], "put")
+
+	operationIDs := map[string]bool{}
+	for path, ops := range spec.Paths {
+		assert.NotContains(path, "?")
+		for method, op := range ops {
+			id := op.(map[string]interface{})["operationId"].(string)
+			assert.False(operationIDs[id], "duplicate operationId %v of %v %v", id, method, path)
+			operationIDs[id] = true
+		}
+	}
+
+	attach := spec.Paths["/v1/volumes/{id}"]["post"].(map[string]interface{})
+	assert.Equal("volumeAction", attach["operationId"])
+	params := attach["parameters"].([]interface{})
+	action := params[len(params)-1].(map[string]interface{})
+	assert.Equal("action", action["name"])
+	assert.Equal("query", action["in"])
+	assert.Equal(true, action["required"])
+	assert.Contains(action["schema"].(map[string]interface{})["enum"], "attach")
+	xAttach := attach["x-actions"].(map[string]interface{})["attach"].(map[string]interface{})
+	assert.Equal("volumeAttach", xAttach["operationId"])
+	assert.Equal(map[string]interface{}{"$ref": "#/components/schemas/attachInput"}, xAttach["input"])
+
+	backupList := spec.Paths["/v1/backupvolumes/{id}"]["post"].(map[string]interface{})
+	assert.Contains(backupList["x-actions"], "backupList")
+
+	// creates a volume without action
+	create := spec.Paths["/v1/volumes"]["post"].(map[string]interface{})
+	assert.Contains(create["x-actions"], "snapshotGroupCreate")
+	params = create["parameters"].([]interface{})
+	assert.Equal(false, params[0].(map[string]interface{})["required"])
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/rancher/go-rancher/client"
+)
+
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 500
+)
+
+// parsePage reads the page (starting with 1) and pageSize query parameters
+func parsePage(query url.Values) (int, int, error) {
+	page, pageSize := 1, DefaultPageSize
+	if v := query.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, 0, errors.Errorf("invalid page '%s'", v)
+		}
+		page = n
+	}
+	if v := query.Get("pageSize"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxPageSize {
+			return 0, 0, errors.Errorf("invalid page size '%s', should be between 1 and %v", v, MaxPageSize)
+		}
+		pageSize = n
+	}
+	return page, pageSize, nil
+}
+
+func pageURL(req *http.Request, page, pageSize int) string {
+	u := *req.URL
+	query := u.Query()
+	query.Set("page", strconv.Itoa(page))
+	query.Set("pageSize", strconv.Itoa(pageSize))
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
+
+// paginate cuts the requested page out of the collection data and fills in
+// the collection pagination links. The link to the last page is set in the
+// collection links, there's no field for it in client.Pagination.
+func paginate(collection *client.GenericCollection, req *http.Request) error {
+	page, pageSize, err := parsePage(req.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	total := int64(len(collection.Data))
+	limit := int64(pageSize)
+	last := 1
+	if total > 0 {
+		last = int((total + limit - 1) / limit)
+	}
+
+	start, end := (page-1)*pageSize, page*pageSize
+	if start > len(collection.Data) {
+		start = len(collection.Data)
+	}
+	if end > len(collection.Data) {
+		end = len(collection.Data)
+	}
+	collection.Data = collection.Data[start:end]
+
+	pagination := &client.Pagination{
+		First:   pageURL(req, 1, pageSize),
+		Limit:   &limit,
+		Total:   &total,
+		Partial: last > 1,
+	}
+	if page > 1 {
+		pagination.Previous = pageURL(req, page-1, pageSize)
+	}
+	if page < last {
+		pagination.Next = pageURL(req, page+1, pageSize)
+	}
+	collection.Pagination = pagination
+	if collection.Links == nil {
+		collection.Links = map[string]string{}
+	}
+	collection.Links["last"] = pageURL(req, last, pageSize)
+	return nil
+}
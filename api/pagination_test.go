@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rancher/go-rancher/client"
+	"github.com/stretchr/testify/require"
+)
+
+func newCollection(n int) *client.GenericCollection {
+	data := []interface{}{}
+	for i := 0; i < n; i++ {
+		data = append(data, i)
+	}
+	return &client.GenericCollection{Data: data}
+}
+
+func TestPaginate(t *testing.T) {
+	assert := require.New(t)
+
+	collection := newCollection(250)
+	assert.Nil(paginate(collection, httptest.NewRequest("GET", "/v1/volumes", nil)))
+	assert.Len(collection.Data, DefaultPageSize)
+	assert.Equal(0, collection.Data[0])
+	assert.Equal(int64(250), *collection.Pagination.Total)
+	assert.Equal(int64(DefaultPageSize), *collection.Pagination.Limit)
+	assert.Equal("/v1/volumes?page=1&pageSize=100", collection.Pagination.First)
+	assert.Equal("", collection.Pagination.Previous)
+	assert.Equal("/v1/volumes?page=2&pageSize=100", collection.Pagination.Next)
+	assert.Equal("/v1/volumes?page=3&pageSize=100", collection.Links["last"])
+
+	collection = newCollection(250)
+	assert.Nil(paginate(collection, httptest.NewRequest("GET", "/v1/volumes?page=3&pageSize=100", nil)))
+	assert.Len(collection.Data, 50)
+	assert.Equal(200, collection.Data[0])
+	assert.Equal("/v1/volumes?page=2&pageSize=100", collection.Pagination.Previous)
+	assert.Equal("", collection.Pagination.Next)
+
+	collection = newCollection(250)
+	assert.Nil(paginate(collection, httptest.NewRequest("GET", "/v1/volumes?page=5&pageSize=100", nil)))
+	assert.Len(collection.Data, 0)
+
+	collection = newCollection(0)
+	assert.Nil(paginate(collection, httptest.NewRequest("GET", "/v1/hosts", nil)))
+	assert.Len(collection.Data, 0)
+	assert.False(collection.Pagination.Partial)
+	assert.Equal("/v1/hosts?page=1&pageSize=100", collection.Links["last"])
+
+	for _, query := range []string{"page=0", "page=x", "pageSize=0", "pageSize=501"} {
+		assert.NotNil(paginate(newCollection(1), httptest.NewRequest("GET", "/v1/volumes?"+query, nil)))
+	}
+}
@@ -1,7 +1,12 @@
 package api
 
 import (
+	"net"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
@@ -37,8 +42,16 @@ func (s *SettingsHandlers) Get(w http.ResponseWriter, req *http.Request) error {
 	switch name {
 	case "backupTarget":
 		value = si.BackupTarget
+	case "backupS3Endpoint":
+		value = si.BackupS3Endpoint
 	case "engineImage":
 		value = si.EngineImage
+	case "replicaAntiAffinity":
+		value = si.ReplicaAntiAffinity
+	case "syslogTarget":
+		value = si.SyslogTarget
+	case "faultedVolumeAutoRecovery":
+		value = strconv.FormatBool(si.FaultedVolumeAutoRecovery)
 	default:
 		return errors.Errorf("invalid setting name %v", name)
 	}
@@ -64,10 +77,23 @@ func (s *SettingsHandlers) Set(w http.ResponseWriter, req *http.Request) error {
 	switch name {
 	case "backupTarget":
 		si.BackupTarget = setting.Value
+	case "backupS3Endpoint":
+		si.BackupS3Endpoint = setting.Value
 	case "engineImage":
 		si.EngineImage = setting.Value
+	case "replicaAntiAffinity":
+		si.ReplicaAntiAffinity = setting.Value
+	case "syslogTarget":
+		si.SyslogTarget = setting.Value
+	case "faultedVolumeAutoRecovery":
+		if si.FaultedVolumeAutoRecovery, err = strconv.ParseBool(setting.Value); err != nil {
+			return errors.Errorf("invalid value '%s' of faultedVolumeAutoRecovery, should be true or false", setting.Value)
+		}
 	default:
-		return errors.Wrapf(err, "invalid setting name %v", name)
+		return errors.Errorf("invalid setting name %v", name)
+	}
+	if err := ValidateSettings(si); err != nil {
+		return err
 	}
 	if err := s.settings.SetSettings(si); err != nil {
 		return errors.Wrapf(err, "fail to set settings %v", si)
@@ -76,3 +102,86 @@ func (s *SettingsHandlers) Set(w http.ResponseWriter, req *http.Request) error {
 	apiContext.Write(toSettingResource(name, setting.Value))
 	return nil
 }
+
+// engineImageRegexp matches [registry[:port]/]repo/image:tag
+var engineImageRegexp = regexp.MustCompile(`^[a-z0-9]+([._-][a-z0-9]+)*(:[0-9]+)?(/[a-z0-9]+([._-][a-z0-9]+)*)+:[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// ValidateSettings checks every setting is either empty (where allowed) or
+// well-formed
+func ValidateSettings(info *types.SettingsInfo) error {
+	if err := validateBackupTarget(info.BackupTarget); err != nil {
+		return err
+	}
+	if err := validateS3Endpoint(info.BackupS3Endpoint); err != nil {
+		return err
+	}
+	if !engineImageRegexp.MatchString(info.EngineImage) {
+		return errors.Errorf("invalid engine image '%s', should be in repo/image:tag format", info.EngineImage)
+	}
+	if info.ReplicaAntiAffinity != "" && info.ReplicaAntiAffinity != types.ReplicaAntiAffinitySoft && info.ReplicaAntiAffinity != types.ReplicaAntiAffinityStrict {
+		return errors.Errorf("invalid replica anti-affinity %v, should be %v or %v",
+			info.ReplicaAntiAffinity, types.ReplicaAntiAffinitySoft, types.ReplicaAntiAffinityStrict)
+	}
+	if err := validateSyslogTarget(info.SyslogTarget); err != nil {
+		return err
+	}
+	return nil
+}
+
+func validateBackupTarget(target string) error {
+	if target == "" {
+		return nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return errors.Wrapf(err, "invalid backup target '%s'", target)
+	}
+	switch u.Scheme {
+	case "nfs", "s3":
+		if u.Host == "" {
+			return errors.Errorf("invalid backup target '%s': missing %s server", target, u.Scheme)
+		}
+	case "vfs":
+		if u.Host != "" || !strings.HasPrefix(u.Path, "/") {
+			return errors.Errorf("invalid backup target '%s': should be vfs:///<absolute path>", target)
+		}
+	default:
+		return errors.Errorf("invalid backup target '%s', should be nfs://, s3:// or vfs:// URL", target)
+	}
+	return nil
+}
+
+func validateS3Endpoint(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return errors.Wrapf(err, "invalid backup S3 endpoint '%s'", endpoint)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.Errorf("invalid backup S3 endpoint '%s', should be http:// or https:// URL", endpoint)
+	}
+	return nil
+}
+
+func validateSyslogTarget(target string) error {
+	if target == "" {
+		return nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return errors.Wrapf(err, "invalid syslog target '%s'", target)
+	}
+	if u.Scheme != "udp" || (u.Path != "" && u.Path != "/") {
+		return errors.Errorf("invalid syslog target '%s', should be udp://host:port", target)
+	}
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil || host == "" {
+		return errors.Errorf("invalid syslog target '%s', should be udp://host:port", target)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return errors.Errorf("invalid port '%s' of syslog target '%s'", port, target)
+	}
+	return nil
+}
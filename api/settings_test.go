@@ -0,0 +1,70 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+func TestValidateSettings(t *testing.T) {
+	assert := require.New(t)
+
+	valid := func() *types.SettingsInfo {
+		return &types.SettingsInfo{
+			EngineImage:         "rancher/longhorn-engine:de88734",
+			ReplicaAntiAffinity: types.ReplicaAntiAffinitySoft,
+		}
+	}
+	assert.Nil(ValidateSettings(valid()))
+
+	for _, target := range []string{
+		"nfs://nfs.example.com/exports/longhorn",
+		"s3://backups@us-east-1/longhorn",
+		"vfs:///var/lib/longhorn/backups",
+	} {
+		si := valid()
+		si.BackupTarget = target
+		assert.Nil(ValidateSettings(si), target)
+	}
+	for _, target := range []string{"nfs:///exports", "vfs://relative/path", "/var/lib/longhorn/backups", "ftp://host/path"} {
+		si := valid()
+		si.BackupTarget = target
+		assert.NotNil(ValidateSettings(si), target)
+	}
+
+	for _, image := range []string{"localhost:5000/rancher/longhorn-engine:v0.1.0", "rancher/longhorn-engine:latest"} {
+		si := valid()
+		si.EngineImage = image
+		assert.Nil(ValidateSettings(si), image)
+	}
+	for _, image := range []string{"", "longhorn-engine:latest", "rancher/longhorn-engine", "Rancher/longhorn-engine:v1"} {
+		si := valid()
+		si.EngineImage = image
+		assert.NotNil(ValidateSettings(si), image)
+	}
+
+	for _, endpoint := range []string{"http://minio.example.com:9000", "https://rgw.example.com"} {
+		si := valid()
+		si.BackupS3Endpoint = endpoint
+		assert.Nil(ValidateSettings(si), endpoint)
+	}
+	for _, endpoint := range []string{"minio.example.com:9000", "s3://minio.example.com", "http://"} {
+		si := valid()
+		si.BackupS3Endpoint = endpoint
+		assert.NotNil(ValidateSettings(si), endpoint)
+	}
+
+	si := valid()
+	si.ReplicaAntiAffinity = "maybe"
+	assert.NotNil(ValidateSettings(si))
+
+	si = valid()
+	si.SyslogTarget = "udp://10.0.0.1:514"
+	assert.Nil(ValidateSettings(si))
+	for _, target := range []string{"tcp://10.0.0.1:514", "udp://10.0.0.1", "udp://:514", "udp://10.0.0.1:99999", "10.0.0.1:514"} {
+		si.SyslogTarget = target
+		assert.NotNil(ValidateSettings(si), target)
+	}
+}
@@ -1,20 +1,55 @@
 package api
 
 import (
+	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 	"github.com/rancher/go-rancher/api"
+	"github.com/rancher/go-rancher/client"
+	"github.com/rancher/longhorn-manager/controller"
 	"github.com/rancher/longhorn-manager/types"
+	"github.com/rancher/longhorn-manager/util"
 )
 
 type SnapshotHandlers struct {
 	man types.VolumeManager
 }
 
+// CreateGroup takes a consistency group snapshot of the volumes
+func (sh *SnapshotHandlers) CreateGroup(w http.ResponseWriter, req *http.Request) error {
+	var input SnapshotGroupInput
+
+	apiContext := api.GetApiContext(req)
+	if err := apiContext.Read(&input); err != nil {
+		return errors.Wrapf(err, "error read snapshotGroupInput")
+	}
+	for k, v := range input.Labels {
+		if strings.Contains(k, "=") || strings.Contains(v, "=") {
+			return errors.New("labels cannot contain '='")
+		}
+	}
+
+	snapName, err := sh.man.CreateGroupSnapshot(input.Volumes, input.Name, input.Labels)
+	if err != nil {
+		return errors.Wrapf(err, "error creating group snapshot of volumes %v", input.Volumes)
+	}
+	logrus.Debugf("success: created group snapshot '%s' of volumes %v", snapName, input.Volumes)
+	apiContext.Write(&ConsistencyGroupSnapshot{
+		Resource: client.Resource{
+			Id:   snapName,
+			Type: "consistencyGroupSnapshot",
+		},
+		Name:    snapName,
+		Volumes: input.Volumes,
+	})
+	return nil
+}
+
 func (sh *SnapshotHandlers) Create(w http.ResponseWriter, req *http.Request) error {
 	var input SnapshotInput
 
@@ -38,11 +73,14 @@ func (sh *SnapshotHandlers) Create(w http.ResponseWriter, req *http.Request) err
 	if err != nil {
 		return errors.Wrapf(err, "error getting SnapshotOps for volume '%s'", volName)
 	}
-	snapName, err := snapOps.Create(input.Name, input.Labels)
+	snapName, err := sh.createSnapshot(snapOps, volName, &input)
 	if err != nil {
-		return errors.Wrapf(err, "error creating snapshot '%s', for volume '%s'", input.Name, volName)
+		return err
 	}
 	logrus.Debugf("created snapshot '%s'", snapName)
+	if err := sh.man.EnforceMaxSnapshots(volName); err != nil {
+		logrus.Errorf("%+v", err)
+	}
 
 	snap, err := snapOps.Get(snapName)
 	if err != nil {
@@ -56,12 +94,41 @@ func (sh *SnapshotHandlers) Create(w http.ResponseWriter, req *http.Request) err
 	return nil
 }
 
+// createSnapshot takes the snapshot, between quiescing and unquiescing the
+// volume if requested
+func (sh *SnapshotHandlers) createSnapshot(snapOps types.SnapshotOps, volName string, input *SnapshotInput) (snapName string, err error) {
+	if input.Quiesce {
+		if err := sh.man.Quiesce(volName); err != nil {
+			return "", err
+		}
+		defer func() {
+			if uErr := sh.man.Unquiesce(volName); uErr != nil {
+				if err != nil {
+					logrus.Errorf("%+v", uErr)
+					return
+				}
+				err = uErr
+			}
+		}()
+	}
+	snapName, err = snapOps.Create(input.Name, input.Labels)
+	if err != nil {
+		return "", errors.Wrapf(err, "error creating snapshot '%s', for volume '%s'", input.Name, volName)
+	}
+	return snapName, nil
+}
+
 func (sh *SnapshotHandlers) List(w http.ResponseWriter, req *http.Request) error {
 	volName := mux.Vars(req)["name"]
 	if volName == "" {
 		return errors.Errorf("volume name required")
 	}
 
+	selector, err := parseLabelSelector(req.URL.Query().Get("labelSelector"))
+	if err != nil {
+		return err
+	}
+
 	snapOps, err := sh.man.SnapshotOps(volName)
 	if err != nil {
 		return errors.Wrapf(err, "error getting SnapshotOps for volume '%s'", volName)
@@ -71,11 +138,59 @@ func (sh *SnapshotHandlers) List(w http.ResponseWriter, req *http.Request) error
 	if err != nil {
 		return errors.Wrapf(err, "error listing snapshots, for volume '%+v'", volName)
 	}
+	snapList = filterSnapshotsByLabels(snapList, selector)
 	logrus.Debugf("success: listed snapshots for volume '%s'", volName)
 	api.GetApiContext(req).Write(toSnapshotCollection(snapList))
 	return nil
 }
 
+func filterSnapshotsByLabels(snapshots []*types.SnapshotInfo, selector labelSelector) []*types.SnapshotInfo {
+	r := []*types.SnapshotInfo{}
+	for _, s := range snapshots {
+		if selector.Matches(s.Labels) {
+			r = append(r, s)
+		}
+	}
+	return r
+}
+
+func (sh *SnapshotHandlers) Diff(w http.ResponseWriter, req *http.Request) error {
+	var input SnapshotDiffInput
+
+	apiContext := api.GetApiContext(req)
+	if err := apiContext.Read(&input); err != nil {
+		return errors.Wrapf(err, "error read snapshotDiffInput")
+	}
+	if input.From == "" || input.To == "" {
+		return errors.Errorf("both snapshots to diff are required")
+	}
+
+	volName := mux.Vars(req)["name"]
+	if volName == "" {
+		return errors.Errorf("volume name required")
+	}
+
+	snapOps, err := sh.man.SnapshotOps(volName)
+	if err != nil {
+		return errors.Wrapf(err, "error getting SnapshotOps for volume '%s'", volName)
+	}
+
+	diff, err := snapOps.Diff(input.From, input.To)
+	if err != nil {
+		return errors.Wrapf(err, "error getting diff of snapshots '%s' and '%s', for volume '%s'", input.From, input.To, volName)
+	}
+	logrus.Debugf("success: diff of snapshots '%s' and '%s' for volume '%s'", input.From, input.To, volName)
+	apiContext.Write(&SnapshotDiff{
+		Resource: client.Resource{
+			Id:      input.From + ".." + input.To,
+			Type:    "snapshotDiff",
+			Actions: map[string]string{},
+		},
+		SnapshotDiff: *diff,
+	})
+	return nil
+}
+
 func (sh *SnapshotHandlers) Get(w http.ResponseWriter, req *http.Request) error {
 	var input SnapshotInput
 
@@ -215,15 +330,102 @@ func (sh *SnapshotHandlers) Backup(w http.ResponseWriter, req *http.Request) err
 		return errors.Wrapf(err, "error getting VolumeBackupOps for volume '%s'", volName)
 	}
 
-	if err := backups.StartBackup(input.Name, backupTarget); err != nil {
+	task, err := backups.StartBackup(input.Name, backupTarget)
+	if err != nil {
 		return errors.Wrapf(err, "error creating backup: snapshot '%s', volume '%s', dest '%s'", input.Name, volName, backupTarget)
 	}
-	logrus.Debugf("success: started backup: snapshot '%s', volume '%s', dest '%s'", input.Name, volName, backupTarget)
-	apiContext.Write(&Empty{})
+	logrus.Debugf("success: started backup: snapshot '%s', volume '%s', dest '%s', bgTask %v", input.Name, volName, backupTarget, task.Num)
+	apiContext.Write(toBgTaskRes(task))
+	return nil
+}
+
+func (sh *SnapshotHandlers) CancelBackup(w http.ResponseWriter, req *http.Request) error {
+	var input BackupCancelInput
+
+	apiContext := api.GetApiContext(req)
+	if err := apiContext.Read(&input); err != nil {
+		return errors.Wrapf(err, "error read backupCancelInput")
+	}
+	if input.BackupURL == "" {
+		return errors.Errorf("empty backup URL not allowed")
+	}
+
+	volName := mux.Vars(req)["name"]
+	if volName == "" {
+		return errors.Errorf("volume name required")
+	}
+
+	backups, err := sh.man.VolumeBackupOps(volName)
+	if err != nil {
+		return errors.Wrapf(err, "error getting VolumeBackupOps for volume '%s'", volName)
+	}
+	if err := backups.Cancel(input.BackupURL); err != nil {
+		return errors.Wrapf(err, "error cancelling backup '%s', volume '%s'", input.BackupURL, volName)
+	}
+
+	v, err := sh.man.Get(volName)
+	if err != nil {
+		return errors.Wrap(err, "unable to get volume")
+	}
+	if v == nil {
+		return errors.Errorf("cannot find volume '%s'", volName)
+	}
+	apiContext.Write(toVolumeResource(v, apiContext))
 	return nil
 }
 
 func (sh *SnapshotHandlers) Purge(w http.ResponseWriter, req *http.Request) error {
+	var input SnapshotPurgeInput
+
+	apiContext := api.GetApiContext(req)
+	if err := apiContext.Read(&input); err != nil && err != io.EOF {
+		return errors.Wrapf(err, "error read snapshotPurgeInput")
+	}
+
+	volName := mux.Vars(req)["name"]
+	if volName == "" {
+		return errors.Errorf("volume name required")
+	}
+
+	var retention time.Duration
+	if input.RetentionPeriod != "" {
+		d, err := time.ParseDuration(input.RetentionPeriod)
+		if err != nil || d < 0 {
+			return errors.Errorf("invalid retention period '%s'", input.RetentionPeriod)
+		}
+		retention = d
+	}
+
+	result, err := sh.man.PurgeSnapshots(volName, retention)
+	if err != nil {
+		return errors.Wrapf(err, "error purging snapshots, for volume '%+v'", volName)
+	}
+	logrus.Debugf("success: purge snapshots for volume '%s', removed %v, freed %v bytes", volName, result.Removed, result.SpaceFreed)
+	apiContext.Write(toPurgeResultResource(volName, result))
+	return nil
+}
+
+// BulkDelete deletes the snapshots of the volume older than the given age
+// and matching all the given labels
+func (sh *SnapshotHandlers) BulkDelete(w http.ResponseWriter, req *http.Request) error {
+	var input SnapshotBulkDeleteInput
+
+	apiContext := api.GetApiContext(req)
+	if err := apiContext.Read(&input); err != nil {
+		return errors.Wrapf(err, "error read snapshotBulkDeleteInput")
+	}
+	if input.OlderThan == "" && len(input.Labels) == 0 {
+		return errors.New("either olderThan or labels required to select snapshots to delete")
+	}
+	var olderThan time.Duration
+	if input.OlderThan != "" {
+		d, err := time.ParseDuration(input.OlderThan)
+		if err != nil || d < 0 {
+			return errors.Errorf("invalid age '%s'", input.OlderThan)
+		}
+		olderThan = d
+	}
+
 	volName := mux.Vars(req)["name"]
 	if volName == "" {
 		return errors.Errorf("volume name required")
@@ -233,11 +435,67 @@ func (sh *SnapshotHandlers) Purge(w http.ResponseWriter, req *http.Request) erro
 	if err != nil {
 		return errors.Wrapf(err, "error getting SnapshotOps for volume '%s'", volName)
 	}
+	snapList, err := snapOps.List()
+	if err != nil {
+		return errors.Wrapf(err, "error listing snapshots, for volume '%+v'", volName)
+	}
 
-	if err := snapOps.Purge(); err != nil {
-		return errors.Wrapf(err, "error purging snapshots, for volume '%+v'", volName)
+	result := &BulkDeleteResult{
+		Resource: client.Resource{
+			Id:   volName,
+			Type: "bulkDeleteResult",
+		},
+		Deleted: []string{},
+		Failed:  []string{},
+	}
+	for _, snap := range selectSnapshotsOlderThan(filterSnapshotsByLabels(snapList, labelSelectorFor(input.Labels)), olderThan, time.Now()) {
+		if err := snapOps.Delete(snap.Name); err != nil {
+			logrus.Errorf("%+v", errors.Wrapf(err, "error deleting snapshot '%s', for volume '%s'", snap.Name, volName))
+			result.Failed = append(result.Failed, snap.Name)
+			continue
+		}
+		result.Deleted = append(result.Deleted, snap.Name)
+	}
+	logrus.Debugf("success: bulk deleted snapshots %v for volume '%s', failed %v", result.Deleted, volName, result.Failed)
+	apiContext.Write(result)
+	return nil
+}
+
+// selectSnapshotsOlderThan returns the snapshots that could be deleted and
+// were created more than age ago
+func selectSnapshotsOlderThan(snapshots []*types.SnapshotInfo, age time.Duration, now time.Time) []*types.SnapshotInfo {
+	r := []*types.SnapshotInfo{}
+	deadline := now.Add(-age)
+	for _, s := range snapshots {
+		if s.Removed || strings.HasPrefix(s.Name, controller.VolumeHeadName) {
+			continue
+		}
+		if age > 0 {
+			created, err := util.ParseTime(s.Created)
+			if err != nil {
+				logrus.Warnf("unable to parse creation time '%s' of snapshot '%s'", s.Created, s.Name)
+				continue
+			}
+			if created.After(deadline) {
+				continue
+			}
+		}
+		r = append(r, s)
 	}
-	logrus.Debugf("success: purge snapshots for volume '%s'", volName)
-	api.GetApiContext(req).Write(&Empty{})
+	return r
+}
+
+func (sh *SnapshotHandlers) Emergency(w http.ResponseWriter, req *http.Request) error {
+	volName := mux.Vars(req)["name"]
+	if volName == "" {
+		return errors.Errorf("volume name required")
+	}
+
+	snap, err := sh.man.TakeEmergencySnapshot(volName)
+	if err != nil {
+		return errors.Wrapf(err, "error taking emergency snapshot, for volume '%s'", volName)
+	}
+	logrus.Debugf("success: took emergency snapshot '%s' for volume '%s'", snap.Name, volName)
+	api.GetApiContext(req).Write(toSnapshotResource(snap))
 	return nil
 }
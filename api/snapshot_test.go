@@ -0,0 +1,42 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/longhorn-manager/types"
+	"github.com/rancher/longhorn-manager/util"
+)
+
+func TestSelectSnapshotsForBulkDelete(t *testing.T) {
+	assert := require.New(t)
+
+	now := time.Now()
+	snapshots := []*types.SnapshotInfo{
+		{Name: "old", Created: util.FormatTimeZ(now.Add(-48 * time.Hour)), Labels: map[string]string{"app": "db"}},
+		{Name: "new", Created: util.FormatTimeZ(now.Add(-time.Hour)), Labels: map[string]string{"app": "db"}},
+		{Name: "other", Created: util.FormatTimeZ(now.Add(-48 * time.Hour)), Labels: map[string]string{"app": "web"}},
+		{Name: "removed", Created: util.FormatTimeZ(now.Add(-48 * time.Hour)), Removed: true},
+		{Name: "volume-head-001.img", Created: util.FormatTimeZ(now.Add(-48 * time.Hour))},
+		{Name: "bad-time", Created: "yesterday"},
+	}
+	names := func(snapshots []*types.SnapshotInfo) []string {
+		r := []string{}
+		for _, s := range snapshots {
+			r = append(r, s.Name)
+		}
+		return r
+	}
+
+	assert.Equal([]string{"old", "other"}, names(selectSnapshotsOlderThan(snapshots, 24*time.Hour, now)))
+	assert.Equal([]string{"old", "new"},
+		names(selectSnapshotsOlderThan(filterSnapshotsByLabels(snapshots, labelSelectorFor(map[string]string{"app": "db"})), 0, now)))
+	assert.Equal([]string{"old"},
+		names(selectSnapshotsOlderThan(filterSnapshotsByLabels(snapshots, labelSelectorFor(map[string]string{"app": "db"})), 24*time.Hour, now)))
+
+	selector, err := parseLabelSelector("app!=db,!missing")
+	assert.Nil(err)
+	assert.Equal([]string{"other", "removed", "volume-head-001.img", "bad-time"}, names(filterSnapshotsByLabels(snapshots, selector)))
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// TraceRequests enables logging the bodies of API requests and responses
+var TraceRequests = false
+
+// TraceBodyLimit is the number of bytes of each body logged
+var TraceBodyLimit = 64 * 1024
+
+// untracedContentTypes are streamed, e.g. volume exports and watches, and
+// their bodies are never logged
+var untracedContentTypes = []string{"application/octet-stream", "text/event-stream"}
+
+type traceResponseWriter struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	truncated bool
+	streamed  string
+}
+
+func (w *traceResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *traceResponseWriter) Write(b []byte) (int, error) {
+	if w.body.Len() == 0 && w.streamed == "" {
+		contentType := w.Header().Get("Content-Type")
+		for _, t := range untracedContentTypes {
+			if strings.HasPrefix(contentType, t) {
+				w.streamed = t
+			}
+		}
+	}
+	if w.streamed == "" && !w.truncated {
+		n := TraceBodyLimit - w.body.Len()
+		if n < len(b) {
+			w.truncated = true
+		} else {
+			n = len(b)
+		}
+		w.body.Write(b[:n])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *traceResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *traceResponseWriter) traced() string {
+	if w.streamed != "" {
+		return "<" + w.streamed + " body not logged>"
+	}
+	return traceBody(w.body.Bytes(), w.truncated)
+}
+
+func traceBody(body []byte, truncated bool) string {
+	if truncated {
+		return string(body) + "...<truncated>"
+	}
+	return string(body)
+}
+
+// traceHandler logs every request and response of h with their bodies, up to
+// TraceBodyLimit bytes
+func traceHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(io.LimitReader(req.Body, int64(TraceBodyLimit)+1))
+		if err != nil {
+			logrus.Warnf("trace: unable to read request body of %v %v: %v", req.Method, req.URL, err)
+		}
+		truncated := len(body) > TraceBodyLimit
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+		if truncated {
+			body = body[:TraceBodyLimit]
+		}
+		logrus.Debugf("trace: request %v %v from %v: %s", req.Method, req.URL, req.RemoteAddr, traceBody(body, truncated))
+
+		tw := &traceResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(tw, req)
+		logrus.Debugf("trace: response %v to %v %v: %s", tw.status, req.Method, req.URL, tw.traced())
+	})
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceHandler(t *testing.T) {
+	assert := require.New(t)
+
+	out := &bytes.Buffer{}
+	defer func(w io.Writer, level logrus.Level) {
+		logrus.SetOutput(w)
+		logrus.SetLevel(level)
+	}(logrus.StandardLogger().Out, logrus.GetLevel())
+	logrus.SetOutput(out)
+	logrus.SetLevel(logrus.DebugLevel)
+
+	h := traceHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		assert.Nil(err)
+		assert.Equal(`{"name":"vol1"}`, string(body))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"vol1"}`))
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/v1/volumes", bytes.NewBufferString(`{"name":"vol1"}`)))
+
+	assert.Equal(http.StatusCreated, w.Code)
+	assert.Equal(`{"id":"vol1"}`, w.Body.String())
+	assert.Contains(out.String(), `trace: request POST /v1/volumes from 192.0.2.1:1234: {\"name\":\"vol1\"}`)
+	assert.Contains(out.String(), `trace: response 201 to POST /v1/volumes: {\"id\":\"vol1\"}`)
+}
+
+func TestTraceHandlerLimits(t *testing.T) {
+	assert := require.New(t)
+
+	out := &bytes.Buffer{}
+	defer func(w io.Writer, level logrus.Level, limit int) {
+		logrus.SetOutput(w)
+		logrus.SetLevel(level)
+		TraceBodyLimit = limit
+	}(logrus.StandardLogger().Out, logrus.GetLevel(), TraceBodyLimit)
+	logrus.SetOutput(out)
+	logrus.SetLevel(logrus.DebugLevel)
+	TraceBodyLimit = 4
+
+	h := traceHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		assert.Nil(err)
+		assert.Equal("0123456789", string(body))
+		w.Write([]byte("abcdef"))
+		w.Write([]byte("ghij"))
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/v1/volumes", bytes.NewBufferString("0123456789")))
+	assert.Equal("abcdefghij", w.Body.String())
+	assert.Contains(out.String(), "trace: request POST /v1/volumes from 192.0.2.1:1234: 0123...<truncated>")
+	assert.Contains(out.String(), "trace: response 200 to POST /v1/volumes: abcd...<truncated>")
+
+	out.Reset()
+	h = traceHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("data"))
+	}))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/v1/volumes/vol1?action=export", nil))
+	assert.Equal("data", w.Body.String())
+	assert.Contains(out.String(), "<application/octet-stream body not logged>")
+	assert.NotContains(out.String(), "data")
+}
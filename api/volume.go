@@ -1,9 +1,17 @@
 package api
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 	"github.com/rancher/go-rancher/api"
@@ -18,18 +26,30 @@ func (s *Server) ListVolume(rw http.ResponseWriter, req *http.Request) error {
 
 	resp := &client.GenericCollection{}
 
+	selector, err := parseLabelSelector(req.URL.Query().Get("labelSelector"))
+	if err != nil {
+		return err
+	}
+
 	volumes, err := s.man.List()
 	if err != nil {
 		return errors.Wrapf(err, "unable to list")
 	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Name < volumes[j].Name })
 
 	for _, v := range volumes {
+		if !selector.Matches(v.Labels) {
+			continue
+		}
 		resp.Data = append(resp.Data, toVolumeResource(v, apiContext))
 	}
 	resp.ResourceType = "volume"
 	resp.CreateTypes = map[string]string{
 		"volume": apiContext.UrlBuilder.Collection("volume"),
 	}
+	if err := paginate(resp, req); err != nil {
+		return err
+	}
 	apiContext.Write(resp)
 
 	return nil
@@ -75,6 +95,63 @@ func (s *Server) UpdateRecurring(rw http.ResponseWriter, req *http.Request) erro
 	return s.GetVolume(rw, req)
 }
 
+func (s *Server) UpdateAutoScale(rw http.ResponseWriter, req *http.Request) error {
+	var input AutoScaleInput
+
+	apiContext := api.GetApiContext(req)
+	if err := apiContext.Read(&input); err != nil {
+		return errors.Wrapf(err, "error read autoScaleInput")
+	}
+
+	id := mux.Vars(req)["name"]
+
+	if err := s.man.UpdateAutoScale(id, input.Enabled, input.ReadIOPSThreshold, input.ScaleDownThreshold, input.MaxReplicas); err != nil {
+		return errors.Wrap(err, "unable to update volume auto-scaling")
+	}
+
+	return s.GetVolume(rw, req)
+}
+
+func (s *Server) UpdateQoS(rw http.ResponseWriter, req *http.Request) error {
+	var input QoSInput
+
+	apiContext := api.GetApiContext(req)
+	if err := apiContext.Read(&input); err != nil {
+		return errors.Wrapf(err, "error read qosInput")
+	}
+
+	id := mux.Vars(req)["name"]
+
+	qos := types.VolumeQoS{
+		ReadIOPSMax:       input.ReadIOPSMax,
+		WriteIOPSMax:      input.WriteIOPSMax,
+		ReadBandwidthMax:  input.ReadBandwidthMax,
+		WriteBandwidthMax: input.WriteBandwidthMax,
+	}
+	if err := s.man.UpdateQoS(id, qos); err != nil {
+		return errors.Wrap(err, "unable to update volume QoS")
+	}
+
+	return s.GetVolume(rw, req)
+}
+
+func (s *Server) UpdateLabels(rw http.ResponseWriter, req *http.Request) error {
+	var input LabelsInput
+
+	apiContext := api.GetApiContext(req)
+	if err := apiContext.Read(&input); err != nil {
+		return errors.Wrapf(err, "error read labelsInput")
+	}
+
+	id := mux.Vars(req)["name"]
+
+	if err := s.man.UpdateLabels(id, input.Labels); err != nil {
+		return errors.Wrap(err, "unable to update volume labels")
+	}
+
+	return s.GetVolume(rw, req)
+}
+
 func (s *Server) BgTaskQueue(rw http.ResponseWriter, req *http.Request) error {
 	apiContext := api.GetApiContext(req)
 	name := mux.Vars(req)["name"]
@@ -88,9 +165,138 @@ func (s *Server) BgTaskQueue(rw http.ResponseWriter, req *http.Request) error {
 	return nil
 }
 
+func (s *Server) CancelBgTask(rw http.ResponseWriter, req *http.Request) error {
+	var input BgTaskCancelInput
+
+	apiContext := api.GetApiContext(req)
+	if err := apiContext.Read(&input); err != nil {
+		return errors.Wrapf(err, "error read bgTaskCancelInput")
+	}
+	name := mux.Vars(req)["name"]
+
+	controller, err := s.man.Controller(name)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get controller for volume '%s'", name)
+	}
+	if controller == nil {
+		return errors.Errorf("volume '%s' is not attached", name)
+	}
+	if err := controller.CancelBgTask(input.Num); err != nil {
+		return errors.Wrapf(err, "unable to cancel bgTask %v of volume '%s'", input.Num, name)
+	}
+
+	apiContext.Write(toBgTaskCollection(append(controller.LatestBgTasks(), controller.BgTaskQueue().List()...)))
+	return nil
+}
+
+func (s *Server) VolumeInfo(rw http.ResponseWriter, req *http.Request) error {
+	apiContext := api.GetApiContext(req)
+	name := mux.Vars(req)["name"]
+
+	controller, err := s.man.Controller(name)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get controller for volume '%s'", name)
+	}
+	if controller == nil {
+		return errors.Errorf("volume '%s' is not attached", name)
+	}
+	info, err := controller.Info()
+	if err != nil {
+		return errors.Wrapf(err, "unable to get controller info for volume '%s'", name)
+	}
+
+	apiContext.Write(toVolumeControllerInfoResource(info))
+	return nil
+}
+
+func (s *Server) VolumeIOStats(rw http.ResponseWriter, req *http.Request) error {
+	apiContext := api.GetApiContext(req)
+	name := mux.Vars(req)["name"]
+
+	controller, err := s.man.Controller(name)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get controller for volume '%s'", name)
+	}
+	if controller == nil {
+		return errors.Errorf("volume '%s' is not attached", name)
+	}
+	stats, err := controller.IOStats()
+	if err != nil {
+		return errors.Wrapf(err, "unable to get I/O stats for volume '%s'", name)
+	}
+
+	apiContext.Write(toVolumeIOStatsResource(name, stats))
+	return nil
+}
+
+func (s *Server) ReplicaRebuildStatus(rw http.ResponseWriter, req *http.Request) error {
+	apiContext := api.GetApiContext(req)
+	name := mux.Vars(req)["name"]
+
+	statuses, err := s.man.RebuildStatus(name)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get rebuild status of volume '%s'", name)
+	}
+	apiContext.Write(toRebuildStatusCollection(statuses))
+	return nil
+}
+
+// ExportVolume streams the raw data of the volume, Content-Length lets the
+// client track the progress
+func (s *Server) ExportVolume(rw http.ResponseWriter, req *http.Request) error {
+	name := mux.Vars(req)["name"]
+
+	data, size, err := s.man.Export(name)
+	if err != nil {
+		return errors.Wrapf(err, "unable to export volume '%s'", name)
+	}
+	defer data.Close()
+
+	rw.Header().Set("Content-Type", "application/octet-stream")
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".img"))
+	rw.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	rw.WriteHeader(http.StatusOK)
+	if _, err := io.CopyN(rw, data, size); err != nil {
+		// too late to respond with the error
+		logrus.Errorf("%+v", errors.Wrapf(err, "failed to export volume '%s'", name))
+	}
+	return nil
+}
+
+func (s *Server) ListReplicas(rw http.ResponseWriter, req *http.Request) error {
+	apiContext := api.GetApiContext(req)
+	name := mux.Vars(req)["name"]
+
+	replicas, err := s.man.ReplicaStates(name)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get replicas of volume '%s'", name)
+	}
+
+	apiContext.Write(toVolumeReplicaCollection(name, replicas))
+	return nil
+}
+
 func (s *Server) DeleteVolume(rw http.ResponseWriter, req *http.Request) error {
 	id := mux.Vars(req)["name"]
 
+	isDryRun, err := dryRun(req)
+	if err != nil {
+		return err
+	}
+	if isDryRun {
+		v, err := s.man.Get(id)
+		if err != nil {
+			return errors.Wrap(err, "unable to get volume")
+		}
+		if v == nil {
+			return errors.Errorf("cannot find volume '%s'", id)
+		}
+		v.DryRun = true
+		apiContext := api.GetApiContext(req)
+		apiContext.Write(toVolumeResource(v, apiContext))
+		return nil
+	}
+
 	if err := s.man.Delete(id); err != nil {
 		return errors.Wrap(err, "unable to delete volume")
 	}
@@ -98,6 +304,20 @@ func (s *Server) DeleteVolume(rw http.ResponseWriter, req *http.Request) error {
 	return nil
 }
 
+// dryRun reads the dryRun query parameter: the volume is only validated and
+// returned as it would be created or deleted
+func dryRun(req *http.Request) (bool, error) {
+	v := req.URL.Query().Get("dryRun")
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errors.Errorf("invalid dryRun '%s'", v)
+	}
+	return b, nil
+}
+
 func (s *Server) CreateVolume(rw http.ResponseWriter, req *http.Request) error {
 	var v Volume
 	apiContext := api.GetApiContext(req)
@@ -110,6 +330,9 @@ func (s *Server) CreateVolume(rw http.ResponseWriter, req *http.Request) error {
 	if err != nil {
 		return errors.Wrap(err, "unable to filter create volume input")
 	}
+	if volume.DryRun, err = dryRun(req); err != nil {
+		return err
+	}
 
 	volumeResp, err := s.man.Create(volume)
 	if err != nil {
@@ -119,6 +342,95 @@ func (s *Server) CreateVolume(rw http.ResponseWriter, req *http.Request) error {
 	return nil
 }
 
+// BulkCreateWorkers limits how many volumes of a bulk request are created
+// at once
+var BulkCreateWorkers = 4
+
+// BulkCreateVolumes creates every volume of the request independently, the
+// result lists the volumes created and the ones failed
+func (s *Server) BulkCreateVolumes(rw http.ResponseWriter, req *http.Request) error {
+	var input BulkCreateInput
+	apiContext := api.GetApiContext(req)
+
+	if err := apiContext.Read(&input); err != nil {
+		return errors.Wrapf(err, "error read bulkCreateInput")
+	}
+	if len(input.Volumes) == 0 {
+		return errors.New("no volumes to create")
+	}
+	isDryRun, err := dryRun(req)
+	if err != nil {
+		return err
+	}
+
+	created, failed := bulkCreate(input.Volumes, func(v *Volume) (*types.VolumeInfo, error) {
+		volume, err := filterCreateVolumeInput(v)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to filter create volume input")
+		}
+		volume.DryRun = isDryRun
+		return s.man.Create(volume)
+	})
+
+	result := &BulkCreateResult{
+		Resource: client.Resource{
+			Type: "bulkCreateResult",
+		},
+		Created: []*Volume{},
+		Failed:  failed,
+	}
+	for _, volume := range created {
+		result.Created = append(result.Created, toVolumeResource(volume, apiContext))
+	}
+	apiContext.Write(result)
+	return nil
+}
+
+// bulkCreate runs create for the volumes with up to BulkCreateWorkers at
+// once, the results are in the order of the volumes
+func bulkCreate(volumes []*Volume, create func(v *Volume) (*types.VolumeInfo, error)) ([]*types.VolumeInfo, []BulkCreateError) {
+	results := make([]*types.VolumeInfo, len(volumes))
+	errs := make([]error, len(volumes))
+
+	sem := make(chan struct{}, BulkCreateWorkers)
+	wg := &sync.WaitGroup{}
+	for i, v := range volumes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, v *Volume) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i], errs[i] = create(v)
+		}(i, v)
+	}
+	wg.Wait()
+
+	created := []*types.VolumeInfo{}
+	failed := []BulkCreateError{}
+	for i, v := range volumes {
+		if errs[i] != nil {
+			logrus.Errorf("%+v", errors.Wrapf(errs[i], "unable to create volume '%s'", v.Name))
+			failed = append(failed, BulkCreateError{Name: v.Name, Error: errs[i].Error()})
+			continue
+		}
+		created = append(created, results[i])
+	}
+	return created, failed
+}
+
+// bulkCreateVolumeNames is the audit resource ID of a bulk volume creation
+func bulkCreateVolumeNames(req *http.Request) string {
+	var input BulkCreateInput
+	json.NewDecoder(util.CopyReq(req).Body).Decode(&input)
+	names := []string{}
+	for _, v := range input.Volumes {
+		if v != nil {
+			names = append(names, v.Name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
 func filterCreateVolumeInput(v *Volume) (*types.VolumeInfo, error) {
 	size, err := util.ConvertSize(v.Size)
 	if err != nil {
@@ -129,15 +441,37 @@ func filterCreateVolumeInput(v *Volume) (*types.VolumeInfo, error) {
 		Size:                util.RoundUpSize(size),
 		BaseImage:           v.BaseImage,
 		FromBackup:          v.FromBackup,
+		FromSnapshot:        v.FromSnapshot,
+		FromVolume:          v.FromVolume,
+		SourcePVC:           v.SourcePVC,
+		AccessMode:          types.AccessMode(v.AccessMode),
+		DataLocality:        types.DataLocality(v.DataLocality),
+		FsType:              v.FsType,
+		MountOptions:        v.MountOptions,
 		NumberOfReplicas:    v.NumberOfReplicas,
 		StaleReplicaTimeout: time.Duration(v.StaleReplicaTimeout) * time.Minute,
+		MaxSnapshots:        v.MaxSnapshots,
+		Labels:              v.Labels,
+		VolumeQoS: types.VolumeQoS{
+			ReadIOPSMax:       v.ReadIOPSMax,
+			WriteIOPSMax:      v.WriteIOPSMax,
+			ReadBandwidthMax:  v.ReadBandwidthMax,
+			WriteBandwidthMax: v.WriteBandwidthMax,
+		},
 	}, nil
 }
 
 func (s *Server) AttachVolume(rw http.ResponseWriter, req *http.Request) error {
+	var input AttachInput
+
+	apiContext := api.GetApiContext(req)
+	if err := apiContext.Read(&input); err != nil {
+		return errors.Wrapf(err, "error read attachInput")
+	}
+
 	id := mux.Vars(req)["name"]
 
-	if err := s.man.Attach(id); err != nil {
+	if err := s.man.Attach(id, input.HostID); err != nil {
 		return errors.Wrap(err, "unable to attach volume")
 	}
 
@@ -154,6 +488,99 @@ func (s *Server) DetachVolume(rw http.ResponseWriter, req *http.Request) error {
 	return s.GetVolume(rw, req)
 }
 
+func (s *Server) MigrateVolume(rw http.ResponseWriter, req *http.Request) error {
+	var input MigrateInput
+
+	apiContext := api.GetApiContext(req)
+	if err := apiContext.Read(&input); err != nil {
+		return errors.Wrapf(err, "error read migrateInput")
+	}
+
+	id := mux.Vars(req)["name"]
+
+	if err := s.man.Migrate(id, input.HostID); err != nil {
+		return errors.Wrap(err, "unable to migrate volume")
+	}
+
+	return s.GetVolume(rw, req)
+}
+
+func (s *Server) RestoreVolume(rw http.ResponseWriter, req *http.Request) error {
+	var input BackupRestoreInput
+
+	apiContext := api.GetApiContext(req)
+	if err := apiContext.Read(&input); err != nil {
+		return errors.Wrapf(err, "error read backupRestoreInput")
+	}
+	if input.BackupURL == "" {
+		return errors.New("backupUrl required")
+	}
+
+	id := mux.Vars(req)["name"]
+
+	if err := s.man.RestoreFromBackup(id, input.BackupURL); err != nil {
+		return errors.Wrap(err, "unable to restore volume from backup")
+	}
+
+	return s.GetVolume(rw, req)
+}
+
+func (s *Server) CreateController(rw http.ResponseWriter, req *http.Request) error {
+	var input ControllerCreateInput
+
+	apiContext := api.GetApiContext(req)
+	if err := apiContext.Read(&input); err != nil {
+		return errors.Wrapf(err, "error read controllerCreateInput")
+	}
+
+	id := mux.Vars(req)["name"]
+
+	volume, err := s.man.Get(id)
+	if err != nil {
+		return errors.Wrap(err, "unable to get volume")
+	}
+	if volume == nil {
+		return errors.Errorf("cannot find volume %v", id)
+	}
+	replicas := map[string]*types.ReplicaInfo{}
+	for _, name := range input.Replicas {
+		if volume.Replicas[name] == nil {
+			return errors.Errorf("cannot find replica %v of volume %v", name, id)
+		}
+		replicas[name] = volume.Replicas[name]
+	}
+	if len(input.Replicas) == 0 {
+		for name, replica := range volume.Replicas {
+			if replica.BadTimestamp == "" {
+				replicas[name] = replica
+			}
+		}
+	}
+
+	if _, err := s.man.CreateController(id, replicas); err != nil {
+		return errors.Wrap(err, "unable to create controller")
+	}
+
+	return s.GetVolume(rw, req)
+}
+
+func (s *Server) ReplicaAdd(rw http.ResponseWriter, req *http.Request) error {
+	var input ReplicaAddInput
+
+	apiContext := api.GetApiContext(req)
+	if err := apiContext.Read(&input); err != nil {
+		return errors.Wrapf(err, "error read replicaAddInput")
+	}
+
+	id := mux.Vars(req)["name"]
+
+	if err := s.man.ReplicaAdd(id, input.HostID); err != nil {
+		return errors.Wrap(err, "unable to add replica")
+	}
+
+	return s.GetVolume(rw, req)
+}
+
 func (s *Server) ReplicaRemove(rw http.ResponseWriter, req *http.Request) error {
 	var input ReplicaRemoveInput
 
@@ -170,3 +597,118 @@ func (s *Server) ReplicaRemove(rw http.ResponseWriter, req *http.Request) error
 
 	return s.GetVolume(rw, req)
 }
+
+func parseReplicaMode(mode string) (types.ReplicaMode, error) {
+	switch types.ReplicaMode(mode) {
+	case types.ReplicaModeRW, types.ReplicaModeWO:
+		return types.ReplicaMode(mode), nil
+	}
+	return "", errors.Errorf("invalid replica mode '%s', should be %v or %v", mode, types.ReplicaModeRW, types.ReplicaModeWO)
+}
+
+func (s *Server) ReplicaModeUpdate(rw http.ResponseWriter, req *http.Request) error {
+	var input ReplicaModeInput
+
+	apiContext := api.GetApiContext(req)
+	if err := apiContext.Read(&input); err != nil {
+		return errors.Wrapf(err, "error read replicaModeInput")
+	}
+	mode, err := parseReplicaMode(input.Mode)
+	if err != nil {
+		return err
+	}
+
+	id := mux.Vars(req)["name"]
+
+	if err := s.man.SetReplicaMode(id, input.Name, mode); err != nil {
+		return errors.Wrap(err, "unable to update replica mode")
+	}
+
+	return s.GetVolume(rw, req)
+}
+
+func (s *Server) UpdateReplica(rw http.ResponseWriter, req *http.Request) error {
+	var input ReplicaModeInput
+
+	apiContext := api.GetApiContext(req)
+	if err := apiContext.Read(&input); err != nil {
+		return errors.Wrapf(err, "error read replicaModeInput")
+	}
+	mode, err := parseReplicaMode(input.Mode)
+	if err != nil {
+		return err
+	}
+
+	name, replicaName := mux.Vars(req)["name"], mux.Vars(req)["replicaName"]
+
+	if err := s.man.SetReplicaMode(name, replicaName, mode); err != nil {
+		return errors.Wrap(err, "unable to update replica mode")
+	}
+	replicas, err := s.man.ReplicaStates(name)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get replicas of volume '%s'", name)
+	}
+	for _, r := range replicas {
+		if r.Name == replicaName {
+			apiContext.Write(toVolumeReplicaResource(name, r))
+			return nil
+		}
+	}
+	return errors.Errorf("cannot find replica %v of volume %v", replicaName, name)
+}
+
+func (s *Server) ReplicaPin(rw http.ResponseWriter, req *http.Request) error {
+	var input ReplicaPinInput
+
+	apiContext := api.GetApiContext(req)
+	if err := apiContext.Read(&input); err != nil {
+		return errors.Wrapf(err, "error read replicaPinInput")
+	}
+
+	id := mux.Vars(req)["name"]
+	// POST /v1/volumes/{name}/replicas/{replicaName}/pin
+	if replicaName := mux.Vars(req)["replicaName"]; replicaName != "" {
+		input.Name = replicaName
+	}
+
+	if err := s.man.PinReplicaToHost(id, input.Name, input.HostID); err != nil {
+		return errors.Wrap(err, "unable to pin replica")
+	}
+
+	return s.GetVolume(rw, req)
+}
+
+func (s *Server) GetSnapshotSchedule(rw http.ResponseWriter, req *http.Request) error {
+	apiContext := api.GetApiContext(req)
+	name := mux.Vars(req)["name"]
+
+	next := 0
+	if v := req.URL.Query().Get("next"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.Wrapf(err, "invalid number of recurring job runs '%s'", v)
+		}
+		next = n
+	}
+	runs, err := s.man.SnapshotSchedule(name, next)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get snapshot schedule for volume '%s'", name)
+	}
+	apiContext.Write(toSnapshotScheduleResource(name, runs))
+	return nil
+}
+
+func (s *Server) GetMonitorStatus(rw http.ResponseWriter, req *http.Request) error {
+	apiContext := api.GetApiContext(req)
+	name := mux.Vars(req)["name"]
+
+	status, err := s.man.MonitorStatus(name)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get monitor status for volume '%s'", name)
+	}
+	if status == nil {
+		return errors.Errorf("volume '%s' isn't monitored, it must be attached", name)
+	}
+	apiContext.Write(toMonitorStatusResource(name, status))
+	return nil
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+func TestBulkCreate(t *testing.T) {
+	assert := require.New(t)
+
+	volumes := []*Volume{}
+	for _, name := range []string{"vol1", "vol2", "bad", "vol3", "vol4", "vol5"} {
+		volumes = append(volumes, &Volume{Name: name})
+	}
+
+	var (
+		lock             sync.Mutex
+		running, maxSeen int
+	)
+	created, failed := bulkCreate(volumes, func(v *Volume) (*types.VolumeInfo, error) {
+		lock.Lock()
+		running++
+		if running > maxSeen {
+			maxSeen = running
+		}
+		lock.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		lock.Lock()
+		running--
+		lock.Unlock()
+
+		if v.Name == "bad" {
+			return nil, errors.New("invalid volume")
+		}
+		return &types.VolumeInfo{Name: v.Name}, nil
+	})
+
+	names := []string{}
+	for _, v := range created {
+		names = append(names, v.Name)
+	}
+	assert.Equal([]string{"vol1", "vol2", "vol3", "vol4", "vol5"}, names)
+	assert.Equal([]BulkCreateError{{Name: "bad", Error: "invalid volume"}}, failed)
+	assert.True(maxSeen > 1)
+	assert.True(maxSeen <= BulkCreateWorkers)
+}
+
+type fakePinManager struct {
+	types.VolumeManager
+	pinned map[string]string
+}
+
+func (m *fakePinManager) Get(name string) (*types.VolumeInfo, error) {
+	return &types.VolumeInfo{Name: name}, nil
+}
+
+func (m *fakePinManager) PinReplicaToHost(volumeName, replicaName, hostID string) error {
+	m.pinned[volumeName+"/"+replicaName] = hostID
+	return nil
+}
+
+func TestReplicaPinRoute(t *testing.T) {
+	assert := require.New(t)
+
+	man := &fakePinManager{pinned: map[string]string{}}
+	sl := &fakeServiceLocator{}
+	h := Handler(&Server{man: man, sl: sl, fwd: &Fwd{sl, nil}})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/v1/volumes/vol1/replicas/r1/pin", strings.NewReader(`{"hostId":"host-1"}`)))
+	assert.Equal(http.StatusOK, w.Code, w.Body.String())
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/v1/volumes/vol1?action=replicaPin", strings.NewReader(`{"name":"r2","hostId":"host-1"}`)))
+	assert.Equal(http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(map[string]string{"vol1/r1": "host-1", "vol1/r2": "host-1"}, man.pinned)
+}
+
+type fakeControllerManager struct {
+	fakePinManager
+	created []string
+}
+
+func (m *fakeControllerManager) CreateController(volumeName string, replicas map[string]*types.ReplicaInfo) (*types.ControllerInfo, error) {
+	m.created = append(m.created, volumeName)
+	return &types.ControllerInfo{}, nil
+}
+
+func TestControllerCreateRoute(t *testing.T) {
+	assert := require.New(t)
+
+	man := &fakeControllerManager{}
+	sl := &fakeServiceLocator{}
+	h := Handler(&Server{man: man, sl: sl, fwd: &Fwd{sl, nil}})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/v1/volumes/vol1/controller", strings.NewReader(`{}`)))
+	assert.Equal(http.StatusOK, w.Code, w.Body.String())
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/v1/volumes/vol1?action=controllerCreate", strings.NewReader(`{}`)))
+	assert.Equal(http.StatusOK, w.Code, w.Body.String())
+	assert.Equal([]string{"vol1", "vol1"}, man.created)
+}
+
+func (m *fakePinManager) Controller(name string) (types.Controller, error) {
+	return nil, nil
+}
+
+func TestVolumeControllerDetached(t *testing.T) {
+	assert := require.New(t)
+
+	sl := &fakeServiceLocator{}
+	h := Handler(&Server{man: &fakePinManager{}, sl: sl, fwd: &Fwd{sl, nil}})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/v1/volumes/vol1?action=volumeInfo", nil))
+	assert.Equal(http.StatusInternalServerError, w.Code)
+	assert.Contains(w.Body.String(), "volume 'vol1' is not attached")
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/v1/volumes/vol1?action=volumeIOStats", nil))
+	assert.Equal(http.StatusInternalServerError, w.Code)
+	assert.Contains(w.Body.String(), "volume 'vol1' is not attached")
+}
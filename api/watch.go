@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/rancher/go-rancher/api"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+// WatchPeriod is how often a watched volume is checked for changes on top of
+// the notifications of the volume manager, which only knows of the changes
+// made by this host
+var WatchPeriod = 5 * time.Second
+
+type volumeWatchState struct {
+	state    types.VolumeState
+	replicas int
+	endpoint string
+}
+
+func watchStateOf(v *types.VolumeInfo) volumeWatchState {
+	return volumeWatchState{state: v.State, replicas: len(v.Replicas), endpoint: v.Endpoint}
+}
+
+// WatchVolume streams the volume as Server-Sent Events whenever its state,
+// number of replicas or endpoint changes, and a "deleted" event at the end
+// if the volume is deleted
+func (s *Server) WatchVolume(w http.ResponseWriter, req *http.Request) error {
+	apiContext := api.GetApiContext(req)
+	name := mux.Vars(req)["name"]
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("streaming responses not supported")
+	}
+
+	changes, stop := s.man.Watch(name)
+	defer stop()
+
+	v, err := s.man.Get(name)
+	if err != nil {
+		return errors.Wrap(err, "unable to get volume")
+	}
+	if v == nil {
+		w.WriteHeader(http.StatusNotFound)
+		apiContext.Write(&Empty{})
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(WatchPeriod)
+	defer ticker.Stop()
+	var last *volumeWatchState
+	for {
+		if v == nil {
+			writeEvent(w, "deleted", map[string]string{"name": name})
+			flusher.Flush()
+			return nil
+		}
+		if state := watchStateOf(v); last == nil || state != *last {
+			if err := writeEvent(w, "volume", toVolumeResource(v, apiContext)); err != nil {
+				logrus.Warnf("%v", errors.Wrapf(err, "stopped watching volume '%s'", name))
+				return nil
+			}
+			flusher.Flush()
+			last = &state
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil
+		case <-changes:
+		case <-ticker.C:
+		}
+		current, err := s.man.Get(name)
+		if err != nil {
+			logrus.Warnf("%v", errors.Wrapf(err, "unable to get watched volume '%s'", name))
+			continue
+		}
+		v = current
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrapf(err, "cannot encode %s event", event)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
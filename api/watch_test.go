@@ -0,0 +1,102 @@
+package api
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+type fakeWatchManager struct {
+	types.VolumeManager
+
+	sync.Mutex
+	volume  *types.VolumeInfo
+	changes chan struct{}
+}
+
+func (m *fakeWatchManager) Get(name string) (*types.VolumeInfo, error) {
+	m.Lock()
+	defer m.Unlock()
+	if m.volume == nil {
+		return nil, nil
+	}
+	v := *m.volume
+	return &v, nil
+}
+
+func (m *fakeWatchManager) Watch(volumeName string) (<-chan struct{}, func()) {
+	return m.changes, func() {}
+}
+
+func (m *fakeWatchManager) update(f func(v *types.VolumeInfo)) {
+	m.Lock()
+	if f == nil {
+		m.volume = nil
+	} else {
+		f(m.volume)
+	}
+	m.Unlock()
+	m.changes <- struct{}{}
+}
+
+func TestWatchVolume(t *testing.T) {
+	assert := require.New(t)
+
+	man := &fakeWatchManager{
+		volume:  &types.VolumeInfo{Name: "vol1", State: types.VolumeStateDetached},
+		changes: make(chan struct{}),
+	}
+	s := &Server{man: man}
+	r := mux.NewRouter()
+	r.Methods("GET").Path("/v1/volumes/{name}/watch").Handler(HandleError(NewSchema(), s.WatchVolume))
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/v1/volumes/vol1/watch")
+	assert.Nil(err)
+	defer resp.Body.Close()
+	assert.Equal("text/event-stream", resp.Header.Get("Content-Type"))
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				lines <- line
+			}
+		}
+		close(lines)
+	}()
+	next := func() string {
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(5 * time.Second):
+			return "timeout"
+		}
+	}
+
+	assert.Equal("event: volume", next())
+	assert.Contains(next(), `"state":"detached"`)
+
+	// no event without a change
+	man.update(func(v *types.VolumeInfo) { v.Size = 1 })
+	man.update(func(v *types.VolumeInfo) { v.State = types.VolumeStateHealthy })
+	assert.Equal("event: volume", next())
+	assert.Contains(next(), `"state":"healthy"`)
+
+	man.update(nil)
+	assert.Equal("event: deleted", next())
+	assert.True(strings.Contains(next(), `"name":"vol1"`))
+	_, ok := <-lines
+	assert.False(ok)
+}
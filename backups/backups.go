@@ -8,10 +8,21 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rancher/longhorn-manager/types"
 	"io"
+	"os"
 	"os/exec"
 	"strings"
 )
 
+const (
+	s3Scheme = "s3://"
+	// S3EndpointEnv points the longhorn CLI to an S3 compatible server
+	S3EndpointEnv = "AWS_ENDPOINTS"
+)
+
+// S3Endpoint returns the endpoint URL of S3 compatible backup targets, empty
+// to use AWS
+var S3Endpoint = func() string { return "" }
+
 type backups struct {
 	BackupTarget string
 }
@@ -26,9 +37,26 @@ type backupVolume struct {
 }
 
 func New(backupTarget string) types.ManagerBackupOps {
+	if isNFSTarget(backupTarget) {
+		return &nfsBackups{strings.TrimSuffix(backupTarget, "/")}
+	}
 	return &backups{backupTarget}
 }
 
+func isS3Target(backupTarget string) bool {
+	return strings.HasPrefix(backupTarget, s3Scheme)
+}
+
+func (b *backups) command(args ...string) *exec.Cmd {
+	cmd := exec.Command("longhorn", args...)
+	if isS3Target(b.BackupTarget) {
+		if endpoint := S3Endpoint(); endpoint != "" {
+			cmd.Env = append(os.Environ(), S3EndpointEnv+"="+endpoint)
+		}
+	}
+	return cmd
+}
+
 func parseBackup(v interface{}) (*types.BackupInfo, error) {
 	backup := new(types.BackupInfo)
 	if err := mapstructure.Decode(v, backup); err != nil {
@@ -77,9 +105,10 @@ func parseBackupVolumesList(stdout io.Reader) ([]*types.BackupVolumeInfo, error)
 
 	for name, v := range data {
 		volumes = append(volumes, &types.BackupVolumeInfo{
-			Name:    name,
-			Size:    v.Size,
-			Created: v.Created,
+			Name:        name,
+			Size:        v.Size,
+			Created:     v.Created,
+			BackupCount: len(v.Backups),
 		})
 	}
 
@@ -100,7 +129,8 @@ func parseOneBackup(stdout io.Reader) (*types.BackupInfo, error) {
 }
 
 func (b *backups) ListVolumes() ([]*types.BackupVolumeInfo, error) {
-	cmd := exec.Command("longhorn", "backup", "ls", "--volume-only", b.BackupTarget)
+	// without --volume-only, so the backups are listed to be counted
+	cmd := b.command("backup", "ls", b.BackupTarget)
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return nil, errors.Wrapf(err, "error getting stdout from cmd '%v'", cmd)
@@ -117,7 +147,7 @@ func (b *backups) ListVolumes() ([]*types.BackupVolumeInfo, error) {
 }
 
 func (b *backups) GetVolume(volumeName string) (*types.BackupVolumeInfo, error) {
-	cmd := exec.Command("longhorn", "backup", "ls", "--volume", volumeName, "--volume-only", b.BackupTarget)
+	cmd := b.command("backup", "ls", "--volume", volumeName, b.BackupTarget)
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return nil, errors.Wrapf(err, "error getting stdout from cmd '%v'", cmd)
@@ -141,7 +171,7 @@ func (b *backups) List(volumeName string) ([]*types.BackupInfo, error) {
 	if volumeName == "" {
 		return nil, nil
 	}
-	cmd := exec.Command("longhorn", "backup", "ls", "--volume", volumeName, b.BackupTarget)
+	cmd := b.command("backup", "ls", "--volume", volumeName, b.BackupTarget)
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return nil, errors.Wrapf(err, "error getting stdout from cmd '%v'", cmd)
@@ -158,7 +188,7 @@ func (b *backups) List(volumeName string) ([]*types.BackupInfo, error) {
 }
 
 func (b *backups) Get(url string) (*types.BackupInfo, error) {
-	cmd := exec.Command("longhorn", "backup", "inspect", url)
+	cmd := b.command("backup", "inspect", url)
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return nil, errors.Wrapf(err, "error getting stdout from cmd '%v'", cmd)
@@ -174,8 +204,14 @@ func (b *backups) Get(url string) (*types.BackupInfo, error) {
 	return parseOneBackup(stdout)
 }
 
+// DeleteVolume deletes all backups of the volume, the backup target removes
+// the volume along with its last backup
+func (b *backups) DeleteVolume(volumeName string) error {
+	return deleteVolume(b, volumeName)
+}
+
 func (b *backups) Delete(url string) error {
-	cmd := exec.Command("longhorn", "backup", "rm", url)
+	cmd := b.command("backup", "rm", url)
 	errBuff := new(bytes.Buffer)
 	cmd.Stderr = errBuff
 	out, err := cmd.Output()
@@ -103,3 +103,35 @@ func TestParseBackupsList2(t *testing.T) {
 	assert.Nil(err)
 	assert.Nil(bs)
 }
+
+func TestParseBackupVolumesList(t *testing.T) {
+	assert := require.New(t)
+
+	stdout := bytes.NewBufferString(backupsListText)
+	volumes, err := parseBackupVolumesList(stdout)
+	assert.Nil(err)
+	assert.Equal([]*types.BackupVolumeInfo{{
+		Name:        "qq",
+		Size:        "10737418240",
+		Created:     "2017-03-25T02:25:53Z",
+		BackupCount: 2,
+	}}, volumes)
+}
+
+func TestS3Endpoint(t *testing.T) {
+	assert := require.New(t)
+
+	defer func(f func() string) { S3Endpoint = f }(S3Endpoint)
+	S3Endpoint = func() string { return "http://minio.example.com:9000" }
+
+	cmd := (&backups{"s3://backups@us-east-1/longhorn"}).command("backup", "ls")
+	assert.Contains(cmd.Env, S3EndpointEnv+"=http://minio.example.com:9000")
+	assert.Equal([]string{"longhorn", "backup", "ls"}, cmd.Args)
+
+	cmd = (&backups{"vfs:///var/lib/longhorn/backups"}).command("backup", "ls")
+	assert.Nil(cmd.Env)
+
+	S3Endpoint = func() string { return "" }
+	cmd = (&backups{"s3://backups@us-east-1/longhorn"}).command("backup", "ls")
+	assert.Nil(cmd.Env)
+}
@@ -0,0 +1,51 @@
+package backups
+
+import (
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+// DeleteWorkers limits how many backups of a volume are deleted at once
+var DeleteWorkers = 4
+
+func deleteVolume(ops types.ManagerBackupOps, volumeName string) error {
+	list, err := ops.List(volumeName)
+	if err != nil {
+		return errors.Wrapf(err, "error listing backups of volume '%s'", volumeName)
+	}
+
+	var (
+		lock   sync.Mutex
+		failed []error
+	)
+	sem := make(chan struct{}, DeleteWorkers)
+	wg := &sync.WaitGroup{}
+	for _, backup := range list {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(url string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := ops.Delete(url); err != nil {
+				lock.Lock()
+				failed = append(failed, errors.Wrapf(err, "error deleting backup '%s'", url))
+				lock.Unlock()
+				return
+			}
+			logrus.Debugf("deleted backup '%s'", url)
+		}(backup.URL)
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		for _, err := range failed[1:] {
+			logrus.Errorf("%+v", err)
+		}
+		return errors.Wrapf(failed[0], "failed to delete %v of %v backups of volume '%s'", len(failed), len(list), volumeName)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package backups
+
+import (
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+type deletingBackupOps struct {
+	fakeBackupOps
+
+	lock    sync.Mutex
+	deleted []string
+	fail    map[string]bool
+}
+
+func (f *deletingBackupOps) Delete(url string) error {
+	if f.fail[url] {
+		return errors.Errorf("cannot delete backup '%s'", url)
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.deleted = append(f.deleted, url)
+	return nil
+}
+
+func TestDeleteVolume(t *testing.T) {
+	assert := require.New(t)
+
+	f := &deletingBackupOps{fakeBackupOps: fakeBackupOps{list: map[string][]*types.BackupInfo{
+		"vol1": {{URL: "vfs:///backups?backup=b1&volume=vol1"}, {URL: "vfs:///backups?backup=b2&volume=vol1"}},
+		"vol2": {{URL: "vfs:///backups?backup=b3&volume=vol2"}},
+	}}}
+	assert.Nil(deleteVolume(f, "vol1"))
+	sort.Strings(f.deleted)
+	assert.Equal([]string{"vfs:///backups?backup=b1&volume=vol1", "vfs:///backups?backup=b2&volume=vol1"}, f.deleted)
+
+	assert.Nil(deleteVolume(f, "nonexistent"))
+
+	f.deleted = nil
+	f.fail = map[string]bool{"vfs:///backups?backup=b3&volume=vol2": true}
+	assert.NotNil(deleteVolume(f, "vol2"))
+	assert.Len(f.deleted, 0)
+}
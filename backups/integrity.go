@@ -0,0 +1,94 @@
+package backups
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+// VerifyIntegrity checks every backup on the backup target.
+func VerifyIntegrity(target string) (*types.BackupIntegrityReport, error) {
+	return CheckIntegrity(New(target))
+}
+
+// CheckIntegrity checks the backups of the specified volumes (all backup
+// volumes if none specified). On vfs and nfs backup targets the backupstore
+// is read directly, see checkStoreIntegrity. On other targets each backup's
+// metadata is compared with its entry in the volume backup list, backups
+// which cannot be inspected or don't match their list entry are reported as
+// corrupted.
+func CheckIntegrity(ops types.ManagerBackupOps, volumeNames ...string) (*types.BackupIntegrityReport, error) {
+	switch b := ops.(type) {
+	case *nfsBackups:
+		var report *types.BackupIntegrityReport
+		err := b.withMount(func(local *backups, mountPoint string) error {
+			var err error
+			report, err = checkStoreIntegrity(b.target, mountPoint, volumeNames)
+			return err
+		})
+		return report, err
+	case *backups:
+		if strings.HasPrefix(b.BackupTarget, vfsScheme) {
+			target := strings.TrimSuffix(b.BackupTarget, "/")
+			return checkStoreIntegrity(target, strings.TrimPrefix(target, vfsScheme), volumeNames)
+		}
+	}
+
+	if len(volumeNames) == 0 {
+		volumes, err := ops.ListVolumes()
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to list backup volumes")
+		}
+		for _, volume := range volumes {
+			volumeNames = append(volumeNames, volume.Name)
+		}
+	}
+	sort.Strings(volumeNames)
+
+	report := &types.BackupIntegrityReport{
+		CorruptedBackups: []string{},
+		MissingBlocks:    []string{},
+		OrphanedBlocks:   []string{},
+	}
+	for _, volumeName := range volumeNames {
+		backups, err := ops.List(volumeName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to list backups of volume '%s'", volumeName)
+		}
+		sort.Slice(backups, func(i, j int) bool {
+			return backups[i].URL < backups[j].URL
+		})
+		report.Volumes++
+		for _, backup := range backups {
+			report.CheckedBackups++
+			if err := checkBackup(ops, backup); err != nil {
+				logrus.Warnf("backup integrity: %v", err)
+				report.CorruptedBackups = append(report.CorruptedBackups, backup.URL)
+			}
+		}
+	}
+	return report, nil
+}
+
+func checkBackup(ops types.ManagerBackupOps, expected *types.BackupInfo) error {
+	backup, err := ops.Get(expected.URL)
+	if err != nil {
+		return errors.Wrapf(err, "fail to inspect backup '%s'", expected.URL)
+	}
+	if backup == nil {
+		return errors.Errorf("cannot find backup '%s'", expected.URL)
+	}
+	if backup.Name != expected.Name || backup.VolumeName != expected.VolumeName ||
+		backup.SnapshotName != expected.SnapshotName || backup.Size != expected.Size {
+		return errors.Errorf("backup '%s' metadata %+v doesn't match backup list entry %+v", expected.URL, backup, expected)
+	}
+	if _, err := strconv.ParseInt(backup.Size, 10, 64); err != nil {
+		return errors.Wrapf(err, "invalid size of backup '%s'", expected.URL)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package backups
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+type fakeBackupOps struct {
+	list    map[string][]*types.BackupInfo
+	inspect map[string]*types.BackupInfo
+}
+
+func (f *fakeBackupOps) List(volumeName string) ([]*types.BackupInfo, error) {
+	return f.list[volumeName], nil
+}
+
+func (f *fakeBackupOps) Get(url string) (*types.BackupInfo, error) {
+	backup, ok := f.inspect[url]
+	if !ok {
+		return nil, errors.Errorf("error parsing backup '%s'", url)
+	}
+	return backup, nil
+}
+
+func (f *fakeBackupOps) Delete(url string) error {
+	return nil
+}
+
+func (f *fakeBackupOps) ListVolumes() ([]*types.BackupVolumeInfo, error) {
+	volumes := []*types.BackupVolumeInfo{}
+	for name := range f.list {
+		volumes = append(volumes, &types.BackupVolumeInfo{Name: name})
+	}
+	return volumes, nil
+}
+
+func (f *fakeBackupOps) GetVolume(volumeName string) (*types.BackupVolumeInfo, error) {
+	return &types.BackupVolumeInfo{Name: volumeName}, nil
+}
+
+func (f *fakeBackupOps) DeleteVolume(volumeName string) error {
+	return nil
+}
+
+func newFakeBackupOps(t *testing.T) *fakeBackupOps {
+	backups, err := parseBackupsList(bytes.NewBufferString(backupsListText), "qq")
+	require.Nil(t, err)
+	f := &fakeBackupOps{
+		list:    map[string][]*types.BackupInfo{"qq": backups},
+		inspect: map[string]*types.BackupInfo{},
+	}
+	for _, b := range backups {
+		backup := *b
+		f.inspect[b.URL] = &backup
+	}
+	return f
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	assert := require.New(t)
+
+	ops := newFakeBackupOps(t)
+	report, err := CheckIntegrity(ops)
+	assert.Nil(err)
+	assert.Equal(1, report.Volumes)
+	assert.Equal(2, report.CheckedBackups)
+	assert.Len(report.CorruptedBackups, 0)
+
+	backups := ops.list["qq"]
+	ops.inspect[backups[0].URL].Size = "1024"
+	delete(ops.inspect, backups[1].URL)
+	report, err = CheckIntegrity(ops, "qq")
+	assert.Nil(err)
+	assert.Equal(2, report.CheckedBackups)
+	assert.Len(report.CorruptedBackups, 2)
+
+	ops = newFakeBackupOps(t)
+	// CheckIntegrity sorts the listed backups in place
+	missing := ops.list["qq"][1].URL
+	ops.inspect[missing] = nil
+	report, err = CheckIntegrity(ops)
+	assert.Nil(err)
+	assert.Equal([]string{missing}, report.CorruptedBackups)
+}
+
+func writeStoreVolume(t *testing.T, root, volumeName string) string {
+	volumePath := storeVolumePath(root, volumeName)
+	require.Nil(t, os.MkdirAll(filepath.Join(volumePath, storeBackupsDir), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(volumePath, storeVolumeCfg), []byte(`{"Name":"`+volumeName+`"}`), 0644))
+	return volumePath
+}
+
+// writeStoreBlock stores data as the block with the given checksum, the
+// checksum of data unless corrupting the block
+func writeStoreBlock(t *testing.T, volumePath, checksum string, data []byte) {
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	_, err := w.Write(data)
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+	path := storeBlockPath(volumePath, checksum)
+	require.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.Nil(t, ioutil.WriteFile(path, buf.Bytes(), 0644))
+}
+
+func writeStoreBackup(t *testing.T, volumePath, volumeName, backupName string, checksums ...string) {
+	backup := storeBackup{Name: backupName, VolumeName: volumeName}
+	for i, checksum := range checksums {
+		backup.Blocks = append(backup.Blocks, storeBlockMapping{Offset: int64(i) * 2 * 1024 * 1024, BlockChecksum: checksum})
+	}
+	content, err := json.Marshal(backup)
+	require.Nil(t, err)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(volumePath, storeBackupsDir, storeBackupPrefix+backupName+storeCfgSuffix), content, 0644))
+}
+
+func TestCheckStoreIntegrity(t *testing.T) {
+	assert := require.New(t)
+
+	root, err := ioutil.TempDir("", "backupstore")
+	assert.Nil(err)
+	defer os.RemoveAll(root)
+	target := "vfs://" + root
+
+	checksums := map[string]string{}
+	vol1 := writeStoreVolume(t, root, "vol1")
+	vol2 := writeStoreVolume(t, root, "vol2")
+	for _, data := range []string{"a", "b", "c", "d"} {
+		checksums[data] = storeChecksum([]byte(data))
+		volumePath := vol1
+		if data == "d" {
+			volumePath = vol2
+		}
+		writeStoreBlock(t, volumePath, checksums[data], []byte(data))
+	}
+	writeStoreBackup(t, vol1, "vol1", "b1", checksums["a"], checksums["b"])
+	writeStoreBackup(t, vol1, "vol1", "b2", checksums["b"], checksums["c"])
+	writeStoreBackup(t, vol2, "vol2", "b3", checksums["d"])
+
+	report, err := CheckIntegrity(New(target))
+	assert.Nil(err)
+	assert.Equal(2, report.Volumes)
+	assert.Equal(3, report.CheckedBackups)
+	assert.Len(report.CorruptedBackups, 0)
+	assert.Len(report.MissingBlocks, 0)
+	assert.Len(report.OrphanedBlocks, 0)
+
+	// corrupted, missing and orphaned blocks, and corrupted metadata
+	writeStoreBlock(t, vol1, checksums["a"], []byte("x"))
+	assert.Nil(os.Remove(storeBlockPath(vol1, checksums["c"])))
+	checksums["e"] = storeChecksum([]byte("e"))
+	writeStoreBlock(t, vol1, checksums["e"], []byte("e"))
+	assert.Nil(ioutil.WriteFile(filepath.Join(vol2, storeBackupsDir, storeBackupPrefix+"b4"+storeCfgSuffix), []byte("{"), 0644))
+
+	report, err = CheckIntegrity(New(target))
+	assert.Nil(err)
+	assert.Equal(2, report.Volumes)
+	assert.Equal(4, report.CheckedBackups)
+	assert.Equal([]string{
+		target + "?backup=b1&volume=vol1",
+		target + "?backup=b2&volume=vol1",
+		target + "?backup=b4&volume=vol2",
+	}, report.CorruptedBackups)
+	assert.Equal([]string{"vol1/" + checksums["c"]}, report.MissingBlocks)
+	assert.Equal([]string{"vol1/" + checksums["e"]}, report.OrphanedBlocks)
+
+	report, err = CheckIntegrity(New(target), "vol2")
+	assert.Nil(err)
+	assert.Equal(1, report.Volumes)
+	assert.Equal([]string{target + "?backup=b4&volume=vol2"}, report.CorruptedBackups)
+	assert.Len(report.OrphanedBlocks, 0)
+
+	_, err = CheckIntegrity(New(target), "vol3")
+	assert.NotNil(err)
+}
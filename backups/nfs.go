@@ -0,0 +1,184 @@
+package backups
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+const (
+	nfsScheme = "nfs://"
+)
+
+var (
+	NFSMountTimeout = time.Minute
+	// NFSMountRoot is where NFS backup targets are mounted while in use
+	NFSMountRoot = "/var/lib/longhorn/nfs-backup-targets"
+
+	nfsMountLock sync.Mutex
+	nfsMounts    = map[string]int{} // mount point -> number of users
+)
+
+// nfsBackups mounts the NFS share of an nfs://<server>/<export> backup
+// target for the duration of every operation, which runs against the mount
+// as a vfs:// backup target. The engine doesn't support nfs:// backup targets,
+// so backups can be listed and deleted, but not taken or restored.
+type nfsBackups struct {
+	target string
+}
+
+func isNFSTarget(backupTarget string) bool {
+	return strings.HasPrefix(backupTarget, nfsScheme)
+}
+
+// parseNFSTarget returns the NFS share and the local mount point of the
+// backup target
+func parseNFSTarget(backupTarget string) (string, string, error) {
+	u, err := url.Parse(backupTarget)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "invalid NFS backup target %v", backupTarget)
+	}
+	if u.Host == "" {
+		return "", "", errors.Errorf("invalid NFS backup target %v: missing server", backupTarget)
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	return u.Host + ":" + path, filepath.Join(NFSMountRoot, u.Host, path), nil
+}
+
+func (b *nfsBackups) mount() (string, error) {
+	source, mountPoint, err := parseNFSTarget(b.target)
+	if err != nil {
+		return "", err
+	}
+
+	nfsMountLock.Lock()
+	defer nfsMountLock.Unlock()
+
+	if nfsMounts[mountPoint] > 0 {
+		nfsMounts[mountPoint]++
+		return mountPoint, nil
+	}
+	if err := os.MkdirAll(mountPoint, 0755); err != nil {
+		return "", errors.Wrapf(err, "fail to create mount point %v", mountPoint)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), NFSMountTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "mount", "-t", "nfs", source, mountPoint).CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", errors.Errorf("timed out mounting NFS backup target %v after %v", b.target, NFSMountTimeout)
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "fail to mount NFS backup target %v: %s", b.target, out)
+	}
+	nfsMounts[mountPoint] = 1
+	return mountPoint, nil
+}
+
+func (b *nfsBackups) unmount(mountPoint string) {
+	nfsMountLock.Lock()
+	defer nfsMountLock.Unlock()
+
+	if nfsMounts[mountPoint]--; nfsMounts[mountPoint] > 0 {
+		return
+	}
+	delete(nfsMounts, mountPoint)
+	if out, err := exec.Command("umount", mountPoint).CombinedOutput(); err != nil {
+		logrus.Errorf("fail to unmount NFS backup target %v from %v: %v: %s", b.target, mountPoint, err, out)
+	}
+}
+
+func (b *nfsBackups) withMount(fn func(local *backups, mountPoint string) error) error {
+	mountPoint, err := b.mount()
+	if err != nil {
+		return err
+	}
+	defer b.unmount(mountPoint)
+	return fn(&backups{localTarget(mountPoint)}, mountPoint)
+}
+
+func localTarget(mountPoint string) string {
+	return "vfs://" + mountPoint
+}
+
+// toLocalURL and toRemoteURL convert the URL of a backup between the NFS
+// backup target and its mount
+func (b *nfsBackups) toLocalURL(backupURL, mountPoint string) string {
+	return localTarget(mountPoint) + strings.TrimPrefix(backupURL, b.target)
+}
+
+func (b *nfsBackups) toRemoteURL(backupURL, mountPoint string) string {
+	return b.target + strings.TrimPrefix(backupURL, localTarget(mountPoint))
+}
+
+func (b *nfsBackups) ListVolumes() ([]*types.BackupVolumeInfo, error) {
+	var volumes []*types.BackupVolumeInfo
+	err := b.withMount(func(local *backups, mountPoint string) error {
+		var err error
+		volumes, err = local.ListVolumes()
+		return err
+	})
+	return volumes, err
+}
+
+func (b *nfsBackups) GetVolume(volumeName string) (*types.BackupVolumeInfo, error) {
+	var volume *types.BackupVolumeInfo
+	err := b.withMount(func(local *backups, mountPoint string) error {
+		var err error
+		volume, err = local.GetVolume(volumeName)
+		return err
+	})
+	return volume, err
+}
+
+func (b *nfsBackups) List(volumeName string) ([]*types.BackupInfo, error) {
+	var list []*types.BackupInfo
+	err := b.withMount(func(local *backups, mountPoint string) error {
+		var err error
+		if list, err = local.List(volumeName); err != nil {
+			return err
+		}
+		for _, backup := range list {
+			backup.URL = b.toRemoteURL(backup.URL, mountPoint)
+		}
+		return nil
+	})
+	return list, err
+}
+
+func (b *nfsBackups) Get(url string) (*types.BackupInfo, error) {
+	var backup *types.BackupInfo
+	err := b.withMount(func(local *backups, mountPoint string) error {
+		var err error
+		if backup, err = local.Get(b.toLocalURL(url, mountPoint)); err != nil || backup == nil {
+			return err
+		}
+		backup.URL = b.toRemoteURL(backup.URL, mountPoint)
+		return nil
+	})
+	return backup, err
+}
+
+func (b *nfsBackups) Delete(url string) error {
+	return b.withMount(func(local *backups, mountPoint string) error {
+		return local.Delete(b.toLocalURL(url, mountPoint))
+	})
+}
+
+func (b *nfsBackups) DeleteVolume(volumeName string) error {
+	return b.withMount(func(local *backups, mountPoint string) error {
+		return local.DeleteVolume(volumeName)
+	})
+}
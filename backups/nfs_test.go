@@ -0,0 +1,38 @@
+package backups
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNFSTarget(t *testing.T) {
+	assert := require.New(t)
+
+	source, mountPoint, err := parseNFSTarget("nfs://nfs.example.com/exports/longhorn")
+	assert.Nil(err)
+	assert.Equal("nfs.example.com:/exports/longhorn", source)
+	assert.Equal(NFSMountRoot+"/nfs.example.com/exports/longhorn", mountPoint)
+
+	source, _, err = parseNFSTarget("nfs://10.0.0.1")
+	assert.Nil(err)
+	assert.Equal("10.0.0.1:/", source)
+
+	_, _, err = parseNFSTarget("nfs:///exports/longhorn")
+	assert.NotNil(err)
+}
+
+func TestNFSBackupURL(t *testing.T) {
+	assert := require.New(t)
+
+	b := New("nfs://nfs.example.com/exports/longhorn/").(*nfsBackups)
+	mountPoint := NFSMountRoot + "/nfs.example.com/exports/longhorn"
+	remote := "nfs://nfs.example.com/exports/longhorn?backup=backup-072d7a718f854328&volume=qq"
+	local := "vfs://" + mountPoint + "?backup=backup-072d7a718f854328&volume=qq"
+
+	assert.Equal(local, b.toLocalURL(remote, mountPoint))
+	assert.Equal(remote, b.toRemoteURL(local, mountPoint))
+
+	assert.IsType(&backups{}, New("s3://backups@us-east-1/longhorn"))
+	assert.IsType(&backups{}, New("vfs:///var/lib/longhorn/backups"))
+}
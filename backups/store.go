@@ -0,0 +1,216 @@
+package backups
+
+import (
+	"compress/gzip"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+// The layout of the backupstore of the longhorn engine on vfs backup
+// targets, and nfs targets once mounted:
+//
+//	backupstore/volumes/<c[0:2]>/<c[2:4]>/<volume>/volume.cfg
+//	backupstore/volumes/<c[0:2]>/<c[2:4]>/<volume>/backups/backup_<name>.cfg
+//	backupstore/volumes/<c[0:2]>/<c[2:4]>/<volume>/blocks/<b[0:2]>/<b[2:4]>/<b>.blk
+//
+// c is the checksum of the volume name, b the checksum of the uncompressed
+// data of the gzipped block.
+const (
+	vfsScheme          = "vfs://"
+	storeVolumesDir    = "backupstore/volumes"
+	storeVolumeCfg     = "volume.cfg"
+	storeBackupsDir    = "backups"
+	storeBackupPrefix  = "backup_"
+	storeCfgSuffix     = ".cfg"
+	storeBlocksDir     = "blocks"
+	storeBlockSuffix   = ".blk"
+	storeChecksumChars = 64
+)
+
+type storeBackup struct {
+	Name       string
+	VolumeName string
+	Blocks     []storeBlockMapping
+}
+
+type storeBlockMapping struct {
+	Offset        int64
+	BlockChecksum string
+}
+
+// storeChecksum is the checksum the backupstore names volumes and blocks by
+func storeChecksum(data []byte) string {
+	sum := sha512.Sum512(data)
+	return hex.EncodeToString(sum[:])[:storeChecksumChars]
+}
+
+func storeVolumePath(root, volumeName string) string {
+	c := storeChecksum([]byte(volumeName))
+	return filepath.Join(root, storeVolumesDir, c[0:2], c[2:4], volumeName)
+}
+
+func storeBlockPath(volumePath, checksum string) string {
+	return filepath.Join(volumePath, storeBlocksDir, checksum[0:2], checksum[2:4], checksum+storeBlockSuffix)
+}
+
+func storeBackupURL(target, volumeName, backupName string) string {
+	v := url.Values{}
+	v.Add("volume", volumeName)
+	v.Add("backup", backupName)
+	return target + "?" + v.Encode()
+}
+
+// storeVolumeNames lists the volumes in the backupstore under root
+func storeVolumeNames(root string) ([]string, error) {
+	cfgs, err := filepath.Glob(filepath.Join(root, storeVolumesDir, "*", "*", "*", storeVolumeCfg))
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to list backup volumes in %v", root)
+	}
+	names := []string{}
+	for _, cfg := range cfgs {
+		names = append(names, filepath.Base(filepath.Dir(cfg)))
+	}
+	return names, nil
+}
+
+// checkStoreIntegrity reads the backupstore of target under root. Backups are
+// corrupted if their metadata can't be read or any of their blocks is missing
+// or doesn't match its checksum.
+func checkStoreIntegrity(target, root string, volumeNames []string) (*types.BackupIntegrityReport, error) {
+	if len(volumeNames) == 0 {
+		var err error
+		if volumeNames, err = storeVolumeNames(root); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(volumeNames)
+
+	report := &types.BackupIntegrityReport{
+		CorruptedBackups: []string{},
+		MissingBlocks:    []string{},
+		OrphanedBlocks:   []string{},
+	}
+	for _, volumeName := range volumeNames {
+		if err := checkStoreVolume(report, target, storeVolumePath(root, volumeName), volumeName); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+func checkStoreVolume(report *types.BackupIntegrityReport, target, volumePath, volumeName string) error {
+	if _, err := os.Stat(filepath.Join(volumePath, storeVolumeCfg)); err != nil {
+		return errors.Wrapf(err, "cannot find backup volume '%s'", volumeName)
+	}
+	cfgs, err := filepath.Glob(filepath.Join(volumePath, storeBackupsDir, storeBackupPrefix+"*"+storeCfgSuffix))
+	if err != nil {
+		return errors.Wrapf(err, "fail to list backups of volume '%s'", volumeName)
+	}
+	sort.Strings(cfgs)
+	report.Volumes++
+
+	blocks := map[string]error{} // checksum -> error checking the block
+	for _, cfg := range cfgs {
+		backupName := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(cfg), storeBackupPrefix), storeCfgSuffix)
+		backupURL := storeBackupURL(target, volumeName, backupName)
+		report.CheckedBackups++
+		if err := checkStoreBackup(blocks, volumePath, volumeName, backupName, cfg); err != nil {
+			logrus.Warnf("backup integrity: backup '%s': %v", backupURL, err)
+			report.CorruptedBackups = append(report.CorruptedBackups, backupURL)
+		}
+	}
+
+	missing := []string{}
+	for checksum, err := range blocks {
+		if os.IsNotExist(errors.Cause(err)) {
+			missing = append(missing, volumeName+"/"+checksum)
+		}
+	}
+	sort.Strings(missing)
+	report.MissingBlocks = append(report.MissingBlocks, missing...)
+
+	orphaned := []string{}
+	err = filepath.Walk(filepath.Join(volumePath, storeBlocksDir), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, storeBlockSuffix) {
+			return nil
+		}
+		checksum := strings.TrimSuffix(info.Name(), storeBlockSuffix)
+		if _, ok := blocks[checksum]; !ok {
+			orphaned = append(orphaned, volumeName+"/"+checksum)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "fail to list blocks of volume '%s'", volumeName)
+	}
+	sort.Strings(orphaned)
+	report.OrphanedBlocks = append(report.OrphanedBlocks, orphaned...)
+	return nil
+}
+
+func checkStoreBackup(blocks map[string]error, volumePath, volumeName, backupName, cfg string) error {
+	content, err := ioutil.ReadFile(cfg)
+	if err != nil {
+		return errors.Wrap(err, "fail to read metadata")
+	}
+	backup := storeBackup{}
+	if err := json.Unmarshal(content, &backup); err != nil {
+		return errors.Wrap(err, "fail to parse metadata")
+	}
+	if backup.Name != backupName || backup.VolumeName != volumeName {
+		return errors.Errorf("metadata of backup '%s' of volume '%s' doesn't match its file %v", backup.Name, backup.VolumeName, cfg)
+	}
+	var blockErr error
+	for _, block := range backup.Blocks {
+		err, checked := blocks[block.BlockChecksum]
+		if !checked {
+			err = checkStoreBlock(volumePath, block.BlockChecksum)
+			blocks[block.BlockChecksum] = err
+		}
+		if err != nil && blockErr == nil {
+			blockErr = errors.Wrapf(err, "block at offset %v", block.Offset)
+		}
+	}
+	return blockErr
+}
+
+func checkStoreBlock(volumePath, checksum string) error {
+	if len(checksum) != storeChecksumChars {
+		return errors.Errorf("invalid block checksum '%s'", checksum)
+	}
+	f, err := os.Open(storeBlockPath(volumePath, checksum))
+	if err != nil {
+		return errors.Wrapf(err, "fail to open block %v", checksum)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return errors.Wrapf(err, "fail to decompress block %v", checksum)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return errors.Wrapf(err, "fail to decompress block %v", checksum)
+	}
+	if actual := storeChecksum(data); actual != checksum {
+		return errors.Errorf("checksum %v of block %v doesn't match", actual, checksum)
+	}
+	return nil
+}
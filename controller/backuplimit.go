@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// BackupConcurrentLimit caps the backups running at once across all volumes,
+// the others wait in the order they come for a running one to finish
+var BackupConcurrentLimit = 5
+
+var (
+	backupSlotsOnce sync.Once
+	backupSlots     *backupLimiter
+)
+
+type backupLimiter struct {
+	sem    chan struct{}
+	queued int64
+}
+
+func newBackupLimiter(limit int) *backupLimiter {
+	return &backupLimiter{sem: make(chan struct{}, limit)}
+}
+
+// getBackupSlots is created on first use, after BackupConcurrentLimit is set
+func getBackupSlots() *backupLimiter {
+	backupSlotsOnce.Do(func() {
+		backupSlots = newBackupLimiter(BackupConcurrentLimit)
+	})
+	return backupSlots
+}
+
+// acquire waits for a slot to run the backup until the context is done
+func (l *backupLimiter) acquire(ctx context.Context, volumeName string) error {
+	select {
+	case l.sem <- struct{}{}:
+		return nil
+	default:
+	}
+	atomic.AddInt64(&l.queued, 1)
+	defer atomic.AddInt64(&l.queued, -1)
+	logrus.Infof("backup of volume '%s' queued, %v backups running", volumeName, len(l.sem))
+	select {
+	case l.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *backupLimiter) release() {
+	<-l.sem
+}
+
+func (l *backupLimiter) stats() (running, queued int) {
+	return len(l.sem), int(atomic.LoadInt64(&l.queued))
+}
+
+// BackupStats returns the number of backups running and waiting to run
+func BackupStats() (running, queued int) {
+	return getBackupSlots().stats()
+}
@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func waitQueued(l *backupLimiter, n int) {
+	for i := 0; i < 100; i++ {
+		if _, queued := l.stats(); queued == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBackupLimiter(t *testing.T) {
+	assert := require.New(t)
+
+	l := newBackupLimiter(1)
+	assert.Nil(l.acquire(context.Background(), "vol1"))
+
+	acquired := make(chan error)
+	go func() {
+		acquired <- l.acquire(context.Background(), "vol2")
+	}()
+	waitQueued(l, 1)
+	running, queued := l.stats()
+	assert.Equal(1, running)
+	assert.Equal(1, queued)
+
+	// a cancelled backup leaves the queue
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error)
+	go func() {
+		cancelled <- l.acquire(ctx, "vol3")
+	}()
+	waitQueued(l, 2)
+	_, queued = l.stats()
+	assert.Equal(2, queued)
+	cancel()
+	assert.NotNil(<-cancelled)
+
+	l.release()
+	assert.Nil(<-acquired)
+	running, queued = l.stats()
+	assert.Equal(1, running)
+	assert.Equal(0, queued)
+}
@@ -1,6 +1,10 @@
 package controller
 
 import (
+	"fmt"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
 	"github.com/rancher/longhorn-manager/types"
 	"github.com/rancher/longhorn-manager/util"
@@ -10,19 +14,72 @@ func (c *controller) BackupOps() types.VolumeBackupOps {
 	return c
 }
 
-func (c *controller) StartBackup(snapName, backupTarget string) error {
+// checkEngineBackupTarget rejects the nfs:// backup targets for the backups
+// and restores the engine runs: it doesn't support them, only the manager
+// lists and deletes their backups on the mounted share.
+func checkEngineBackupTarget(url string) error {
+	if strings.HasPrefix(url, "nfs://") {
+		return errors.Errorf("the longhorn engine cannot back up to or restore from the nfs:// backup target of '%s', mount the share and use a vfs:// backup target", url)
+	}
+	return nil
+}
+
+func (c *controller) StartBackup(snapName, backupTarget string) (*types.BgTask, error) {
+	if err := checkEngineBackupTarget(backupTarget); err != nil {
+		return nil, err
+	}
 	snap, err := c.Get(snapName)
 	if err != nil {
-		return errors.Wrapf(err, "error getting snapshot '%s', volume '%s'", snapName, c.name)
+		return nil, errors.Wrapf(err, "error getting snapshot '%s', volume '%s'", snapName, c.name)
 	}
 	if snap == nil {
-		return errors.Errorf("could not find snapshot '%s' to backup, volume '%s'", snapName, c.name)
+		return nil, errors.Errorf("could not find snapshot '%s' to backup, volume '%s'", snapName, c.name)
 	}
-	c.bgTaskQueue.Put(&types.BgTask{Task: &types.BackupBgTask{Snapshot: snapName, BackupTarget: backupTarget}})
-	return nil
+	t := &types.BgTask{Task: &types.BackupBgTask{
+		Snapshot:     snapName,
+		BackupTarget: backupTarget,
+		URL:          c.pendingBackupURL(snapName, backupTarget),
+	}}
+	c.bgTaskQueue.Put(t)
+
+	// a copy, the task may be running already
+	c.bgTaskLock.Lock()
+	defer c.bgTaskLock.Unlock()
+	return copyBgTask(t), nil
+}
+
+// pendingBackupURL identifies a backup until the engine creates it
+func (c *controller) pendingBackupURL(snapName, backupTarget string) string {
+	return fmt.Sprintf("%s?snapshot=%s&volume=%s", strings.TrimSuffix(backupTarget, "/"), snapName, c.name)
+}
+
+func (c *controller) Cancel(backup string) error {
+	c.bgTaskLock.Lock()
+	defer c.bgTaskLock.Unlock()
+
+	if t := backupTaskOf(c.runningBgTask); t != nil && t.URL == backup {
+		c.cancelBgTask()
+		logrus.Infof("cancelling backup '%s', volume '%s'", backup, c.name)
+		return nil
+	}
+	if t := backupTaskOf(c.lastRunBgTask); t != nil && (t.URL == backup || t.BackupURL == backup) {
+		return errors.Errorf("backup '%s' has already completed, volume '%s'", backup, c.name)
+	}
+	return errors.Errorf("cannot find backup '%s' in progress, volume '%s'", backup, c.name)
+}
+
+func backupTaskOf(t *types.BgTask) *types.BackupBgTask {
+	if t == nil {
+		return nil
+	}
+	bt, _ := t.Task.(*types.BackupBgTask)
+	return bt
 }
 
 func (c *controller) Restore(backup string) error {
+	if err := checkEngineBackupTarget(backup); err != nil {
+		return err
+	}
 	if _, err := util.Execute("longhorn", "--url", c.url, "backup", "restore", backup); err != nil {
 		return errors.Wrapf(err, "error restoring backup '%s'", backup)
 	}
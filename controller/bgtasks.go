@@ -2,11 +2,15 @@ package controller
 
 import (
 	"bytes"
+	"context"
 	"github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
 	"github.com/rancher/longhorn-manager/types"
 	"github.com/rancher/longhorn-manager/util"
 	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -16,16 +20,27 @@ func (c *controller) LatestBgTasks() []*types.BgTask {
 
 	r := []*types.BgTask{}
 
+	// copies, the running task is updated while it runs
 	if c.lastRunBgTask != nil {
-		r = append(r, c.lastRunBgTask)
+		r = append(r, copyBgTask(c.lastRunBgTask))
 	}
 	if c.runningBgTask != nil {
-		r = append(r, c.runningBgTask)
+		r = append(r, copyBgTask(c.runningBgTask))
 	}
 
 	return r
 }
 
+// copyBgTask copies the task, call it holding bgTaskLock
+func copyBgTask(t *types.BgTask) *types.BgTask {
+	copied := *t
+	if bt, ok := t.Task.(*types.BackupBgTask); ok {
+		task := *bt
+		copied.Task = &task
+	}
+	return &copied
+}
+
 func (c *controller) BgTaskQueue() types.TaskQueue {
 	return c.bgTaskQueue
 }
@@ -41,19 +56,22 @@ func (c *controller) runBgTasks() {
 }
 
 func (c *controller) runTask(t *types.BgTask) {
-	t.Started = util.FormatTimeZ(time.Now())
-
+	ctx, cancel := context.WithCancel(context.Background())
 	func() {
 		c.bgTaskLock.Lock()
 		defer c.bgTaskLock.Unlock()
 
+		t.Started = util.FormatTimeZ(time.Now())
 		c.runningBgTask = t
+		c.cancelBgTask = cancel
 	}()
 	var err error
 	defer func() {
 		c.bgTaskLock.Lock()
 		defer c.bgTaskLock.Unlock()
 
+		cancel()
+		c.cancelBgTask = nil
 		c.lastRunBgTask = c.runningBgTask
 		c.runningBgTask = nil
 		c.lastRunBgTask.Finished = util.FormatTimeZ(time.Now())
@@ -62,16 +80,53 @@ func (c *controller) runTask(t *types.BgTask) {
 
 	switch task := t.Task.(type) {
 	case *types.BackupBgTask:
-		err = c.runBackup(task)
+		err = c.runBackup(ctx, t, task)
 	default:
 		err = errors.Errorf("unknown task type: %#v", task)
 	}
+	if err == nil && ctx.Err() == context.Canceled {
+		err = errors.Errorf("bgTask %v cancelled, volume '%s'", t.Num, c.name)
+	}
 	if err != nil {
 		logrus.Errorf("%+v", err)
 	}
 }
 
-func (c *controller) runBackup(t *types.BackupBgTask) error {
+// CancelBgTask cancels the running task with the number, or removes it from
+// the queue if it hasn't started yet
+func (c *controller) CancelBgTask(num int64) error {
+	if c.cancelRunningBgTask(num) {
+		return nil
+	}
+	if t := c.bgTaskQueue.Remove(num); t != nil {
+		logrus.Infof("removed queued bgTask %v, volume '%s'", num, c.name)
+		if bt := backupTaskOf(t); bt != nil && bt.CleanupHook != nil {
+			if err := bt.CleanupHook(); err != nil {
+				logrus.Errorf("%+v", errors.Wrapf(err, "error running cleanup after cancelled BackupBgTask, snapshot '%s'", bt.Snapshot))
+			}
+		}
+		return nil
+	}
+	// the task may have started in between
+	if c.cancelRunningBgTask(num) {
+		return nil
+	}
+	return errors.Errorf("cannot find bgTask %v running or queued, volume '%s'", num, c.name)
+}
+
+func (c *controller) cancelRunningBgTask(num int64) bool {
+	c.bgTaskLock.Lock()
+	defer c.bgTaskLock.Unlock()
+
+	if c.runningBgTask == nil || c.runningBgTask.Num != num {
+		return false
+	}
+	c.cancelBgTask()
+	logrus.Infof("cancelling bgTask %v, volume '%s'", num, c.name)
+	return true
+}
+
+func (c *controller) runBackup(ctx context.Context, bt *types.BgTask, t *types.BackupBgTask) error {
 	if t.CleanupHook != nil {
 		defer func() {
 			if err := t.CleanupHook(); err != nil {
@@ -80,15 +135,71 @@ func (c *controller) runBackup(t *types.BackupBgTask) error {
 		}()
 	}
 
-	var stdout, stderr bytes.Buffer
-	cmd := exec.Command("longhorn", "--url", c.url, "backup", "create", "--dest", t.BackupTarget, t.Snapshot)
-	cmd.Stdout = &stdout
+	c.bgTaskLock.Lock()
+	if t.URL == "" {
+		t.URL = c.pendingBackupURL(t.Snapshot, t.BackupTarget)
+	}
+	c.bgTaskLock.Unlock()
+
+	if err := checkEngineBackupTarget(t.BackupTarget); err != nil {
+		return err
+	}
+
+	slots := getBackupSlots()
+	if err := slots.acquire(ctx, c.name); err != nil {
+		return errors.Errorf("backup of snapshot '%s' to backupTarget '%s' cancelled while queued", t.Snapshot, t.BackupTarget)
+	}
+	defer slots.release()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "longhorn", "--url", c.url, "backup", "create", "--dest", t.BackupTarget, t.Snapshot)
 	cmd.Stderr = &stderr
 
-	err := cmd.Run()
+	cancel := make(chan interface{})
+	defer close(cancel)
+	lineCh, errCh := util.CmdOutLines(cmd, cancel)
+	backupURL := ""
+	for line := range lineCh {
+		if progress, ok := parseBackupProgress(line); ok {
+			c.setProgress(bt, progress)
+		} else if strings.Contains(line, "://") {
+			// the engine prints the URL of the created backup
+			backupURL = strings.TrimSpace(line)
+		}
+	}
+	err := <-errCh
 
+	if ctx.Err() == context.Canceled {
+		return errors.Errorf("backup of snapshot '%s' to backupTarget '%s' cancelled", t.Snapshot, t.BackupTarget)
+	}
 	if err == nil {
+		c.setProgress(bt, 100)
+		c.bgTaskLock.Lock()
+		t.BackupURL = backupURL
+		c.bgTaskLock.Unlock()
 		logrus.Infof("completed backup: volume '%s', snapshot '%s', backupTarget '%s'", c.name, t.Snapshot, t.BackupTarget)
 	}
 	return errors.Wrapf(err, "error creating backup for snapshot '%s', backupTarget '%s': %s", t.Snapshot, t.BackupTarget, &stderr)
 }
+
+func (c *controller) setProgress(t *types.BgTask, progress int) {
+	c.bgTaskLock.Lock()
+	defer c.bgTaskLock.Unlock()
+	t.Progress = progress
+}
+
+var progressRegexp = regexp.MustCompile(`(?:^|\s)(\d{1,3})%`)
+
+// parseBackupProgress finds the percentage of the backup completed in a line
+// of the engine output
+func parseBackupProgress(line string) (int, bool) {
+	m := progressRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return 0, false
+	}
+	progress, err := strconv.Atoi(m[1])
+	if err != nil || progress > 100 {
+		return 0, false
+	}
+	return progress, true
+}
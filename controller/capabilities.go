@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/rancher/longhorn-manager/util"
+)
+
+// ErrEngineUnsupported is the cause of the errors of the features the
+// longhorn engine doesn't have. The stats, replica-rebuild-status and
+// snapshot diff commands are not in rancher/longhorn-engine:046b5a5, the
+// engine of the integration tests, and need a newer engine CLI providing
+// them.
+var ErrEngineUnsupported = errors.New("not supported by the longhorn engine")
+
+var (
+	engineCommandsLock sync.Mutex
+	engineCommands     = map[string]map[string]bool{} // parent command -> commands
+
+	// engineHelp returns the help of the longhorn CLI command, the top level
+	// one if empty
+	engineHelp = func(command ...string) (string, error) {
+		return util.Execute("longhorn", append(command, "--help")...)
+	}
+)
+
+// requireEngineCommand checks the longhorn CLI has the command, e.g.
+// "snapshot", "diff". The commands are read from the CLI help once.
+func requireEngineCommand(command ...string) error {
+	parent, name := strings.Join(command[:len(command)-1], " "), command[len(command)-1]
+
+	engineCommandsLock.Lock()
+	defer engineCommandsLock.Unlock()
+	commands, ok := engineCommands[parent]
+	if !ok {
+		help, err := engineHelp(command[:len(command)-1]...)
+		if err != nil {
+			return errors.Wrapf(err, "cannot get the commands of the longhorn engine")
+		}
+		commands = parseEngineCommands(help)
+		engineCommands[parent] = commands
+	}
+	if !commands[name] {
+		return errors.Wrapf(ErrEngineUnsupported, "longhorn engine has no command '%s'", strings.Join(command, " "))
+	}
+	return nil
+}
+
+// parseEngineCommands parses the COMMANDS section of the CLI help, e.g.
+//
+//	COMMANDS:
+//	     snapshot, snapshots
+//	     info
+//	     help, h  Shows a list of commands or help for one command
+func parseEngineCommands(help string) map[string]bool {
+	commands := map[string]bool{}
+	inCommands := false
+	for _, line := range strings.Split(help, "\n") {
+		if strings.TrimSpace(line) == "COMMANDS:" {
+			inCommands = true
+			continue
+		}
+		if !inCommands {
+			continue
+		}
+		if strings.TrimSpace(line) == "" || !strings.HasPrefix(line, " ") {
+			break
+		}
+		for _, field := range strings.Fields(line) {
+			commands[strings.TrimSuffix(field, ",")] = true
+			if !strings.HasSuffix(field, ",") {
+				break
+			}
+		}
+	}
+	return commands
+}
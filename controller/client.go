@@ -0,0 +1,259 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/rancher/longhorn-manager/types"
+	"github.com/rancher/longhorn-manager/util"
+)
+
+const (
+	// EnvEngineClient selects the longhorn engine client, set it to
+	// EngineClientExec to use the longhorn CLI instead of the REST API
+	EnvEngineClient = "LONGHORN_ENGINE_CLIENT"
+
+	EngineClientHTTP = "http"
+	EngineClientExec = "exec"
+
+	engineClientTimeout = 30 * time.Second
+)
+
+// engineAdd adds the replica with the longhorn CLI. The engine REST API only
+// registers the replica as WO, the CLI also syncs the snapshots from a healthy
+// replica and verifies the new one before setting it RW.
+var engineAdd = func(controllerURL, replicaURL string) error {
+	_, err := util.Execute("longhorn", "--url", controllerURL, "add", replicaURL)
+	return err
+}
+
+// LonghornEngineClient talks to the controller of a longhorn engine
+type LonghornEngineClient interface {
+	ListReplicas() ([]*types.ReplicaInfo, error)
+	AddReplica(url string) error
+	RemoveReplica(url string) error
+	SetReplicaMode(url string, mode types.ReplicaMode) error
+	Info() (*types.VolumeControllerInfo, error)
+	Freeze() error
+	Unfreeze() error
+}
+
+func NewEngineClient(url string) LonghornEngineClient {
+	if os.Getenv(EnvEngineClient) == EngineClientExec {
+		return &execEngineClient{url: url}
+	}
+	return &httpEngineClient{
+		url:    url,
+		client: &http.Client{Timeout: engineClientTimeout},
+	}
+}
+
+type httpEngineClient struct {
+	url    string
+	client *http.Client
+}
+
+type engineReplica struct {
+	Address string `json:"address"`
+	Mode    string `json:"mode"`
+}
+
+type engineReplicaCollection struct {
+	Data []engineReplica `json:"data"`
+}
+
+type engineVolumeCollection struct {
+	Data []types.VolumeControllerInfo `json:"data"`
+}
+
+type engineVolumeIDCollection struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// engineID is how the engine REST API identifies a replica
+func engineID(url string) string {
+	return base64.StdEncoding.EncodeToString([]byte(url))
+}
+
+func (c *httpEngineClient) do(method, path string, input, output interface{}) error {
+	var body bytes.Buffer
+	if input != nil {
+		if err := json.NewEncoder(&body).Encode(input); err != nil {
+			return errors.Wrapf(err, "cannot encode request to %s %s", method, path)
+		}
+	}
+	req, err := http.NewRequest(method, c.url+"/v1"+path, &body)
+	if err != nil {
+		return errors.Wrapf(err, "cannot create request %s %s", method, path)
+	}
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "error requesting %s %s", method, req.URL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg := new(bytes.Buffer)
+		msg.ReadFrom(resp.Body)
+		return errors.Errorf("%s %s: unexpected response status %v: %s", method, req.URL, resp.Status, strings.TrimSpace(msg.String()))
+	}
+	if output == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(output); err != nil {
+		return errors.Wrapf(err, "cannot decode response to %s %s", method, req.URL)
+	}
+	return nil
+}
+
+func (c *httpEngineClient) ListReplicas() ([]*types.ReplicaInfo, error) {
+	collection := &engineReplicaCollection{}
+	if err := c.do("GET", "/replicas", nil, collection); err != nil {
+		return nil, err
+	}
+	replicas := []*types.ReplicaInfo{}
+	for _, r := range collection.Data {
+		mode, ok := modes[r.Mode]
+		if !ok {
+			mode = types.ReplicaModeERR
+		}
+		replicas = append(replicas, &types.ReplicaInfo{
+			InstanceInfo: types.InstanceInfo{
+				Address: getIPFromURL(r.Address),
+			},
+			Mode: mode,
+		})
+	}
+	return replicas, nil
+}
+
+func (c *httpEngineClient) AddReplica(url string) error {
+	return engineAdd(c.url, url)
+}
+
+func (c *httpEngineClient) RemoveReplica(url string) error {
+	return c.do("DELETE", "/replicas/"+engineID(url), nil, nil)
+}
+
+func (c *httpEngineClient) SetReplicaMode(url string, mode types.ReplicaMode) error {
+	return c.do("PUT", "/replicas/"+engineID(url), &engineReplica{Address: url, Mode: string(mode)}, nil)
+}
+
+func (c *httpEngineClient) Info() (*types.VolumeControllerInfo, error) {
+	collection := &engineVolumeCollection{}
+	if err := c.do("GET", "/volumes", nil, collection); err != nil {
+		return nil, err
+	}
+	if len(collection.Data) == 0 {
+		return nil, errors.Errorf("no volume found at %s", c.url)
+	}
+	return &collection.Data[0], nil
+}
+
+func (c *httpEngineClient) Freeze() error {
+	return c.volumeAction("freeze")
+}
+
+func (c *httpEngineClient) Unfreeze() error {
+	return c.volumeAction("unfreeze")
+}
+
+func (c *httpEngineClient) volumeAction(action string) error {
+	collection := &engineVolumeIDCollection{}
+	if err := c.do("GET", "/volumes", nil, collection); err != nil {
+		return err
+	}
+	if len(collection.Data) == 0 {
+		return errors.Errorf("no volume found at %s", c.url)
+	}
+	return c.do("POST", "/volumes/"+collection.Data[0].ID+"?action="+action, nil, nil)
+}
+
+type execEngineClient struct {
+	url string
+}
+
+func (c *execEngineClient) ListReplicas() ([]*types.ReplicaInfo, error) {
+	replicas := []*types.ReplicaInfo{}
+	cancel := make(chan interface{})
+	defer close(cancel)
+	// kill the CLI if the controller hangs, GetReplicaStates gives up on it anyway
+	ctx, cancelCtx := context.WithTimeout(context.Background(), ReplicaStatesTimeout)
+	defer cancelCtx()
+	lineCh, cliErrCh := util.CmdOutLines(exec.CommandContext(ctx, "longhorn", "--url", c.url, "ls"), cancel)
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	parsingErrCh := make(chan error)
+	go func() {
+		defer wg.Done()
+		defer close(parsingErrCh)
+		for s := range lineCh {
+			if strings.HasPrefix(s, "ADDRESS") {
+				continue
+			}
+			replica, err := parseReplica(s)
+			if err != nil {
+				parsingErrCh <- errors.Wrapf(err, "error parsing replica status from `%s`", s)
+				break
+			}
+			replicas = append(replicas, replica)
+		}
+	}()
+	for err := range parsingErrCh {
+		return nil, err
+	}
+	for err := range cliErrCh {
+		return nil, err
+	}
+
+	wg.Wait()
+	return replicas, nil
+}
+
+func (c *execEngineClient) AddReplica(url string) error {
+	return engineAdd(c.url, url)
+}
+
+func (c *execEngineClient) RemoveReplica(url string) error {
+	_, err := util.Execute("longhorn", "--url", c.url, "rm", url)
+	return err
+}
+
+func (c *execEngineClient) SetReplicaMode(url string, mode types.ReplicaMode) error {
+	return errors.Errorf("the longhorn CLI cannot set the mode of replica %s, use the %s engine client", url, EngineClientHTTP)
+}
+
+func (c *execEngineClient) Info() (*types.VolumeControllerInfo, error) {
+	output, err := util.Execute("longhorn", "--url", c.url, "info")
+	if err != nil {
+		return nil, err
+	}
+
+	info := &types.VolumeControllerInfo{}
+	if err := json.Unmarshal([]byte(output), info); err != nil {
+		return nil, errors.Wrapf(err, "cannot decode volume info: %v", output)
+	}
+	return info, nil
+}
+
+func (c *execEngineClient) Freeze() error {
+	return errors.Errorf("the longhorn CLI cannot freeze the volume at %s, use the %s engine client", c.url, EngineClientHTTP)
+}
+
+func (c *execEngineClient) Unfreeze() error {
+	return errors.Errorf("the longhorn CLI cannot unfreeze the volume at %s, use the %s engine client", c.url, EngineClientHTTP)
+}
@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+type fakeEngine struct {
+	replicas []engineReplica
+	frozen   bool
+}
+
+func (e *fakeEngine) handler() http.Handler {
+	r := mux.NewRouter()
+	r.Methods("GET").Path("/v1/replicas").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(&engineReplicaCollection{Data: e.replicas})
+	})
+	r.Methods("POST").Path("/v1/replicas").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		replica := engineReplica{}
+		if err := json.NewDecoder(req.Body).Decode(&replica); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		replica.Mode = "WO"
+		e.replicas = append(e.replicas, replica)
+	})
+	r.Methods("DELETE").Path("/v1/replicas/{id}").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := mux.Vars(req)["id"]
+		for i, replica := range e.replicas {
+			if engineID(replica.Address) == id {
+				e.replicas = append(e.replicas[:i], e.replicas[i+1:]...)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+	r.Methods("PUT").Path("/v1/replicas/{id}").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		update := engineReplica{}
+		if err := json.NewDecoder(req.Body).Decode(&update); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		id := mux.Vars(req)["id"]
+		for i, replica := range e.replicas {
+			if engineID(replica.Address) == id {
+				e.replicas[i].Mode = update.Mode
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+	r.Methods("GET").Path("/v1/volumes").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": []map[string]interface{}{{
+			"id":           "1",
+			"name":         "qq",
+			"replicaCount": len(e.replicas),
+			"endpoint":     "/dev/longhorn/qq",
+		}}})
+	})
+	r.Methods("POST").Path("/v1/volumes/1").Queries("action", "{action}").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch mux.Vars(req)["action"] {
+		case "freeze":
+			e.frozen = true
+		case "unfreeze":
+			e.frozen = false
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	return r
+}
+
+func TestHTTPEngineClient(t *testing.T) {
+	assert := require.New(t)
+
+	engine := &fakeEngine{replicas: []engineReplica{
+		{Address: "tcp://replica-1.volume-qq:9502", Mode: "RW"},
+		{Address: "tcp://replica-2.volume-qq:9502", Mode: "ERR"},
+	}}
+	server := httptest.NewServer(engine.handler())
+	defer server.Close()
+
+	// the longhorn CLI registers the replica as WO, syncs it and sets it RW
+	defer func(add func(string, string) error) {
+		engineAdd = add
+	}(engineAdd)
+	synced := []string{}
+	engineAdd = func(controllerURL, replicaURL string) error {
+		cli := &httpEngineClient{url: controllerURL, client: http.DefaultClient}
+		if err := cli.do("POST", "/replicas", &engineReplica{Address: replicaURL}, nil); err != nil {
+			return err
+		}
+		synced = append(synced, replicaURL)
+		return cli.SetReplicaMode(replicaURL, types.ReplicaModeRW)
+	}
+
+	client := NewEngineClient(server.URL)
+	assert.IsType(&httpEngineClient{}, client)
+
+	replicas, err := client.ListReplicas()
+	assert.Nil(err)
+	assert.Len(replicas, 2)
+	assert.Equal("replica-1.volume-qq", replicas[0].Address)
+	assert.Equal(types.ReplicaModeRW, replicas[0].Mode)
+	assert.Equal(types.ReplicaModeERR, replicas[1].Mode)
+
+	assert.Nil(client.AddReplica("tcp://replica-3.volume-qq:9502"))
+	assert.Nil(client.RemoveReplica("tcp://replica-2.volume-qq:9502"))
+	assert.NotNil(client.RemoveReplica("tcp://replica-2.volume-qq:9502"))
+	replicas, err = client.ListReplicas()
+	assert.Nil(err)
+	assert.Len(replicas, 2)
+	assert.Equal("replica-3.volume-qq", replicas[1].Address)
+	assert.Equal(types.ReplicaModeRW, replicas[1].Mode)
+	assert.Equal([]string{"tcp://replica-3.volume-qq:9502"}, synced)
+
+	assert.Nil(client.SetReplicaMode("tcp://replica-3.volume-qq:9502", types.ReplicaModeWO))
+	assert.NotNil(client.SetReplicaMode("tcp://replica-2.volume-qq:9502", types.ReplicaModeRW))
+	replicas, err = client.ListReplicas()
+	assert.Nil(err)
+	assert.Equal(types.ReplicaModeWO, replicas[1].Mode)
+
+	info, err := client.Info()
+	assert.Nil(err)
+	assert.Equal(types.VolumeControllerInfo{Name: "qq", ReplicaCount: 2, Endpoint: "/dev/longhorn/qq"}, *info)
+
+	assert.Nil(client.Freeze())
+	assert.True(engine.frozen)
+	assert.Nil(client.Unfreeze())
+	assert.False(engine.frozen)
+}
+
+func TestNewEngineClientExec(t *testing.T) {
+	assert := require.New(t)
+
+	defer os.Unsetenv(EnvEngineClient)
+	os.Setenv(EnvEngineClient, EngineClientExec)
+	assert.IsType(&execEngineClient{}, NewEngineClient("http://localhost:9501"))
+}
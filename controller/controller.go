@@ -1,10 +1,13 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
-	"os/exec"
+	"fmt"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
@@ -18,6 +21,16 @@ func init() {
 
 var reqCh = make(chan *req)
 
+var (
+	// ReplicaStatesTimeout limits how long GetReplicaStates waits for the
+	// controller to respond
+	ReplicaStatesTimeout = 30 * time.Second
+
+	// ErrUnresponsive is the cause of the error returned when the controller
+	// doesn't respond in time
+	ErrUnresponsive = errors.New("controller is unresponsive")
+)
+
 type req struct {
 	volume *types.VolumeInfo
 	result chan *controller
@@ -28,11 +41,11 @@ func ctrlReq(volume *types.VolumeInfo) *req {
 }
 
 func getControllerURL(address string) string {
-	return "http://" + address + ":9501"
+	return fmt.Sprintf("http://%s:%d", address, util.ControllerPort())
 }
 
 func getReplicaURL(address string) string {
-	return "tcp://" + address + ":9502"
+	return fmt.Sprintf("tcp://%s:%d", address, util.ReplicaPort())
 }
 
 func getIPFromURL(url string) string {
@@ -43,7 +56,19 @@ func getIPFromURL(url string) string {
 func holdControllers() {
 	cs := map[string]*controller{}
 
-	for r := range reqCh {
+	for {
+		var r *req
+		select {
+		case result := <-trackedReqCh:
+			tracked := []TrackedController{}
+			for _, c := range cs {
+				tracked = append(tracked, TrackedController{Name: c.name, URL: c.url})
+			}
+			sort.Slice(tracked, func(i, j int) bool { return tracked[i].Name < tracked[j].Name })
+			result <- tracked
+			continue
+		case r = <-reqCh:
+		}
 		if r.volume.Controller == nil || !r.volume.Controller.Running {
 			c := cs[r.volume.Name]
 			if c != nil {
@@ -55,7 +80,7 @@ func holdControllers() {
 		c := cs[r.volume.Name]
 		cURL := getControllerURL(r.volume.Controller.Address)
 		if c == nil || c.url != cURL {
-			c = &controller{name: r.volume.Name, url: cURL, bgTaskQueue: TaskQueue(), purgeQueue: make(chan struct{}, 2)}
+			c = &controller{name: r.volume.Name, url: cURL, client: NewEngineClient(cURL), bgTaskQueue: TaskQueue(), purgeQueue: make(chan struct{}, 2)}
 			go c.runBgTasks()
 			cs[r.volume.Name] = c
 		}
@@ -63,14 +88,32 @@ func holdControllers() {
 	}
 }
 
+// TrackedController is a controller cached for a volume
+type TrackedController struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+var trackedReqCh = make(chan chan []TrackedController)
+
+// Tracked lists the cached controllers by volume name, to find the ones
+// with a stale URL
+func Tracked() []TrackedController {
+	result := make(chan []TrackedController)
+	trackedReqCh <- result
+	return <-result
+}
+
 type controller struct {
 	sync.Mutex
 
-	name string
-	url  string
+	name   string
+	url    string
+	client LonghornEngineClient
 
 	lastRunBgTask *types.BgTask
 	runningBgTask *types.BgTask
+	cancelBgTask  context.CancelFunc
 	bgTaskLock    sync.Mutex
 
 	bgTaskQueue types.TaskQueue
@@ -78,12 +121,6 @@ type controller struct {
 	purgeQueue chan struct{}
 }
 
-type volumeInfo struct {
-	Name         string `json:"name"`
-	ReplicaCount int    `json:"replicaCount"`
-	Endpoint     string `json:"endpoint"`
-}
-
 func Get(volume *types.VolumeInfo) types.Controller {
 	if volume == nil || volume.Controller == nil || !volume.Controller.Running {
 		return nil
@@ -127,42 +164,29 @@ func parseReplica(s string) (*types.ReplicaInfo, error) {
 }
 
 func (c *controller) GetReplicaStates() ([]*types.ReplicaInfo, error) {
-	replicas := []*types.ReplicaInfo{}
-	cancel := make(chan interface{})
-	defer close(cancel)
-	lineCh, cliErrCh := util.CmdOutLines(exec.Command("longhorn", "--url", c.url, "ls"), cancel)
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
-	parsingErrCh := make(chan error)
+	type result struct {
+		replicas []*types.ReplicaInfo
+		err      error
+	}
+	resultCh := make(chan result, 1)
 	go func() {
-		defer wg.Done()
-		defer close(parsingErrCh)
-		for s := range lineCh {
-			if strings.HasPrefix(s, "ADDRESS") {
-				continue
-			}
-			replica, err := parseReplica(s)
-			if err != nil {
-				parsingErrCh <- errors.Wrapf(err, "error parsing replica status from `%s`", s)
-				break
-			}
-			replicas = append(replicas, replica)
-		}
+		replicas, err := c.client.ListReplicas()
+		resultCh <- result{replicas, err}
 	}()
-	for err := range parsingErrCh {
-		return nil, err
-	}
-	for err := range cliErrCh {
-		return nil, err
+	select {
+	case r := <-resultCh:
+		if r.err != nil {
+			return nil, errors.Wrapf(r.err, "failed to list replicas of controller '%s'", c.name)
+		}
+		return r.replicas, nil
+	case <-time.After(ReplicaStatesTimeout):
+		return nil, errors.Wrapf(ErrUnresponsive, "no replica states from controller '%s' in %v", c.name, ReplicaStatesTimeout)
 	}
-
-	wg.Wait()
-	return replicas, nil
 }
 
 func (c *controller) AddReplica(replica *types.ReplicaInfo) error {
 	rURL := getReplicaURL(replica.Address)
-	if _, err := util.Execute("longhorn", "--url", c.url, "add", rURL); err != nil {
+	if err := c.client.AddReplica(rURL); err != nil {
 		return errors.Wrapf(err, "failed to add replica address='%s' to controller '%s'", rURL, c.name)
 	}
 	return nil
@@ -170,14 +194,36 @@ func (c *controller) AddReplica(replica *types.ReplicaInfo) error {
 
 func (c *controller) RemoveReplica(replica *types.ReplicaInfo) error {
 	rURL := getReplicaURL(replica.Address)
-	if _, err := util.Execute("longhorn", "--url", c.url, "rm", rURL); err != nil {
+	if err := c.client.RemoveReplica(rURL); err != nil {
 		return errors.Wrapf(err, "failed to rm replica address='%s' from controller '%s'", rURL, c.name)
 	}
 	return nil
 }
 
+func (c *controller) SetReplicaMode(replica *types.ReplicaInfo, mode types.ReplicaMode) error {
+	rURL := getReplicaURL(replica.Address)
+	if err := c.client.SetReplicaMode(rURL, mode); err != nil {
+		return errors.Wrapf(err, "failed to set mode of replica address='%s' to %v in controller '%s'", rURL, mode, c.name)
+	}
+	return nil
+}
+
+func (c *controller) Freeze() error {
+	if err := c.client.Freeze(); err != nil {
+		return errors.Wrapf(err, "failed to freeze controller '%s'", c.name)
+	}
+	return nil
+}
+
+func (c *controller) Unfreeze() error {
+	if err := c.client.Unfreeze(); err != nil {
+		return errors.Wrapf(err, "failed to unfreeze controller '%s'", c.name)
+	}
+	return nil
+}
+
 func (c *controller) Endpoint() string {
-	info, err := c.info()
+	info, err := c.Info()
 	if err != nil {
 		logrus.Warn("Fail to get frontend info: ", err)
 		return ""
@@ -186,15 +232,66 @@ func (c *controller) Endpoint() string {
 	return info.Endpoint
 }
 
-func (c *controller) info() (*volumeInfo, error) {
-	output, err := util.Execute("longhorn", "--url", c.url, "info")
+func (c *controller) Info() (*types.VolumeControllerInfo, error) {
+	info, err := c.client.Info()
 	if err != nil {
 		return nil, errors.Wrapf(err, "cannot get volume info")
 	}
+	return info, nil
+}
 
-	info := &volumeInfo{}
-	if err := json.Unmarshal([]byte(output), info); err != nil {
-		return nil, errors.Wrapf(err, "cannot decode volume info: %v", output)
+func (c *controller) RebuildStatus() ([]*types.RebuildStatus, error) {
+	if err := requireEngineCommand("replica-rebuild-status"); err != nil {
+		return nil, err
 	}
-	return info, nil
+	output, err := util.Execute("longhorn", "--url", c.url, "replica-rebuild-status")
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get replica rebuild status")
+	}
+	return parseRebuildStatus(output)
+}
+
+// parseRebuildStatus parses the rebuild status of the replicas by URL the
+// longhorn CLI reports, e.g.
+// {"tcp://10.0.0.1:9502": {"isRebuilding": true, "progress": 42, "state": "in_progress", "error": ""}}
+func parseRebuildStatus(output string) ([]*types.RebuildStatus, error) {
+	statuses := map[string]struct {
+		IsRebuilding bool   `json:"isRebuilding"`
+		Progress     int    `json:"progress"`
+		State        string `json:"state"`
+		Error        string `json:"error"`
+	}{}
+	if err := json.Unmarshal([]byte(output), &statuses); err != nil {
+		return nil, errors.Wrapf(err, "cannot decode replica rebuild status: %v", output)
+	}
+	result := []*types.RebuildStatus{}
+	for url, s := range statuses {
+		state := s.State
+		if s.Error != "" {
+			state = "error: " + s.Error
+		}
+		result = append(result, &types.RebuildStatus{
+			Address:  getIPFromURL(url),
+			Progress: s.Progress,
+			State:    state,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Address < result[j].Address })
+	return result, nil
+}
+
+func (c *controller) IOStats() (*types.VolumeIOStats, error) {
+	if err := requireEngineCommand("stats"); err != nil {
+		return nil, err
+	}
+	output, err := util.Execute("longhorn", "--url", c.url, "stats")
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get volume stats")
+	}
+
+	stats := &types.VolumeIOStats{}
+	if err := json.Unmarshal([]byte(output), stats); err != nil {
+		return nil, errors.Wrapf(err, "cannot decode volume stats: %v", output)
+	}
+	return stats, nil
 }
@@ -1,6 +1,11 @@
 package controller
 
 import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
 	"github.com/rancher/longhorn-manager/types"
 	"github.com/stretchr/testify/require"
 	"testing"
@@ -21,3 +26,235 @@ func TestParseReplica(t *testing.T) {
 	assert.Equal("replica-79VrD86STQ.volume-qq", replica.Address)
 	assert.Equal(types.ReplicaModeRW, replica.Mode)
 }
+
+func TestParseBackupProgress(t *testing.T) {
+	assert := require.New(t)
+
+	progress, ok := parseBackupProgress("Backup progress: 42%")
+	assert.True(ok)
+	assert.Equal(42, progress)
+	progress, ok = parseBackupProgress("100%")
+	assert.True(ok)
+	assert.Equal(100, progress)
+
+	_, ok = parseBackupProgress("vfs:///var/lib/longhorn/backups/default?backup=backup-1&volume=qq")
+	assert.False(ok)
+	_, ok = parseBackupProgress("Backup progress: 420%")
+	assert.False(ok)
+}
+
+func TestCancelBackup(t *testing.T) {
+	assert := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &controller{name: "qq"}
+	running := &types.BackupBgTask{Snapshot: "snap2", BackupTarget: "vfs:///var/lib/longhorn/backups/default/"}
+	running.URL = c.pendingBackupURL(running.Snapshot, running.BackupTarget)
+	assert.Equal("vfs:///var/lib/longhorn/backups/default?snapshot=snap2&volume=qq", running.URL)
+	c.runningBgTask = &types.BgTask{Task: running}
+	c.cancelBgTask = cancel
+	c.lastRunBgTask = &types.BgTask{Task: &types.BackupBgTask{
+		Snapshot:  "snap1",
+		URL:       "vfs:///var/lib/longhorn/backups/default?snapshot=snap1&volume=qq",
+		BackupURL: "vfs:///var/lib/longhorn/backups/default?backup=backup-1&volume=qq",
+	}}
+
+	assert.NotNil(c.Cancel("vfs:///var/lib/longhorn/backups/default?snapshot=snap1&volume=qq"))
+	assert.NotNil(c.Cancel("vfs:///var/lib/longhorn/backups/default?backup=backup-1&volume=qq"))
+	assert.NotNil(c.Cancel("vfs:///var/lib/longhorn/backups/default?snapshot=snap3&volume=qq"))
+	assert.Nil(ctx.Err())
+
+	assert.Nil(c.Cancel(running.URL))
+	assert.Equal(context.Canceled, ctx.Err())
+}
+
+func TestNFSBackupTarget(t *testing.T) {
+	assert := require.New(t)
+
+	c := &controller{name: "qq"}
+	_, err := c.StartBackup("snap1", "nfs://nfs.example.com/exports/longhorn")
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "nfs://")
+	err = c.Restore("nfs://nfs.example.com/exports/longhorn?backup=backup-1&volume=qq")
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "nfs://")
+
+	cleanedUp := false
+	task := &types.BackupBgTask{
+		Snapshot:     "snap1",
+		BackupTarget: "nfs://nfs.example.com/exports/longhorn",
+		CleanupHook: func() error {
+			cleanedUp = true
+			return nil
+		},
+	}
+	assert.NotNil(c.runBackup(context.Background(), &types.BgTask{Task: task}, task))
+	assert.True(cleanedUp)
+}
+
+type hangingEngineClient struct {
+	LonghornEngineClient
+	release chan struct{}
+}
+
+func (c *hangingEngineClient) ListReplicas() ([]*types.ReplicaInfo, error) {
+	<-c.release
+	return []*types.ReplicaInfo{}, nil
+}
+
+func TestGetReplicaStatesTimeout(t *testing.T) {
+	assert := require.New(t)
+
+	defer func(timeout time.Duration) { ReplicaStatesTimeout = timeout }(ReplicaStatesTimeout)
+	ReplicaStatesTimeout = 10 * time.Millisecond
+
+	client := &hangingEngineClient{release: make(chan struct{})}
+	c := &controller{name: "qq", client: client}
+	_, err := c.GetReplicaStates()
+	assert.NotNil(err)
+	assert.Equal(ErrUnresponsive, errors.Cause(err))
+
+	close(client.release)
+	replicas, err := c.GetReplicaStates()
+	assert.Nil(err)
+	assert.Len(replicas, 0)
+}
+
+func TestTracked(t *testing.T) {
+	assert := require.New(t)
+
+	volume := &types.VolumeInfo{Name: "tracked-qq", Controller: &types.ControllerInfo{InstanceInfo: types.InstanceInfo{
+		Running: true,
+		Address: "10.0.0.1",
+	}}}
+	assert.NotNil(Get(volume))
+	assert.Contains(Tracked(), TrackedController{Name: "tracked-qq", URL: "http://10.0.0.1:9501"})
+
+	volume.Controller.Address = "10.0.0.2"
+	Get(volume)
+	tracked := Tracked()
+	assert.Contains(tracked, TrackedController{Name: "tracked-qq", URL: "http://10.0.0.2:9501"})
+	assert.NotContains(tracked, TrackedController{Name: "tracked-qq", URL: "http://10.0.0.1:9501"})
+}
+
+func TestParseRebuildStatus(t *testing.T) {
+	assert := require.New(t)
+
+	statuses, err := parseRebuildStatus(`{
+		"tcp://10.0.0.2:9502": {"isRebuilding": false, "progress": 0, "state": "error", "error": "connection reset"},
+		"tcp://10.0.0.1:9502": {"isRebuilding": true, "progress": 42, "state": "in_progress", "error": ""}
+	}`)
+	assert.Nil(err)
+	assert.Equal([]*types.RebuildStatus{
+		{Address: "10.0.0.1", Progress: 42, State: "in_progress"},
+		{Address: "10.0.0.2", State: "error: connection reset"},
+	}, statuses)
+
+	_, err = parseRebuildStatus("Failed to connect")
+	assert.NotNil(err)
+}
+
+func TestParseSnapshotDiff(t *testing.T) {
+	assert := require.New(t)
+
+	diff, err := parseSnapshotDiff(`[{"offset": 8192, "length": 4096}, {"offset": 0, "length": 2048}]`)
+	assert.Nil(err)
+	assert.Equal(&types.SnapshotDiff{
+		ChangedBlocks: []types.BlockRange{{Offset: 0, Length: 2048}, {Offset: 8192, Length: 4096}},
+		TotalChanged:  6144,
+	}, diff)
+
+	diff, err = parseSnapshotDiff("[]")
+	assert.Nil(err)
+	assert.Equal(int64(0), diff.TotalChanged)
+
+	_, err = parseSnapshotDiff(`[{"offset": -1, "length": 4096}]`)
+	assert.NotNil(err)
+	_, err = parseSnapshotDiff("Failed to connect")
+	assert.NotNil(err)
+}
+
+func TestCancelBgTask(t *testing.T) {
+	assert := require.New(t)
+
+	c := &controller{name: "qq", bgTaskQueue: TaskQueue()}
+	defer c.bgTaskQueue.Close()
+
+	cleanedUp := false
+	queued := &types.BgTask{Task: &types.BackupBgTask{Snapshot: "snap1", CleanupHook: func() error {
+		cleanedUp = true
+		return nil
+	}}}
+	c.bgTaskQueue.Put(queued)
+	assert.Nil(c.CancelBgTask(queued.Num))
+	assert.True(cleanedUp)
+	assert.Len(c.bgTaskQueue.List(), 0)
+	assert.NotNil(c.CancelBgTask(queued.Num))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.runningBgTask = &types.BgTask{Num: 42, Task: &types.BackupBgTask{Snapshot: "snap2"}}
+	c.cancelBgTask = cancel
+	assert.Nil(c.CancelBgTask(42))
+	assert.Equal(context.Canceled, ctx.Err())
+}
+
+func TestRequireEngineCommand(t *testing.T) {
+	assert := require.New(t)
+
+	defer func(help func(...string) (string, error)) {
+		engineHelp = help
+		engineCommands = map[string]map[string]bool{}
+	}(engineHelp)
+	helps := map[string]string{
+		"": `NAME:
+   longhorn - A new cli application
+
+USAGE:
+   longhorn [global options] command [command options] [arguments...]
+
+COMMANDS:
+     rm
+     add-replica, add
+     ls, info
+     snapshot, snapshots
+     backup, backups
+     help, h           Shows a list of commands or help for one command
+
+GLOBAL OPTIONS:
+   --url value  (default: "http://localhost:9501")
+`,
+		"snapshot": `USAGE:
+   longhorn snapshot command [command options] [arguments...]
+
+COMMANDS:
+     create
+     revert
+     ls, list
+     rm
+     purge
+     info
+
+OPTIONS:
+   --help, -h  show help
+`,
+	}
+	calls := 0
+	engineHelp = func(command ...string) (string, error) {
+		calls++
+		return helps[strings.Join(command, " ")], nil
+	}
+	engineCommands = map[string]map[string]bool{}
+
+	assert.Nil(requireEngineCommand("add"))
+	assert.Nil(requireEngineCommand("snapshots"))
+	assert.Nil(requireEngineCommand("snapshot", "list"))
+	err := requireEngineCommand("stats")
+	assert.Equal(ErrEngineUnsupported, errors.Cause(err))
+	err = requireEngineCommand("snapshot", "diff")
+	assert.Equal(ErrEngineUnsupported, errors.Cause(err))
+	assert.False(parseEngineCommands(helps[""])["Shows"])
+	assert.False(parseEngineCommands(helps[""])["--url"])
+	assert.Equal(2, calls)
+}
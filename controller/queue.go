@@ -14,8 +14,15 @@ type taskQueue struct {
 }
 
 type listReq chan []*types.BgTask
-type putReq *types.BgTask
+type putReq struct {
+	t    *types.BgTask
+	done chan struct{}
+}
 type takeReq chan *types.BgTask
+type removeReq struct {
+	num    int64
+	result chan *types.BgTask
+}
 
 func (tq *taskQueue) runQueue() {
 	var i int64
@@ -25,13 +32,14 @@ func (tq *taskQueue) runQueue() {
 			r <- tq.queue
 		case putReq:
 			i++
-			r.Num = i
-			r.Submitted = util.FormatTimeZ(time.Now())
+			r.t.Num = i
+			r.t.Submitted = util.FormatTimeZ(time.Now())
+			close(r.done)
 			if len(tq.takeReqs) > 0 {
-				tq.takeReqs[0] <- r
+				tq.takeReqs[0] <- r.t
 				tq.takeReqs = tq.takeReqs[1:]
 			} else {
-				tq.queue = append(tq.queue, r)
+				tq.queue = append(tq.queue, r.t)
 			}
 		case takeReq:
 			if len(tq.queue) > 0 {
@@ -40,6 +48,18 @@ func (tq *taskQueue) runQueue() {
 			} else {
 				tq.takeReqs = append(tq.takeReqs, r)
 			}
+		case removeReq:
+			var removed *types.BgTask
+			queue := []*types.BgTask{}
+			for _, t := range tq.queue {
+				if t.Num == r.num && removed == nil {
+					removed = t
+					continue
+				}
+				queue = append(queue, t)
+			}
+			tq.queue = queue
+			r.result <- removed
 		}
 	}
 	for _, r := range tq.takeReqs {
@@ -66,7 +86,9 @@ func (tq *taskQueue) Put(t *types.BgTask) {
 	defer func() {
 		recover()
 	}()
-	tq.reqCh <- putReq(t)
+	req := putReq{t: t, done: make(chan struct{})}
+	tq.reqCh <- req
+	<-req.done
 }
 
 func (tq *taskQueue) Take() *types.BgTask {
@@ -78,6 +100,15 @@ func (tq *taskQueue) Take() *types.BgTask {
 	return <-req
 }
 
+func (tq *taskQueue) Remove(num int64) *types.BgTask {
+	defer func() {
+		recover()
+	}()
+	req := removeReq{num: num, result: make(chan *types.BgTask)}
+	tq.reqCh <- req
+	return <-req.result
+}
+
 func (tq *taskQueue) Close() error {
 	defer func() {
 		recover()
@@ -50,3 +50,34 @@ func TestTaskQueue_Close(t *testing.T) {
 	wgTake.Done()
 	wg.Wait()
 }
+
+func TestTaskQueue_PutNum(t *testing.T) {
+	assert := require.New(t)
+
+	q := TaskQueue()
+	defer q.Close()
+	t0, t1 := &types.BgTask{}, &types.BgTask{}
+	q.Put(t0)
+	q.Put(t1)
+	assert.Equal(int64(1), t0.Num)
+	assert.Equal(int64(2), t1.Num)
+	assert.NotEmpty(t1.Submitted)
+}
+
+func TestTaskQueue_Remove(t *testing.T) {
+	assert := require.New(t)
+
+	q := TaskQueue()
+	defer q.Close()
+	t0, t1, t2 := &types.BgTask{}, &types.BgTask{}, &types.BgTask{}
+	q.Put(t0)
+	q.Put(t1)
+	q.Put(t2)
+
+	assert.Equal(t1, q.Remove(t1.Num))
+	assert.Nil(q.Remove(t1.Num))
+	assert.Nil(q.Remove(42))
+	assert.Equal([]*types.BgTask{t0, t2}, q.List())
+	assert.Equal(t0, q.Take())
+	assert.Equal(t2, q.Take())
+}
@@ -3,6 +3,7 @@ package controller
 import (
 	"encoding/json"
 	"os/exec"
+	"sort"
 	"strings"
 	"time"
 
@@ -113,3 +114,32 @@ func (c *controller) Purge() error {
 	}
 	return nil
 }
+
+// Diff runs the diff command of the engine, which prints the ranges changed
+// between the snapshots as JSON, see ErrEngineUnsupported
+func (c *controller) Diff(from, to string) (*types.SnapshotDiff, error) {
+	if err := requireEngineCommand("snapshot", "diff"); err != nil {
+		return nil, err
+	}
+	output, err := util.Execute("longhorn", "--url", c.url, "snapshot", "diff", from, to)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting diff from snapshot '%s' to '%s', volume '%s'", from, to, c.name)
+	}
+	return parseSnapshotDiff(output)
+}
+
+func parseSnapshotDiff(output string) (*types.SnapshotDiff, error) {
+	blocks := []types.BlockRange{}
+	if err := json.Unmarshal([]byte(output), &blocks); err != nil {
+		return nil, errors.Wrapf(err, "error parsing snapshot diff: \n%s", output)
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Offset < blocks[j].Offset })
+	diff := &types.SnapshotDiff{ChangedBlocks: blocks}
+	for _, b := range blocks {
+		if b.Offset < 0 || b.Length < 0 {
+			return nil, errors.Errorf("invalid range %+v in snapshot diff", b)
+		}
+		diff.TotalChanged += b.Length
+	}
+	return diff, nil
+}
@@ -1,7 +1,10 @@
 package kvstore
 
 import (
+	"crypto/tls"
 	"encoding/json"
+	"net"
+	"net/http"
 	"time"
 
 	"github.com/pkg/errors"
@@ -16,12 +19,25 @@ type ETCDBackend struct {
 	kapi eCli.KeysAPI
 }
 
-func NewETCDBackend(servers []string) (*ETCDBackend, error) {
+// NewETCDBackend connects to the etcd servers, with the client certificate
+// and CAs of tlsConfig if it isn't nil
+func NewETCDBackend(servers []string, tlsConfig *tls.Config) (*ETCDBackend, error) {
 	eCfg := eCli.Config{
 		Endpoints:               servers,
 		Transport:               eCli.DefaultTransport,
 		HeaderTimeoutPerRequest: time.Second,
 	}
+	if tlsConfig != nil {
+		eCfg.Transport = &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			Dial: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).Dial,
+			TLSHandshakeTimeout: 10 * time.Second,
+			TLSClientConfig:     tlsConfig,
+		}
+	}
 
 	etcdc, err := eCli.New(eCfg)
 	if err != nil {
@@ -50,6 +66,58 @@ func (s *ETCDBackend) IsNotFoundError(err error) bool {
 	return eCli.IsKeyNotFound(err)
 }
 
+func (s *ETCDBackend) Create(key string, obj interface{}, ttl time.Duration) error {
+	value, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	if _, err := s.kapi.Set(context.Background(), key, string(value), &eCli.SetOptions{
+		PrevExist: eCli.PrevNoExist,
+		TTL:       ttl,
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *ETCDBackend) CompareAndDelete(key string, obj interface{}) error {
+	value, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	_, err = s.kapi.Delete(context.Background(), key, &eCli.DeleteOptions{
+		PrevValue: string(value),
+	})
+	if err != nil {
+		if eCli.IsKeyNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *ETCDBackend) CompareAndRefresh(key string, obj interface{}, ttl time.Duration) error {
+	value, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	if _, err := s.kapi.Set(context.Background(), key, string(value), &eCli.SetOptions{
+		PrevValue: string(value),
+		TTL:       ttl,
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *ETCDBackend) IsExistError(err error) bool {
+	if cErr, ok := err.(eCli.Error); ok {
+		return cErr.Code == eCli.ErrorCodeNodeExist
+	}
+	return false
+}
+
 func (s *ETCDBackend) Get(key string, obj interface{}) error {
 	resp, err := s.kapi.Get(context.Background(), key, nil)
 	if err != nil {
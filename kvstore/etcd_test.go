@@ -0,0 +1,56 @@
+package kvstore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+
+	. "gopkg.in/check.v1"
+)
+
+type ETCDSuite struct{}
+
+var _ = Suite(&ETCDSuite{})
+
+func (s *ETCDSuite) TestFailover(c *C) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Etcd-Index", "1")
+		w.Write([]byte(`{"action":"get","node":{"key":"/longhorn/key","value":"\"value\"","modifiedIndex":1,"createdIndex":1}}`))
+	}))
+	defer up.Close()
+
+	backend, err := NewETCDBackend([]string{down.URL, up.URL}, nil)
+	c.Assert(err, IsNil)
+	for i := 0; i < 5; i++ {
+		var value string
+		c.Assert(backend.Get("/longhorn/key", &value), IsNil)
+		c.Assert(value, Equals, "value")
+	}
+}
+
+func (s *ETCDSuite) TestTLS(c *C) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Etcd-Index", "1")
+		w.Write([]byte(`{"action":"get","node":{"key":"/longhorn/key","value":"\"value\"","modifiedIndex":1,"createdIndex":1}}`))
+	}))
+	defer server.Close()
+
+	backend, err := NewETCDBackend([]string{server.URL}, nil)
+	c.Assert(err, IsNil)
+	var value string
+	c.Assert(backend.Get("/longhorn/key", &value), NotNil)
+
+	cert, err := x509.ParseCertificate(server.TLS.Certificates[0].Certificate[0])
+	c.Assert(err, IsNil)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	backend, err = NewETCDBackend([]string{server.URL}, &tls.Config{RootCAs: pool})
+	c.Assert(err, IsNil)
+	c.Assert(backend.Get("/longhorn/key", &value), IsNil)
+	c.Assert(value, Equals, "value")
+}
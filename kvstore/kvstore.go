@@ -2,6 +2,7 @@ package kvstore
 
 import (
 	"path/filepath"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
@@ -15,12 +16,18 @@ type Backend interface {
 	Delete(key string) error
 	Keys(prefix string) ([]string, error)
 	IsNotFoundError(err error) bool
+
+	Create(key string, obj interface{}, ttl time.Duration) error            // fails if key exists, no expiration if ttl is 0
+	CompareAndDelete(key string, obj interface{}) error                     // deletes only if current value matches obj
+	CompareAndRefresh(key string, obj interface{}, ttl time.Duration) error // resets ttl only if current value matches obj
+	IsExistError(err error) bool
 }
 
 type KVStore struct {
 	Prefix string
 
-	b Backend
+	b    Backend
+	held heldLocks
 }
 
 const (
@@ -35,6 +42,7 @@ func NewKVStore(prefix string, backend Backend) (*KVStore, error) {
 	return &KVStore{
 		Prefix: prefix,
 		b:      backend,
+		held:   heldLocks{locks: map[string]*heldLock{}},
 	}, nil
 }
 
@@ -62,7 +62,7 @@ func (s *TestSuite) SetUpTest(c *C) {
 	s.engineImage = os.Getenv(EnvEngineImage)
 	c.Assert(s.engineImage, Not(Equals), "")
 
-	etcdBackend, err := NewETCDBackend([]string{"http://" + etcdIP + ":2379"})
+	etcdBackend, err := NewETCDBackend([]string{"http://" + etcdIP + ":2379"}, nil)
 	c.Assert(err, IsNil)
 
 	etcd, err := NewKVStore("/longhorn", etcdBackend)
@@ -349,7 +349,23 @@ func (s *TestSuite) testVolume(c *C, st *KVStore) {
 	volume2.Controller = controller2
 	s.verifyVolume(c, st, volume2)
 
-	err = st.DeleteVolume(volume1.Name)
+	renamed := *volume1
+	renamed.Name = "volume3"
+	renamed.Controller = nil
+	renamed.Replicas = map[string]*types.ReplicaInfo{}
+	for _, r := range volume1.Replicas {
+		replica := *r
+		replica.VolumeName = renamed.Name
+		renamed.Replicas[replica.Name] = &replica
+	}
+	err = st.RenameVolume(volume1.Name, &renamed)
+	c.Assert(err, IsNil)
+	s.verifyVolume(c, st, &renamed)
+	volume, err = st.GetVolume(volume1.Name)
+	c.Assert(err, IsNil)
+	c.Assert(volume, IsNil)
+
+	err = st.DeleteVolume(renamed.Name)
 	c.Assert(err, IsNil)
 
 	volumes, err = st.ListVolumes()
@@ -364,3 +380,144 @@ func (s *TestSuite) testVolume(c *C, st *KVStore) {
 	c.Assert(err, IsNil)
 	c.Assert(len(volumes), Equals, 0)
 }
+
+func (s *TestSuite) TestLock(c *C) {
+	s.testLock(c, s.memory)
+
+	if s.etcd != nil {
+		s.testLock(c, s.etcd)
+	}
+}
+
+func (s *TestSuite) testLock(c *C, st *KVStore) {
+	token1, err := st.Lock("lock1", "owner1", time.Second)
+	c.Assert(err, IsNil)
+
+	_, err = st.Lock("lock1", "owner1", time.Second)
+	c.Assert(err, NotNil)
+
+	token2, err := st.Lock("lock2", "owner1", time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(token2, Not(Equals), token1)
+
+	// only the acquisition holding the lock can release it
+	err = st.Unlock("lock1", token2)
+	c.Assert(err, NotNil)
+	_, err = st.Lock("lock1", "owner1", time.Second)
+	c.Assert(err, NotNil)
+
+	err = st.Unlock("lock1", token1)
+	c.Assert(err, IsNil)
+	err = st.Unlock("lock1", token1)
+	c.Assert(err, NotNil)
+	token1, err = st.Lock("lock1", "owner2", time.Second)
+	c.Assert(err, IsNil)
+
+	err = st.Unlock("lock1", token1)
+	c.Assert(err, IsNil)
+	err = st.Unlock("lock2", token2)
+	c.Assert(err, IsNil)
+}
+
+func (s *TestSuite) TestLockRefresh(c *C) {
+	defer func(ttl time.Duration) {
+		LockTTL = ttl
+	}(LockTTL)
+	LockTTL = 300 * time.Millisecond
+
+	token, err := s.memory.Lock("lock1", "owner1", time.Second)
+	c.Assert(err, IsNil)
+	// held past its TTL
+	time.Sleep(3 * LockTTL)
+	_, err = s.memory.Lock("lock1", "owner2", LockTTL)
+	c.Assert(err, NotNil)
+
+	err = s.memory.Unlock("lock1", token)
+	c.Assert(err, IsNil)
+	token, err = s.memory.Lock("lock1", "owner2", LockTTL)
+	c.Assert(err, IsNil)
+	err = s.memory.Unlock("lock1", token)
+	c.Assert(err, IsNil)
+}
+
+func (s *TestSuite) TestLeader(c *C) {
+	s.testLeader(c, s.memory)
+
+	if s.etcd != nil {
+		s.testLeader(c, s.etcd)
+	}
+}
+
+func (s *TestSuite) testLeader(c *C, st *KVStore) {
+	leader, err := st.GetLeader("election1")
+	c.Assert(err, IsNil)
+	c.Assert(leader, Equals, "")
+
+	leader, err = st.CampaignLeader("election1", "id1", time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(leader, Equals, "id1")
+
+	leader, err = st.CampaignLeader("election1", "id2", time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(leader, Equals, "id1")
+
+	// the leader renews its term
+	leader, err = st.CampaignLeader("election1", "id1", time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(leader, Equals, "id1")
+
+	// only the leader can resign
+	err = st.ResignLeader("election1", "id2")
+	c.Assert(err, NotNil)
+	err = st.ResignLeader("election1", "id1")
+	c.Assert(err, IsNil)
+
+	leader, err = st.CampaignLeader("election1", "id2", time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(leader, Equals, "id2")
+
+	err = st.ResignLeader("election1", "id2")
+	c.Assert(err, IsNil)
+}
+
+func (s *TestSuite) TestOperation(c *C) {
+	s.testOperation(c, s.memory)
+
+	if s.etcd != nil {
+		s.testOperation(c, s.etcd)
+	}
+}
+
+func (s *TestSuite) testOperation(c *C, st *KVStore) {
+	op, err := st.GetOperation("volume1")
+	c.Assert(err, IsNil)
+	c.Assert(op, IsNil)
+
+	op1 := &types.Operation{
+		VolumeName: "volume1",
+		Type:       types.OperationCreateFromBackup,
+		HostID:     "host1",
+		Steps:      []string{types.OperationStepCreatedReplicas},
+	}
+	err = st.SetOperation(op1)
+	c.Assert(err, IsNil)
+	op2 := &types.Operation{VolumeName: "volume2", Type: types.OperationCreateFromBackup, HostID: "host1"}
+	err = st.SetOperation(op2)
+	c.Assert(err, IsNil)
+
+	op, err = st.GetOperation("volume1")
+	c.Assert(err, IsNil)
+	c.Assert(op, DeepEquals, op1)
+
+	ops, err := st.ListOperations()
+	c.Assert(err, IsNil)
+	c.Assert(len(ops), Equals, 2)
+
+	err = st.DeleteOperation("volume1")
+	c.Assert(err, IsNil)
+	err = st.DeleteOperation("volume2")
+	c.Assert(err, IsNil)
+	ops, err = st.ListOperations()
+	c.Assert(err, IsNil)
+	c.Assert(len(ops), Equals, 0)
+}
@@ -0,0 +1,57 @@
+package kvstore
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	keyLeaders = "leaders"
+)
+
+type leaderInfo struct {
+	ID string `json:"id"`
+}
+
+func (s *KVStore) leaderKey(name string) string {
+	return s.key(keyLeaders + "/" + name)
+}
+
+// CampaignLeader makes id the leader of the election name for ttl, or renews
+// the term if id is the leader already. Returns the current leader.
+func (s *KVStore) CampaignLeader(name, id string, ttl time.Duration) (string, error) {
+	key := s.leaderKey(name)
+	if err := s.b.CompareAndRefresh(key, &leaderInfo{ID: id}, ttl); err == nil {
+		return id, nil
+	}
+	err := s.b.Create(key, &leaderInfo{ID: id}, ttl)
+	if err == nil {
+		return id, nil
+	}
+	if !s.b.IsExistError(err) {
+		return "", errors.Wrapf(err, "unable to campaign for leader of %v", name)
+	}
+	return s.GetLeader(name)
+}
+
+// GetLeader returns the current leader of the election name, or an empty
+// string if there's none
+func (s *KVStore) GetLeader(name string) (string, error) {
+	leader := &leaderInfo{}
+	if err := s.b.Get(s.leaderKey(name), leader); err != nil {
+		if s.b.IsNotFoundError(err) {
+			return "", nil
+		}
+		return "", errors.Wrapf(err, "unable to get leader of %v", name)
+	}
+	return leader.ID, nil
+}
+
+// ResignLeader ends the term of id if it's the leader of the election name
+func (s *KVStore) ResignLeader(name, id string) error {
+	if err := s.b.CompareAndDelete(s.leaderKey(name), &leaderInfo{ID: id}); err != nil {
+		return errors.Wrapf(err, "unable to resign leader of %v", name)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package kvstore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+
+	"github.com/rancher/longhorn-manager/util"
+)
+
+const (
+	keyLocks = "locks"
+)
+
+var (
+	// LockTTL is how long a lock is held if its owner dies without releasing
+	// it, the TTL is refreshed while the lock is held
+	LockTTL = 5 * time.Minute
+	// LockTimeout is how long to wait for the holder to release a lock
+	LockTimeout       = 5 * time.Minute
+	LockRetryInterval = 500 * time.Millisecond
+)
+
+type lockInfo struct {
+	Owner string `json:"owner"`
+	Token string `json:"token"`
+}
+
+type heldLock struct {
+	info *lockInfo
+	stop chan struct{}
+}
+
+type heldLocks struct {
+	sync.Mutex
+	locks map[string]*heldLock // token -> lock
+}
+
+func (s *KVStore) lockKey(name string) string {
+	return s.key(keyLocks + "/" + name)
+}
+
+// Lock acquires the lock name for owner, waiting up to timeout for the
+// current holder to release it. The lock is kept alive until it's released
+// with the returned token.
+func (s *KVStore) Lock(name, owner string, timeout time.Duration) (string, error) {
+	info := &lockInfo{Owner: owner, Token: util.UUID()}
+	deadline := time.Now().Add(timeout)
+	for {
+		err := s.b.Create(s.lockKey(name), info, LockTTL)
+		if err == nil {
+			s.keepLock(name, info)
+			return info.Token, nil
+		}
+		if !s.b.IsExistError(err) {
+			return "", errors.Wrapf(err, "unable to acquire lock %v", name)
+		}
+		if time.Now().After(deadline) {
+			return "", errors.Errorf("timed out acquiring lock %v", name)
+		}
+		time.Sleep(LockRetryInterval)
+	}
+}
+
+// keepLock refreshes the TTL of the lock until it's released
+func (s *KVStore) keepLock(name string, info *lockInfo) {
+	held := &heldLock{info: info, stop: make(chan struct{})}
+	s.held.Lock()
+	s.held.locks[info.Token] = held
+	s.held.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(LockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-held.stop:
+				return
+			case <-ticker.C:
+				if err := s.b.CompareAndRefresh(s.lockKey(name), info, LockTTL); err != nil {
+					logrus.Errorf("unable to refresh lock %v: %v", name, err)
+				}
+			}
+		}
+	}()
+}
+
+// Unlock releases the lock name acquired with token
+func (s *KVStore) Unlock(name, token string) error {
+	s.held.Lock()
+	held := s.held.locks[token]
+	delete(s.held.locks, token)
+	s.held.Unlock()
+	if held == nil {
+		return errors.Errorf("unable to release lock %v: not held with token %v", name, token)
+	}
+	close(held.stop)
+
+	if err := s.b.CompareAndDelete(s.lockKey(name), held.info); err != nil {
+		return errors.Wrapf(err, "unable to release lock %v", name)
+	}
+	return nil
+}
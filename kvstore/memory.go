@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -12,11 +14,14 @@ import (
 
 var (
 	MemoryKeyNotFoundError = errors.Errorf("key not found")
+	MemoryKeyExistsError   = errors.Errorf("key already exists")
 
 	Separator = "/"
 )
 
 type MemoryBackend struct {
+	sync.Mutex
+
 	c *cache.Cache
 }
 
@@ -107,3 +112,64 @@ func (m *MemoryBackend) Keys(prefix string) ([]string, error) {
 func (m *MemoryBackend) IsNotFoundError(err error) bool {
 	return err == MemoryKeyNotFoundError
 }
+
+func (m *MemoryBackend) Create(key string, obj interface{}, ttl time.Duration) error {
+	value, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		ttl = cache.NoExpiration
+	}
+	if err := m.c.Add(key, string(value), ttl); err != nil {
+		return MemoryKeyExistsError
+	}
+	return nil
+}
+
+func (m *MemoryBackend) CompareAndDelete(key string, obj interface{}) error {
+	value, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	current, exists := m.c.Get(key)
+	if !exists {
+		return nil
+	}
+	if current.(string) != string(value) {
+		return errors.Errorf("value of key %v doesn't match", key)
+	}
+	m.c.Delete(key)
+	return nil
+}
+
+func (m *MemoryBackend) CompareAndRefresh(key string, obj interface{}, ttl time.Duration) error {
+	value, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		ttl = cache.NoExpiration
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	current, exists := m.c.Get(key)
+	if !exists {
+		return MemoryKeyNotFoundError
+	}
+	if current.(string) != string(value) {
+		return errors.Errorf("value of key %v doesn't match", key)
+	}
+	m.c.Set(key, string(value), ttl)
+	return nil
+}
+
+func (m *MemoryBackend) IsExistError(err error) bool {
+	return err == MemoryKeyExistsError
+}
@@ -0,0 +1,69 @@
+package kvstore
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+const (
+	keyOperations = "operations"
+)
+
+func (s *KVStore) operationKey(volumeName string) string {
+	return s.key(keyOperations + "/" + volumeName)
+}
+
+func (s *KVStore) SetOperation(op *types.Operation) error {
+	if op.VolumeName == "" {
+		return errors.Errorf("operation doesn't have valid volume name: %+v", op)
+	}
+	if err := s.b.Set(s.operationKey(op.VolumeName), op); err != nil {
+		return errors.Wrapf(err, "unable to set operation %+v", op)
+	}
+	return nil
+}
+
+func (s *KVStore) GetOperation(volumeName string) (*types.Operation, error) {
+	op, err := s.getOperationByKey(s.operationKey(volumeName))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get operation on volume %v", volumeName)
+	}
+	return op, nil
+}
+
+func (s *KVStore) getOperationByKey(key string) (*types.Operation, error) {
+	op := types.Operation{}
+	if err := s.b.Get(key, &op); err != nil {
+		if s.b.IsNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &op, nil
+}
+
+func (s *KVStore) DeleteOperation(volumeName string) error {
+	if err := s.b.Delete(s.operationKey(volumeName)); err != nil {
+		return errors.Wrapf(err, "unable to remove operation on volume %v", volumeName)
+	}
+	return nil
+}
+
+func (s *KVStore) ListOperations() ([]*types.Operation, error) {
+	keys, err := s.b.Keys(s.key(keyOperations))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list operations")
+	}
+	ops := []*types.Operation{}
+	for _, key := range keys {
+		op, err := s.getOperationByKey(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to list operations")
+		}
+		if op != nil {
+			ops = append(ops, op)
+		}
+	}
+	return ops, nil
+}
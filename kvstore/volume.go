@@ -3,6 +3,7 @@ package kvstore
 import (
 	"path/filepath"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
 
 	"github.com/rancher/longhorn-manager/types"
@@ -278,6 +279,26 @@ func (s *KVStore) DeleteVolume(id string) error {
 	return nil
 }
 
+// RenameVolume writes the volume under its new name, then removes all keys of
+// the old name with a single recursive delete. The new keys are removed again
+// if either step fails.
+func (s *KVStore) RenameVolume(oldName string, volume *types.VolumeInfo) (err error) {
+	defer func() {
+		if err == nil {
+			return
+		}
+		if rerr := s.b.Delete(s.volumeRootKey(volume.Name)); rerr != nil && !s.b.IsNotFoundError(rerr) {
+			logrus.Errorf("unable to roll back renaming volume %v to %v: %v", oldName, volume.Name, rerr)
+		}
+		err = errors.Wrapf(err, "unable to rename volume %v to %v", oldName, volume.Name)
+	}()
+
+	if err := s.SetVolume(volume); err != nil {
+		return err
+	}
+	return s.DeleteVolume(oldName)
+}
+
 func (s *KVStore) ListVolumes() ([]*types.VolumeInfo, error) {
 	volumeKeys, err := s.b.Keys(s.key(keyVolumes))
 	if err != nil {
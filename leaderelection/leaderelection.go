@@ -0,0 +1,139 @@
+package leaderelection
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+var (
+	// DefaultTTL is how long a leader stays elected without renewing its term
+	DefaultTTL = 15 * time.Second
+)
+
+// Store is implemented by orchestrators able to elect a leader, the term of
+// the leader is a key in etcd expiring after its TTL unless renewed
+type Store interface {
+	CampaignLeader(name, id string, ttl time.Duration) (string, error) // returns the current leader
+	GetLeader(name string) (string, error)                             // empty if there's no leader
+	ResignLeader(name, id string) error
+}
+
+type Config struct {
+	Name string // of the election
+	ID   string // of this candidate, followers forward requests to it once elected
+
+	TTL time.Duration
+	// RenewDeadline is how long the leader keeps leading without renewing
+	// its term, shorter than TTL so it steps down before another candidate
+	// can be elected. Defaults to two thirds of TTL.
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration // defaults to a third of TTL
+
+	OnStartedLeading func()
+	OnStoppedLeading func()
+}
+
+type LeaderElector struct {
+	store Store
+	cfg   Config
+
+	lock        sync.RWMutex
+	leader      string
+	lastRenewal time.Time
+}
+
+func New(store Store, cfg Config) *LeaderElector {
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTTL
+	}
+	if cfg.RenewDeadline <= 0 || cfg.RenewDeadline >= cfg.TTL {
+		cfg.RenewDeadline = cfg.TTL * 2 / 3
+	}
+	if cfg.RetryPeriod <= 0 {
+		cfg.RetryPeriod = cfg.TTL / 3
+	}
+	return &LeaderElector{
+		store: store,
+		cfg:   cfg,
+	}
+}
+
+// Run campaigns for leadership every RetryPeriod until stop is closed, then
+// resigns if elected
+func (le *LeaderElector) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(le.cfg.RetryPeriod)
+	defer ticker.Stop()
+	for {
+		le.campaign()
+		select {
+		case <-stop:
+			if le.IsLeader() {
+				if err := le.store.ResignLeader(le.cfg.Name, le.cfg.ID); err != nil {
+					logrus.Warnf("leader election: %v", err)
+				}
+				le.setLeader("")
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (le *LeaderElector) campaign() {
+	leader, err := le.store.CampaignLeader(le.cfg.Name, le.cfg.ID, le.cfg.TTL)
+	if err != nil {
+		logrus.Warnf("leader election: %v", err)
+		// keep leading until the renew deadline, before our term expires in
+		// the store and another candidate can be elected
+		le.lock.RLock()
+		expired := time.Since(le.lastRenewal) > le.cfg.RenewDeadline
+		le.lock.RUnlock()
+		if !expired {
+			return
+		}
+		leader = ""
+	}
+	le.setLeader(leader)
+}
+
+func (le *LeaderElector) setLeader(leader string) {
+	le.lock.Lock()
+	wasLeader := le.leader == le.cfg.ID
+	le.leader = leader
+	isLeader := leader == le.cfg.ID
+	if isLeader {
+		le.lastRenewal = time.Now()
+	}
+	le.lock.Unlock()
+
+	if isLeader == wasLeader {
+		return
+	}
+	if isLeader {
+		logrus.Infof("leader election: %v elected leader of %v", le.cfg.ID, le.cfg.Name)
+		if le.cfg.OnStartedLeading != nil {
+			go le.cfg.OnStartedLeading()
+		}
+		return
+	}
+	logrus.Warnf("leader election: %v lost leadership of %v to '%v'", le.cfg.ID, le.cfg.Name, leader)
+	if le.cfg.OnStoppedLeading != nil {
+		le.cfg.OnStoppedLeading()
+	}
+}
+
+func (le *LeaderElector) IsLeader() bool {
+	le.lock.RLock()
+	defer le.lock.RUnlock()
+	return le.leader == le.cfg.ID
+}
+
+// Leader is the ID of the current leader as of the last campaign, empty if
+// unknown
+func (le *LeaderElector) Leader() string {
+	le.lock.RLock()
+	defer le.lock.RUnlock()
+	return le.leader
+}
@@ -0,0 +1,131 @@
+package leaderelection
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore struct {
+	sync.Mutex
+	leader string
+	err    error
+}
+
+func (s *fakeStore) CampaignLeader(name, id string, ttl time.Duration) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.err != nil {
+		return "", s.err
+	}
+	if s.leader == "" {
+		s.leader = id
+	}
+	return s.leader, nil
+}
+
+func (s *fakeStore) GetLeader(name string) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.leader, nil
+}
+
+func (s *fakeStore) ResignLeader(name, id string) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.leader == id {
+		s.leader = ""
+	}
+	return nil
+}
+
+func (s *fakeStore) set(leader string, err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.leader = leader
+	s.err = err
+}
+
+func TestLeaderElector(t *testing.T) {
+	assert := require.New(t)
+
+	store := &fakeStore{leader: "other"}
+	started, stopped := make(chan struct{}, 1), make(chan struct{}, 1)
+	le := New(store, Config{
+		Name:             "test",
+		ID:               "me",
+		TTL:              time.Hour,
+		OnStartedLeading: func() { started <- struct{}{} },
+		OnStoppedLeading: func() { stopped <- struct{}{} },
+	})
+
+	le.campaign()
+	assert.False(le.IsLeader())
+	assert.Equal("other", le.Leader())
+
+	store.set("", nil)
+	le.campaign()
+	assert.True(le.IsLeader())
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		assert.Fail("OnStartedLeading not called")
+	}
+
+	// still leading while the term hasn't expired
+	store.set("", errors.New("etcd unavailable"))
+	le.campaign()
+	assert.True(le.IsLeader())
+	assert.Len(stopped, 0)
+
+	store.set("other", nil)
+	le.campaign()
+	assert.False(le.IsLeader())
+	assert.Equal("other", le.Leader())
+	assert.Len(stopped, 1)
+}
+
+func TestLeaderElectorRenewDeadline(t *testing.T) {
+	assert := require.New(t)
+
+	store := &fakeStore{}
+	stopped := make(chan struct{}, 1)
+	le := New(store, Config{
+		Name:             "test",
+		ID:               "me",
+		TTL:              time.Hour,
+		OnStoppedLeading: func() { stopped <- struct{}{} },
+	})
+	assert.Equal(40*time.Minute, le.cfg.RenewDeadline)
+
+	le.campaign()
+	assert.True(le.IsLeader())
+
+	store.set("me", errors.New("etcd unavailable"))
+	le.lock.Lock()
+	le.lastRenewal = time.Now().Add(-41 * time.Minute)
+	le.lock.Unlock()
+	// steps down before the term expires at lastRenewal+TTL
+	le.campaign()
+	assert.False(le.IsLeader())
+	assert.Equal("", le.Leader())
+	assert.Len(stopped, 1)
+}
+
+func TestLeaderElectorResign(t *testing.T) {
+	assert := require.New(t)
+
+	store := &fakeStore{}
+	le := New(store, Config{Name: "test", ID: "me", TTL: time.Hour})
+	stop := make(chan struct{})
+	close(stop)
+	le.Run(stop)
+
+	assert.False(le.IsLeader())
+	leader, err := store.GetLeader("test")
+	assert.Nil(err)
+	assert.Equal("", leader)
+}
@@ -2,7 +2,11 @@ package main
 
 import (
 	"fmt"
+	"log/syslog"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/urfave/cli"
@@ -10,10 +14,12 @@ import (
 	"github.com/rancher/longhorn-manager/api"
 	"github.com/rancher/longhorn-manager/backups"
 	"github.com/rancher/longhorn-manager/controller"
+	"github.com/rancher/longhorn-manager/leaderelection"
 	"github.com/rancher/longhorn-manager/manager"
 	"github.com/rancher/longhorn-manager/orch"
-	"github.com/rancher/longhorn-manager/orch/docker"
+	_ "github.com/rancher/longhorn-manager/orch/docker"
 	"github.com/rancher/longhorn-manager/types"
+	"github.com/rancher/longhorn-manager/util"
 	"github.com/rancher/longhorn-manager/util/daemon"
 	"github.com/rancher/longhorn-manager/util/server"
 )
@@ -25,8 +31,6 @@ const (
 var VERSION = "0.1.0"
 
 func main() {
-	logrus.SetFormatter(&logrus.TextFormatter{ForceColors: true})
-
 	app := cli.NewApp()
 	app.Version = VERSION
 	app.Usage = "Rancher Longhorn storage driver/orchestration"
@@ -35,26 +39,157 @@ func main() {
 	app.Flags = []cli.Flag{
 		cli.BoolFlag{
 			Name:   "debug, d",
-			Usage:  "enable debug logging level",
+			Usage:  "enable the /debug HTTP endpoints and debug logging level (deprecated, use --log-level debug)",
 			EnvVar: "RANCHER_DEBUG",
 		},
+		cli.StringFlag{
+			Name:   "log-level",
+			Usage:  "Choose log level: trace, debug, info, warn or error. Trace is debug with API request and response bodies",
+			EnvVar: "LONGHORN_LOG_LEVEL",
+			Value:  "info",
+		},
+		cli.StringFlag{
+			Name:   "log-format",
+			Usage:  "Choose log format: text or json",
+			EnvVar: "LONGHORN_LOG_FORMAT",
+			Value:  "text",
+		},
+		cli.StringFlag{
+			Name:  "audit-log",
+			Usage: "Choose where to log API audit events: stderr or syslog",
+			Value: "stderr",
+		},
+		cli.DurationFlag{
+			Name:  "recurring-backfill-window",
+			Usage: "run recurring jobs missed within this period before start, 0 to disable",
+			Value: manager.RecurringBackfillWindow,
+		},
+		cli.IntFlag{
+			Name:  "rebuild-concurrency",
+			Usage: "maximum number of replicas rebuilt at once",
+			Value: manager.RebuildConcurrency,
+		},
+		cli.IntFlag{
+			Name:  "max-replicas-per-host",
+			Usage: "reject volumes with more replicas than this many times the number of hosts",
+			Value: manager.MaxReplicasPerHost,
+		},
+		cli.IntFlag{
+			Name:  "faulted-recovery-attempts",
+			Usage: "attempts to recover a faulted volume if the faultedVolumeAutoRecovery setting is on",
+			Value: manager.FaultedRecoveryAttempts,
+		},
+		cli.StringFlag{
+			Name:  "backup-s3-endpoint",
+			Usage: "URL of the S3 compatible server (e.g. MinIO) of s3:// backup targets, unless set by the backupS3Endpoint setting",
+		},
+		cli.DurationFlag{
+			Name:  "nfs-mount-timeout",
+			Usage: "how long to wait for the NFS share of an nfs:// backup target to mount",
+			Value: backups.NFSMountTimeout,
+		},
+		cli.DurationFlag{
+			Name:  "replica-states-timeout",
+			Usage: "restart the controller of a volume if it doesn't report replica states in time",
+			Value: controller.ReplicaStatesTimeout,
+		},
+		cli.DurationFlag{
+			Name:  "replica-health-timeout",
+			Usage: "wait this long for the replicas to accept connections when attaching a volume",
+			Value: manager.ReplicaHealthTimeout,
+		},
+		cli.IntFlag{
+			Name:  "backup-concurrent-limit",
+			Usage: "maximum number of backups running at once, the others are queued",
+			Value: controller.BackupConcurrentLimit,
+		},
+		cli.IntFlag{
+			Name:  "event-log-size",
+			Usage: "number of the latest events served at /v1/events",
+			Value: manager.EventLogSize,
+		},
+		cli.DurationFlag{
+			Name:  "gc-interval",
+			Usage: "remove containers of deleted volumes at this interval, 0 to disable",
+			Value: manager.GCInterval,
+		},
 		cli.StringFlag{
 			Name:  "orchestrator",
-			Usage: "Choose orchestrator: docker",
+			Usage: "Choose orchestrator: " + strings.Join(orch.Names(), ", "),
 			Value: "docker",
 		},
 
+		cli.StringFlag{
+			Name:  "tls-cert",
+			Usage: "TLS certificate file, the API port serves HTTPS only if set together with --tls-key; also the client certificate to the other managers",
+		},
+		cli.StringFlag{
+			Name:  "tls-key",
+			Usage: "TLS private key file",
+		},
+		cli.StringFlag{
+			Name:  "tls-ca",
+			Usage: "CA certificate file to verify API client certificates (mutual TLS) and the other managers",
+		},
+		cli.StringFlag{
+			Name:  "basic-auth-file",
+			Usage: "htpasswd file with SHA1 hashes (htpasswd -s) of the users allowed to the TCP API, a stopgap until RBAC/OIDC",
+		},
+		cli.StringFlag{
+			Name:  "peer-credentials-file",
+			Usage: "file with the user:password the manager authenticates with to the other managers, required with --basic-auth-file",
+		},
+
 		cli.StringFlag{
 			Name:   orch.EngineImageParam,
 			EnvVar: "LONGHORN_ENGINE_IMAGE",
 			Usage:  "Specify Longhorn engine image",
 		},
 
+		cli.StringFlag{
+			Name:  orch.NodeTagsParam,
+			Usage: "tags of the current node for replica placement, in format `rack=A,zone=us-east-1a`",
+		},
+		cli.IntFlag{
+			Name:  orch.BasePortParam,
+			Usage: "base port of the cluster, controllers and replicas listen on the next two ports, the manager API on it unless --manager-port is set",
+			Value: api.DefaultPort,
+		},
+		cli.IntFlag{
+			Name:  orch.ManagerPortParam,
+			Usage: "port of the manager API, the base port by default",
+		},
+		cli.StringFlag{
+			Name:  orch.PeerAddressParam,
+			Usage: "API address `host:port` advertised to the other managers, by default the container IP and the manager port",
+		},
+		cli.IntFlag{
+			Name:  orch.EngineReplicaTimeoutParam,
+			Usage: "seconds the controller waits for a replica to respond before marking it ERR",
+			Value: orch.DefaultEngineReplicaTimeout,
+		},
+		cli.IntFlag{
+			Name:  orch.MaxVolumesPerNodeParam,
+			Usage: "maximum number of replicas scheduled to the current node, 0 for no limit",
+		},
+
 		// Docker
 		cli.StringSliceFlag{
 			Name:  "etcd-servers",
 			Usage: "etcd server ip and port, in format `http://etcd1:2379,http://etcd2:2379`",
 		},
+		cli.StringFlag{
+			Name:  "etcd-tls-cert, etcd-auth-cert",
+			Usage: "client certificate file for etcd servers requiring client certificate authentication, with --etcd-tls-key",
+		},
+		cli.StringFlag{
+			Name:  "etcd-tls-key, etcd-auth-key",
+			Usage: "client certificate key file for etcd",
+		},
+		cli.StringFlag{
+			Name:  "etcd-tls-ca",
+			Usage: "CA file to verify the etcd servers with, the system CAs by default",
+		},
 		cli.StringFlag{
 			Name:  "etcd-prefix",
 			Usage: "the prefix using with etcd server",
@@ -64,6 +199,10 @@ func main() {
 			Name:  "docker-network",
 			Usage: "use specified docker network, can be omitted for auto detection",
 		},
+		cli.BoolFlag{
+			Name:  "enable-leader-election",
+			Usage: "elect a leader among the managers of the host, only the leader monitors volumes while followers forward writes to it",
+		},
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -78,35 +217,195 @@ func RunManager(c *cli.Context) error {
 		err error
 	)
 
+	switch logFormat := c.String("log-format"); logFormat {
+	case "text":
+		logrus.SetFormatter(&logrus.TextFormatter{ForceColors: true})
+	case "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano})
+	default:
+		return fmt.Errorf("Invalid log format %v", logFormat)
+	}
+
+	logLevel := c.String("log-level")
 	if c.Bool("debug") {
+		logrus.Warn("--debug is deprecated, use --log-level debug")
+		api.DebugEndpoints = true
+		if logLevel == "info" {
+			logLevel = "debug"
+		}
+	}
+	switch logLevel {
+	case "trace":
 		logrus.SetLevel(logrus.DebugLevel)
+		api.TraceRequests = true
+	case "debug", "info", "warn", "error":
+		level, _ := logrus.ParseLevel(logLevel)
+		logrus.SetLevel(level)
+	default:
+		return fmt.Errorf("Invalid log level %v", logLevel)
+	}
+
+	switch auditLog := c.String("audit-log"); auditLog {
+	case "stderr":
+	case "syslog":
+		w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_AUTHPRIV, "longhorn-manager")
+		if err != nil {
+			return fmt.Errorf("Cannot connect to syslog for audit log: %v", err)
+		}
+		api.AuditLogger = logrus.New()
+		api.AuditLogger.Out = w
+		api.AuditLogger.Formatter = &logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano}
+	default:
+		return fmt.Errorf("Invalid audit log %v", auditLog)
+	}
+
+	tlsCert, tlsKey, tlsCA := c.String("tls-cert"), c.String("tls-key"), c.String("tls-ca")
+	if (tlsCert == "") != (tlsKey == "") {
+		return fmt.Errorf("Must specify both --tls-cert and --tls-key")
+	}
+	if tlsCA != "" && tlsCert == "" {
+		return fmt.Errorf("Must specify --tls-cert and --tls-key to use --tls-ca")
+	}
+	if util.BasePort = c.Int(orch.BasePortParam); util.BasePort < 1 || util.BasePort > 65535-4 {
+		return fmt.Errorf("invalid base port %v", util.BasePort)
+	}
+	managerPort := c.Int(orch.ManagerPortParam)
+	if managerPort == 0 {
+		managerPort = util.BasePort
+	}
+	if managerPort < 1 || managerPort > 65535 {
+		return fmt.Errorf("invalid manager port %v", managerPort)
+	}
+	var authUsers api.Htpasswd
+	if file := c.String("basic-auth-file"); file != "" {
+		if authUsers, err = api.LoadHtpasswd(file); err != nil {
+			return err
+		}
+		peerFile := c.String("peer-credentials-file")
+		if peerFile == "" {
+			return fmt.Errorf("Must specify --peer-credentials-file to use --basic-auth-file")
+		}
+		if util.PeerUser, util.PeerPassword, err = api.LoadPeerCredentials(peerFile); err != nil {
+			return err
+		}
+		if !authUsers.Authenticate(util.PeerUser, util.PeerPassword) {
+			return fmt.Errorf("Peer credentials of user %v are not accepted by --basic-auth-file", util.PeerUser)
+		}
+	}
+	tcpServer := server.NewTCPServer(fmt.Sprintf(":%v", managerPort))
+	if tlsCert != "" {
+		tlsConfig, err := server.TLSConfig(tlsCert, tlsKey, tlsCA)
+		if err != nil {
+			return err
+		}
+		tcpServer = server.NewTLSServer(fmt.Sprintf(":%v", managerPort), tlsConfig)
+		clientTLSConfig, err := server.ClientTLSConfig(tlsCert, tlsKey, tlsCA)
+		if err != nil {
+			return err
+		}
+		util.PeerScheme = "https"
+		util.PeerTransport = &http.Transport{TLSClientConfig: clientTLSConfig}
 	}
 
 	if c.String(orch.EngineImageParam) == "" {
 		return fmt.Errorf("Must specify %v", orch.EngineImageParam)
 	}
 
-	orcName := c.String("orchestrator")
-	if orcName == "docker" {
-		orc, err = docker.New(c)
-	} else {
-		err = fmt.Errorf("Invalid orchestrator %v", orcName)
+	manager.RecurringBackfillWindow = c.Duration("recurring-backfill-window")
+	manager.GCInterval = c.Duration("gc-interval")
+	controller.ReplicaStatesTimeout = c.Duration("replica-states-timeout")
+	manager.ReplicaHealthTimeout = c.Duration("replica-health-timeout")
+	backups.NFSMountTimeout = c.Duration("nfs-mount-timeout")
+	if manager.RebuildConcurrency = c.Int("rebuild-concurrency"); manager.RebuildConcurrency < 1 {
+		return fmt.Errorf("invalid rebuild concurrency %v", manager.RebuildConcurrency)
+	}
+	if manager.MaxReplicasPerHost = c.Int("max-replicas-per-host"); manager.MaxReplicasPerHost < 1 {
+		return fmt.Errorf("invalid max replicas per host %v", manager.MaxReplicasPerHost)
+	}
+	if controller.BackupConcurrentLimit = c.Int("backup-concurrent-limit"); controller.BackupConcurrentLimit < 1 {
+		return fmt.Errorf("invalid backup concurrent limit %v", controller.BackupConcurrentLimit)
 	}
+	if manager.EventLogSize = c.Int("event-log-size"); manager.EventLogSize < 1 {
+		return fmt.Errorf("invalid event log size %v", manager.EventLogSize)
+	}
+	if manager.FaultedRecoveryAttempts = c.Int("faulted-recovery-attempts"); manager.FaultedRecoveryAttempts < 1 {
+		return fmt.Errorf("invalid faulted recovery attempts %v", manager.FaultedRecoveryAttempts)
+	}
+
+	orcName := c.String("orchestrator")
+	orc, err = orch.New(orcName, c)
 	if err != nil {
 		return err
 	}
 
+	backups.S3Endpoint = s3Endpoint(orc, c.String("backup-s3-endpoint"))
+
 	man := manager.New(orc, manager.Monitor(controller.Get), controller.Get, backups.New)
-	if err := man.Start(); err != nil {
-		return err
-	}
 
 	proxy := api.Proxy()
 
+	api.Version = VERSION
+	api.Orchestrator = orcName
 	s := api.NewServer(man, orc, proxy)
+	api.AuditPeer = api.PeerManagerAddr(man, orc)
+
+	if c.Bool("enable-leader-election") {
+		le, err := newLeaderElector(orc, man)
+		if err != nil {
+			return err
+		}
+		s.SetLeaderLocator(le)
+		go le.Run(nil)
+	} else if err := man.Start(); err != nil {
+		return err
+	}
 
 	go server.NewUnixServer(sockFile).Serve(api.Handler(s))
-	go server.NewTCPServer(fmt.Sprintf(":%v", api.DefaultPort)).Serve(api.Handler(s))
+	tcpHandler := api.Handler(s)
+	if authUsers != nil {
+		tcpHandler = api.BasicAuthHandler(authUsers, tcpHandler)
+	}
+	go tcpServer.Serve(tcpHandler)
 
 	return daemon.WaitForExit()
 }
+
+// s3Endpoint prefers the backupS3Endpoint setting over the flag
+func s3Endpoint(settings types.Settings, flag string) func() string {
+	return func() string {
+		si, err := settings.GetSettings()
+		if err != nil {
+			logrus.Warnf("fail to read backup S3 endpoint setting: %v", err)
+		}
+		if si != nil && si.BackupS3Endpoint != "" {
+			return si.BackupS3Endpoint
+		}
+		return flag
+	}
+}
+
+// newLeaderElector elects the manager monitoring the volumes of the host,
+// the leader exits once it loses the leadership so it never races the new one
+func newLeaderElector(orc types.Orchestrator, man types.VolumeManager) (*leaderelection.LeaderElector, error) {
+	store, ok := orc.(leaderelection.Store)
+	if !ok {
+		return nil, fmt.Errorf("Orchestrator doesn't support leader election")
+	}
+	hostID := orc.GetCurrentHostID()
+	address, err := orc.GetAddress(hostID)
+	if err != nil {
+		return nil, err
+	}
+	return leaderelection.New(store, leaderelection.Config{
+		Name: "manager-" + hostID,
+		ID:   address,
+		OnStartedLeading: func() {
+			if err := man.Start(); err != nil {
+				logrus.Fatalf("Fail to start volume manager: %v", err)
+			}
+		},
+		OnStoppedLeading: func() {
+			logrus.Fatalf("Lost leadership of host %v, exiting", hostID)
+		},
+	}), nil
+}
@@ -0,0 +1,171 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+
+	"github.com/rancher/longhorn-manager/controller"
+	"github.com/rancher/longhorn-manager/types"
+)
+
+var (
+	AutoScaleUpPeriod   = time.Minute * 5
+	AutoScaleDownPeriod = time.Minute * 30
+)
+
+type autoScaler struct {
+	enabled            bool
+	readIOPSThreshold  int64
+	scaleDownThreshold int64
+	minReplicas        int
+	maxReplicas        int
+
+	aboveSince time.Time
+	belowSince time.Time
+}
+
+func newAutoScaler(volume *types.VolumeInfo) *autoScaler {
+	minReplicas := volume.MinAutoScaleReplicas
+	if minReplicas < 1 {
+		minReplicas = 1
+	}
+	return &autoScaler{
+		enabled:            volume.AutoScaleReplicas,
+		readIOPSThreshold:  volume.AutoScaleReadIOPSThreshold,
+		scaleDownThreshold: volume.AutoScaleScaleDownThreshold,
+		minReplicas:        minReplicas,
+		maxReplicas:        volume.MaxAutoScaleReplicas,
+	}
+}
+
+// evaluate takes a read IOPS sample made at the time now and returns the
+// change to apply to the number of replicas: 1, -1 or 0
+func (as *autoScaler) evaluate(numberOfReplicas int, readIOPS int64, now time.Time) int {
+	if !as.enabled {
+		return 0
+	}
+	if readIOPS > as.readIOPSThreshold {
+		as.belowSince = time.Time{}
+		if as.aboveSince.IsZero() {
+			as.aboveSince = now
+		}
+		if now.Sub(as.aboveSince) > AutoScaleUpPeriod && numberOfReplicas < as.maxReplicas {
+			as.aboveSince = time.Time{}
+			return 1
+		}
+		return 0
+	}
+	as.aboveSince = time.Time{}
+	if readIOPS < as.scaleDownThreshold {
+		if as.belowSince.IsZero() {
+			as.belowSince = now
+		}
+		if now.Sub(as.belowSince) > AutoScaleDownPeriod && numberOfReplicas > as.minReplicas {
+			as.belowSince = time.Time{}
+			return -1
+		}
+		return 0
+	}
+	as.belowSince = time.Time{}
+	return 0
+}
+
+func (man *volumeManager) getAutoScaler(volume *types.VolumeInfo) *autoScaler {
+	man.Lock()
+	defer man.Unlock()
+	as := man.autoScalers[volume.Name]
+	if as == nil {
+		as = newAutoScaler(volume)
+		man.autoScalers[volume.Name] = as
+	}
+	return as
+}
+
+func (man *volumeManager) setAutoScaler(volume *types.VolumeInfo) {
+	man.Lock()
+	defer man.Unlock()
+	man.autoScalers[volume.Name] = newAutoScaler(volume)
+}
+
+func (man *volumeManager) autoScale(ctrl types.Controller, volume *types.VolumeInfo, goodReplicas []*types.ReplicaInfo) error {
+	as := man.getAutoScaler(volume)
+	if !as.enabled {
+		return nil
+	}
+	stats, err := ctrl.IOStats()
+	if errors.Cause(err) == controller.ErrEngineUnsupported {
+		logrus.Debugf("not auto-scaling volume '%s': %v", volume.Name, err)
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to get I/O stats, volume '%s'", volume.Name)
+	}
+	delta := as.evaluate(volume.NumberOfReplicas, stats.ReadIOPS, time.Now())
+	if delta == 0 {
+		return nil
+	}
+
+	token, err := man.orc.LockVolume(volume.Name)
+	if err != nil {
+		return errors.Wrapf(err, "unable to lock volume '%s' to auto-scale", volume.Name)
+	}
+	defer man.unlockVolume(volume.Name, token)
+
+	v, err := man.orc.GetVolume(volume.Name)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get volume '%s'", volume.Name)
+	}
+	if v == nil {
+		return errors.Errorf("cannot find volume '%s'", volume.Name)
+	}
+	v.NumberOfReplicas = volume.NumberOfReplicas + delta
+	if err := man.orc.UpdateVolume(v); err != nil {
+		return errors.Wrapf(err, "unable to update volume '%s'", volume.Name)
+	}
+	volume.NumberOfReplicas = v.NumberOfReplicas
+	logrus.Infof("auto-scaled volume '%s' to %v replicas, read IOPS %v", volume.Name, volume.NumberOfReplicas, stats.ReadIOPS)
+
+	if delta < 0 && len(goodReplicas) > volume.NumberOfReplicas {
+		if replica := unpinnedReplica(v, goodReplicas); replica != nil {
+			return man.removeReplicaFromController(ctrl, v, replica)
+		}
+		logrus.Warnf("all replicas of volume '%s' are pinned, not removing any", volume.Name)
+	}
+	return nil
+}
+
+// unpinnedReplica returns the last of replicas not pinned to a host
+func unpinnedReplica(volume *types.VolumeInfo, replicas []*types.ReplicaInfo) *types.ReplicaInfo {
+	pinned := map[string]bool{}
+	for _, r := range volume.Replicas {
+		if r.PinnedHostID != "" {
+			pinned[r.Address] = true
+		}
+	}
+	for i := len(replicas) - 1; i >= 0; i-- {
+		if !pinned[replicas[i].Address] {
+			return replicas[i]
+		}
+	}
+	return nil
+}
+
+func (man *volumeManager) removeReplicaFromController(ctrl types.Controller, volume *types.VolumeInfo, replica *types.ReplicaInfo) error {
+	if err := ctrl.RemoveReplica(replica); err != nil {
+		return errors.Wrapf(err, "failed to remove replica '%s' from volume '%s'", replica.Address, volume.Name)
+	}
+	for _, r := range volume.Replicas {
+		if r.Address != replica.Address {
+			continue
+		}
+		if _, err := man.orc.StopInstance(&r.InstanceInfo); err != nil {
+			return errors.Wrapf(err, "failed to stop replica '%s' of volume '%s'", r.Name, volume.Name)
+		}
+		if _, err := man.orc.RemoveInstance(&r.InstanceInfo); err != nil {
+			return errors.Wrapf(err, "failed to remove replica '%s' of volume '%s'", r.Name, volume.Name)
+		}
+	}
+	return nil
+}
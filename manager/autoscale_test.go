@@ -0,0 +1,142 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+const autoScaleTick = 2 * time.Second
+
+func simulateAutoScale(as *autoScaler, replicas int, readIOPS int64, start time.Time, d time.Duration) (int, time.Time) {
+	now := start
+	for end := start.Add(d); now.Before(end); now = now.Add(autoScaleTick) {
+		replicas += as.evaluate(replicas, readIOPS, now)
+	}
+	return replicas, now
+}
+
+func TestAutoScalerEvaluate(t *testing.T) {
+	assert := require.New(t)
+
+	as := newAutoScaler(&types.VolumeInfo{
+		AutoScaleReplicas:           true,
+		AutoScaleReadIOPSThreshold:  1000,
+		AutoScaleScaleDownThreshold: 100,
+		MinAutoScaleReplicas:        2,
+		MaxAutoScaleReplicas:        4,
+	})
+	now := time.Now()
+
+	// sustained load below the up period doesn't scale
+	replicas, now := simulateAutoScale(as, 2, 2000, now, AutoScaleUpPeriod)
+	assert.Equal(2, replicas)
+
+	// a dip between the thresholds resets the timer
+	replicas, now = simulateAutoScale(as, replicas, 500, now, autoScaleTick)
+	assert.Equal(2, replicas)
+	replicas, now = simulateAutoScale(as, replicas, 2000, now, AutoScaleUpPeriod)
+	assert.Equal(2, replicas)
+
+	replicas, now = simulateAutoScale(as, replicas, 2000, now, AutoScaleUpPeriod+autoScaleTick*2)
+	assert.Equal(3, replicas)
+
+	// capped at max replicas
+	replicas, now = simulateAutoScale(as, replicas, 2000, now, AutoScaleUpPeriod*5)
+	assert.Equal(4, replicas)
+
+	replicas, now = simulateAutoScale(as, replicas, 10, now, AutoScaleDownPeriod)
+	assert.Equal(4, replicas)
+	replicas, now = simulateAutoScale(as, replicas, 10, now, autoScaleTick*2)
+	assert.Equal(3, replicas)
+
+	// floored at min replicas
+	replicas, _ = simulateAutoScale(as, replicas, 10, now, AutoScaleDownPeriod*5)
+	assert.Equal(2, replicas)
+
+	as.enabled = false
+	assert.Equal(0, as.evaluate(2, 2000, now.Add(AutoScaleUpPeriod*10)))
+}
+
+func TestUpdateAutoScale(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+
+	assert.NotNil(env.man.UpdateAutoScale("vol1", true, 0, 0, 4))
+	assert.NotNil(env.man.UpdateAutoScale("vol1", true, 1000, 1000, 4))
+	assert.NotNil(env.man.UpdateAutoScale("vol1", true, 1000, 100, 1))
+	assert.NotNil(env.man.UpdateAutoScale("vol2", true, 1000, 100, 4))
+
+	// being updated by another manager
+	token, err := env.orc.LockVolume("vol1")
+	assert.Nil(err)
+	assert.NotNil(env.man.UpdateAutoScale("vol1", true, 1000, 100, 4))
+	assert.Nil(env.orc.UnlockVolume("vol1", token))
+
+	assert.Nil(env.man.UpdateAutoScale("vol1", true, 1000, 100, 4))
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	assert.True(volume.AutoScaleReplicas)
+	assert.Equal(int64(1000), volume.AutoScaleReadIOPSThreshold)
+	assert.Equal(int64(100), volume.AutoScaleScaleDownThreshold)
+	assert.Equal(2, volume.MinAutoScaleReplicas)
+	assert.Equal(4, volume.MaxAutoScaleReplicas)
+
+	as := env.man.getAutoScaler(volume)
+	assert.True(as.enabled)
+	assert.Equal(2, as.minReplicas)
+
+	assert.Nil(env.man.UpdateAutoScale("vol1", false, 0, 0, 0))
+	volume, err = env.man.Get("vol1")
+	assert.Nil(err)
+	assert.False(volume.AutoScaleReplicas)
+	assert.False(env.man.getAutoScaler(volume).enabled)
+}
+
+func TestAutoScaleEngineUnsupported(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+	assert.Nil(env.man.UpdateAutoScale("vol1", true, 1000, 100, 4))
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+
+	ctrl := env.controller("vol1")
+	ctrl.engineUnsupported = true
+	assert.Nil(env.man.autoScale(ctrl, volume, nil))
+
+	ctrl.engineUnsupported = false
+	assert.Nil(env.man.autoScale(ctrl, volume, nil))
+}
+
+func TestAutoScaleLock(t *testing.T) {
+	assert := require.New(t)
+
+	defer func(period time.Duration) { AutoScaleUpPeriod = period }(AutoScaleUpPeriod)
+	AutoScaleUpPeriod = -time.Second
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+	assert.Nil(env.man.UpdateAutoScale("vol1", true, 1000, 100, 4))
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	ctrl := env.controller("vol1")
+	ctrl.readIOPS = 2000
+
+	// being updated by another manager
+	token, err := env.orc.LockVolume("vol1")
+	assert.Nil(err)
+	assert.NotNil(env.man.autoScale(ctrl, volume, nil))
+	assert.Equal(2, env.orc.volumes["vol1"].NumberOfReplicas)
+	assert.Nil(env.orc.UnlockVolume("vol1", token))
+
+	assert.Nil(env.man.autoScale(ctrl, volume, nil))
+	assert.Equal(3, env.orc.volumes["vol1"].NumberOfReplicas)
+	assert.Empty(env.orc.locks)
+}
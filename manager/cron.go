@@ -18,8 +18,15 @@ const (
 	BackupJob = "backupJob"
 
 	retainBackupSnapshots = 2
+
+	DefaultScheduleCount = 5
+	MaxScheduleCount     = 100
 )
 
+// RecurringBackfillWindow is how far back in time the manager looks for
+// recurring jobs missed while it was down
+var RecurringBackfillWindow = 24 * time.Hour
+
 type taskCons func(runner *jobRunner, job *types.RecurringJob, si *types.SettingsInfo) Task
 
 var tasks = map[string]taskCons{
@@ -27,6 +34,16 @@ var tasks = map[string]taskCons{
 	types.BackupTaskName:   BackupTask,
 }
 
+// TaskNames returns the sorted names of the tasks recurring jobs can run
+func TaskNames() []string {
+	names := []string{}
+	for name := range tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 type jobRunner struct {
 	volume   *types.VolumeInfo
 	ctrl     types.Controller
@@ -69,24 +86,104 @@ func RunJobs(volume *types.VolumeInfo, ctrl types.Controller, settings types.Set
 	}
 }
 
+// ValidateJobs checks the recurring jobs have unique names, known tasks,
+// retain at least 1 snapshot or backup and have cron schedules robfig/cron
+// can parse: 6 fields starting with seconds, or descriptors like @daily and
+// @every 1h
 func ValidateJobs(jobs []*types.RecurringJob) error {
-	c := cron.NewWithLocation(time.UTC)
+	names := map[string]bool{}
 	for _, j := range jobs {
-		if t := tasks[j.Task]; t != nil {
-			if strings.TrimSpace(j.Name) != j.Name || j.Name == "" {
-				return errors.Errorf("job name cannot be empty, start or end with whitespace: '%s'", j.Name)
-			}
-			if _, ok := tasks[j.Task]; !ok {
-				return errors.Errorf("invalid task '%s'", j.Task)
-			}
-			if err := c.AddFunc(j.Cron, func() {}); err != nil {
-				return errors.Wrap(err, "cron job validation error")
-			}
+		if strings.TrimSpace(j.Name) != j.Name || j.Name == "" {
+			return errors.Errorf("job name cannot be empty, start or end with whitespace: '%s'", j.Name)
+		}
+		if names[j.Name] {
+			return errors.Errorf("duplicate job name '%s'", j.Name)
+		}
+		names[j.Name] = true
+		if _, ok := tasks[j.Task]; !ok {
+			return errors.Errorf("invalid task '%s' of job '%s', should be one of %v", j.Task, j.Name, TaskNames())
+		}
+		if _, err := cron.Parse(j.Cron); err != nil {
+			return errors.Wrapf(err, "invalid cron schedule '%s' of job '%s'", j.Cron, j.Name)
+		}
+		if j.Retain < 1 {
+			return errors.Errorf("invalid retain count %v of job '%s', should keep at least 1 snapshot or backup", j.Retain, j.Name)
 		}
 	}
 	return nil
 }
 
+// lastJobRun returns the creation time of the latest snapshot taken by job
+func lastJobRun(job *types.RecurringJob, snapshots []*types.SnapshotInfo) time.Time {
+	last := time.Time{}
+	for _, s := range snapshots {
+		if s.Removed || s.Labels[JobName] != job.Name {
+			continue
+		}
+		created, err := util.ParseTime(s.Created)
+		if err != nil {
+			logrus.Warnf("unable to parse creation time '%s' of snapshot '%s'", s.Created, s.Name)
+			continue
+		}
+		if created.After(last) {
+			last = created
+		}
+	}
+	return last
+}
+
+// missedJobs returns the jobs that should have fired between since (or their
+// last run, if later) and now, but didn't
+func missedJobs(jobs []*types.RecurringJob, snapshots []*types.SnapshotInfo, since, now time.Time) []*types.RecurringJob {
+	missed := []*types.RecurringJob{}
+	for _, job := range jobs {
+		if tasks[job.Task] == nil {
+			continue
+		}
+		schedule, err := cron.Parse(job.Cron)
+		if err != nil {
+			logrus.Warnf("unable to parse cron spec '%s' of recurring job '%s'", job.Cron, job.Name)
+			continue
+		}
+		from := since
+		if last := lastJobRun(job, snapshots); last.After(from) {
+			from = last
+		}
+		if next := schedule.Next(from.UTC()); !next.IsZero() && next.Before(now) {
+			missed = append(missed, job)
+		}
+	}
+	return missed
+}
+
+// nextJobRuns returns the next count times after now any of the jobs will
+// fire. Jobs are scheduled in UTC (see setJobs), so are the returned times.
+func nextJobRuns(jobs []*types.RecurringJob, now time.Time, count int) []time.Time {
+	runs := []time.Time{}
+	for _, job := range jobs {
+		if tasks[job.Task] == nil {
+			continue
+		}
+		schedule, err := cron.Parse(job.Cron)
+		if err != nil {
+			logrus.Warnf("unable to parse cron spec '%s' of recurring job '%s'", job.Cron, job.Name)
+			continue
+		}
+		t := now.UTC()
+		for i := 0; i < count; i++ {
+			if t = schedule.Next(t); t.IsZero() {
+				break
+			}
+			runs = append(runs, t)
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Before(runs[j]) })
+	if len(runs) > count {
+		runs = runs[:count]
+	}
+	return runs
+}
+
 func (runner *jobRunner) setJobs(jobs []*types.RecurringJob) *cron.Cron {
 	si, err := runner.settings.GetSettings()
 	if err != nil {
@@ -221,11 +318,13 @@ func (bt *backupTask) Run() error {
 	if _, err := bt.runner.ctrl.SnapshotOps().Create(name, map[string]string{JobName: bt.job.Name, BackupJob: bt.job.Name}); err != nil {
 		return errors.Wrapf(err, "error creating snapshot for recurring backup '%s', volume '%s'", name, bt.runner.volume.Name)
 	}
-	bt.runner.ctrl.BgTaskQueue().Put(&types.BgTask{Task: types.BackupBgTask{
+	t := &types.BackupBgTask{
 		Snapshot:     name,
 		BackupTarget: bt.backupTarget,
-		CleanupHook:  bt.cleanup,
-	}})
+	}
+	// the controller sets BackupURL once the backup is created
+	t.CleanupHook = func() error { return bt.cleanup(t.BackupURL != "") }
+	bt.runner.ctrl.BgTaskQueue().Put(&types.BgTask{Task: t})
 	return nil
 }
 
@@ -270,10 +369,16 @@ func (bt *backupTask) listBackups() ([]*types.BackupInfo, error) {
 	return bs, nil
 }
 
-func (bt *backupTask) cleanup() error {
+// cleanup removes the backup snapshots beyond the latest ones, and the
+// backups beyond the retain count if a new one was created, so a failing
+// backup doesn't remove the good ones
+func (bt *backupTask) cleanup(backedUp bool) error {
 	if err := bt.cleanupBackupSnapshots(); err != nil {
 		logrus.Errorf("%+v", errors.Wrap(err, "error cleaning up backup snapshots"))
 	}
+	if !backedUp {
+		return nil
+	}
 	return bt.cleanupBackups()
 }
 
@@ -0,0 +1,209 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/longhorn-manager/types"
+	"github.com/rancher/longhorn-manager/util"
+)
+
+func jobSnapshot(job string, created time.Time) *types.SnapshotInfo {
+	return &types.SnapshotInfo{
+		Name:    snapName(job),
+		Created: util.FormatTimeZ(created),
+		Labels:  map[string]string{JobName: job},
+	}
+}
+
+func TestMissedJobs(t *testing.T) {
+	assert := require.New(t)
+
+	now := time.Date(2017, 6, 1, 12, 30, 0, 0, time.UTC)
+	since := now.Add(-24 * time.Hour)
+	jobs := []*types.RecurringJob{
+		{Name: "hourly-recent", Cron: "@every 1h", Task: types.SnapshotTaskName},
+		{Name: "hourly-never", Cron: "@every 1h", Task: types.SnapshotTaskName},
+		{Name: "daily-recent", Cron: "0 0 0 * * *", Task: types.BackupTaskName},
+		{Name: "daily-old", Cron: "0 0 0 * * *", Task: types.BackupTaskName},
+		{Name: "unknown", Cron: "@every 1h", Task: "unknown"},
+	}
+	snapshots := []*types.SnapshotInfo{
+		jobSnapshot("hourly-recent", now.Add(-10*time.Minute)),
+		jobSnapshot("hourly-recent", now.Add(-70*time.Minute)),
+		jobSnapshot("daily-recent", time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)),
+		jobSnapshot("daily-old", time.Date(2017, 5, 29, 0, 0, 0, 0, time.UTC)),
+	}
+
+	missed := missedJobs(jobs, snapshots, since, now)
+	names := []string{}
+	for _, job := range missed {
+		names = append(names, job.Name)
+	}
+	assert.Equal([]string{"hourly-never", "daily-old"}, names)
+
+	assert.Len(missedJobs(jobs, snapshots, now, now), 0)
+}
+
+func TestRecurringJobBackfill(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+	assert.Nil(env.man.UpdateRecurring("vol1", []*types.RecurringJob{
+		{Name: "hourly", Cron: "@every 1h", Task: types.SnapshotTaskName, Retain: 24},
+	}))
+
+	since := time.Now().Add(-RecurringBackfillWindow)
+	assert.NotNil(env.man.RecurringJobBackfill("vol1", since))
+	assert.NotNil(env.man.RecurringJobBackfill("nonexistent", since))
+
+	assert.Nil(env.man.Attach("vol1", ""))
+	assert.Nil(env.man.RecurringJobBackfill("vol1", since))
+	snapshots, err := env.controller("vol1").List()
+	assert.Nil(err)
+	assert.Len(snapshots, 1)
+	assert.Equal("hourly", snapshots[0].Labels[JobName])
+
+	// up to one backfill per job
+	assert.Nil(env.man.RecurringJobBackfill("vol1", since))
+	snapshots, err = env.controller("vol1").List()
+	assert.Nil(err)
+	assert.Len(snapshots, 1)
+}
+
+func TestNextJobRuns(t *testing.T) {
+	assert := require.New(t)
+
+	newYork, err := time.LoadLocation("America/New_York")
+	assert.Nil(err)
+
+	// 02:30 doesn't exist in New York on 2017-03-12, jobs are scheduled in
+	// UTC and aren't affected
+	now := time.Date(2017, 3, 11, 12, 0, 0, 0, newYork)
+	daily := []*types.RecurringJob{{Name: "daily", Cron: "0 30 2 * * *", Task: types.SnapshotTaskName}}
+	runs := nextJobRuns(daily, now, 5)
+	assert.Len(runs, 5)
+	assert.Equal(time.Date(2017, 3, 12, 2, 30, 0, 0, time.UTC), runs[0])
+	for i := 1; i < len(runs); i++ {
+		assert.Equal(24*time.Hour, runs[i].Sub(runs[i-1]))
+	}
+
+	// 01:00-02:00 happens twice in New York on 2017-11-05, no run is
+	// skipped or repeated
+	now = time.Date(2017, 11, 5, 0, 30, 0, 0, newYork)
+	hourly := []*types.RecurringJob{{Name: "hourly", Cron: "0 0 * * * *", Task: types.SnapshotTaskName}}
+	runs = nextJobRuns(hourly, now, 4)
+	assert.Len(runs, 4)
+	assert.Equal(time.Date(2017, 11, 5, 5, 0, 0, 0, time.UTC), runs[0])
+	for i := 1; i < len(runs); i++ {
+		assert.Equal(time.Hour, runs[i].Sub(runs[i-1]))
+	}
+
+	// runs of all jobs are merged, unknown tasks and bad specs are skipped
+	jobs := append(daily, hourly...)
+	jobs = append(jobs,
+		&types.RecurringJob{Name: "unknown", Cron: "@every 1m", Task: "unknown"},
+		&types.RecurringJob{Name: "bad", Cron: "bad", Task: types.SnapshotTaskName},
+	)
+	now = time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	runs = nextJobRuns(jobs, now, 5)
+	assert.Equal([]time.Time{
+		now.Add(time.Hour),
+		now.Add(2 * time.Hour),
+		now.Add(150 * time.Minute),
+		now.Add(3 * time.Hour),
+		now.Add(4 * time.Hour),
+	}, runs)
+
+	assert.Len(nextJobRuns(nil, now, 5), 0)
+}
+
+func TestSnapshotSchedule(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+
+	runs, err := env.man.SnapshotSchedule("vol1", 0)
+	assert.Nil(err)
+	assert.Len(runs, 0)
+
+	assert.Nil(env.man.UpdateRecurring("vol1", []*types.RecurringJob{
+		{Name: "hourly", Cron: "@every 1h", Task: types.SnapshotTaskName, Retain: 24},
+	}))
+	runs, err = env.man.SnapshotSchedule("vol1", 0)
+	assert.Nil(err)
+	assert.Len(runs, DefaultScheduleCount)
+	runs, err = env.man.SnapshotSchedule("vol1", 2)
+	assert.Nil(err)
+	assert.Len(runs, 2)
+
+	_, err = env.man.SnapshotSchedule("vol1", MaxScheduleCount+1)
+	assert.NotNil(err)
+	_, err = env.man.SnapshotSchedule("nonexistent", 0)
+	assert.NotNil(err)
+}
+
+func TestValidateJobs(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Nil(ValidateJobs([]*types.RecurringJob{
+		{Name: "hourly", Cron: "@every 1h", Task: types.SnapshotTaskName, Retain: 5},
+		{Name: "daily", Cron: "0 0 2 * * *", Task: types.BackupTaskName, Retain: 7},
+	}))
+
+	for _, job := range []*types.RecurringJob{
+		{Name: "", Cron: "@every 1h", Task: types.SnapshotTaskName},
+		{Name: " hourly", Cron: "@every 1h", Task: types.SnapshotTaskName},
+		{Name: "hourly", Cron: "@every 1h", Task: "unknown"},
+		{Name: "hourly", Cron: "every hour", Task: types.SnapshotTaskName},
+		{Name: "hourly", Cron: "0 0 25 * * *", Task: types.SnapshotTaskName},
+		{Name: "hourly", Cron: "@every 1h", Task: types.SnapshotTaskName, Retain: -1},
+		{Name: "hourly", Cron: "@every 1h", Task: types.SnapshotTaskName, Retain: 0},
+		{Name: "hourly", Cron: "@every 1h", Task: "", Retain: 5},
+	} {
+		assert.NotNil(ValidateJobs([]*types.RecurringJob{job}), "%+v", job)
+	}
+
+	assert.NotNil(ValidateJobs([]*types.RecurringJob{
+		{Name: "hourly", Cron: "@every 1h", Task: types.SnapshotTaskName},
+		{Name: "hourly", Cron: "@every 2h", Task: types.BackupTaskName},
+	}))
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+	assert.NotNil(env.man.UpdateRecurring("vol1", []*types.RecurringJob{{Name: "hourly", Cron: "@every 1h", Task: "unknown"}}))
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Len(volume.RecurringJobs, 0)
+}
+
+func TestBackupTaskFailed(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	volume := env.createVolume(t, "vol1", 2)
+	ctrl := env.controller("vol1")
+	job := &types.RecurringJob{Name: "daily", Cron: "@daily", Task: types.BackupTaskName, Retain: 1}
+	task := BackupTask(newJobRunner(volume, ctrl, env.man.Settings()), job, &types.SettingsInfo{BackupTarget: "vfs:///var/lib/longhorn/backups"})
+
+	// failed backups keep the previous backups, so they aren't even listed
+	for i := 0; i < retainBackupSnapshots+1; i++ {
+		assert.Nil(task.Run())
+		bgTask := ctrl.queue.Take()
+		assert.NotNil(bgTask)
+		assert.Nil(bgTask.Task.(*types.BackupBgTask).CleanupHook())
+	}
+	snapshots, err := ctrl.List()
+	assert.Nil(err)
+	kept := 0
+	for _, s := range snapshots {
+		if !s.Removed {
+			kept++
+		}
+	}
+	assert.Equal(retainBackupSnapshots, kept)
+}
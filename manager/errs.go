@@ -1,8 +1,15 @@
 package manager
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"reflect"
 	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/rancher/longhorn-manager/controller"
 )
 
 type Errs []error
@@ -15,22 +22,83 @@ func (errs Errs) Error() string {
 	return strings.Join(ss, "\n\n")
 }
 
-type ControllerError interface {
-	Cause() error
+// Unwrap returns the errors for errors.Is and errors.As of the standard library
+func (errs Errs) Unwrap() []error {
+	return errs
+}
+
+// As finds the first of the errors that can be assigned to target, see As
+func (errs Errs) As(target interface{}) bool {
+	for _, err := range errs {
+		if As(err, target) {
+			return true
+		}
+	}
+	return false
 }
 
-type ctrlErr struct {
-	err error
+// As finds the first error in the chain of causes of err that can be assigned
+// to target, a non-nil pointer, and sets target to it. Errors with an
+// As(interface{}) bool method, like Errs, decide for themselves.
+func As(err error, target interface{}) bool {
+	val := reflect.ValueOf(target)
+	if target == nil || val.Kind() != reflect.Ptr || val.IsNil() {
+		panic("manager: As target must be a non-nil pointer")
+	}
+	targetType := val.Type().Elem()
+	for err != nil {
+		if reflect.TypeOf(err).AssignableTo(targetType) {
+			val.Elem().Set(reflect.ValueOf(err))
+			return true
+		}
+		if aser, ok := err.(interface {
+			As(interface{}) bool
+		}); ok && aser.As(target) {
+			return true
+		}
+		causer, ok := err.(interface {
+			Cause() error
+		})
+		if !ok {
+			return false
+		}
+		err = causer.Cause()
+	}
+	return false
+}
+
+// ControllerError is the failure to reach the controller of a volume.
+// Transient errors (timeouts) are retried, an unresponsive controller is
+// restarted, others fail the volume after MonitoringMaxRetries in a row.
+type ControllerError struct {
+	Err          error
+	Transient    bool
+	Unresponsive bool
 }
 
 func NewControllerError(err error) error {
-	return &ctrlErr{err}
+	if errors.Cause(err) == controller.ErrUnresponsive {
+		return &ControllerError{Err: err, Unresponsive: true}
+	}
+	return &ControllerError{Err: err, Transient: isTransientError(err)}
 }
 
-func (e *ctrlErr) Error() string {
-	return e.err.Error()
+func (e *ControllerError) Error() string {
+	return e.Err.Error()
 }
 
-func (e *ctrlErr) Cause() error {
-	return e.err
+func (e *ControllerError) Cause() error {
+	return e.Err
+}
+
+func isTransientError(err error) bool {
+	cause := errors.Cause(err)
+	if cause == context.DeadlineExceeded {
+		return true
+	}
+	if netErr, ok := cause.(net.Error); ok && (netErr.Timeout() || netErr.Temporary()) {
+		return true
+	}
+	// util.Execute killing the longhorn CLI
+	return strings.HasPrefix(cause.Error(), "Timeout executing")
 }
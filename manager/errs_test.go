@@ -0,0 +1,60 @@
+package manager
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/longhorn-manager/controller"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+func TestNewControllerError(t *testing.T) {
+	assert := require.New(t)
+
+	for _, err := range []error{
+		context.DeadlineExceeded,
+		errors.Wrap(timeoutError{}, "error requesting GET /v1/replicas"),
+		errors.New("Timeout executing: longhorn [--url http://10.0.0.1:9501 ls], output , error <nil>"),
+	} {
+		ctrlErr, ok := NewControllerError(err).(*ControllerError)
+		assert.True(ok)
+		assert.True(ctrlErr.Transient, err.Error())
+		assert.Equal(err, ctrlErr.Cause())
+	}
+
+	ctrlErr := NewControllerError(errors.New("Failed to execute: longhorn ls, exit status 1")).(*ControllerError)
+	assert.False(ctrlErr.Transient)
+	assert.False(ctrlErr.Unresponsive)
+
+	ctrlErr = NewControllerError(errors.Wrap(controller.ErrUnresponsive, "no replica states")).(*ControllerError)
+	assert.True(ctrlErr.Unresponsive)
+	assert.False(ctrlErr.Transient)
+}
+
+func TestErrsAs(t *testing.T) {
+	assert := require.New(t)
+
+	ctrlErr := NewControllerError(errors.Wrap(controller.ErrUnresponsive, "no replica states"))
+	errs := Errs{errors.New("failed to mark replica bad"), errors.Wrap(ctrlErr, "error checking volume")}
+
+	var target *ControllerError
+	assert.True(As(errs, &target))
+	assert.Equal(ctrlErr, target)
+	assert.True(As(errors.Wrap(errs, "check failed"), &target))
+
+	target = nil
+	assert.False(As(Errs{errors.New("failed")}, &target))
+	assert.Nil(target)
+	assert.Len(errs.Unwrap(), 2)
+}
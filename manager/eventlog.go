@@ -0,0 +1,68 @@
+package manager
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/rancher/longhorn-manager/types"
+	"github.com/rancher/longhorn-manager/util"
+)
+
+// EventLogSize is how many of the latest events the manager keeps in memory
+var EventLogSize = 1000
+
+// eventLog is a ring buffer of the latest events, numbered from 1
+type eventLog struct {
+	sync.Mutex
+
+	events []*types.EventInfo
+	next   int // where the next event goes once the buffer is full
+	lastID int64
+}
+
+func newEventLog(size int) *eventLog {
+	if size < 1 {
+		size = 1
+	}
+	return &eventLog{events: make([]*types.EventInfo, 0, size)}
+}
+
+func (l *eventLog) add(eventType, resource, message string) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.lastID++
+	e := &types.EventInfo{
+		ID:        strconv.FormatInt(l.lastID, 10),
+		Timestamp: util.Now(),
+		Type:      eventType,
+		Resource:  resource,
+		Message:   message,
+	}
+	if len(l.events) < cap(l.events) {
+		l.events = append(l.events, e)
+		return
+	}
+	l.events[l.next] = e
+	l.next = (l.next + 1) % len(l.events)
+}
+
+// since returns the events after the event with the ID, oldest first
+func (l *eventLog) since(id int64) []*types.EventInfo {
+	l.Lock()
+	defer l.Unlock()
+
+	events := []*types.EventInfo{}
+	for i := range l.events {
+		e := l.events[(l.next+i)%len(l.events)]
+		if eventID, _ := strconv.ParseInt(e.ID, 10, 64); eventID > id {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// ListEvents lists the latest events after the event with the ID
+func (man *volumeManager) ListEvents(sinceEventID int64) ([]*types.EventInfo, error) {
+	return man.events.since(sinceEventID), nil
+}
@@ -0,0 +1,55 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventLog(t *testing.T) {
+	assert := require.New(t)
+
+	l := newEventLog(3)
+	assert.Len(l.since(0), 0)
+	for _, msg := range []string{"a", "b"} {
+		l.add("ReplicaFailed", "volume/vol1", msg)
+	}
+	events := l.since(0)
+	assert.Len(events, 2)
+	assert.Equal("1", events[0].ID)
+	assert.Equal("a", events[0].Message)
+	assert.NotEmpty(events[0].Timestamp)
+
+	for _, msg := range []string{"c", "d", "e"} {
+		l.add("ReplicaFailed", "volume/vol1", msg)
+	}
+	messages := []string{}
+	for _, e := range l.since(0) {
+		messages = append(messages, e.Message)
+	}
+	assert.Equal([]string{"c", "d", "e"}, messages)
+	events = l.since(4)
+	assert.Len(events, 1)
+	assert.Equal("5", events[0].ID)
+	assert.Len(l.since(5), 0)
+}
+
+func TestListEvents(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+	assert.Nil(env.man.Attach("vol1", ""))
+	assert.Nil(env.man.Detach("vol1"))
+
+	events, err := env.man.ListEvents(0)
+	assert.Nil(err)
+	assert.Len(events, 2)
+	assert.Equal("VolumeAttached", events[0].Type)
+	assert.Equal("volume/vol1", events[0].Resource)
+	assert.Equal("VolumeDetached", events[1].Type)
+
+	events, err = env.man.ListEvents(1)
+	assert.Nil(err)
+	assert.Len(events, 1)
+}
@@ -0,0 +1,92 @@
+package manager
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+var (
+	EvictTimeout      = 10 * time.Minute
+	EvictPollInterval = time.Second
+)
+
+// Evict moves the controllers of all volumes attached to the host to the
+// current host, e.g. before maintenance, and waits for the volumes to become
+// healthy. A zero timeout means EvictTimeout. The volumes are detached from
+// here, the monitors of the evicted host stop once they see their controllers
+// moved.
+func (man *volumeManager) Evict(hostID string, timeout time.Duration) error {
+	if hostID == man.orc.GetCurrentHostID() {
+		return errors.Errorf("cannot evict the current host %v, evict it from another host", hostID)
+	}
+	host, err := man.orc.GetHost(hostID)
+	if err != nil {
+		return errors.Wrapf(err, "fail to get host %v to evict", hostID)
+	}
+	if host == nil {
+		return errors.Errorf("cannot find host %v to evict", hostID)
+	}
+	if timeout == 0 {
+		timeout = EvictTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
+	volumes, err := man.List()
+	if err != nil {
+		return errors.Wrapf(err, "fail to list volumes to evict host %v", hostID)
+	}
+	evicted := []string{}
+	errs := Errs{}
+	for _, volume := range volumes {
+		if volume.Controller == nil || !volume.Controller.Running || volume.Controller.HostID != hostID {
+			continue
+		}
+		logrus.Infof("evicting volume %v from host %v", volume.Name, hostID)
+		if err := man.Detach(volume.Name); err != nil {
+			errs = append(errs, errors.Wrapf(err, "fail to detach volume %v from host %v", volume.Name, hostID))
+			continue
+		}
+		if err := man.Attach(volume.Name, ""); err != nil {
+			errs = append(errs, errors.Wrapf(err, "fail to reattach volume %v, the volume is left detached", volume.Name))
+			continue
+		}
+		evicted = append(evicted, volume.Name)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	for {
+		unhealthy, err := man.unhealthyVolumes(evicted)
+		if err != nil {
+			return errors.Wrapf(err, "fail to check volumes evicted from host %v", hostID)
+		}
+		if len(unhealthy) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.Errorf("timed out after %v waiting for volumes evicted from host %v to become healthy: %v", timeout, hostID, unhealthy)
+		}
+		time.Sleep(EvictPollInterval)
+	}
+}
+
+func (man *volumeManager) unhealthyVolumes(names []string) ([]string, error) {
+	unhealthy := []string{}
+	for _, name := range names {
+		volume, err := man.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		if volume == nil || volume.State != types.VolumeStateHealthy {
+			unhealthy = append(unhealthy, name)
+		}
+	}
+	sort.Strings(unhealthy)
+	return unhealthy, nil
+}
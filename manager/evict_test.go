@@ -0,0 +1,58 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+func TestEvict(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+	env.createVolume(t, "vol2", 2)
+	assert.Nil(env.man.Attach("vol1", ""))
+	assert.Nil(env.man.Attach("vol2", ""))
+	env.orc.volumes["vol1"].Controller.HostID = "host-2"
+
+	assert.NotNil(env.man.Evict(testHostID, time.Second))
+	assert.NotNil(env.man.Evict("host-9", time.Second))
+
+	assert.Nil(env.man.Evict("host-2", time.Second))
+	for _, name := range []string{"vol1", "vol2"} {
+		volume, err := env.man.Get(name)
+		assert.Nil(err)
+		assert.Equal(types.VolumeStateHealthy, volume.State)
+		assert.Equal(testHostID, volume.Controller.HostID)
+	}
+	assert.Len(env.orc.locks, 0)
+}
+
+func TestEvictStopsMonitoring(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+	man2 := env.newManager(&hostOrc{fakeOrc: env.orc, hostID: "host-2"})
+	assert.Nil(man2.Attach("vol1", ""))
+	volume, err := man2.Get("vol1")
+	assert.Nil(err)
+	assert.NotNil(man2.monitors["vol1"])
+
+	assert.Nil(env.man.Evict("host-2", time.Second))
+
+	// the monitor of the evicted host gives up the volume without detaching it
+	ctrl := env.controller("vol1")
+	ctrl.statesErr = errors.New("connection refused")
+	assert.Nil(man2.CheckController(ctrl, volume))
+	assert.Nil(man2.monitors["vol1"])
+	volume, err = env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Equal(types.VolumeStateHealthy, volume.State)
+	assert.Equal(testHostID, volume.Controller.HostID)
+}
@@ -0,0 +1,37 @@
+package manager
+
+import (
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+// Export opens the block device of the volume attached to the current host
+// for reading its raw data. The data is live, writes to the volume while
+// exporting make the image inconsistent.
+func (man *volumeManager) Export(volumeName string) (io.ReadCloser, int64, error) {
+	volume, err := man.Get(volumeName)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "unable to get volume '%s'", volumeName)
+	}
+	if volume == nil {
+		return nil, 0, errors.Errorf("cannot find volume '%s'", volumeName)
+	}
+	if volume.State != types.VolumeStateHealthy && volume.State != types.VolumeStateDegraded {
+		return nil, 0, errors.Errorf("volume '%s' is %v, it should be attached to export it", volumeName, volume.State)
+	}
+	if volume.Controller == nil || volume.Controller.HostID != man.orc.GetCurrentHostID() {
+		return nil, 0, errors.Errorf("volume '%s' is not attached to the current host", volumeName)
+	}
+	if volume.Endpoint == "" {
+		return nil, 0, errors.Errorf("volume '%s' has no block device to export", volumeName)
+	}
+	f, err := os.Open(volume.Endpoint)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "unable to open block device of volume '%s'", volumeName)
+	}
+	return f, volume.Size, nil
+}
@@ -0,0 +1,41 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	volume := env.createVolume(t, "vol1", 2)
+	_, _, err := env.man.Export("vol1")
+	assert.NotNil(err)
+	_, _, err = env.man.Export("nonexistent")
+	assert.NotNil(err)
+
+	f, err := ioutil.TempFile("", "vol1")
+	assert.Nil(err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("data")
+	assert.Nil(err)
+	assert.Nil(f.Close())
+	env.controller("vol1").endpoint = f.Name()
+
+	assert.Nil(env.man.Attach("vol1", ""))
+	data, size, err := env.man.Export("vol1")
+	assert.Nil(err)
+	defer data.Close()
+	assert.Equal(volume.Size, size)
+	b, err := ioutil.ReadAll(data)
+	assert.Nil(err)
+	assert.Equal("data", string(b))
+
+	env.orc.volumes["vol1"].Controller.HostID = "host-2"
+	_, _, err = env.man.Export("vol1")
+	assert.NotNil(err)
+}
@@ -0,0 +1,68 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+// GCInterval is how often the manager removes the instances on the current
+// host whose volume no longer exists, 0 to disable
+var GCInterval = 10 * time.Minute
+
+func (man *volumeManager) runGC() {
+	ticker := time.NewTicker(GCInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := man.removeOrphanedInstances(); err != nil {
+			logrus.Errorf("%+v", err)
+		}
+	}
+}
+
+func (man *volumeManager) removeOrphanedInstances() error {
+	instances, err := man.orc.ListInstances()
+	if err != nil {
+		return errors.Wrap(err, "fail to list instances for garbage collection")
+	}
+	volumes, err := man.orc.ListVolumes()
+	if err != nil {
+		return errors.Wrap(err, "fail to list volumes for garbage collection")
+	}
+	existing := map[string]struct{}{}
+	// instances of renamed volumes still carry the old volume name
+	owned := map[string]struct{}{}
+	for _, volume := range volumes {
+		existing[volume.Name] = struct{}{}
+		if volume.Controller != nil {
+			owned[volume.Controller.ID] = struct{}{}
+		}
+		for _, replica := range volume.Replicas {
+			owned[replica.ID] = struct{}{}
+		}
+	}
+
+	for _, instance := range instances {
+		if _, ok := existing[instance.VolumeName]; ok {
+			continue
+		}
+		if _, ok := owned[instance.ID]; ok {
+			continue
+		}
+		// the volume could have been created after listing
+		volume, err := man.orc.GetVolume(instance.VolumeName)
+		if err != nil {
+			logrus.Errorf("%+v", errors.Wrapf(err, "fail to get volume '%s' of instance %v", instance.VolumeName, instance.Name))
+			continue
+		}
+		if volume != nil {
+			continue
+		}
+		logrus.Infof("removing orphaned %v %v of deleted volume '%s'", instance.Type, instance.Name, instance.VolumeName)
+		if err := man.orc.RemoveOrphanedInstance(instance); err != nil {
+			logrus.Errorf("%+v", errors.Wrapf(err, "fail to remove orphaned instance %v", instance.Name))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+func TestRemoveOrphanedInstances(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+	assert.Nil(env.man.Attach("vol1", ""))
+	env.orc.orphans = []*types.InstanceInfo{
+		{ID: "orphan-c", Name: "deleted-controller", Type: types.InstanceTypeController, HostID: testHostID, VolumeName: "deleted", Running: true},
+		{ID: "orphan-r", Name: "deleted-replica-1", Type: types.InstanceTypeReplica, HostID: testHostID, VolumeName: "deleted"},
+	}
+
+	assert.Nil(env.man.removeOrphanedInstances())
+	assert.Len(env.orc.orphans, 0)
+
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Equal(types.VolumeStateHealthy, volume.State)
+	assert.Len(volume.Replicas, 2)
+}
+
+func TestRemoveOrphanedInstancesKeepsRenamed(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+	assert.Nil(env.man.Rename("vol1", "vol2"))
+	volume, err := env.man.Get("vol2")
+	assert.Nil(err)
+	// the containers of the replicas still carry the old volume name
+	for _, replica := range volume.Replicas {
+		instance := replica.InstanceInfo
+		instance.VolumeName = "vol1"
+		env.orc.orphans = append(env.orc.orphans, &instance)
+	}
+
+	assert.Nil(env.man.removeOrphanedInstances())
+	assert.Len(env.orc.orphans, 2)
+}
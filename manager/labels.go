@@ -0,0 +1,51 @@
+package manager
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	labelKeyRegexp   = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_./]{0,61}[A-Za-z0-9])?$`)
+	labelValueRegexp = regexp.MustCompile(`^([A-Za-z0-9]([-A-Za-z0-9_.]{0,61}[A-Za-z0-9])?)?$`)
+)
+
+// ValidateLabels checks volume labels are alphanumeric with '-', '_' and '.'
+// (and '/' in keys) inside, up to 63 characters, so they can be selected on
+func ValidateLabels(labels map[string]string) error {
+	for k, v := range labels {
+		if !labelKeyRegexp.MatchString(k) {
+			return errors.Errorf("invalid label key '%s'", k)
+		}
+		if !labelValueRegexp.MatchString(v) {
+			return errors.Errorf("invalid value '%s' of label '%s'", v, k)
+		}
+	}
+	return nil
+}
+
+// UpdateLabels replaces the labels of the volume
+func (man *volumeManager) UpdateLabels(name string, labels map[string]string) error {
+	if err := ValidateLabels(labels); err != nil {
+		return err
+	}
+	token, err := man.orc.LockVolume(name)
+	if err != nil {
+		return errors.Wrapf(err, "unable to lock volume '%s'", name)
+	}
+	defer man.unlockVolume(name, token)
+
+	volume, err := man.orc.GetVolume(name)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get volume '%s'", name)
+	}
+	if volume == nil {
+		return errors.Errorf("cannot find volume '%s'", name)
+	}
+	volume.Labels = labels
+	if err := man.orc.UpdateVolume(volume); err != nil {
+		return errors.Wrapf(err, "unable to update volume '%s'", name)
+	}
+	return nil
+}
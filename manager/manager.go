@@ -1,19 +1,38 @@
 package manager
 
 import (
+	"fmt"
+	"net"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
 
+	"github.com/rancher/longhorn-manager/controller"
+	"github.com/rancher/longhorn-manager/scheduler"
 	"github.com/rancher/longhorn-manager/types"
 	"github.com/rancher/longhorn-manager/util"
 )
 
+const (
+	EmergencySnapshotName = "emergency"
+	CloneSnapshotName     = "clone"
+)
+
 var (
 	KeepBadReplicasPeriod = time.Hour * 2
+
+	// ListWorkers limits how many volumes List processes concurrently
+	ListWorkers = 8
+
+	// ReplicaHealthTimeout is how long attach waits for the started replicas
+	// to accept connections before creating the controller
+	ReplicaHealthTimeout      = 30 * time.Second
+	ReplicaHealthPollInterval = time.Second
 )
 
 type volumeManager struct {
@@ -21,49 +40,80 @@ type volumeManager struct {
 
 	monitors       map[string]types.Monitor
 	addingReplicas map[string]int
+	rebuilding     int
+	autoScalers    map[string]*autoScaler
+	woSince        map[string]map[string]time.Time // volume -> replica address -> when first seen in WO mode
+	checking       map[string]bool                 // volumes with CheckController in progress
+	monitorStatus  map[string]*types.MonitorStatus
+	bus            *volumeBus
+	events         *eventLog
 
 	orc     types.Orchestrator
 	monitor types.BeginMonitoring
 
 	getController types.GetController
 	getBackups    types.GetManagerBackupOps
+	checkReplica  func(replica *types.ReplicaInfo, timeout time.Duration) error
 
 	settings types.Settings
+
+	started bool
 }
 
 func (man *volumeManager) GetControllerName(volumeName string) string {
 	return volumeName + "-controller"
 }
 
+// GetReplicaName returns a new replica name, unique thanks to a whole UUID v4
 func (man *volumeManager) GetReplicaName(volumeName string) string {
-	return volumeName + "-replica-" + util.RandomID()
+	return volumeName + "-replica-" + util.UUID()
 }
 
+// RebuildConcurrency is the maximum number of replicas the manager rebuilds
+// at once, across all volumes
+var RebuildConcurrency = 3
+
+// MaxReplicasPerHost limits the number of replicas of a new volume to this
+// many times the number of hosts
+var MaxReplicasPerHost = 1
+
 func New(orc types.Orchestrator, monitor types.BeginMonitoring, getController types.GetController, getBackups types.GetManagerBackupOps) types.VolumeManager {
 	return &volumeManager{
 		monitors:       map[string]types.Monitor{},
 		addingReplicas: map[string]int{},
+		autoScalers:    map[string]*autoScaler{},
+		woSince:        map[string]map[string]time.Time{},
+		checking:       map[string]bool{},
+		monitorStatus:  map[string]*types.MonitorStatus{},
+		bus:            newVolumeBus(),
+		events:         newEventLog(EventLogSize),
 
 		orc:     orc,
 		monitor: monitor,
 
 		getController: getController,
 		getBackups:    getBackups,
+		checkReplica:  checkReplicaHealthy,
 
 		settings: orc,
 	}
 }
 
-func (man *volumeManager) doCreate(volume *types.VolumeInfo) (*types.VolumeInfo, error) {
+// doCreate creates the volume and its replicas, checkpointing op once the
+// volume is created, if op isn't nil
+func (man *volumeManager) doCreate(volume *types.VolumeInfo, op *types.Operation) (*types.VolumeInfo, error) {
 	volume.Created = util.Now()
 	vol, err := man.orc.CreateVolume(volume)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create volume '%s'", volume.Name)
 	}
+	if op != nil {
+		man.checkpoint(op, types.OperationStepCreatedVolume)
+	}
 
 	for i := 0; i < vol.NumberOfReplicas; i++ {
 		replicaName := man.GetReplicaName(vol.Name)
-		if _, err := man.orc.CreateReplica(vol.Name, replicaName); err != nil {
+		if _, err := man.orc.CreateReplica(vol.Name, replicaName, ""); err != nil {
 			return nil, errors.Wrapf(err, "error creating replica '%s', volume '%s'", replicaName, vol.Name)
 		}
 	}
@@ -84,23 +134,173 @@ func (man *volumeManager) createFromBackup(volume *types.VolumeInfo, backup *typ
 		return nil, errors.Wrapf(err, "error parsing backup.VolumeSize, backup: %+v", backup)
 	}
 	volume.Size = size
-	vol, err := man.doCreate(volume)
+	volume.Restoring = true
+	op := man.beginOperation(volume.Name, types.OperationCreateFromBackup)
+	vol, err := man.doCreate(volume, op)
 	if err != nil {
+		defer man.rollback(op)
 		return nil, err
 	}
+	man.checkpoint(op, types.OperationStepCreatedReplicas)
 	if err := man.doAttach(vol); err != nil {
-		defer man.cleanupFailedCreate(vol)
+		defer man.rollback(op)
 		return nil, errors.Wrapf(err, "failed to attach to restore the backup, volume '%s', backup '%+v'", vol.Name, backup)
 	}
+	man.checkpoint(op, types.OperationStepAttachedController)
 	if err := man.getController(vol).BackupOps().Restore(backup.URL); err != nil {
-		defer man.cleanupFailedCreate(vol)
+		defer man.rollback(op)
 		return nil, errors.Wrapf(err, "failed to restore the backup, volume '%s', backup '%+v'", vol.Name, backup)
 	}
+	man.checkpoint(op, types.OperationStepRestoredBackup)
+	if err := man.finishRestore(vol); err != nil {
+		defer man.rollback(op)
+		return nil, errors.Wrapf(err, "failed to finish restoring the backup, volume '%s', backup '%+v'", vol.Name, backup)
+	}
+	man.endOperation(op)
+	return vol, nil
+}
+
+// finishRestore marks the volume restored and detaches it
+func (man *volumeManager) finishRestore(vol *types.VolumeInfo) error {
+	vol.Restoring = false
+	if err := man.orc.UpdateVolume(vol); err != nil {
+		return errors.Wrapf(err, "failed to update volume '%s' after restoring the backup", vol.Name)
+	}
+	if err := man.doDetach(vol); err != nil {
+		return errors.Wrapf(err, "failed to detach after restoring the backup, volume '%s'", vol.Name)
+	}
+	man.events.add("BackupRestored", "volume/"+vol.Name, "restored backup "+vol.FromBackup)
+	return nil
+}
+
+func parseSnapshotRef(ref string) (string, string, error) {
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.Errorf("invalid snapshot reference '%s', should be in format '<volume>/<snapshot>'", ref)
+	}
+	return parts[0], parts[1], nil
+}
+
+func (man *volumeManager) createFromPVC(volume *types.VolumeInfo) (*types.VolumeInfo, error) {
+	srcName, err := man.sourceVolumeName(volume)
+	if err != nil {
+		return nil, errors.Wrap(err, "create volume fail")
+	}
+	return man.createFromVolume(volume, srcName)
+}
+
+func (man *volumeManager) createFromVolume(volume *types.VolumeInfo, srcName string) (*types.VolumeInfo, error) {
+	return man.createFromSnapshot(volume, srcName, "")
+}
+
+// createFromSnapshot creates volume from the snapshot snapName of the volume
+// srcName. If snapName is empty, a new snapshot of srcName is taken.
+func (man *volumeManager) createFromSnapshot(volume *types.VolumeInfo, srcName, snapName string) (*types.VolumeInfo, error) {
+	src, err := man.Get(srcName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting source volume '%s'", srcName)
+	}
+	if src == nil {
+		return nil, errors.Errorf("cannot find source volume '%s'", srcName)
+	}
+	srcAttached := src.Controller != nil && src.Controller.Running
+	if srcAttached && src.Controller.HostID != man.orc.GetCurrentHostID() {
+		return nil, errors.Errorf("source volume '%s' is attached to another host %v", srcName, src.Controller.HostID)
+	}
+
+	volume.Size = src.Size
+	if volume.FsType == "" {
+		volume.FsType = src.FsType
+		if len(volume.MountOptions) == 0 {
+			volume.MountOptions = src.MountOptions
+		}
+	}
+	vol, err := man.doCreate(volume, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if !srcAttached {
+		if err := man.doAttach(src); err != nil {
+			defer man.cleanupFailedCreate(vol)
+			return nil, errors.Wrapf(err, "failed to attach source volume '%s'", srcName)
+		}
+		defer func() {
+			if err := man.doDetach(src); err != nil {
+				logrus.Errorf("%+v", errors.Wrapf(err, "failed to detach source volume '%s'", srcName))
+			}
+		}()
+	}
+	if snapName == "" {
+		if snapName, err = man.takeCloneSnapshot(src, vol.Name); err != nil {
+			defer man.cleanupFailedCreate(vol)
+			return nil, err
+		}
+	}
+	if err := man.copyReplicasFrom(vol, src, snapName); err != nil {
+		defer man.cleanupFailedCreate(vol)
+		return nil, errors.Wrapf(err, "failed to copy snapshot '%s' of volume '%s' to volume '%s'", snapName, srcName, vol.Name)
+	}
+
+	if err := man.doAttach(vol); err != nil {
+		defer man.cleanupFailedCreate(vol)
+		return nil, errors.Wrapf(err, "failed to attach to revert to the snapshot, volume '%s', snapshot '%s'", vol.Name, snapName)
+	}
+	if err := man.getController(vol).SnapshotOps().Revert(snapName); err != nil {
+		defer man.cleanupFailedCreate(vol)
+		return nil, errors.Wrapf(err, "failed to revert to the snapshot, volume '%s', snapshot '%s'", vol.Name, snapName)
+	}
 	if err := man.doDetach(vol); err != nil {
 		defer man.cleanupFailedCreate(vol)
-		return nil, errors.Wrapf(err, "failed to detach after restoring the backup, volume '%s', backup '%+v'", vol.Name, backup)
+		return nil, errors.Wrapf(err, "failed to detach after reverting to the snapshot, volume '%s', snapshot '%s'", vol.Name, snapName)
 	}
-	return vol, nil
+	return man.Get(vol.Name)
+}
+
+func (man *volumeManager) takeCloneSnapshot(src *types.VolumeInfo, cloneName string) (string, error) {
+	srcCtrl := man.getController(src)
+	if srcCtrl == nil {
+		return "", errors.Errorf("cannot reach the controller of volume '%s'", src.Name)
+	}
+	name, err := srcCtrl.SnapshotOps().Create(snapName(CloneSnapshotName), map[string]string{CloneSnapshotName: cloneName})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to take snapshot of volume '%s' to clone", src.Name)
+	}
+	return name, nil
+}
+
+// copyReplicasFrom lets the controller of src rebuild every replica of vol,
+// so they end up with the whole snapshot chain of src
+func (man *volumeManager) copyReplicasFrom(vol, src *types.VolumeInfo, snapName string) error {
+	srcCtrl := man.getController(src)
+	if srcCtrl == nil {
+		return errors.Errorf("cannot reach the controller of volume '%s'", src.Name)
+	}
+	snap, err := srcCtrl.SnapshotOps().Get(snapName)
+	if err != nil {
+		return errors.Wrapf(err, "error getting snapshot '%s', volume '%s'", snapName, src.Name)
+	}
+	if snap == nil || snap.Removed {
+		return errors.Errorf("cannot find snapshot '%s', volume '%s'", snapName, src.Name)
+	}
+	for _, replica := range vol.Replicas {
+		instance, err := man.orc.StartInstance(&replica.InstanceInfo)
+		if err != nil {
+			return errors.Wrapf(err, "failed to start replica '%s' for volume '%s'", replica.Name, vol.Name)
+		}
+		replica.InstanceInfo = *instance
+		addErr := srcCtrl.AddReplica(replica)
+		if err := srcCtrl.RemoveReplica(replica); err != nil && addErr == nil {
+			addErr = err
+		}
+		if _, err := man.orc.StopInstance(&replica.InstanceInfo); err != nil && addErr == nil {
+			addErr = err
+		}
+		if addErr != nil {
+			return errors.Wrapf(addErr, "failed to copy data to replica '%s' of volume '%s'", replica.Name, vol.Name)
+		}
+	}
+	return nil
 }
 
 func (man *volumeManager) Create(volume *types.VolumeInfo) (*types.VolumeInfo, error) {
@@ -121,6 +321,41 @@ func (man *volumeManager) Create(volume *types.VolumeInfo) (*types.VolumeInfo, e
 			return nil, errors.New("create volume fail: No EngineImage specified")
 		}
 	}
+	switch volume.AccessMode {
+	case "":
+		volume.AccessMode = types.AccessModeReadWriteOnce
+	case types.AccessModeReadWriteOnce, types.AccessModeReadWriteMany:
+	default:
+		return nil, errors.Errorf("create volume fail: invalid access mode '%s'", volume.AccessMode)
+	}
+	if volume.MaxSnapshots < 0 {
+		return nil, errors.Errorf("create volume fail: invalid max snapshots %v", volume.MaxSnapshots)
+	}
+	if err := validateQoS(volume.VolumeQoS); err != nil {
+		return nil, errors.Wrap(err, "create volume fail")
+	}
+	switch volume.DataLocality {
+	case "":
+		volume.DataLocality = types.DataLocalityDisabled
+	case types.DataLocalityDisabled, types.DataLocalityBestEffort:
+	default:
+		return nil, errors.Errorf("create volume fail: invalid data locality '%s'", volume.DataLocality)
+	}
+	if err := ValidateLabels(volume.Labels); err != nil {
+		return nil, errors.Wrap(err, "create volume fail")
+	}
+	if err := man.checkReplicaCount(volume.NumberOfReplicas); err != nil {
+		return nil, errors.Wrap(err, "create volume fail")
+	}
+	sources := 0
+	for _, source := range []string{volume.FromBackup, volume.FromSnapshot, volume.FromVolume, volume.SourcePVC} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return nil, errors.New("create volume fail: only one of backup, snapshot, volume or PersistentVolumeClaim source can be specified")
+	}
 	if volume.FromBackup != "" {
 		backupTarget := settings.BackupTarget
 		if backupTarget == "" {
@@ -131,9 +366,117 @@ func (man *volumeManager) Create(volume *types.VolumeInfo) (*types.VolumeInfo, e
 		if err != nil {
 			return nil, errors.Wrapf(err, "error getting backup (to create volume) '%s'", volume.FromBackup)
 		}
+		if volume.DryRun {
+			return man.planCreate(volume, backup)
+		}
 		return man.createFromBackup(volume, backup)
 	}
-	return man.doCreate(volume)
+	if volume.DryRun {
+		return man.planCreate(volume, nil)
+	}
+	if volume.FromSnapshot != "" {
+		srcName, snapName, err := parseSnapshotRef(volume.FromSnapshot)
+		if err != nil {
+			return nil, errors.Wrap(err, "create volume fail")
+		}
+		return man.createFromSnapshot(volume, srcName, snapName)
+	}
+	if volume.FromVolume != "" {
+		return man.createFromVolume(volume, volume.FromVolume)
+	}
+	if volume.SourcePVC != "" {
+		return man.createFromPVC(volume)
+	}
+	return man.doCreate(volume, nil)
+}
+
+func (man *volumeManager) checkReplicaCount(count int) error {
+	hosts, err := man.ListHosts()
+	if err != nil {
+		return errors.Wrap(err, "fail to list hosts")
+	}
+	if max := len(hosts) * MaxReplicasPerHost; count > max {
+		return errors.Errorf("%v replicas requested, but only %v hosts are available for up to %v replicas each", count, len(hosts), MaxReplicasPerHost)
+	}
+	return nil
+}
+
+// planCreate returns the volume as it would be created, with the replicas
+// placed on the hosts proposed by the scheduler. Nothing is created.
+func (man *volumeManager) planCreate(volume *types.VolumeInfo, backup *types.BackupInfo) (*types.VolumeInfo, error) {
+	switch {
+	case backup != nil:
+		size, err := strconv.ParseInt(backup.VolumeSize, 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing backup.VolumeSize, backup: %+v", backup)
+		}
+		volume.Size = size
+	case volume.FromSnapshot != "" || volume.FromVolume != "" || volume.SourcePVC != "":
+		srcName, err := man.sourceVolumeName(volume)
+		if err != nil {
+			return nil, errors.Wrap(err, "create volume fail")
+		}
+		src, err := man.Get(srcName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting source volume '%s'", srcName)
+		}
+		if src == nil {
+			return nil, errors.Errorf("cannot find source volume '%s'", srcName)
+		}
+		volume.Size = src.Size
+	}
+	if volume.NumberOfReplicas < 1 {
+		return nil, errors.Errorf("create volume fail: invalid number of replicas %v", volume.NumberOfReplicas)
+	}
+
+	settings, err := man.settings.GetSettings()
+	if err != nil || settings == nil {
+		return nil, errors.New("create volume fail: fail to load settings")
+	}
+	hosts, err := man.orc.ListHosts()
+	if err != nil {
+		return nil, errors.Wrap(err, "create volume fail: fail to list hosts")
+	}
+	policy := scheduler.ReplicaSchedulePolicy(settings.ReplicaAntiAffinity, volume)
+	hostIDs, err := scheduler.PlanReplicas(hosts, policy, volume.NumberOfReplicas)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create volume fail: cannot schedule replicas of volume '%s'", volume.Name)
+	}
+
+	volume.Replicas = map[string]*types.ReplicaInfo{}
+	for _, hostID := range hostIDs {
+		name := man.GetReplicaName(volume.Name)
+		volume.Replicas[name] = &types.ReplicaInfo{
+			InstanceInfo: types.InstanceInfo{
+				Type:       types.InstanceTypeReplica,
+				Name:       name,
+				HostID:     hostID,
+				VolumeName: volume.Name,
+			},
+		}
+	}
+	volume.State = volumeState(volume)
+	return volume, nil
+}
+
+// sourceVolumeName is the name of the volume the volume is cloned from
+func (man *volumeManager) sourceVolumeName(volume *types.VolumeInfo) (string, error) {
+	if volume.FromSnapshot != "" {
+		srcName, _, err := parseSnapshotRef(volume.FromSnapshot)
+		return srcName, err
+	}
+	if volume.FromVolume != "" {
+		return volume.FromVolume, nil
+	}
+	resolver, ok := man.orc.(types.PVCResolver)
+	if !ok {
+		return "", errors.Errorf("orchestrator doesn't support PersistentVolumeClaim source '%s'", volume.SourcePVC)
+	}
+	srcName, err := resolver.GetVolumeNameForPVC(volume.SourcePVC)
+	if err != nil {
+		return "", errors.Wrapf(err, "error getting volume for PersistentVolumeClaim '%s'", volume.SourcePVC)
+	}
+	return srcName, nil
 }
 
 func (man *volumeManager) Delete(name string) error {
@@ -159,6 +502,62 @@ func (man *volumeManager) Delete(name string) error {
 	return errors.Wrapf(man.orc.DeleteVolume(name), "failed to delete volume '%s'", name)
 }
 
+// Rename moves a detached volume to a new name, renaming the replicas named
+// after the volume along with it
+func (man *volumeManager) Rename(oldName, newName string) error {
+	if oldName == "" || newName == "" {
+		return errors.New("rename volume fail: empty volume name")
+	}
+	if oldName == newName {
+		return errors.Errorf("rename volume fail: volume '%s' already has this name", oldName)
+	}
+	// lock in a fixed order so concurrent renames cannot deadlock
+	names := []string{oldName, newName}
+	sort.Strings(names)
+	for _, name := range names {
+		token, err := man.orc.LockVolume(name)
+		if err != nil {
+			return errors.Wrapf(err, "failed to lock volume '%s' to rename", name)
+		}
+		defer man.unlockVolume(name, token)
+	}
+
+	volume, err := man.orc.GetVolume(oldName)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get volume '%s'", oldName)
+	}
+	if volume == nil {
+		return errors.Errorf("cannot find volume '%s'", oldName)
+	}
+	if volume.Controller != nil {
+		return errors.Errorf("volume '%s' must be detached to be renamed", oldName)
+	}
+	existing, err := man.orc.GetVolume(newName)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get volume '%s'", newName)
+	}
+	if existing != nil {
+		return errors.Errorf("volume %v already exists", newName)
+	}
+
+	renamed := *volume
+	renamed.Name = newName
+	renamed.Replicas = map[string]*types.ReplicaInfo{}
+	for _, r := range volume.Replicas {
+		replica := *r
+		replica.VolumeName = newName
+		if strings.HasPrefix(replica.Name, oldName+"-replica-") {
+			replica.Name = newName + strings.TrimPrefix(replica.Name, oldName)
+		}
+		renamed.Replicas[replica.Name] = &replica
+	}
+	if err := man.orc.RenameVolume(oldName, &renamed); err != nil {
+		return errors.Wrapf(err, "failed to rename volume '%s' to '%s'", oldName, newName)
+	}
+	logrus.Infof("renamed volume '%s' to '%s'", oldName, newName)
+	return nil
+}
+
 func volumeState(volume *types.VolumeInfo) types.VolumeState {
 	goodReplicaCount := 0
 	for _, replica := range volume.Replicas {
@@ -171,6 +570,8 @@ func volumeState(volume *types.VolumeInfo) types.VolumeState {
 		return types.VolumeStateFaulted
 	case volume.Controller == nil:
 		return types.VolumeStateDetached
+	case volume.Restoring:
+		return types.VolumeStateRestoring
 	case goodReplicaCount == volume.NumberOfReplicas:
 		return types.VolumeStateHealthy
 	}
@@ -203,13 +604,36 @@ func (man *volumeManager) List() ([]*types.VolumeInfo, error) {
 	if err != nil {
 		return nil, err
 	}
-	for i, v := range volumes {
-		volumes[i] = man.completeVolumeState(v)
+	workers := ListWorkers
+	if workers < 1 {
+		workers = 1
 	}
+	if workers > len(volumes) {
+		workers = len(volumes)
+	}
+	indices := make(chan int)
+	wg := &sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				volumes[i] = man.completeVolumeState(volumes[i])
+			}
+		}()
+	}
+	for i := range volumes {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
 	return volumes, nil
 }
 
 func (man *volumeManager) Start() error {
+	if err := man.recoverOperations(); err != nil {
+		logrus.Errorf("%+v", err)
+	}
 	vs, err := man.List()
 	if err != nil {
 		return err
@@ -217,17 +641,39 @@ func (man *volumeManager) Start() error {
 	for _, v := range vs {
 		if v.Controller != nil && v.Controller.Running && v.Controller.HostID == man.orc.GetCurrentHostID() {
 			man.startMonitoring(v)
+			if RecurringBackfillWindow > 0 {
+				go func(name string) {
+					if err := man.RecurringJobBackfill(name, time.Now().Add(-RecurringBackfillWindow)); err != nil {
+						logrus.Errorf("%+v", err)
+					}
+				}(v.Name)
+			}
 		}
 	}
+
+	if GCInterval > 0 {
+		go man.runGC()
+	}
+
+	man.Lock()
+	defer man.Unlock()
+	man.started = true
 	return nil
 }
 
+func (man *volumeManager) Started() bool {
+	man.Lock()
+	defer man.Unlock()
+	return man.started
+}
+
 func (man *volumeManager) startMonitoring(volume *types.VolumeInfo) {
 	man.Lock()
 	defer man.Unlock()
 	if man.monitors[volume.Name] == nil {
 		man.monitors[volume.Name] = man.monitor(volume, man)
 	}
+	man.bus.publish(volume.Name)
 }
 
 func (man *volumeManager) updateCron(volume *types.VolumeInfo, jobs []*types.RecurringJob) {
@@ -250,29 +696,74 @@ func (man *volumeManager) stopMonitoring(volume *types.VolumeInfo) {
 		mon.Close()
 		delete(man.monitors, volume.Name)
 	}
+	delete(man.autoScalers, volume.Name)
+	delete(man.woSince, volume.Name)
+	delete(man.monitorStatus, volume.Name)
+	man.bus.publish(volume.Name)
 }
 
-func (man *volumeManager) Attach(name string) error {
+// Attach starts the controller of the volume on the host, empty for the
+// current host. The controller is monitored by the manager of its host, so
+// only the current host is accepted: the API forwards the request to it.
+func (man *volumeManager) Attach(name, hostID string) error {
+	if hostID == "" {
+		hostID = man.orc.GetCurrentHostID()
+	}
+	if hostID != man.orc.GetCurrentHostID() {
+		return errors.Errorf("volume %v can only be attached to the current host %v, not %v", name, man.orc.GetCurrentHostID(), hostID)
+	}
 	volume, err := man.Get(name)
 	if err != nil {
 		return err
 	}
-	return man.doAttach(volume)
+	if err := man.doAttach(volume); err != nil {
+		return err
+	}
+	man.events.add("VolumeAttached", "volume/"+name, "volume attached to host "+hostID)
+	return nil
+}
+
+func (man *volumeManager) unlockVolume(name, token string) {
+	if err := man.orc.UnlockVolume(name, token); err != nil {
+		logrus.Errorf("%+v", errors.Wrapf(err, "failed to unlock volume '%s'", name))
+	}
 }
 
 func (man *volumeManager) doAttach(volume *types.VolumeInfo) error {
+	token, err := man.orc.LockVolume(volume.Name)
+	if err != nil {
+		return errors.Wrapf(err, "failed to lock volume '%s' to attach", volume.Name)
+	}
+	defer man.unlockVolume(volume.Name, token)
+	// another manager may have changed the volume before we got the lock
+	locked, err := man.Get(volume.Name)
+	if err != nil {
+		return err
+	}
+	if locked == nil {
+		return errors.Errorf("volume '%s' no longer exists to attach", volume.Name)
+	}
+	if err := man.attach(locked); err != nil {
+		return err
+	}
+	*volume = *locked
+	return nil
+}
+
+func (man *volumeManager) attach(volume *types.VolumeInfo) error {
 	if volume.Controller != nil {
 		if volume.Controller.Running && volume.Controller.HostID == man.orc.GetCurrentHostID() {
 			man.startMonitoring(volume)
 			return nil
 		}
-		if err := man.Detach(volume.Name); err != nil {
+		if volume.Controller.Running && volume.AccessMode == types.AccessModeReadWriteOnce {
+			return errors.Errorf("volume '%s' with access mode '%s' is already attached to host %v", volume.Name, volume.AccessMode, volume.Controller.HostID)
+		}
+		if err := man.detach(volume); err != nil {
 			return errors.Wrapf(err, "failed to detach before reattaching volume '%s'", volume.Name)
 		}
 	}
 	replicas := map[string]*types.ReplicaInfo{}
-	var recentBadReplica *types.ReplicaInfo
-	var recentBadK string
 	wg := &sync.WaitGroup{}
 	errCh := make(chan error)
 	for k, replica := range volume.Replicas {
@@ -287,21 +778,6 @@ func (man *volumeManager) doAttach(volume *types.VolumeInfo) error {
 		}
 		if replica.BadTimestamp == "" {
 			replicas[k] = replica
-		} else {
-			replicaBadTime, err := util.ParseTime(replica.BadTimestamp)
-			if err != nil {
-				logrus.Errorf("%+v", err)
-				continue
-			}
-			recentBadTime, err := util.ParseTime(recentBadReplica.BadTimestamp)
-			if err != nil {
-				logrus.Errorf("%+v", err)
-				continue
-			}
-			if recentBadReplica == nil || replicaBadTime.After(recentBadTime) {
-				recentBadReplica = replica
-				recentBadK = k
-			}
 		}
 	}
 	go func() {
@@ -316,8 +792,11 @@ func (man *volumeManager) doAttach(volume *types.VolumeInfo) error {
 	if len(errs) > 0 {
 		return errs
 	}
-	if len(replicas) == 0 && recentBadReplica != nil {
-		replicas[recentBadK] = recentBadReplica
+	if len(replicas) == 0 {
+		// the replica marked bad the last has the most recent data
+		if replica := mostRecentBadReplica(volume); replica != nil {
+			replicas[replica.Name] = replica
+		}
 	}
 	if len(replicas) == 0 {
 		return errors.Errorf("no replicas to start the controller for volume '%s'", volume.Name)
@@ -328,8 +807,16 @@ func (man *volumeManager) doAttach(volume *types.VolumeInfo) error {
 		wg.Add(1)
 		go func(replica *types.ReplicaInfo) {
 			defer wg.Done()
-			if _, err := man.orc.StartInstance(&replica.InstanceInfo); err != nil {
+			instance, err := man.orc.StartInstance(&replica.InstanceInfo)
+			if err != nil {
 				errCh <- errors.Wrapf(err, "failed to start replica '%s' for volume '%s'", replica.Name, volume.Name)
+				return
+			}
+			if instance != nil && instance.Address != "" {
+				replica.Address = instance.Address
+			}
+			if err := man.checkReplica(replica, ReplicaHealthTimeout); err != nil {
+				errCh <- errors.Wrapf(err, "replica '%s' for volume '%s' isn't healthy", replica.Name, volume.Name)
 			}
 		}(replica)
 	}
@@ -356,6 +843,24 @@ func (man *volumeManager) doAttach(volume *types.VolumeInfo) error {
 	return nil
 }
 
+// checkReplicaHealthy waits for the started replica to accept connections,
+// the controller fails to start if it can't connect to a replica
+func checkReplicaHealthy(replica *types.ReplicaInfo, timeout time.Duration) error {
+	address := net.JoinHostPort(replica.Address, strconv.Itoa(util.ReplicaPort()))
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", address, ReplicaHealthPollInterval)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.Wrapf(err, "replica '%s' isn't reachable at %v after %v", replica.Name, address, timeout)
+		}
+		time.Sleep(ReplicaHealthPollInterval)
+	}
+}
+
 func (man *volumeManager) Detach(name string) error {
 	volume, err := man.Get(name)
 	if err != nil {
@@ -365,10 +870,35 @@ func (man *volumeManager) Detach(name string) error {
 		logrus.Warnf("volume %v no longer exist for detach", name)
 		return nil
 	}
-	return man.doDetach(volume)
+	if err := man.doDetach(volume); err != nil {
+		return err
+	}
+	man.events.add("VolumeDetached", "volume/"+name, "volume detached")
+	return nil
 }
 
 func (man *volumeManager) doDetach(volume *types.VolumeInfo) error {
+	token, err := man.orc.LockVolume(volume.Name)
+	if err != nil {
+		return errors.Wrapf(err, "failed to lock volume '%s' to detach", volume.Name)
+	}
+	defer man.unlockVolume(volume.Name, token)
+	locked, err := man.Get(volume.Name)
+	if err != nil {
+		return err
+	}
+	if locked == nil {
+		logrus.Warnf("volume %v no longer exist for detach", volume.Name)
+		return nil
+	}
+	if err := man.detach(locked); err != nil {
+		return err
+	}
+	*volume = *locked
+	return nil
+}
+
+func (man *volumeManager) detach(volume *types.VolumeInfo) error {
 	man.stopMonitoring(volume)
 	errCh := make(chan error)
 	wg := &sync.WaitGroup{}
@@ -407,20 +937,24 @@ func (man *volumeManager) doDetach(volume *types.VolumeInfo) error {
 	return nil
 }
 
-func (man *volumeManager) createAndAddReplicaToController(volumeName string, ctrl types.Controller) error {
-	replica, err := man.orc.CreateReplica(volumeName, man.GetReplicaName(volumeName))
+func (man *volumeManager) createAndAddReplicaToController(volumeName, hostID string, ctrl types.Controller) error {
+	if err := man.startRebuild(volumeName); err != nil {
+		return err
+	}
+	replica, err := man.orc.CreateReplica(volumeName, man.GetReplicaName(volumeName), hostID)
 	if err != nil {
+		man.finishRebuild(volumeName)
 		return errors.Wrapf(err, "failed to create a replica for volume '%s'", volumeName)
 	}
 	instance, err := man.orc.StartInstance(&replica.InstanceInfo)
 	if err != nil {
+		man.finishRebuild(volumeName)
 		return errors.Wrapf(err, "failed to start replica %v for volume '%s'", replica.Name, volumeName)
 	}
 	// Update replica.InstanceInfo to provide address for ctrl.AddReplica() call
 	replica.InstanceInfo = *instance
 	go func() {
-		man.addingReplicasCount(volumeName, 1)
-		defer man.addingReplicasCount(volumeName, -1)
+		defer man.finishRebuild(volumeName)
 		if err := ctrl.AddReplica(replica); err != nil {
 			logrus.Errorf("%+v", errors.Wrapf(err, "failed to add replica '%s' to volume '%s'", replica.Name, volumeName))
 			if _, err := man.orc.StopInstance(&replica.InstanceInfo); err != nil {
@@ -434,68 +968,241 @@ func (man *volumeManager) createAndAddReplicaToController(volumeName string, ctr
 	return nil
 }
 
-func (man *volumeManager) addingReplicasCount(name string, add int) int {
+// startRebuild reserves a replica rebuild for the volume. A volume rebuilds
+// one replica at a time, and up to RebuildConcurrency replicas are rebuilt
+// at once by the manager.
+func (man *volumeManager) startRebuild(volumeName string) error {
+	man.Lock()
+	defer man.Unlock()
+	if man.addingReplicas[volumeName] > 0 {
+		return errors.Errorf("volume '%s' is already rebuilding a replica", volumeName)
+	}
+	if man.rebuilding >= RebuildConcurrency {
+		return errors.Errorf("cannot rebuild a replica for volume '%s': %v rebuilds in progress", volumeName, man.rebuilding)
+	}
+	man.addingReplicas[volumeName]++
+	man.rebuilding++
+	return nil
+}
+
+func (man *volumeManager) finishRebuild(volumeName string) {
+	man.Lock()
+	defer man.Unlock()
+	man.addingReplicas[volumeName]--
+	if man.addingReplicas[volumeName] <= 0 {
+		delete(man.addingReplicas, volumeName)
+	}
+	man.rebuilding--
+}
+
+func (man *volumeManager) canRebuild(volumeName string) bool {
 	man.Lock()
 	defer man.Unlock()
-	count := man.addingReplicas[name] + add
-	man.addingReplicas[name] = count
-	return count
+	return man.addingReplicas[volumeName] == 0 && man.rebuilding < RebuildConcurrency
 }
 
 func (man *volumeManager) UpdateRecurring(name string, jobs []*types.RecurringJob) error {
+	if err := ValidateJobs(jobs); err != nil {
+		return err
+	}
+
 	volume, err := man.orc.GetVolume(name)
 	if err != nil {
 		return errors.Wrapf(err, "unable to get volume '%s'", name)
 	}
+	if volume == nil {
+		return errors.Errorf("cannot find volume '%s'", name)
+	}
 	volume.RecurringJobs = jobs
 	if err := man.orc.UpdateVolume(volume); err != nil {
 		return errors.Wrapf(err, "unable to update volume '%s'", name)
 	}
 
-	if err := ValidateJobs(jobs); err != nil {
-		return err
-	}
-
 	man.updateCron(volume, jobs)
 
 	return nil
 }
 
-func (man *volumeManager) CheckController(ctrl types.Controller, volume *types.VolumeInfo) error {
-	replicas, err := ctrl.GetReplicaStates()
+func (man *volumeManager) RecurringJobBackfill(volumeName string, since time.Time) error {
+	volume, err := man.Get(volumeName)
 	if err != nil {
-		return NewControllerError(err)
+		return errors.Wrapf(err, "unable to get volume '%s'", volumeName)
 	}
-	logrus.Debugf("checking '%s', NumberOfReplicas=%v: controller knows %v replicas", volume.Name, volume.NumberOfReplicas, len(volume.Replicas))
-	goodReplicas := []*types.ReplicaInfo{}
-	woReplicas := []*types.ReplicaInfo{}
-	errCh := make(chan error)
-	wg := &sync.WaitGroup{}
-	for _, replica := range replicas {
-		switch replica.Mode {
-		case types.ReplicaModeRW:
-			goodReplicas = append(goodReplicas, replica)
-		case types.ReplicaModeWO:
-			woReplicas = append(woReplicas, replica)
+	if volume == nil {
+		return errors.Errorf("cannot find volume '%s'", volumeName)
+	}
+	if len(volume.RecurringJobs) == 0 {
+		return nil
+	}
+	ctrl := man.getController(volume)
+	if ctrl == nil {
+		return errors.Errorf("volume '%s' is not attached, cannot backfill recurring jobs", volumeName)
+	}
+	si, err := man.settings.GetSettings()
+	if err != nil {
+		return errors.Wrap(err, "unable to get settings to backfill recurring jobs")
+	}
+	snapshots, err := ctrl.SnapshotOps().List()
+	if err != nil {
+		return errors.Wrapf(err, "error listing snapshots, volume '%s'", volumeName)
+	}
+	runner := newJobRunner(volume, ctrl, man.settings)
+	for _, job := range missedJobs(volume.RecurringJobs, snapshots, since, time.Now()) {
+		logrus.Infof("backfilling missed recurring job '%s', volume '%s'", job.Name, volumeName)
+		if err := tasks[job.Task](runner, job, si).Run(); err != nil {
+			return errors.Wrapf(err, "unable to backfill recurring job '%s', volume '%s'", job.Name, volumeName)
+		}
+	}
+	return nil
+}
+
+func (man *volumeManager) SnapshotSchedule(volumeName string, next int) ([]time.Time, error) {
+	if next <= 0 {
+		next = DefaultScheduleCount
+	}
+	if next > MaxScheduleCount {
+		return nil, errors.Errorf("cannot preview more than %v recurring job runs", MaxScheduleCount)
+	}
+	volume, err := man.orc.GetVolume(volumeName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get volume '%s'", volumeName)
+	}
+	if volume == nil {
+		return nil, errors.Errorf("cannot find volume '%s'", volumeName)
+	}
+	return nextJobRuns(volume.RecurringJobs, time.Now(), next), nil
+}
+
+func (man *volumeManager) UpdateAutoScale(name string, enabled bool, readIOPSThreshold, scaleDownThreshold int64, maxReplicas int) error {
+	token, err := man.orc.LockVolume(name)
+	if err != nil {
+		return errors.Wrapf(err, "unable to lock volume '%s'", name)
+	}
+	defer man.unlockVolume(name, token)
+
+	volume, err := man.orc.GetVolume(name)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get volume '%s'", name)
+	}
+	if volume == nil {
+		return errors.Errorf("cannot find volume '%s'", name)
+	}
+	if enabled {
+		if readIOPSThreshold <= 0 {
+			return errors.Errorf("invalid read IOPS threshold %v", readIOPSThreshold)
+		}
+		if scaleDownThreshold < 0 || scaleDownThreshold >= readIOPSThreshold {
+			return errors.Errorf("scale down threshold %v should be less than read IOPS threshold %v", scaleDownThreshold, readIOPSThreshold)
+		}
+		if maxReplicas < volume.NumberOfReplicas {
+			return errors.Errorf("max replicas %v is less than the current number of replicas %v", maxReplicas, volume.NumberOfReplicas)
+		}
+		if !volume.AutoScaleReplicas {
+			volume.MinAutoScaleReplicas = volume.NumberOfReplicas
+		}
+	}
+	volume.AutoScaleReplicas = enabled
+	volume.AutoScaleReadIOPSThreshold = readIOPSThreshold
+	volume.AutoScaleScaleDownThreshold = scaleDownThreshold
+	volume.MaxAutoScaleReplicas = maxReplicas
+	if err := man.orc.UpdateVolume(volume); err != nil {
+		return errors.Wrapf(err, "unable to update volume '%s'", name)
+	}
+
+	man.setAutoScaler(volume)
+	return nil
+}
+
+// beginCheck marks the volume as being checked, unless a check (e.g. by the
+// monitor of a previous attachment, stuck on the controller) is in progress
+func (man *volumeManager) beginCheck(volumeName string) bool {
+	man.Lock()
+	defer man.Unlock()
+	if man.checking[volumeName] {
+		return false
+	}
+	man.checking[volumeName] = true
+	return true
+}
+
+func (man *volumeManager) endCheck(volumeName string) {
+	man.Lock()
+	defer man.Unlock()
+	delete(man.checking, volumeName)
+}
+
+// controllerMoved is true if the controller of the volume isn't on the current
+// host any more. Migrate and Evict detach the volume on the new host, so the
+// monitor of the old host finds out here.
+func (man *volumeManager) controllerMoved(volume *types.VolumeInfo) bool {
+	current, err := man.orc.GetVolume(volume.Name)
+	if err != nil {
+		logrus.Warnf("%v", errors.Wrapf(err, "unable to get volume '%s' to check its controller", volume.Name))
+		return false
+	}
+	return current == nil || current.Controller == nil || current.Controller.HostID != man.orc.GetCurrentHostID()
+}
+
+func (man *volumeManager) CheckController(ctrl types.Controller, volume *types.VolumeInfo) (err error) {
+	if man.controllerMoved(volume) {
+		logrus.Infof("controller of volume '%s' is no longer on this host, stop monitoring it", volume.Name)
+		man.stopMonitoring(volume)
+		return nil
+	}
+	if !man.beginCheck(volume.Name) {
+		logrus.Warnf("previous check of volume '%s' is still running, skipping", volume.Name)
+		return nil
+	}
+	defer man.endCheck(volume.Name)
+	defer func() { man.recordCheck(volume.Name, err) }()
+	defer man.bus.publish(volume.Name)
+
+	replicas, err := ctrl.GetReplicaStates()
+	if err != nil {
+		err = NewControllerError(err)
+		if err.(*ControllerError).Unresponsive {
+			man.recordEvent(volume, types.EventTypeWarning, "ControllerUnresponsive", "controller didn't respond in %v, restarting it", controller.ReplicaStatesTimeout)
+		}
+		return err
+	}
+	logrus.Debugf("checking '%s', NumberOfReplicas=%v: controller knows %v replicas", volume.Name, volume.NumberOfReplicas, len(volume.Replicas))
+	goodReplicas := []*types.ReplicaInfo{}
+	woReplicas := []*types.ReplicaInfo{}
+	badReplicas := []*types.ReplicaInfo{}
+	for _, replica := range replicas {
+		switch replica.Mode {
+		case types.ReplicaModeRW:
+			goodReplicas = append(goodReplicas, replica)
+		case types.ReplicaModeWO:
+			woReplicas = append(woReplicas, replica)
 		case types.ReplicaModeERR:
-			wg.Add(1)
-			go func(replica *types.ReplicaInfo) {
-				defer wg.Done()
-				logrus.Warnf("Marking bad replica '%s'", replica.Address)
-				wg.Add(2)
-				go func() {
-					defer wg.Done()
-					err := ctrl.RemoveReplica(replica)
-					errCh <- errors.Wrapf(err, "failed to remove ERR replica '%s' from volume '%s'", replica.Address, volume.Name)
-				}()
-				go func() {
-					defer wg.Done()
-					err := man.orc.MarkBadReplica(volume.Name, replica)
-					errCh <- errors.Wrapf(err, "failed to mark replica '%s' bad for volume '%s'", replica.Address, volume.Name)
-				}()
-			}(replica)
+			badReplicas = append(badReplicas, replica)
 		}
 	}
+	woReplicas, staleReplicas := man.checkStaleReplicas(volume, woReplicas, time.Now())
+	badReplicas = append(badReplicas, staleReplicas...)
+
+	errCh := make(chan error)
+	wg := &sync.WaitGroup{}
+	for _, replica := range badReplicas {
+		wg.Add(1)
+		go func(replica *types.ReplicaInfo) {
+			defer wg.Done()
+			logrus.Warnf("Marking bad replica '%s'", replica.Address)
+			man.recordEvent(volume, types.EventTypeWarning, "ReplicaFailed", "replica %v in %v mode is marked bad", replica.Address, replica.Mode)
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				err := ctrl.RemoveReplica(replica)
+				errCh <- errors.Wrapf(err, "failed to remove %v replica '%s' from volume '%s'", replica.Mode, replica.Address, volume.Name)
+			}()
+			go func() {
+				defer wg.Done()
+				err := man.orc.MarkBadReplica(volume.Name, replica)
+				errCh <- errors.Wrapf(err, "failed to mark replica '%s' bad for volume '%s'", replica.Address, volume.Name)
+			}()
+		}(replica)
+	}
 	go func() {
 		wg.Wait()
 		close(errCh)
@@ -513,23 +1220,77 @@ func (man *volumeManager) CheckController(ctrl types.Controller, volume *types.V
 	}
 	if len(goodReplicas) == 0 {
 		logrus.Errorf("volume '%s' has no more good replicas, shutting it down", volume.Name)
-		return man.Detach(volume.Name)
+		man.recordEvent(volume, types.EventTypeWarning, "VolumeFaulted", "volume has no more good replicas, shutting it down")
+		if err := man.Detach(volume.Name); err != nil {
+			return err
+		}
+		if settings, err := man.settings.GetSettings(); err == nil && settings != nil && settings.FaultedVolumeAutoRecovery {
+			go func() {
+				if err := man.recoverFaulted(volume.Name); err != nil {
+					logrus.Errorf("%+v", err)
+				}
+			}()
+		}
+		return nil
 	}
 
-	addingReplicas := man.addingReplicasCount(volume.Name, 0)
-	logrus.Debugf("'%s' replicas by state: RW=%v, WO=%v, adding=%v", volume.Name, len(goodReplicas), len(woReplicas), addingReplicas)
-	if len(goodReplicas) < volume.NumberOfReplicas && len(woReplicas) == 0 && addingReplicas == 0 {
-		if err := man.createAndAddReplicaToController(volume.Name, ctrl); err != nil {
-			return err
+	logrus.Debugf("'%s' replicas by state: RW=%v, WO=%v", volume.Name, len(goodReplicas), len(woReplicas))
+	if len(goodReplicas) < volume.NumberOfReplicas && len(woReplicas) == 0 {
+		if man.canRebuild(volume.Name) {
+			if err := man.createAndAddReplicaToController(volume.Name, "", ctrl); err != nil {
+				return err
+			}
+		} else {
+			logrus.Debugf("volume '%s' is under-replicated, waiting for a replica rebuild slot", volume.Name)
 		}
 	}
 	if len(goodReplicas)+len(woReplicas) > volume.NumberOfReplicas {
 		logrus.Warnf("volume '%s' has more replicas than needed: has %v, needs %v", volume.Name, len(goodReplicas), volume.NumberOfReplicas)
 	}
+	if err := man.autoScale(ctrl, volume, goodReplicas); err != nil {
+		logrus.Warnf("%v", errors.Wrapf(err, "error auto-scaling replicas, volume '%s'", volume.Name))
+	}
 
 	return nil
 }
 
+// recordEvent keeps a volume event in the event log and publishes it if the
+// orchestrator supports it
+func (man *volumeManager) recordEvent(volume *types.VolumeInfo, eventType, reason, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	man.events.add(reason, "volume/"+volume.Name, message)
+	if recorder, ok := man.orc.(types.EventRecorder); ok {
+		recorder.RecordVolumeEvent(volume, eventType, reason, message)
+	}
+}
+
+// checkStaleReplicas tracks since when the replicas of the volume are in WO
+// mode and splits off those not rebuilt within the volume's
+// StaleReplicaTimeout
+func (man *volumeManager) checkStaleReplicas(volume *types.VolumeInfo, woReplicas []*types.ReplicaInfo, now time.Time) ([]*types.ReplicaInfo, []*types.ReplicaInfo) {
+	man.Lock()
+	defer man.Unlock()
+
+	since := map[string]time.Time{}
+	rebuilding := []*types.ReplicaInfo{}
+	stale := []*types.ReplicaInfo{}
+	for _, replica := range woReplicas {
+		t, ok := man.woSince[volume.Name][replica.Address]
+		if !ok {
+			t = now
+		}
+		if volume.StaleReplicaTimeout > 0 && now.Sub(t) > volume.StaleReplicaTimeout {
+			logrus.Warnf("replica '%s' of volume '%s' is still in WO mode after %v, giving up rebuilding it", replica.Address, volume.Name, volume.StaleReplicaTimeout)
+			stale = append(stale, replica)
+			continue
+		}
+		since[replica.Address] = t
+		rebuilding = append(rebuilding, replica)
+	}
+	man.woSince[volume.Name] = since
+	return rebuilding, stale
+}
+
 func (man *volumeManager) Cleanup(v *types.VolumeInfo) error {
 	volume, err := man.Get(v.Name)
 	if err != nil {
@@ -563,6 +1324,10 @@ func (man *volumeManager) Cleanup(v *types.VolumeInfo) error {
 				errCh <- errors.Wrapf(err, "fail to parse bad timestamp %v", replica.BadTimestamp)
 				return
 			}
+			if replica.PinnedHostID != "" {
+				logrus.Warnf("bad replica '%s' of volume '%s' is pinned to host %v, not removing it", replica.Name, volume.Name, replica.PinnedHostID)
+				return
+			}
 			if badTime.Add(KeepBadReplicasPeriod).Before(now) {
 				wg.Add(1)
 				go func() {
@@ -591,6 +1356,103 @@ func (man *volumeManager) Cleanup(v *types.VolumeInfo) error {
 	return nil
 }
 
+// ReplicaStates returns the replicas of the volume sorted by name. The mode
+// of each replica is reported by the volume controller, it's empty if the
+// volume is detached or the controller doesn't know the replica.
+func (man *volumeManager) ReplicaStates(volumeName string) ([]*types.ReplicaInfo, error) {
+	volume, err := man.Get(volumeName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to get replicas of volume %v", volumeName)
+	}
+	if volume == nil {
+		return nil, errors.Errorf("cannot find volume %v", volumeName)
+	}
+
+	modes := map[string]types.ReplicaMode{}
+	if ctrl := man.getController(volume); ctrl != nil {
+		states, err := ctrl.GetReplicaStates()
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to get replica states of volume %v", volumeName)
+		}
+		for _, state := range states {
+			modes[state.Address] = state.Mode
+		}
+	}
+
+	replicas := []*types.ReplicaInfo{}
+	for _, r := range volume.Replicas {
+		replica := *r
+		replica.Mode = ""
+		if replica.Running && replica.Address != "" {
+			replica.Mode = modes[replica.Address]
+		}
+		replicas = append(replicas, &replica)
+	}
+	sort.Slice(replicas, func(i, j int) bool { return replicas[i].Name < replicas[j].Name })
+	return replicas, nil
+}
+
+// RebuildStatus reports the rebuild progress of the replicas of the attached
+// volume in WO mode
+func (man *volumeManager) RebuildStatus(volumeName string) ([]*types.RebuildStatus, error) {
+	volume, err := man.Get(volumeName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to get volume %v", volumeName)
+	}
+	if volume == nil {
+		return nil, errors.Errorf("cannot find volume %v", volumeName)
+	}
+	ctrl := man.getController(volume)
+	if ctrl == nil {
+		return nil, errors.Errorf("volume %v is not attached", volumeName)
+	}
+	states, err := ctrl.GetReplicaStates()
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to get replica states of volume %v", volumeName)
+	}
+	rebuilding := map[string]bool{}
+	for _, state := range states {
+		if state.Mode == types.ReplicaModeWO {
+			rebuilding[state.Address] = true
+		}
+	}
+	if len(rebuilding) == 0 {
+		return []*types.RebuildStatus{}, nil
+	}
+
+	// without the rebuild status of the engine only the replicas in WO mode
+	// are known to be rebuilding, with unknown progress
+	unknownState := "unknown"
+	reported, err := ctrl.RebuildStatus()
+	if errors.Cause(err) == controller.ErrEngineUnsupported {
+		logrus.Debugf("%v, volume '%s'", err, volumeName)
+		reported, err = nil, nil
+		unknownState = "rebuilding"
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to get rebuild status of volume %v", volumeName)
+	}
+	byAddress := map[string]*types.RebuildStatus{}
+	for _, status := range reported {
+		byAddress[status.Address] = status
+	}
+	statuses := []*types.RebuildStatus{}
+	for _, replica := range volume.Replicas {
+		if !replica.Running || !rebuilding[replica.Address] {
+			continue
+		}
+		status := byAddress[replica.Address]
+		if status == nil {
+			status = &types.RebuildStatus{State: unknownState}
+		}
+		status.ReplicaName = replica.Name
+		status.Address = replica.Address
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].ReplicaName < statuses[j].ReplicaName })
+	return statuses, nil
+}
+
 func (man *volumeManager) Controller(name string) (types.Controller, error) {
 	volume, err := man.Get(name)
 	if err != nil {
@@ -639,6 +1501,176 @@ func (man *volumeManager) ProcessSchedule(spec *types.ScheduleSpec, item *types.
 	return scheduler.Process(spec, item)
 }
 
+func (man *volumeManager) CreateController(volumeName string, replicas map[string]*types.ReplicaInfo) (*types.ControllerInfo, error) {
+	volume, err := man.Get(volumeName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to create controller for volume %v", volumeName)
+	}
+	if volume == nil {
+		return nil, errors.Errorf("cannot find volume %v", volumeName)
+	}
+	if volume.Controller != nil {
+		return nil, errors.Errorf("volume %v already has controller %v", volumeName, volume.Controller.Name)
+	}
+	if len(replicas) == 0 {
+		return nil, errors.Errorf("cannot create controller for volume %v without replicas", volumeName)
+	}
+	for name := range replicas {
+		if volume.Replicas[name] == nil {
+			return nil, errors.Errorf("cannot find replica %v of volume %v", name, volumeName)
+		}
+	}
+	controller, err := man.orc.CreateController(volumeName, man.GetControllerName(volumeName), replicas)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to create controller for volume %v", volumeName)
+	}
+	return controller, nil
+}
+
+func (man *volumeManager) ReplicaAdd(volumeName, hostID string) error {
+	volume, err := man.Get(volumeName)
+	if err != nil {
+		return errors.Wrapf(err, "fail to add replica to volume %v", volumeName)
+	}
+	if volume == nil {
+		return errors.Errorf("cannot find volume %v", volumeName)
+	}
+	if volume.State != types.VolumeStateHealthy && volume.State != types.VolumeStateDegraded {
+		return errors.Errorf("volume %v should be attached to add a replica, current state %v", volumeName, volume.State)
+	}
+	if hostID != "" {
+		host, err := man.orc.GetHost(hostID)
+		if err != nil {
+			return errors.Wrapf(err, "fail to get host %v to add replica to volume %v", hostID, volumeName)
+		}
+		if host == nil {
+			return errors.Errorf("cannot find host %v to add replica to volume %v", hostID, volumeName)
+		}
+	}
+	ctrl := man.getController(volume)
+	if ctrl == nil {
+		return errors.Errorf("cannot reach the controller of volume %v", volumeName)
+	}
+	return man.createAndAddReplicaToController(volumeName, hostID, ctrl)
+}
+
+// Migrate moves the controller of volume to host. The controller is always
+// created on the current host, so it should be called on the target host.
+func (man *volumeManager) Migrate(volumeName, hostID string) error {
+	if hostID != man.orc.GetCurrentHostID() {
+		return errors.Errorf("volume %v can only be migrated to the current host %v, not %v", volumeName, man.orc.GetCurrentHostID(), hostID)
+	}
+	hosts, err := man.orc.ListHosts()
+	if err != nil {
+		return errors.Wrapf(err, "fail to list hosts to migrate volume %v", volumeName)
+	}
+	if hosts[hostID] == nil {
+		return errors.Errorf("cannot find host %v to migrate volume %v", hostID, volumeName)
+	}
+
+	token, err := man.orc.LockVolume(volumeName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to lock volume '%s' to migrate", volumeName)
+	}
+	defer man.unlockVolume(volumeName, token)
+
+	volume, err := man.Get(volumeName)
+	if err != nil {
+		return errors.Wrapf(err, "fail to migrate volume %v", volumeName)
+	}
+	if volume == nil {
+		return errors.Errorf("cannot find volume %v", volumeName)
+	}
+	if volume.State != types.VolumeStateHealthy {
+		return errors.Errorf("volume %v should be healthy to migrate, current state %v", volumeName, volume.State)
+	}
+	fromHostID := volume.Controller.HostID
+	if fromHostID == hostID {
+		return nil
+	}
+
+	logrus.Infof("migrating volume %v from host %v to host %v", volumeName, fromHostID, hostID)
+	if err := man.detach(volume); err != nil {
+		return errors.Wrapf(err, "fail to detach volume %v from host %v", volumeName, fromHostID)
+	}
+	if err := man.attach(volume); err != nil {
+		return errors.Wrapf(err, "fail to attach volume %v to host %v, the volume is left detached", volumeName, hostID)
+	}
+	return nil
+}
+
+// RestoreFromBackup overwrites the data of the attached volume with the
+// backup. The volume is in restoring state while the backup is restored, so
+// the API allows no other action than detach on it.
+func (man *volumeManager) RestoreFromBackup(volumeName, backupURL string) error {
+	settings, err := man.settings.GetSettings()
+	if err != nil {
+		return errors.Wrap(err, "unable to get settings to restore the backup")
+	}
+	if settings == nil || settings.BackupTarget == "" {
+		return errors.New("cannot restore the backup: backupTarget not set")
+	}
+	backup, err := man.getBackups(settings.BackupTarget).Get(backupURL)
+	if err != nil {
+		return errors.Wrapf(err, "error getting backup '%s' to restore volume '%s'", backupURL, volumeName)
+	}
+	if backup == nil {
+		return errors.Errorf("cannot find backup '%s'", backupURL)
+	}
+
+	token, err := man.orc.LockVolume(volumeName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to lock volume '%s' to restore the backup", volumeName)
+	}
+	defer man.unlockVolume(volumeName, token)
+
+	volume, err := man.Get(volumeName)
+	if err != nil {
+		return errors.Wrapf(err, "fail to restore the backup to volume '%s'", volumeName)
+	}
+	if volume == nil {
+		return errors.Errorf("cannot find volume %v", volumeName)
+	}
+	if volume.State != types.VolumeStateHealthy {
+		return errors.Errorf("volume %v should be healthy to restore the backup, current state %v", volumeName, volume.State)
+	}
+	size, err := strconv.ParseInt(backup.VolumeSize, 10, 64)
+	if err != nil {
+		return errors.Wrapf(err, "error parsing backup.VolumeSize, backup: %+v", backup)
+	}
+	if size > volume.Size {
+		return errors.Errorf("backup '%s' of size %v doesn't fit into volume '%s' of size %v", backupURL, size, volumeName, volume.Size)
+	}
+
+	logrus.Infof("restoring backup '%s' to volume '%s'", backupURL, volumeName)
+	volume.Restoring = true
+	if err := man.orc.UpdateVolume(volume); err != nil {
+		return errors.Wrapf(err, "failed to update volume '%s' to restore the backup", volumeName)
+	}
+	defer func() {
+		volume.Restoring = false
+		if err := man.orc.UpdateVolume(volume); err != nil {
+			logrus.Errorf("%+v", errors.Wrapf(err, "failed to update volume '%s' after restoring the backup", volumeName))
+		}
+	}()
+
+	// quiesce I/O while the data is overwritten, resume it after
+	ctrl := man.getController(volume)
+	if err := ctrl.Freeze(); err != nil {
+		return errors.Wrapf(err, "failed to quiesce volume '%s' to restore the backup", volumeName)
+	}
+	defer func() {
+		if err := ctrl.Unfreeze(); err != nil {
+			logrus.Errorf("%+v", errors.Wrapf(err, "failed to resume volume '%s' after restoring the backup", volumeName))
+		}
+	}()
+
+	if err := ctrl.BackupOps().Restore(backupURL); err != nil {
+		return errors.Wrapf(err, "failed to restore the backup '%s' to volume '%s'", backupURL, volumeName)
+	}
+	return nil
+}
+
 func (man *volumeManager) ReplicaRemove(volumeName, replicaName string) error {
 	volume, err := man.Get(volumeName)
 	if err != nil {
@@ -658,3 +1690,152 @@ func (man *volumeManager) ReplicaRemove(volumeName, replicaName string) error {
 	}
 	return nil
 }
+
+func (man *volumeManager) PinReplicaToHost(volumeName, replicaName, hostID string) error {
+	volume, err := man.Get(volumeName)
+	if err != nil {
+		return errors.Wrapf(err, "fail to pin replica %v of volume %v", replicaName, volumeName)
+	}
+	if volume == nil {
+		return errors.Errorf("cannot find volume %v", volumeName)
+	}
+	replica := volume.Replicas[replicaName]
+	if replica == nil {
+		return errors.Errorf("cannot find replica %v of volume %v", replicaName, volumeName)
+	}
+	if hostID != "" {
+		if replica.HostID != hostID {
+			return errors.Errorf("cannot pin replica %v of volume %v to host %v: replica is on host %v", replicaName, volumeName, hostID, replica.HostID)
+		}
+		// the replica is kept on a host gone from the cluster, e.g. to
+		// recover its data
+		hosts, err := man.orc.ListHosts()
+		if err != nil {
+			return errors.Wrapf(err, "fail to list hosts to pin replica %v of volume %v", replicaName, volumeName)
+		}
+		if hosts[hostID] == nil {
+			logrus.Warnf("pinning replica %v of volume %v to host %v, which is not in the hosts of the cluster", replicaName, volumeName, hostID)
+		}
+	}
+	replica.PinnedHostID = hostID
+	if err := man.orc.UpdateReplica(replica); err != nil {
+		return errors.Wrapf(err, "fail to pin replica %v of volume %v", replicaName, volumeName)
+	}
+	return nil
+}
+
+// SetReplicaMode overrides the mode of a replica in the volume controller,
+// for manual recovery
+func (man *volumeManager) SetReplicaMode(volumeName, replicaName string, mode types.ReplicaMode) error {
+	volume, err := man.Get(volumeName)
+	if err != nil {
+		return errors.Wrapf(err, "fail to set mode of replica %v of volume %v", replicaName, volumeName)
+	}
+	if volume == nil {
+		return errors.Errorf("cannot find volume %v", volumeName)
+	}
+	replica := volume.Replicas[replicaName]
+	if replica == nil {
+		return errors.Errorf("cannot find replica %v of volume %v", replicaName, volumeName)
+	}
+	if !replica.Running || replica.Address == "" {
+		return errors.Errorf("cannot set mode of replica %v of volume %v: replica is not running", replicaName, volumeName)
+	}
+	ctrl := man.getController(volume)
+	if ctrl == nil {
+		return errors.Errorf("cannot set mode of replica %v of volume %v: volume is not attached", replicaName, volumeName)
+	}
+	if err := ctrl.SetReplicaMode(replica, mode); err != nil {
+		return errors.Wrapf(err, "fail to set mode of replica %v of volume %v", replicaName, volumeName)
+	}
+	logrus.Infof("set mode of replica %v of volume %v to %v", replicaName, volumeName, mode)
+	replica.Mode = mode
+	if err := man.orc.UpdateReplica(replica); err != nil {
+		return errors.Wrapf(err, "fail to update replica %v of volume %v", replicaName, volumeName)
+	}
+	return nil
+}
+
+func mostRecentBadReplica(volume *types.VolumeInfo) *types.ReplicaInfo {
+	var recent *types.ReplicaInfo
+	var recentTime time.Time
+	for _, replica := range volume.Replicas {
+		if replica.BadTimestamp == "" {
+			continue
+		}
+		badTime, err := util.ParseTime(replica.BadTimestamp)
+		if err != nil {
+			logrus.Errorf("%+v", errors.Wrapf(err, "fail to parse bad timestamp of replica %v", replica.Name))
+			continue
+		}
+		if recent == nil || badTime.After(recentTime) {
+			recent = replica
+			recentTime = badTime
+		}
+	}
+	return recent
+}
+
+func (man *volumeManager) TakeEmergencySnapshot(name string) (*types.SnapshotInfo, error) {
+	// the temporary controller must not race attach
+	token, err := man.orc.LockVolume(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to lock volume '%s' to take emergency snapshot", name)
+	}
+	defer man.unlockVolume(name, token)
+
+	volume, err := man.Get(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to take emergency snapshot of volume %v", name)
+	}
+	if volume == nil {
+		return nil, errors.Errorf("cannot find volume %v", name)
+	}
+	if volume.State != types.VolumeStateFaulted {
+		return nil, errors.Errorf("emergency snapshot is only allowed for faulted volume, volume %v is %v", name, volume.State)
+	}
+	if volume.Controller != nil {
+		return nil, errors.Errorf("volume %v still has a controller, detach it first", name)
+	}
+	// the replica marked bad the last has the most recent data
+	replica := mostRecentBadReplica(volume)
+	if replica == nil {
+		return nil, errors.Errorf("no replicas to take emergency snapshot of volume %v", name)
+	}
+	if !replica.Running {
+		instance, err := man.orc.StartInstance(&replica.InstanceInfo)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to start replica '%s' for volume '%s'", replica.Name, name)
+		}
+		replica.InstanceInfo = *instance
+	}
+
+	controller, err := man.orc.CreateController(name, man.GetControllerName(name), map[string]*types.ReplicaInfo{replica.Name: replica})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to start the temporary controller for volume '%s'", name)
+	}
+	volume.Controller = controller
+	defer func() {
+		if err := man.detach(volume); err != nil {
+			logrus.Errorf("%+v", errors.Wrapf(err, "failed to stop the temporary controller for volume '%s'", name))
+		}
+	}()
+
+	ctrl := man.getController(volume)
+	if ctrl == nil {
+		return nil, errors.Errorf("cannot reach the temporary controller for volume '%s'", name)
+	}
+	snapName, err := ctrl.SnapshotOps().Create(snapName(EmergencySnapshotName), map[string]string{EmergencySnapshotName: replica.Name})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to take emergency snapshot of volume '%s'", name)
+	}
+	snap, err := ctrl.SnapshotOps().Get(snapName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting snapshot '%s', volume '%s'", snapName, name)
+	}
+	if snap == nil {
+		return nil, errors.Errorf("not found just created snapshot '%s', volume '%s'", snapName, name)
+	}
+	logrus.Infof("took emergency snapshot '%s' from replica '%s', volume '%s'", snapName, replica.Name, name)
+	return snap, nil
+}
@@ -0,0 +1,2046 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/longhorn-manager/controller"
+	"github.com/rancher/longhorn-manager/types"
+	"github.com/rancher/longhorn-manager/util"
+)
+
+const (
+	testHostID      = "host-1"
+	testEngineImage = "rancher/longhorn:test"
+)
+
+type fakeOrc struct {
+	sync.Mutex
+
+	volumes  map[string]*types.VolumeInfo
+	hosts    map[string]*types.HostInfo
+	settings *types.SettingsInfo
+	locks    map[string]string // volume -> lock token
+	orphans  []*types.InstanceInfo
+}
+
+func newFakeOrc() *fakeOrc {
+	return &fakeOrc{
+		volumes: map[string]*types.VolumeInfo{},
+		locks:   map[string]string{},
+		hosts: map[string]*types.HostInfo{
+			testHostID: {UUID: testHostID, Name: testHostID, Address: "10.0.0.1:9500"},
+			"host-2":   {UUID: "host-2", Name: "host-2", Address: "10.0.0.2:9500"},
+			"host-3":   {UUID: "host-3", Name: "host-3", Address: "10.0.0.3:9500"},
+		},
+		settings: &types.SettingsInfo{EngineImage: testEngineImage},
+	}
+}
+
+func copyVolume(v *types.VolumeInfo) *types.VolumeInfo {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	r := &types.VolumeInfo{}
+	if err := json.Unmarshal(b, r); err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func (o *fakeOrc) CreateVolume(volume *types.VolumeInfo) (*types.VolumeInfo, error) {
+	o.Lock()
+	defer o.Unlock()
+	if o.volumes[volume.Name] != nil {
+		return nil, errors.Errorf("volume %v already exists", volume.Name)
+	}
+	o.volumes[volume.Name] = copyVolume(volume)
+	return volume, nil
+}
+
+func (o *fakeOrc) DeleteVolume(volumeName string) error {
+	o.Lock()
+	defer o.Unlock()
+	delete(o.volumes, volumeName)
+	return nil
+}
+
+func (o *fakeOrc) GetVolume(volumeName string) (*types.VolumeInfo, error) {
+	o.Lock()
+	defer o.Unlock()
+	return copyVolume(o.volumes[volumeName]), nil
+}
+
+func (o *fakeOrc) ListVolumes() ([]*types.VolumeInfo, error) {
+	o.Lock()
+	defer o.Unlock()
+	volumes := []*types.VolumeInfo{}
+	for _, v := range o.volumes {
+		volumes = append(volumes, copyVolume(v))
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Name < volumes[j].Name })
+	return volumes, nil
+}
+
+func (o *fakeOrc) MarkBadReplica(volumeName string, replica *types.ReplicaInfo) error {
+	o.Lock()
+	defer o.Unlock()
+	v := o.volumes[volumeName]
+	if v == nil {
+		return errors.Errorf("cannot find volume %v", volumeName)
+	}
+	for _, r := range v.Replicas {
+		if r.Name == replica.Name || (replica.Name == "" && r.Address == replica.Address) {
+			r.BadTimestamp = util.Now()
+		}
+	}
+	return nil
+}
+
+func (o *fakeOrc) UpdateReplica(replica *types.ReplicaInfo) error {
+	o.Lock()
+	defer o.Unlock()
+	v := o.volumes[replica.VolumeName]
+	if v == nil || v.Replicas[replica.Name] == nil {
+		return errors.Errorf("cannot find replica %v", replica.Name)
+	}
+	r := *replica
+	v.Replicas[replica.Name] = &r
+	return nil
+}
+
+func (o *fakeOrc) LockVolume(volumeName string) (string, error) {
+	o.Lock()
+	defer o.Unlock()
+	if o.locks[volumeName] != "" {
+		return "", errors.Errorf("volume %v is locked", volumeName)
+	}
+	token := util.UUID()
+	o.locks[volumeName] = token
+	return token, nil
+}
+
+func (o *fakeOrc) UnlockVolume(volumeName, token string) error {
+	o.Lock()
+	defer o.Unlock()
+	if o.locks[volumeName] != token {
+		return errors.Errorf("volume %v is not locked with token %v", volumeName, token)
+	}
+	delete(o.locks, volumeName)
+	return nil
+}
+
+func (o *fakeOrc) UpdateVolume(volume *types.VolumeInfo) error {
+	o.Lock()
+	defer o.Unlock()
+	v := o.volumes[volume.Name]
+	if v == nil {
+		return errors.Errorf("cannot update volume %v because it doesn't exists", volume.Name)
+	}
+	base := copyVolume(volume)
+	base.Controller = v.Controller
+	base.Replicas = v.Replicas
+	o.volumes[volume.Name] = base
+	return nil
+}
+
+func (o *fakeOrc) RenameVolume(oldName string, volume *types.VolumeInfo) error {
+	o.Lock()
+	defer o.Unlock()
+	if o.volumes[oldName] == nil {
+		return errors.Errorf("cannot find volume %v", oldName)
+	}
+	if o.volumes[volume.Name] != nil {
+		return errors.Errorf("volume %v already exists", volume.Name)
+	}
+	delete(o.volumes, oldName)
+	o.volumes[volume.Name] = copyVolume(volume)
+	return nil
+}
+
+func (o *fakeOrc) CreateController(volumeName, controllerName string, replicas map[string]*types.ReplicaInfo) (*types.ControllerInfo, error) {
+	o.Lock()
+	defer o.Unlock()
+	v := o.volumes[volumeName]
+	if v == nil {
+		return nil, errors.Errorf("cannot find volume %v", volumeName)
+	}
+	for name := range replicas {
+		if v.Replicas[name] == nil {
+			return nil, errors.Errorf("cannot find replica %v", name)
+		}
+	}
+	controller := &types.ControllerInfo{
+		InstanceInfo: types.InstanceInfo{
+			ID:         controllerName,
+			Type:       types.InstanceTypeController,
+			Name:       controllerName,
+			HostID:     testHostID,
+			Address:    controllerName + ".address",
+			Running:    true,
+			VolumeName: volumeName,
+		},
+	}
+	v.Controller = controller
+	c := *controller
+	return &c, nil
+}
+
+func (o *fakeOrc) CreateReplica(volumeName, replicaName, hostID string) (*types.ReplicaInfo, error) {
+	o.Lock()
+	defer o.Unlock()
+	v := o.volumes[volumeName]
+	if v == nil {
+		return nil, errors.Errorf("cannot find volume %v", volumeName)
+	}
+	if hostID == "" {
+		hostID = testHostID
+	}
+	replica := &types.ReplicaInfo{
+		InstanceInfo: types.InstanceInfo{
+			ID:         replicaName,
+			Type:       types.InstanceTypeReplica,
+			Name:       replicaName,
+			HostID:     hostID,
+			VolumeName: volumeName,
+		},
+	}
+	if v.Replicas == nil {
+		v.Replicas = map[string]*types.ReplicaInfo{}
+	}
+	v.Replicas[replicaName] = replica
+	r := *replica
+	return &r, nil
+}
+
+func (o *fakeOrc) setRunning(instance *types.InstanceInfo, running bool) (*types.InstanceInfo, error) {
+	o.Lock()
+	defer o.Unlock()
+	v := o.volumes[instance.VolumeName]
+	if v == nil {
+		return nil, errors.Errorf("cannot find volume %v", instance.VolumeName)
+	}
+	var stored *types.InstanceInfo
+	switch instance.Type {
+	case types.InstanceTypeController:
+		if v.Controller != nil && v.Controller.ID == instance.ID {
+			stored = &v.Controller.InstanceInfo
+		}
+	case types.InstanceTypeReplica:
+		if r := v.Replicas[instance.Name]; r != nil {
+			stored = &r.InstanceInfo
+		}
+	}
+	if stored == nil {
+		return nil, errors.Errorf("cannot find instance %+v", instance)
+	}
+	stored.Running = running
+	stored.Address = ""
+	if running {
+		stored.Address = stored.Name + ".address"
+	}
+	r := *stored
+	return &r, nil
+}
+
+func (o *fakeOrc) StartInstance(instance *types.InstanceInfo) (*types.InstanceInfo, error) {
+	return o.setRunning(instance, true)
+}
+
+func (o *fakeOrc) StopInstance(instance *types.InstanceInfo) (*types.InstanceInfo, error) {
+	return o.setRunning(instance, false)
+}
+
+func (o *fakeOrc) RemoveInstance(instance *types.InstanceInfo) (*types.InstanceInfo, error) {
+	o.Lock()
+	defer o.Unlock()
+	v := o.volumes[instance.VolumeName]
+	if v == nil {
+		return nil, errors.Errorf("cannot find volume %v", instance.VolumeName)
+	}
+	switch instance.Type {
+	case types.InstanceTypeController:
+		v.Controller = nil
+	case types.InstanceTypeReplica:
+		delete(v.Replicas, instance.Name)
+	}
+	return instance, nil
+}
+
+func (o *fakeOrc) ListInstances() ([]*types.InstanceInfo, error) {
+	o.Lock()
+	defer o.Unlock()
+	instances := append([]*types.InstanceInfo{}, o.orphans...)
+	for _, v := range o.volumes {
+		if v.Controller != nil && v.Controller.HostID == testHostID {
+			instances = append(instances, &v.Controller.InstanceInfo)
+		}
+		for _, r := range v.Replicas {
+			if r.HostID == testHostID {
+				instances = append(instances, &r.InstanceInfo)
+			}
+		}
+	}
+	return instances, nil
+}
+
+func (o *fakeOrc) RemoveOrphanedInstance(instance *types.InstanceInfo) error {
+	o.Lock()
+	defer o.Unlock()
+	for i, orphan := range o.orphans {
+		if orphan.ID == instance.ID {
+			o.orphans = append(o.orphans[:i], o.orphans[i+1:]...)
+			return nil
+		}
+	}
+	return errors.Errorf("cannot find orphaned instance %v", instance.ID)
+}
+
+func (o *fakeOrc) ListHosts() (map[string]*types.HostInfo, error) {
+	return o.hosts, nil
+}
+
+func (o *fakeOrc) GetHost(id string) (*types.HostInfo, error) {
+	return o.hosts[id], nil
+}
+
+func (o *fakeOrc) Scheduler() types.Scheduler {
+	return nil
+}
+
+func (o *fakeOrc) GetCurrentHostID() string {
+	return testHostID
+}
+
+func (o *fakeOrc) GetAddress(hostID string) (string, error) {
+	host := o.hosts[hostID]
+	if host == nil {
+		return "", errors.Errorf("cannot find host %v", hostID)
+	}
+	return host.Address, nil
+}
+
+func (o *fakeOrc) GetSettings() (*types.SettingsInfo, error) {
+	o.Lock()
+	defer o.Unlock()
+	s := *o.settings
+	return &s, nil
+}
+
+func (o *fakeOrc) SetSettings(settings *types.SettingsInfo) error {
+	o.Lock()
+	defer o.Unlock()
+	s := *settings
+	o.settings = &s
+	return nil
+}
+
+type fakeController struct {
+	sync.Mutex
+
+	name       string
+	replicas   []*types.ReplicaInfo
+	snapshots  map[string]*types.SnapshotInfo
+	restored   []string
+	onRestore  func()
+	restoreErr error
+	statesErr  error
+	queue      types.TaskQueue
+	readIOPS   int64
+	frozen     bool
+	freezeErr  error
+	endpoint   string
+	// engine without the stats and rebuild status commands
+	engineUnsupported bool
+}
+
+func newFakeController(name string) *fakeController {
+	return &fakeController{
+		name:      name,
+		snapshots: map[string]*types.SnapshotInfo{},
+		queue:     &fakeTaskQueue{},
+	}
+}
+
+func (c *fakeController) Name() string {
+	return c.name
+}
+
+func (c *fakeController) Endpoint() string {
+	if c.endpoint != "" {
+		return c.endpoint
+	}
+	return "/dev/longhorn/" + c.name
+}
+
+func (c *fakeController) GetReplicaStates() ([]*types.ReplicaInfo, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.statesErr != nil {
+		return nil, c.statesErr
+	}
+	return c.replicas, nil
+}
+
+func (c *fakeController) AddReplica(replica *types.ReplicaInfo) error {
+	c.Lock()
+	defer c.Unlock()
+	c.replicas = append(c.replicas, &types.ReplicaInfo{InstanceInfo: replica.InstanceInfo, Mode: types.ReplicaModeWO})
+	return nil
+}
+
+func (c *fakeController) RemoveReplica(replica *types.ReplicaInfo) error {
+	c.Lock()
+	defer c.Unlock()
+	replicas := []*types.ReplicaInfo{}
+	for _, r := range c.replicas {
+		if r.Address != replica.Address {
+			replicas = append(replicas, r)
+		}
+	}
+	c.replicas = replicas
+	return nil
+}
+
+func (c *fakeController) SetReplicaMode(replica *types.ReplicaInfo, mode types.ReplicaMode) error {
+	c.Lock()
+	defer c.Unlock()
+	for _, r := range c.replicas {
+		if r.Address == replica.Address {
+			r.Mode = mode
+			return nil
+		}
+	}
+	return errors.Errorf("cannot find replica %v", replica.Address)
+}
+
+func (c *fakeController) RebuildStatus() ([]*types.RebuildStatus, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.engineUnsupported {
+		return nil, errors.Wrap(controller.ErrEngineUnsupported, "longhorn engine has no command 'replica-rebuild-status'")
+	}
+	statuses := []*types.RebuildStatus{}
+	for _, r := range c.replicas {
+		if r.Mode == types.ReplicaModeWO {
+			statuses = append(statuses, &types.RebuildStatus{Address: r.Address, Progress: 50, State: "in_progress"})
+		}
+	}
+	return statuses, nil
+}
+
+func (c *fakeController) IOStats() (*types.VolumeIOStats, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.engineUnsupported {
+		return nil, errors.Wrap(controller.ErrEngineUnsupported, "longhorn engine has no command 'stats'")
+	}
+	return &types.VolumeIOStats{ReadIOPS: c.readIOPS}, nil
+}
+
+func (c *fakeController) Info() (*types.VolumeControllerInfo, error) {
+	c.Lock()
+	defer c.Unlock()
+	return &types.VolumeControllerInfo{
+		Name:         c.name,
+		ReplicaCount: len(c.replicas),
+		Endpoint:     "/dev/longhorn/" + c.name,
+	}, nil
+}
+
+func (c *fakeController) Freeze() error {
+	c.Lock()
+	defer c.Unlock()
+	if c.freezeErr != nil {
+		return c.freezeErr
+	}
+	c.frozen = true
+	return nil
+}
+
+func (c *fakeController) Unfreeze() error {
+	c.Lock()
+	defer c.Unlock()
+	c.frozen = false
+	return nil
+}
+
+func (c *fakeController) CancelBgTask(num int64) error {
+	if c.queue.Remove(num) == nil {
+		return errors.Errorf("cannot find bgTask %v", num)
+	}
+	return nil
+}
+
+func (c *fakeController) BgTaskQueue() types.TaskQueue {
+	return c.queue
+}
+
+func (c *fakeController) LatestBgTasks() []*types.BgTask {
+	return nil
+}
+
+func (c *fakeController) SnapshotOps() types.SnapshotOps {
+	return c
+}
+
+func (c *fakeController) BackupOps() types.VolumeBackupOps {
+	return c
+}
+
+func (c *fakeController) Create(name string, labels map[string]string) (string, error) {
+	c.Lock()
+	defer c.Unlock()
+	c.snapshots[name] = &types.SnapshotInfo{
+		Name:        name,
+		UserCreated: true,
+		Created:     util.FormatTimeZ(time.Now()),
+		Labels:      labels,
+	}
+	if c.frozen {
+		c.snapshots[name].Labels = map[string]string{"frozen": "true"}
+		for k, v := range labels {
+			c.snapshots[name].Labels[k] = v
+		}
+	}
+	return name, nil
+}
+
+func (c *fakeController) List() ([]*types.SnapshotInfo, error) {
+	c.Lock()
+	defer c.Unlock()
+	ss := []*types.SnapshotInfo{}
+	for _, s := range c.snapshots {
+		ss = append(ss, s)
+	}
+	return ss, nil
+}
+
+func (c *fakeController) Get(name string) (*types.SnapshotInfo, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.snapshots[name], nil
+}
+
+func (c *fakeController) Delete(name string) error {
+	c.Lock()
+	defer c.Unlock()
+	if s := c.snapshots[name]; s != nil {
+		s.Removed = true
+	}
+	return nil
+}
+
+func (c *fakeController) Revert(name string) error {
+	return nil
+}
+
+func (c *fakeController) Diff(from, to string) (*types.SnapshotDiff, error) {
+	return &types.SnapshotDiff{ChangedBlocks: []types.BlockRange{}}, nil
+}
+
+func (c *fakeController) Purge() error {
+	c.Lock()
+	defer c.Unlock()
+	for name, s := range c.snapshots {
+		if s.Removed {
+			delete(c.snapshots, name)
+		}
+	}
+	return nil
+}
+
+func (c *fakeController) StartBackup(snapName, backupTarget string) (*types.BgTask, error) {
+	t := &types.BgTask{Task: &types.BackupBgTask{Snapshot: snapName, BackupTarget: backupTarget}}
+	c.queue.Put(t)
+	return t, nil
+}
+
+func (c *fakeController) Restore(backup string) error {
+	if c.onRestore != nil {
+		c.onRestore()
+	}
+	c.Lock()
+	defer c.Unlock()
+	if c.restoreErr != nil {
+		return c.restoreErr
+	}
+	c.restored = append(c.restored, backup)
+	return nil
+}
+
+func (c *fakeController) DeleteBackup(backup string) error {
+	return nil
+}
+
+func (c *fakeController) Cancel(backup string) error {
+	return nil
+}
+
+type fakeTaskQueue struct {
+	sync.Mutex
+
+	tasks []*types.BgTask
+}
+
+func (q *fakeTaskQueue) Close() error {
+	return nil
+}
+
+func (q *fakeTaskQueue) List() []*types.BgTask {
+	q.Lock()
+	defer q.Unlock()
+	return q.tasks
+}
+
+func (q *fakeTaskQueue) Put(t *types.BgTask) {
+	q.Lock()
+	defer q.Unlock()
+	q.tasks = append(q.tasks, t)
+}
+
+func (q *fakeTaskQueue) Remove(num int64) *types.BgTask {
+	q.Lock()
+	defer q.Unlock()
+	for i, t := range q.tasks {
+		if t.Num == num {
+			q.tasks = append(q.tasks[:i], q.tasks[i+1:]...)
+			return t
+		}
+	}
+	return nil
+}
+
+func (q *fakeTaskQueue) Take() *types.BgTask {
+	q.Lock()
+	defer q.Unlock()
+	if len(q.tasks) == 0 {
+		return nil
+	}
+	t := q.tasks[0]
+	q.tasks = q.tasks[1:]
+	return t
+}
+
+type fakeMonitor struct{}
+
+func (m *fakeMonitor) Close() error {
+	return nil
+}
+
+func (m *fakeMonitor) CronCh() chan<- types.Event {
+	return nil
+}
+
+type testEnv struct {
+	sync.Mutex
+
+	orc         *fakeOrc
+	man         *volumeManager
+	controllers map[string]*fakeController
+}
+
+func newTestEnv() *testEnv {
+	env := &testEnv{
+		orc:         newFakeOrc(),
+		controllers: map[string]*fakeController{},
+	}
+	env.man = env.newManager(env.orc)
+	return env
+}
+
+func (env *testEnv) newManager(orc types.Orchestrator) *volumeManager {
+	monitor := func(volume *types.VolumeInfo, man types.VolumeManager) types.Monitor {
+		return &fakeMonitor{}
+	}
+	getBackups := func(backupTarget string) types.ManagerBackupOps {
+		return nil
+	}
+	man := New(orc, monitor, env.getController, getBackups).(*volumeManager)
+	man.checkReplica = func(replica *types.ReplicaInfo, timeout time.Duration) error {
+		return nil
+	}
+	return man
+}
+
+func (env *testEnv) getController(volume *types.VolumeInfo) types.Controller {
+	if volume == nil || volume.Controller == nil || !volume.Controller.Running {
+		return nil
+	}
+	return env.controller(volume.Name)
+}
+
+func (env *testEnv) controller(volumeName string) *fakeController {
+	env.Lock()
+	defer env.Unlock()
+	c := env.controllers[volumeName]
+	if c == nil {
+		c = newFakeController(volumeName)
+		env.controllers[volumeName] = c
+	}
+	return c
+}
+
+func (env *testEnv) createVolume(t *testing.T, name string, numberOfReplicas int) *types.VolumeInfo {
+	volume, err := env.man.Create(&types.VolumeInfo{
+		Name:             name,
+		Size:             1024 * 1024,
+		NumberOfReplicas: numberOfReplicas,
+	})
+	require.Nil(t, err)
+	require.NotNil(t, volume)
+	return volume
+}
+
+func TestTakeEmergencySnapshot(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	volume := env.createVolume(t, "vol", 2)
+
+	_, err := env.man.TakeEmergencySnapshot("vol")
+	assert.NotNil(err)
+
+	now := time.Now()
+	var recentReplica string
+	for _, replica := range volume.Replicas {
+		badTime := now.Add(-time.Hour)
+		if recentReplica == "" {
+			badTime = now.Add(-time.Minute)
+			recentReplica = replica.Name
+		}
+		env.orc.volumes["vol"].Replicas[replica.Name].BadTimestamp = util.FormatTimeZ(badTime)
+	}
+	volume, err = env.man.Get("vol")
+	assert.Nil(err)
+	assert.Equal(types.VolumeStateFaulted, volume.State)
+
+	// being attached
+	token, err := env.orc.LockVolume("vol")
+	assert.Nil(err)
+	_, err = env.man.TakeEmergencySnapshot("vol")
+	assert.NotNil(err)
+	assert.Nil(env.orc.UnlockVolume("vol", token))
+
+	snap, err := env.man.TakeEmergencySnapshot("vol")
+	assert.Nil(err)
+	assert.NotNil(snap)
+	assert.Equal(recentReplica, snap.Labels[EmergencySnapshotName])
+
+	ss, err := env.controller("vol").List()
+	assert.Nil(err)
+	assert.Len(ss, 1)
+
+	volume, err = env.man.Get("vol")
+	assert.Nil(err)
+	assert.Nil(volume.Controller)
+	assert.Equal(types.VolumeStateFaulted, volume.State)
+	for _, replica := range volume.Replicas {
+		assert.False(replica.Running)
+	}
+	assert.Empty(env.orc.locks)
+
+	_, err = env.man.TakeEmergencySnapshot("nonexistent")
+	assert.NotNil(err)
+}
+
+func TestPurgeSnapshots(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol", 2)
+	assert.Nil(env.man.Attach("vol", ""))
+	ctrl := env.controller("vol")
+	old := util.FormatTimeZ(time.Now().Add(-48 * time.Hour))
+	ctrl.snapshots = map[string]*types.SnapshotInfo{
+		"old":                 {Name: "old", Created: old, Size: "1024"},
+		"removed":             {Name: "removed", Created: util.FormatTimeZ(time.Now()), Removed: true, Size: "512"},
+		"recent":              {Name: "recent", Created: util.FormatTimeZ(time.Now()), Size: "2048"},
+		"volume-head-001.img": {Name: "volume-head-001.img", Created: old},
+	}
+
+	result, err := env.man.PurgeSnapshots("vol", 0)
+	assert.Nil(err)
+	assert.Equal(types.PurgeResult{Removed: 1, SpaceFreed: 512}, *result)
+
+	result, err = env.man.PurgeSnapshots("vol", 24*time.Hour)
+	assert.Nil(err)
+	assert.Equal(types.PurgeResult{Removed: 1, SpaceFreed: 1024}, *result)
+
+	ss, err := ctrl.List()
+	assert.Nil(err)
+	assert.Len(ss, 2)
+}
+
+func TestEnforceMaxSnapshots(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	_, err := env.man.Create(&types.VolumeInfo{Name: "vol", Size: 1024 * 1024, NumberOfReplicas: 2, MaxSnapshots: -1})
+	assert.NotNil(err)
+	_, err = env.man.Create(&types.VolumeInfo{Name: "vol", Size: 1024 * 1024, NumberOfReplicas: 2, MaxSnapshots: 2})
+	assert.Nil(err)
+	assert.Nil(env.man.Attach("vol", ""))
+	// no limit
+	env.createVolume(t, "vol2", 2)
+	assert.Nil(env.man.EnforceMaxSnapshots("vol2"))
+
+	ctrl := env.controller("vol")
+	created := func(hours int) string {
+		return util.FormatTimeZ(time.Now().Add(time.Duration(-hours) * time.Hour))
+	}
+	ctrl.snapshots = map[string]*types.SnapshotInfo{
+		"backed-up":           {Name: "backed-up", Created: created(4)},
+		"old":                 {Name: "old", Created: created(3)},
+		"recent":              {Name: "recent", Created: created(2)},
+		"latest":              {Name: "latest", Created: created(1)},
+		"volume-head-001.img": {Name: "volume-head-001.img", Created: created(5)},
+	}
+	backup := &types.BackupInfo{
+		URL:          "vfs:///var/lib/longhorn/backups/default?backup=backup-1&volume=vol",
+		VolumeName:   "vol",
+		SnapshotName: "backed-up",
+	}
+	env.man.getBackups = func(backupTarget string) types.ManagerBackupOps {
+		return fakeBackups{backup.URL: backup}
+	}
+	assert.Nil(env.man.settings.SetSettings(&types.SettingsInfo{BackupTarget: "vfs:///var/lib/longhorn/backups/default"}))
+
+	assert.Nil(env.man.EnforceMaxSnapshots("vol"))
+	ss, err := ctrl.List()
+	assert.Nil(err)
+	names := []string{}
+	for _, s := range ss {
+		names = append(names, s.Name)
+	}
+	sort.Strings(names)
+	assert.Equal([]string{"backed-up", "latest", "volume-head-001.img"}, names)
+}
+
+func TestCreateDryRun(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	volume, err := env.man.Create(&types.VolumeInfo{Name: "vol1", Size: 1024 * 1024, NumberOfReplicas: 3, DryRun: true})
+	assert.Nil(err)
+	assert.Len(volume.Replicas, 3)
+	hostIDs := []string{}
+	for _, replica := range volume.Replicas {
+		hostIDs = append(hostIDs, replica.HostID)
+	}
+	sort.Strings(hostIDs)
+	assert.Equal([]string{"host-1", "host-2", "host-3"}, hostIDs)
+	assert.Equal(types.VolumeStateDetached, volume.State)
+	assert.Len(env.orc.volumes, 0)
+
+	_, err = env.man.Create(&types.VolumeInfo{Name: "vol1", Size: 1024 * 1024, NumberOfReplicas: 4, DryRun: true})
+	assert.NotNil(err)
+
+	defer func(n int) { MaxReplicasPerHost = n }(MaxReplicasPerHost)
+	MaxReplicasPerHost = 2
+	volume, err = env.man.Create(&types.VolumeInfo{Name: "vol1", Size: 1024 * 1024, NumberOfReplicas: 4, DryRun: true})
+	assert.Nil(err)
+	assert.Len(volume.Replicas, 4)
+
+	settings, err := env.orc.GetSettings()
+	assert.Nil(err)
+	settings.ReplicaAntiAffinity = types.ReplicaAntiAffinityStrict
+	assert.Nil(env.orc.SetSettings(settings))
+	_, err = env.man.Create(&types.VolumeInfo{Name: "vol1", Size: 1024 * 1024, NumberOfReplicas: 4, DryRun: true})
+	assert.NotNil(err)
+
+	src := env.createVolume(t, "src", 2)
+	volume, err = env.man.Create(&types.VolumeInfo{Name: "clone", NumberOfReplicas: 2, FromSnapshot: "src/snap1", DryRun: true})
+	assert.Nil(err)
+	assert.Equal(src.Size, volume.Size)
+	_, err = env.man.Create(&types.VolumeInfo{Name: "clone", NumberOfReplicas: 2, FromSnapshot: "nonexistent/snap1", DryRun: true})
+	assert.NotNil(err)
+	assert.Len(env.orc.volumes, 1)
+}
+
+func TestCreateFromSnapshot(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	src := env.createVolume(t, "src", 2)
+	env.orc.volumes["src"].FsType = "xfs"
+	env.orc.volumes["src"].MountOptions = []string{"noatime"}
+	_, err := env.controller("src").Create("snap1", nil)
+	assert.Nil(err)
+
+	_, err = env.man.Create(&types.VolumeInfo{Name: "clone", NumberOfReplicas: 2, FromSnapshot: "src"})
+	assert.NotNil(err)
+	_, err = env.man.Create(&types.VolumeInfo{Name: "clone", NumberOfReplicas: 2, FromSnapshot: "src/nonexistent"})
+	assert.NotNil(err)
+	volume, err := env.man.Get("clone")
+	assert.Nil(err)
+	assert.Nil(volume)
+
+	volume, err = env.man.Create(&types.VolumeInfo{Name: "clone", NumberOfReplicas: 2, FromSnapshot: "src/snap1"})
+	assert.Nil(err)
+	assert.NotNil(volume)
+	assert.Equal(src.Size, volume.Size)
+	assert.Equal("xfs", volume.FsType)
+	assert.Equal([]string{"noatime"}, volume.MountOptions)
+	assert.Equal(types.VolumeStateDetached, volume.State)
+	assert.Len(volume.Replicas, 2)
+
+	src, err = env.man.Get("src")
+	assert.Nil(err)
+	assert.Equal(types.VolumeStateDetached, src.State)
+	replicas, err := env.controller("src").GetReplicaStates()
+	assert.Nil(err)
+	assert.Len(replicas, 0)
+}
+
+func TestCreateFromVolume(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	src := env.createVolume(t, "src", 2)
+
+	_, err := env.man.Create(&types.VolumeInfo{Name: "clone", NumberOfReplicas: 2, FromVolume: "nonexistent"})
+	assert.NotNil(err)
+	_, err = env.man.Create(&types.VolumeInfo{Name: "clone", NumberOfReplicas: 2, FromVolume: "src", FromSnapshot: "src/snap1"})
+	assert.NotNil(err)
+
+	volume, err := env.man.Create(&types.VolumeInfo{Name: "clone", NumberOfReplicas: 2, FromVolume: "src"})
+	assert.Nil(err)
+	assert.NotNil(volume)
+	assert.Equal(src.Size, volume.Size)
+	assert.Equal(types.VolumeStateDetached, volume.State)
+	assert.Len(volume.Replicas, 2)
+
+	snapshots, err := env.controller("src").List()
+	assert.Nil(err)
+	assert.Len(snapshots, 1)
+	assert.Equal("clone", snapshots[0].Labels[CloneSnapshotName])
+
+	src, err = env.man.Get("src")
+	assert.Nil(err)
+	assert.Equal(types.VolumeStateDetached, src.State)
+}
+
+type fakePVCOrc struct {
+	*fakeOrc
+
+	pvcs map[string]string
+}
+
+func (orc *fakePVCOrc) GetVolumeNameForPVC(pvc string) (string, error) {
+	name, ok := orc.pvcs[pvc]
+	if !ok {
+		return "", errors.Errorf("cannot find PersistentVolumeClaim %v", pvc)
+	}
+	return name, nil
+}
+
+func TestCreateFromBackupRestoring(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	backup := &types.BackupInfo{
+		URL:        "vfs:///var/lib/longhorn/backups/default?backup=backup-1&volume=src",
+		VolumeSize: "1048576",
+	}
+
+	var restoringState types.VolumeState
+	env.controller("vol1").onRestore = func() {
+		volume, err := env.man.Get("vol1")
+		assert.Nil(err)
+		restoringState = volume.State
+	}
+	volume, err := env.man.createFromBackup(&types.VolumeInfo{
+		Name:             "vol1",
+		FromBackup:       backup.URL,
+		NumberOfReplicas: 2,
+	}, backup)
+	assert.Nil(err)
+	assert.Equal(types.VolumeStateRestoring, restoringState)
+	assert.Equal([]string{backup.URL}, env.controller("vol1").restored)
+
+	volume, err = env.man.Get(volume.Name)
+	assert.Nil(err)
+	assert.False(volume.Restoring)
+	assert.Equal(types.VolumeStateDetached, volume.State)
+
+	assert.Nil(env.man.Attach("vol1", ""))
+	volume, err = env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Equal(types.VolumeStateHealthy, volume.State)
+}
+
+type fakeBackups map[string]*types.BackupInfo
+
+func (b fakeBackups) List(volumeName string) ([]*types.BackupInfo, error) {
+	backups := []*types.BackupInfo{}
+	for _, backup := range b {
+		if backup.VolumeName == volumeName {
+			backups = append(backups, backup)
+		}
+	}
+	return backups, nil
+}
+
+func (b fakeBackups) Get(url string) (*types.BackupInfo, error) {
+	backup := b[url]
+	if backup == nil {
+		return nil, errors.Errorf("cannot find backup %v", url)
+	}
+	return backup, nil
+}
+
+func (b fakeBackups) Delete(url string) error {
+	delete(b, url)
+	return nil
+}
+
+func (b fakeBackups) ListVolumes() ([]*types.BackupVolumeInfo, error) {
+	return nil, nil
+}
+
+func (b fakeBackups) GetVolume(volumeName string) (*types.BackupVolumeInfo, error) {
+	return nil, nil
+}
+
+func (b fakeBackups) DeleteVolume(volumeName string) error {
+	return nil
+}
+
+func TestRestoreFromBackup(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	volume := env.createVolume(t, "vol1", 2)
+	backup := &types.BackupInfo{
+		URL:        "vfs:///var/lib/longhorn/backups/default?backup=backup-1&volume=vol1",
+		VolumeName: "vol1",
+		VolumeSize: strconv.FormatInt(volume.Size, 10),
+	}
+	large := &types.BackupInfo{
+		URL:        "vfs:///var/lib/longhorn/backups/default?backup=backup-2&volume=vol2",
+		VolumeName: "vol2",
+		VolumeSize: strconv.FormatInt(volume.Size*2, 10),
+	}
+	env.man.getBackups = func(backupTarget string) types.ManagerBackupOps {
+		return fakeBackups{backup.URL: backup, large.URL: large}
+	}
+
+	assert.NotNil(env.man.RestoreFromBackup("vol1", backup.URL))
+	assert.Nil(env.man.settings.SetSettings(&types.SettingsInfo{BackupTarget: "vfs:///var/lib/longhorn/backups/default"}))
+	assert.NotNil(env.man.RestoreFromBackup("vol1", backup.URL))
+
+	assert.Nil(env.man.Attach("vol1", ""))
+	ctrl := env.controller("vol1")
+	var restoringState types.VolumeState
+	var restoringFrozen bool
+	ctrl.onRestore = func() {
+		volume, err := env.man.Get("vol1")
+		assert.Nil(err)
+		restoringState = volume.State
+		restoringFrozen = ctrl.frozen
+	}
+	assert.NotNil(env.man.RestoreFromBackup("vol1", large.URL))
+	assert.NotNil(env.man.RestoreFromBackup("vol1", "vfs:///nonexistent"))
+	assert.NotNil(env.man.RestoreFromBackup("nonexistent", backup.URL))
+
+	assert.Nil(env.man.RestoreFromBackup("vol1", backup.URL))
+	assert.Equal(types.VolumeStateRestoring, restoringState)
+	assert.True(restoringFrozen)
+	assert.False(ctrl.frozen)
+	assert.Equal([]string{backup.URL}, ctrl.restored)
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	assert.False(volume.Restoring)
+	assert.Equal(types.VolumeStateHealthy, volume.State)
+
+	// not restored unless quiesced
+	ctrl.freezeErr = errors.New("freeze failed")
+	assert.NotNil(env.man.RestoreFromBackup("vol1", backup.URL))
+	assert.Len(ctrl.restored, 1)
+}
+
+func TestCreateFromPVC(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	src := env.createVolume(t, "src", 2)
+
+	// orchestrator doesn't support PVCs
+	_, err := env.man.Create(&types.VolumeInfo{Name: "clone", NumberOfReplicas: 2, SourcePVC: "default/pvc1"})
+	assert.NotNil(err)
+	_, err = env.man.Create(&types.VolumeInfo{Name: "clone", NumberOfReplicas: 2, SourcePVC: "default/pvc1", FromSnapshot: "src/snap1"})
+	assert.NotNil(err)
+
+	env.man = env.newManager(&fakePVCOrc{
+		fakeOrc: env.orc,
+		pvcs:    map[string]string{"default/pvc1": "src"},
+	})
+
+	_, err = env.man.Create(&types.VolumeInfo{Name: "clone", NumberOfReplicas: 2, SourcePVC: "default/nonexistent"})
+	assert.NotNil(err)
+	volume, err := env.man.Get("clone")
+	assert.Nil(err)
+	assert.Nil(volume)
+
+	volume, err = env.man.Create(&types.VolumeInfo{Name: "clone", NumberOfReplicas: 2, SourcePVC: "default/pvc1"})
+	assert.Nil(err)
+	assert.NotNil(volume)
+	assert.Equal(src.Size, volume.Size)
+	assert.Equal(types.VolumeStateDetached, volume.State)
+	assert.Len(volume.Replicas, 2)
+
+	snapshots, err := env.controller("src").List()
+	assert.Nil(err)
+	assert.Len(snapshots, 1)
+	assert.Equal("clone", snapshots[0].Labels[CloneSnapshotName])
+
+	src, err = env.man.Get("src")
+	assert.Nil(err)
+	assert.Equal(types.VolumeStateDetached, src.State)
+}
+
+func TestAttachAccessMode(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+
+	_, err := env.man.Create(&types.VolumeInfo{Name: "vol1", Size: 1024 * 1024, NumberOfReplicas: 2, AccessMode: "rw"})
+	assert.NotNil(err)
+
+	rwo := env.createVolume(t, "rwo", 2)
+	assert.Equal(types.AccessModeReadWriteOnce, rwo.AccessMode)
+	rwx, err := env.man.Create(&types.VolumeInfo{Name: "rwx", Size: 1024 * 1024, NumberOfReplicas: 2, AccessMode: types.AccessModeReadWriteMany})
+	assert.Nil(err)
+	assert.Equal(types.AccessModeReadWriteMany, rwx.AccessMode)
+
+	for _, name := range []string{"rwo", "rwx"} {
+		assert.Nil(env.man.Attach(name, ""))
+		env.orc.volumes[name].Controller.HostID = "host-2"
+	}
+
+	err = env.man.Attach("rwo", "")
+	assert.NotNil(err)
+	volume, err := env.man.Get("rwo")
+	assert.Nil(err)
+	assert.Equal("host-2", volume.Controller.HostID)
+
+	assert.Nil(env.man.Attach("rwx", ""))
+	volume, err = env.man.Get("rwx")
+	assert.Nil(err)
+	assert.Equal(testHostID, volume.Controller.HostID)
+}
+
+func TestCreateDataLocality(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+
+	_, err := env.man.Create(&types.VolumeInfo{Name: "vol1", Size: 1024 * 1024, NumberOfReplicas: 2, DataLocality: "strict"})
+	assert.NotNil(err)
+
+	volume := env.createVolume(t, "vol1", 2)
+	assert.Equal(types.DataLocalityDisabled, volume.DataLocality)
+	volume, err = env.man.Create(&types.VolumeInfo{Name: "vol2", Size: 1024 * 1024, NumberOfReplicas: 2, DataLocality: types.DataLocalityBestEffort})
+	assert.Nil(err)
+	assert.Equal(types.DataLocalityBestEffort, volume.DataLocality)
+}
+
+func TestCheckReplicaHealthy(t *testing.T) {
+	assert := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	defer l.Close()
+	port := l.Addr().(*net.TCPAddr).Port
+
+	basePort := util.BasePort
+	defer func() {
+		util.BasePort = basePort
+	}()
+	util.BasePort = port - 2
+
+	replica := &types.ReplicaInfo{InstanceInfo: types.InstanceInfo{Name: "replica-1", Address: "127.0.0.1"}}
+	assert.Nil(checkReplicaHealthy(replica, time.Second))
+
+	l.Close()
+	assert.NotNil(checkReplicaHealthy(replica, 0))
+}
+
+func TestAttachUnhealthyReplica(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+	env.man.checkReplica = func(replica *types.ReplicaInfo, timeout time.Duration) error {
+		assert.Equal(replica.Name+".address", replica.Address)
+		return errors.New("connection refused")
+	}
+	assert.NotNil(env.man.Attach("vol1", ""))
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Nil(volume.Controller)
+}
+
+func TestAttachHost(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+
+	assert.NotNil(env.man.Attach("vol1", "host-2"))
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Equal(types.VolumeStateDetached, volume.State)
+
+	assert.Nil(env.man.Attach("vol1", testHostID))
+	volume, err = env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Equal(types.VolumeStateHealthy, volume.State)
+	assert.Equal(testHostID, volume.Controller.HostID)
+}
+
+func TestMigrate(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+
+	assert.NotNil(env.man.Migrate("vol1", testHostID))
+	assert.Nil(env.man.Attach("vol1", ""))
+	env.orc.volumes["vol1"].Controller.HostID = "host-2"
+
+	assert.NotNil(env.man.Migrate("vol1", "host-3"))
+	assert.NotNil(env.man.Migrate("nonexistent", testHostID))
+
+	assert.Nil(env.man.Migrate("vol1", testHostID))
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Equal(types.VolumeStateHealthy, volume.State)
+	assert.Equal(testHostID, volume.Controller.HostID)
+	assert.Len(env.orc.locks, 0)
+
+	assert.Nil(env.man.Migrate("vol1", testHostID))
+}
+
+func TestCheckControllerMoved(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+	assert.Nil(env.man.Attach("vol1", ""))
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	assert.NotNil(env.man.monitors["vol1"])
+
+	// migrated to another host, which detached it from this one
+	env.orc.volumes["vol1"].Controller.HostID = "host-2"
+	ctrl := env.controller("vol1")
+	ctrl.statesErr = errors.New("connection refused")
+	assert.Nil(env.man.CheckController(ctrl, volume))
+	assert.Nil(env.man.monitors["vol1"])
+	volume, err = env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Equal("host-2", volume.Controller.HostID)
+}
+
+func TestReplicaAdd(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+
+	assert.NotNil(env.man.ReplicaAdd("vol1", ""))
+	assert.NotNil(env.man.ReplicaAdd("nonexistent", ""))
+
+	assert.Nil(env.man.Attach("vol1", ""))
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Equal(types.VolumeStateHealthy, volume.State)
+
+	assert.NotNil(env.man.ReplicaAdd("vol1", "nonexistent-host"))
+
+	assert.Nil(env.man.ReplicaAdd("vol1", "host-2"))
+	volume, err = env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Len(volume.Replicas, 3)
+	hosts := map[string]int{}
+	for _, replica := range volume.Replicas {
+		hosts[replica.HostID]++
+	}
+	assert.Equal(1, hosts["host-2"])
+}
+
+func TestReplicaStates(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	volume := env.createVolume(t, "vol1", 2)
+	names := []string{}
+	for name := range volume.Replicas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	replicas, err := env.man.ReplicaStates("vol1")
+	assert.Nil(err)
+	assert.Len(replicas, 2)
+	assert.Equal(names[0], replicas[0].Name)
+	assert.Equal(types.ReplicaMode(""), replicas[0].Mode)
+
+	assert.Nil(env.man.Attach("vol1", ""))
+	volume, err = env.man.Get("vol1")
+	assert.Nil(err)
+	r0 := volume.Replicas[names[0]]
+	env.controller("vol1").replicas = []*types.ReplicaInfo{{
+		InstanceInfo: types.InstanceInfo{Address: r0.Address},
+		Mode:         types.ReplicaModeRW,
+	}}
+	replicas, err = env.man.ReplicaStates("vol1")
+	assert.Nil(err)
+	assert.Len(replicas, 2)
+	assert.Equal(types.ReplicaModeRW, replicas[0].Mode)
+	assert.Equal(types.ReplicaMode(""), replicas[1].Mode)
+	assert.Equal(types.ReplicaMode(""), volume.Replicas[names[0]].Mode)
+
+	_, err = env.man.ReplicaStates("nonexistent")
+	assert.NotNil(err)
+}
+
+func TestRebuildStatus(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	volume := env.createVolume(t, "vol1", 2)
+	_, err := env.man.RebuildStatus("vol1")
+	assert.NotNil(err)
+
+	assert.Nil(env.man.Attach("vol1", ""))
+	volume, err = env.man.Get("vol1")
+	assert.Nil(err)
+	names := []string{}
+	for name := range volume.Replicas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	r0, r1 := volume.Replicas[names[0]], volume.Replicas[names[1]]
+
+	env.controller("vol1").replicas = []*types.ReplicaInfo{
+		{InstanceInfo: types.InstanceInfo{Address: r0.Address}, Mode: types.ReplicaModeRW},
+		{InstanceInfo: types.InstanceInfo{Address: r1.Address}, Mode: types.ReplicaModeRW},
+	}
+	statuses, err := env.man.RebuildStatus("vol1")
+	assert.Nil(err)
+	assert.Len(statuses, 0)
+
+	env.controller("vol1").replicas[1].Mode = types.ReplicaModeWO
+	statuses, err = env.man.RebuildStatus("vol1")
+	assert.Nil(err)
+	assert.Equal([]*types.RebuildStatus{{ReplicaName: r1.Name, Address: r1.Address, Progress: 50, State: "in_progress"}}, statuses)
+
+	env.controller("vol1").engineUnsupported = true
+	statuses, err = env.man.RebuildStatus("vol1")
+	assert.Nil(err)
+	assert.Equal([]*types.RebuildStatus{{ReplicaName: r1.Name, Address: r1.Address, State: "rebuilding"}}, statuses)
+}
+
+func TestRebuildLimit(t *testing.T) {
+	assert := require.New(t)
+
+	defer func(concurrency int) {
+		RebuildConcurrency = concurrency
+	}(RebuildConcurrency)
+	RebuildConcurrency = 2
+
+	env := newTestEnv()
+	for _, name := range []string{"vol1", "vol2", "vol3"} {
+		env.createVolume(t, name, 2)
+		assert.Nil(env.man.Attach(name, ""))
+	}
+
+	assert.Nil(env.man.startRebuild("vol1"))
+	assert.NotNil(env.man.startRebuild("vol1"))
+	assert.False(env.man.canRebuild("vol1"))
+	assert.NotNil(env.man.ReplicaAdd("vol1", ""))
+
+	assert.Nil(env.man.startRebuild("vol2"))
+	assert.False(env.man.canRebuild("vol3"))
+	assert.NotNil(env.man.ReplicaAdd("vol3", ""))
+
+	// under-replicated volume waits for a rebuild slot
+	volume, err := env.man.Get("vol3")
+	assert.Nil(err)
+	ctrl := env.controller("vol3")
+	for _, replica := range volume.Replicas {
+		ctrl.replicas = append(ctrl.replicas, &types.ReplicaInfo{InstanceInfo: replica.InstanceInfo, Mode: types.ReplicaModeRW})
+	}
+	volume.NumberOfReplicas = 3
+	assert.Nil(env.man.CheckController(ctrl, volume))
+	volume, err = env.man.Get("vol3")
+	assert.Nil(err)
+	assert.Len(volume.Replicas, 2)
+
+	env.man.finishRebuild("vol1")
+	assert.True(env.man.canRebuild("vol3"))
+	volume.NumberOfReplicas = 3
+	assert.Nil(env.man.CheckController(ctrl, volume))
+	volume, err = env.man.Get("vol3")
+	assert.Nil(err)
+	assert.Len(volume.Replicas, 3)
+}
+
+func TestPinReplicaToHost(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	volume := env.createVolume(t, "vol1", 2)
+	var replica *types.ReplicaInfo
+	for _, r := range volume.Replicas {
+		replica = r
+		break
+	}
+
+	assert.NotNil(env.man.PinReplicaToHost("nonexistent", replica.Name, testHostID))
+	assert.NotNil(env.man.PinReplicaToHost("vol1", "nonexistent", testHostID))
+	assert.NotNil(env.man.PinReplicaToHost("vol1", replica.Name, "host-2"))
+
+	assert.Nil(env.man.PinReplicaToHost("vol1", replica.Name, testHostID))
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Equal(testHostID, volume.Replicas[replica.Name].PinnedHostID)
+
+	// pinned bad replicas are kept
+	assert.Nil(env.orc.MarkBadReplica("vol1", replica))
+	env.orc.volumes["vol1"].Replicas[replica.Name].BadTimestamp = util.FormatTimeZ(time.Now().Add(-2 * KeepBadReplicasPeriod))
+	assert.Nil(env.man.Cleanup(volume))
+	volume, err = env.man.Get("vol1")
+	assert.Nil(err)
+	assert.NotNil(volume.Replicas[replica.Name])
+
+	assert.Nil(env.man.PinReplicaToHost("vol1", replica.Name, ""))
+	volume, err = env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Equal("", volume.Replicas[replica.Name].PinnedHostID)
+
+	// with a warning
+	delete(env.orc.hosts, testHostID)
+	assert.Nil(env.man.PinReplicaToHost("vol1", replica.Name, testHostID))
+	volume, err = env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Equal(testHostID, volume.Replicas[replica.Name].PinnedHostID)
+}
+
+func TestStarted(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	assert.False(env.man.Started())
+	assert.Nil(env.man.Start())
+	assert.True(env.man.Started())
+}
+
+func TestListConcurrent(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	names := []string{}
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("vol%02d", i)
+		env.createVolume(t, name, 1)
+		names = append(names, name)
+	}
+	for _, name := range names[:10] {
+		assert.Nil(env.man.Attach(name, ""))
+	}
+
+	for _, workers := range []int{0, 1, 3, 8, 100} {
+		ListWorkers = workers
+		volumes, err := env.man.List()
+		assert.Nil(err)
+		assert.Len(volumes, len(names))
+		for i, volume := range volumes {
+			assert.Equal(names[i], volume.Name)
+			if i < 10 {
+				assert.Equal(types.VolumeStateHealthy, volume.State)
+				assert.Equal("/dev/longhorn/"+volume.Name, volume.Endpoint)
+			} else {
+				assert.Equal(types.VolumeStateDetached, volume.State)
+				assert.Equal("", volume.Endpoint)
+			}
+		}
+	}
+	ListWorkers = 8
+}
+
+func TestCreateController(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	volume := env.createVolume(t, "vol1", 2)
+
+	_, err := env.man.CreateController("nonexistent", volume.Replicas)
+	assert.NotNil(err)
+	_, err = env.man.CreateController("vol1", nil)
+	assert.NotNil(err)
+	_, err = env.man.CreateController("vol1", map[string]*types.ReplicaInfo{"nonexistent": {}})
+	assert.NotNil(err)
+
+	controller, err := env.man.CreateController("vol1", volume.Replicas)
+	assert.Nil(err)
+	assert.Equal(env.man.GetControllerName("vol1"), controller.Name)
+	volume, err = env.man.Get("vol1")
+	assert.Nil(err)
+	assert.NotNil(volume.Controller)
+
+	_, err = env.man.CreateController("vol1", volume.Replicas)
+	assert.NotNil(err)
+}
+
+func TestAttachDetachLock(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+
+	// held by another manager
+	token, err := env.orc.LockVolume("vol1")
+	assert.Nil(err)
+	assert.NotNil(env.man.Attach("vol1", ""))
+	assert.NotNil(env.orc.UnlockVolume("vol1", "other"))
+	assert.Nil(env.orc.UnlockVolume("vol1", token))
+
+	assert.Nil(env.man.Attach("vol1", ""))
+	assert.Empty(env.orc.locks["vol1"])
+
+	token, err = env.orc.LockVolume("vol1")
+	assert.Nil(err)
+	assert.NotNil(env.man.Detach("vol1"))
+	assert.Nil(env.orc.UnlockVolume("vol1", token))
+
+	assert.Nil(env.man.Detach("vol1"))
+	assert.Empty(env.orc.locks["vol1"])
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Equal(types.VolumeStateDetached, volume.State)
+}
+
+// hostOrc is the view of the manager of another host on the shared fakeOrc
+type hostOrc struct {
+	*fakeOrc
+	hostID     string
+	beforeLock func()
+}
+
+func (o *hostOrc) GetCurrentHostID() string {
+	return o.hostID
+}
+
+func (o *hostOrc) LockVolume(volumeName string) (string, error) {
+	if o.beforeLock != nil {
+		o.beforeLock()
+	}
+	return o.fakeOrc.LockVolume(volumeName)
+}
+
+func (o *hostOrc) CreateController(volumeName, controllerName string, replicas map[string]*types.ReplicaInfo) (*types.ControllerInfo, error) {
+	controller, err := o.fakeOrc.CreateController(volumeName, controllerName, replicas)
+	if err != nil {
+		return nil, err
+	}
+	o.fakeOrc.Lock()
+	defer o.fakeOrc.Unlock()
+	o.volumes[volumeName].Controller.HostID = o.hostID
+	controller.HostID = o.hostID
+	return controller, nil
+}
+
+func TestConcurrentAttach(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+
+	read := make(chan struct{})
+	attached := make(chan struct{})
+	man1 := env.newManager(&hostOrc{fakeOrc: env.orc, hostID: testHostID, beforeLock: func() {
+		close(read)
+		<-attached
+	}})
+	man2 := env.newManager(&hostOrc{fakeOrc: env.orc, hostID: "host-2"})
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- man1.Attach("vol1", "")
+	}()
+	// man1 has read the volume detached, man2 attaches it before man1 locks it
+	<-read
+	assert.Nil(man2.Attach("vol1", ""))
+	close(attached)
+
+	err := <-errCh
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "already attached to host host-2")
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Equal("host-2", volume.Controller.HostID)
+	assert.Empty(env.orc.locks["vol1"])
+}
+
+func TestCheckStaleReplicas(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	volume := &types.VolumeInfo{Name: "vol1", StaleReplicaTimeout: 20 * time.Minute}
+	r1 := &types.ReplicaInfo{InstanceInfo: types.InstanceInfo{Address: "10.0.0.1"}, Mode: types.ReplicaModeWO}
+	r2 := &types.ReplicaInfo{InstanceInfo: types.InstanceInfo{Address: "10.0.0.2"}, Mode: types.ReplicaModeWO}
+	now := time.Now()
+
+	wo, stale := env.man.checkStaleReplicas(volume, []*types.ReplicaInfo{r1}, now)
+	assert.Len(wo, 1)
+	assert.Len(stale, 0)
+
+	wo, stale = env.man.checkStaleReplicas(volume, []*types.ReplicaInfo{r1, r2}, now.Add(15*time.Minute))
+	assert.Len(wo, 2)
+	assert.Len(stale, 0)
+
+	wo, stale = env.man.checkStaleReplicas(volume, []*types.ReplicaInfo{r1, r2}, now.Add(21*time.Minute))
+	assert.Equal([]*types.ReplicaInfo{r2}, wo)
+	assert.Equal([]*types.ReplicaInfo{r1}, stale)
+
+	// a replica leaving WO mode is tracked anew if it's rebuilt again
+	wo, stale = env.man.checkStaleReplicas(volume, []*types.ReplicaInfo{}, now.Add(22*time.Minute))
+	assert.Len(wo, 0)
+	wo, stale = env.man.checkStaleReplicas(volume, []*types.ReplicaInfo{r2}, now.Add(40*time.Minute))
+	assert.Len(wo, 1)
+	assert.Len(stale, 0)
+
+	volume.StaleReplicaTimeout = 0
+	wo, stale = env.man.checkStaleReplicas(volume, []*types.ReplicaInfo{r2}, now.Add(24*time.Hour))
+	assert.Len(wo, 1)
+	assert.Len(stale, 0)
+}
+
+func TestSetReplicaMode(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	volume := env.createVolume(t, "vol1", 2)
+	var name string
+	for name = range volume.Replicas {
+		break
+	}
+	assert.NotNil(env.man.SetReplicaMode("vol1", name, types.ReplicaModeRW))
+
+	assert.Nil(env.man.Attach("vol1", ""))
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	env.controller("vol1").replicas = []*types.ReplicaInfo{{
+		InstanceInfo: types.InstanceInfo{Address: volume.Replicas[name].Address},
+		Mode:         types.ReplicaModeWO,
+	}}
+
+	assert.Nil(env.man.SetReplicaMode("vol1", name, types.ReplicaModeRW))
+	assert.Equal(types.ReplicaModeRW, env.controller("vol1").replicas[0].Mode)
+	volume, err = env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Equal(types.ReplicaModeRW, volume.Replicas[name].Mode)
+
+	assert.NotNil(env.man.SetReplicaMode("vol1", "nonexistent", types.ReplicaModeRW))
+}
+
+func TestUpdateLabels(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+
+	assert.Nil(env.man.UpdateLabels("vol1", map[string]string{"app": "db", "example.com/tier": "backend"}))
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Equal(map[string]string{"app": "db", "example.com/tier": "backend"}, volume.Labels)
+
+	assert.NotNil(env.man.UpdateLabels("vol1", map[string]string{"app=": "db"}))
+	assert.NotNil(env.man.UpdateLabels("vol1", map[string]string{"app": "d b"}))
+	assert.NotNil(env.man.UpdateLabels("nonexistent", map[string]string{"app": "db"}))
+
+	assert.Nil(env.man.UpdateLabels("vol1", nil))
+	volume, err = env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Len(volume.Labels, 0)
+}
+
+func TestUpdateQoS(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+
+	qos := types.VolumeQoS{ReadIOPSMax: 1000, WriteBandwidthMax: 10 << 20}
+	assert.Nil(env.man.UpdateQoS("vol1", qos))
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Equal(qos, volume.VolumeQoS)
+	assert.Equal(types.VolumeStateDetached, volume.State)
+
+	assert.NotNil(env.man.UpdateQoS("vol1", types.VolumeQoS{WriteIOPSMax: -1}))
+	assert.NotNil(env.man.UpdateQoS("nonexistent", qos))
+
+	// the controller of the attached volume is restarted with the new limits
+	assert.Nil(env.man.Attach("vol1", ""))
+	env.orc.volumes["vol1"].Controller.HostID = "host-2"
+	qos.ReadIOPSMax = 0
+	assert.Nil(env.man.UpdateQoS("vol1", qos))
+	volume, err = env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Equal(qos, volume.VolumeQoS)
+	assert.Equal(types.VolumeStateHealthy, volume.State)
+	assert.Equal(testHostID, volume.Controller.HostID)
+	assert.Len(env.orc.locks, 0)
+}
+
+type fakeEventOrc struct {
+	*fakeOrc
+
+	sync.Mutex
+	reasons []string
+}
+
+func (orc *fakeEventOrc) RecordVolumeEvent(volume *types.VolumeInfo, eventType, reason, message string) {
+	orc.Lock()
+	defer orc.Unlock()
+	orc.reasons = append(orc.reasons, reason)
+}
+
+func TestCheckControllerEvents(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	orc := &fakeEventOrc{fakeOrc: env.orc}
+	env.man = env.newManager(orc)
+	volume := env.createVolume(t, "vol1", 2)
+	assert.Nil(env.man.Attach("vol1", ""))
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+
+	addresses := []string{}
+	for _, r := range volume.Replicas {
+		addresses = append(addresses, r.Address)
+	}
+	ctrl := env.controller("vol1")
+	ctrl.replicas = []*types.ReplicaInfo{
+		{InstanceInfo: types.InstanceInfo{Address: addresses[0]}, Mode: types.ReplicaModeRW},
+		{InstanceInfo: types.InstanceInfo{Address: addresses[1]}, Mode: types.ReplicaModeERR},
+	}
+	assert.Nil(env.man.CheckController(ctrl, volume))
+	assert.Equal([]string{"ReplicaFailed"}, orc.reasons)
+
+	orc.reasons = nil
+	ctrl.replicas = []*types.ReplicaInfo{
+		{InstanceInfo: types.InstanceInfo{Address: addresses[0]}, Mode: types.ReplicaModeERR},
+	}
+	env.man.CheckController(ctrl, volume)
+	assert.Equal([]string{"ReplicaFailed", "VolumeFaulted"}, orc.reasons)
+}
+
+func TestMonitorStatus(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+
+	status, err := env.man.MonitorStatus("vol1")
+	assert.Nil(err)
+	assert.Nil(status)
+
+	assert.Nil(env.man.Attach("vol1", ""))
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	status, err = env.man.MonitorStatus("vol1")
+	assert.Nil(err)
+	assert.Equal(MonitoringPeriod, status.Interval)
+	assert.True(status.LastCheckTime.IsZero())
+
+	ctrl := env.controller("vol1")
+	ctrl.statesErr = errors.New("connection refused")
+	assert.NotNil(env.man.CheckController(ctrl, volume))
+	assert.NotNil(env.man.CheckController(ctrl, volume))
+	status, err = env.man.MonitorStatus("vol1")
+	assert.Nil(err)
+	assert.False(status.LastCheckTime.IsZero())
+	assert.Equal(2, status.ConsecutiveErrors)
+	assert.Contains(status.LastCheckError, "connection refused")
+
+	ctrl.statesErr = nil
+	for _, r := range volume.Replicas {
+		ctrl.replicas = append(ctrl.replicas, &types.ReplicaInfo{InstanceInfo: types.InstanceInfo{Address: r.Address}, Mode: types.ReplicaModeRW})
+	}
+	assert.Nil(env.man.CheckController(ctrl, volume))
+	status, err = env.man.MonitorStatus("vol1")
+	assert.Nil(err)
+	assert.Equal(0, status.ConsecutiveErrors)
+	assert.Equal("", status.LastCheckError)
+
+	assert.Nil(env.man.Detach("vol1"))
+	status, err = env.man.MonitorStatus("vol1")
+	assert.Nil(err)
+	assert.Nil(status)
+}
+
+func TestCheckControllerUnresponsive(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	orc := &fakeEventOrc{fakeOrc: env.orc}
+	env.man = env.newManager(orc)
+	env.createVolume(t, "vol1", 2)
+	assert.Nil(env.man.Attach("vol1", ""))
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+
+	ctrl := env.controller("vol1")
+	ctrl.statesErr = errors.Wrap(controller.ErrUnresponsive, "no replica states")
+	err = env.man.CheckController(ctrl, volume)
+	ctrlErr, ok := err.(*ControllerError)
+	assert.True(ok)
+	assert.True(ctrlErr.Unresponsive)
+	assert.Equal([]string{"ControllerUnresponsive"}, orc.reasons)
+
+	assert.Nil(restartController(env.man, "vol1"))
+	volume, err = env.man.Get("vol1")
+	assert.Nil(err)
+	assert.NotNil(volume.Controller)
+	assert.True(volume.Controller.Running)
+}
+
+func TestCreateReplicaCount(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	_, err := env.man.Create(&types.VolumeInfo{Name: "vol1", Size: 1 << 30, NumberOfReplicas: 4})
+	assert.NotNil(err)
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Nil(volume)
+
+	defer func(n int) { MaxReplicasPerHost = n }(MaxReplicasPerHost)
+	MaxReplicasPerHost = 2
+	assert.Nil(env.man.checkReplicaCount(6))
+	assert.NotNil(env.man.checkReplicaCount(7))
+}
+
+type blockingController struct {
+	*fakeController
+
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingController) GetReplicaStates() ([]*types.ReplicaInfo, error) {
+	c.entered <- struct{}{}
+	<-c.release
+	return c.fakeController.GetReplicaStates()
+}
+
+func TestCheckControllerSkipsConcurrentCheck(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+	assert.Nil(env.man.Attach("vol1", ""))
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	ctrl := &blockingController{
+		fakeController: env.controller("vol1"),
+		entered:        make(chan struct{}, 1),
+		release:        make(chan struct{}),
+	}
+	for _, r := range volume.Replicas {
+		ctrl.replicas = append(ctrl.replicas, &types.ReplicaInfo{InstanceInfo: types.InstanceInfo{Address: r.Address}, Mode: types.ReplicaModeRW})
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- env.man.CheckController(ctrl, volume)
+	}()
+	<-ctrl.entered
+
+	// doesn't reach the controller while the first check is stuck
+	assert.Nil(env.man.CheckController(ctrl, volume))
+	assert.Len(ctrl.entered, 0)
+
+	close(ctrl.release)
+	assert.Nil(<-done)
+
+	assert.Nil(env.man.CheckController(ctrl, volume))
+	assert.Len(ctrl.entered, 1)
+}
+
+func TestCreateGroupSnapshot(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+	env.createVolume(t, "vol2", 2)
+
+	_, err := env.man.CreateGroupSnapshot([]string{"vol1", "vol2"}, "", nil)
+	assert.NotNil(err)
+	assert.Nil(env.man.Attach("vol1", ""))
+	assert.Nil(env.man.Attach("vol2", ""))
+
+	_, err = env.man.CreateGroupSnapshot([]string{"vol1", "nonexistent"}, "", nil)
+	assert.NotNil(err)
+	_, err = env.man.CreateGroupSnapshot([]string{"vol1", "vol1"}, "", nil)
+	assert.NotNil(err)
+
+	name, err := env.man.CreateGroupSnapshot([]string{"vol1", "vol2"}, "", map[string]string{"app": "db"})
+	assert.Nil(err)
+	assert.True(strings.HasPrefix(name, "group-"))
+	for _, volumeName := range []string{"vol1", "vol2"} {
+		snap, err := env.controller(volumeName).Get(name)
+		assert.Nil(err)
+		assert.NotNil(snap)
+		assert.Equal(map[string]string{"frozen": "true", "app": "db"}, snap.Labels)
+		assert.False(env.controller(volumeName).frozen)
+	}
+
+	env.controller("vol2").freezeErr = errors.New("cannot freeze")
+	_, err = env.man.CreateGroupSnapshot([]string{"vol1", "vol2"}, "snap2", nil)
+	assert.NotNil(err)
+	snap, err := env.controller("vol1").Get("snap2")
+	assert.Nil(err)
+	assert.Nil(snap)
+	assert.False(env.controller("vol1").frozen)
+}
+
+func TestQuiesce(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+	assert.NotNil(env.man.Quiesce("vol1"))
+	assert.NotNil(env.man.Quiesce("nonexistent"))
+
+	assert.Nil(env.man.Attach("vol1", ""))
+	assert.Nil(env.man.Quiesce("vol1"))
+	assert.True(env.controller("vol1").frozen)
+	assert.Nil(env.man.Unquiesce("vol1"))
+	assert.False(env.controller("vol1").frozen)
+
+	env.controller("vol1").freezeErr = errors.New("cannot freeze")
+	assert.NotNil(env.man.Quiesce("vol1"))
+	assert.False(env.controller("vol1").frozen)
+}
+
+func TestGetReplicaName(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	names := map[string]struct{}{}
+	for i := 0; i < 10000; i++ {
+		name := env.man.GetReplicaName("vol")
+		assert.Regexp(`^vol-replica-[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, name)
+		names[name] = struct{}{}
+	}
+	assert.Len(names, 10000)
+	assert.Equal("vol-controller", env.man.GetControllerName("vol"))
+}
+
+func TestWatch(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+	changes, stop := env.man.Watch("vol1")
+	others, stopOthers := env.man.Watch("vol2")
+	defer stopOthers()
+
+	assert.Nil(env.man.Attach("vol1", ""))
+	assert.Len(changes, 1)
+	assert.Nil(env.man.Detach("vol1"))
+	// notifications don't pile up
+	assert.Len(changes, 1)
+	<-changes
+	assert.Len(others, 0)
+
+	stop()
+	assert.Nil(env.man.Attach("vol1", ""))
+	assert.Len(changes, 0)
+}
+
+func TestWaitForHealthy(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	env.createVolume(t, "vol1", 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.NotNil(env.man.WaitForHealthy(ctx, "vol1"))
+	assert.NotNil(env.man.WaitForHealthy(context.Background(), "nonexistent"))
+
+	done := make(chan error)
+	go func() {
+		done <- env.man.WaitForHealthy(context.Background(), "vol1")
+	}()
+	assert.Nil(env.man.Attach("vol1", ""))
+	select {
+	case err := <-done:
+		assert.Nil(err)
+	case <-time.After(time.Second):
+		t.Fatal("WaitForHealthy didn't return after the volume got healthy")
+	}
+}
+
+func TestRename(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	volume := env.createVolume(t, "vol1", 2)
+	env.createVolume(t, "vol2", 1)
+
+	assert.NotNil(env.man.Rename("vol1", "vol2"))
+	assert.NotNil(env.man.Rename("vol1", "vol1"))
+	assert.NotNil(env.man.Rename("missing", "vol3"))
+
+	assert.Nil(env.man.Attach("vol1", ""))
+	assert.NotNil(env.man.Rename("vol1", "vol3"))
+	assert.Nil(env.man.Detach("vol1"))
+
+	assert.Nil(env.man.Rename("vol1", "vol3"))
+	old, err := env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Nil(old)
+
+	renamed, err := env.man.Get("vol3")
+	assert.Nil(err)
+	assert.NotNil(renamed)
+	assert.Equal(volume.Size, renamed.Size)
+	assert.Len(renamed.Replicas, 2)
+	for name, replica := range renamed.Replicas {
+		assert.Equal(name, replica.Name)
+		assert.True(strings.HasPrefix(name, "vol3-replica-"))
+		assert.Equal("vol3", replica.VolumeName)
+		assert.Equal(volume.Replicas["vol1"+strings.TrimPrefix(name, "vol3")].ID, replica.ID)
+	}
+	assert.Empty(env.orc.locks)
+
+	assert.Nil(env.man.Attach("vol3", ""))
+	renamed, err = env.man.Get("vol3")
+	assert.Nil(err)
+	assert.Equal(types.VolumeStateHealthy, renamed.State)
+}
@@ -53,12 +53,27 @@ func monitor(ctrl types.Controller, volume *types.VolumeInfo, man types.VolumeMa
 	defer ticker.Start().Stop()
 	<-ch
 	failedAttempts := 0
+	unresponsive := false
 	for range ch {
 		if err := func() error {
 			defer ticker.Stop().Start()
 			if err := man.CheckController(ctrl, volume); err != nil {
-				if err, ok := err.(ControllerError); ok {
-					return errors.Wrapf(err.Cause(), "controller failed, volume '%s'", volume.Name)
+				var ctrlErr *ControllerError
+				if As(err, &ctrlErr) {
+					if ctrlErr.Unresponsive {
+						unresponsive = true
+						return errors.Wrapf(ctrlErr.Cause(), "controller unresponsive, volume '%s'", volume.Name)
+					}
+					if !ctrlErr.Transient {
+						if failedAttempts++; failedAttempts > MonitoringMaxRetries {
+							return errors.Wrapf(ctrlErr.Cause(), "controller failed repeatedly, volume '%s'", volume.Name)
+						}
+						logrus.Warnf("%v", errors.Wrapf(ctrlErr.Cause(), "controller failed, volume '%s', going to retry", volume.Name))
+						return nil
+					}
+					failedAttempts = 0
+					logrus.Warnf("%v", errors.Wrapf(ctrlErr.Cause(), "controller not responding, volume '%s', going to retry", volume.Name))
+					return nil
 				}
 				if failedAttempts++; failedAttempts > MonitoringMaxRetries {
 					return errors.Wrapf(err, "repeated errors checking volume '%s', giving up", volume.Name)
@@ -70,6 +85,13 @@ func monitor(ctrl types.Controller, volume *types.VolumeInfo, man types.VolumeMa
 			return nil
 		}(); err != nil {
 			close(ch)
+			if unresponsive {
+				logrus.Error(errors.Wrapf(err, "restarting controller"))
+				if err := restartController(man, volume.Name); err != nil {
+					logrus.Errorf("%+v", err)
+				}
+				continue
+			}
 			logrus.Error(errors.Wrapf(err, "detaching volume"))
 			if err := man.Detach(volume.Name); err != nil {
 				logrus.Errorf("%+v", errors.Wrapf(err, "error detaching failed volume '%s'", volume.Name))
@@ -78,6 +100,18 @@ func monitor(ctrl types.Controller, volume *types.VolumeInfo, man types.VolumeMa
 	}
 }
 
+// restartController replaces the hung controller of the volume by detaching
+// (which stops its container) and attaching it again
+func restartController(man types.VolumeManager, volumeName string) error {
+	if err := man.Detach(volumeName); err != nil {
+		return errors.Wrapf(err, "error detaching volume '%s' with unresponsive controller", volumeName)
+	}
+	if err := man.Attach(volumeName, ""); err != nil {
+		return errors.Wrapf(err, "error reattaching volume '%s' with unresponsive controller", volumeName)
+	}
+	return nil
+}
+
 func cleanup(volume *types.VolumeInfo, man types.VolumeManager, ch chan types.Event) {
 	ticker := NewTicker(CleanupPeriod, ch)
 	defer ticker.Start().Stop()
@@ -0,0 +1,59 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+type fakeMonitoredManager struct {
+	types.VolumeManager
+	checkErrs []error
+	detached  chan string
+}
+
+func (m *fakeMonitoredManager) CheckController(ctrl types.Controller, volume *types.VolumeInfo) error {
+	err := m.checkErrs[0]
+	m.checkErrs = m.checkErrs[1:]
+	return err
+}
+
+func (m *fakeMonitoredManager) Detach(name string) error {
+	m.detached <- name
+	return nil
+}
+
+func TestMonitorPermanentErrors(t *testing.T) {
+	assert := require.New(t)
+
+	defer func(period time.Duration) { MonitoringPeriod = period }(MonitoringPeriod)
+	MonitoringPeriod = time.Hour
+
+	failed := &ControllerError{Err: errors.New("replica failed")}
+	man := &fakeMonitoredManager{
+		checkErrs: []error{failed, nil, failed, failed, failed, failed},
+		detached:  make(chan string, 1),
+	}
+	ch := make(chan types.Event)
+	go monitor(nil, &types.VolumeInfo{Name: "vol1"}, man, ch)
+	ch <- TimeEvent()
+
+	// one permanent error doesn't detach the volume
+	ch <- TimeEvent()
+	ch <- TimeEvent()
+	assert.Len(man.detached, 0)
+
+	for i := 0; i < MonitoringMaxRetries+1; i++ {
+		ch <- TimeEvent()
+	}
+	select {
+	case name := <-man.detached:
+		assert.Equal("vol1", name)
+	case <-time.After(time.Second):
+		assert.Fail("volume not detached after repeated errors")
+	}
+}
@@ -0,0 +1,46 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+// recordCheck updates the monitor status of the volume with the result of a
+// CheckController call
+func (man *volumeManager) recordCheck(volumeName string, err error) {
+	man.Lock()
+	defer man.Unlock()
+	if man.monitors[volumeName] == nil {
+		return
+	}
+	status := man.monitorStatus[volumeName]
+	if status == nil {
+		status = &types.MonitorStatus{}
+		man.monitorStatus[volumeName] = status
+	}
+	status.Interval = MonitoringPeriod
+	status.LastCheckTime = time.Now().UTC()
+	if err != nil {
+		status.LastCheckError = err.Error()
+		status.ConsecutiveErrors++
+		return
+	}
+	status.LastCheckError = ""
+	status.ConsecutiveErrors = 0
+}
+
+// MonitorStatus returns the status of the checks of the volume's controller,
+// nil if the volume isn't monitored by the current host
+func (man *volumeManager) MonitorStatus(volumeName string) (*types.MonitorStatus, error) {
+	man.Lock()
+	defer man.Unlock()
+	if man.monitors[volumeName] == nil {
+		return nil, nil
+	}
+	status := &types.MonitorStatus{Interval: MonitoringPeriod}
+	if s := man.monitorStatus[volumeName]; s != nil {
+		*status = *s
+	}
+	return status, nil
+}
@@ -0,0 +1,122 @@
+package manager
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+
+	"github.com/rancher/longhorn-manager/types"
+	"github.com/rancher/longhorn-manager/util"
+)
+
+// beginOperation starts logging the steps of a multi-step operation on the
+// volume, if the orchestrator supports it, so it can be recovered if the
+// manager stops in the middle of it
+func (man *volumeManager) beginOperation(volumeName, opType string) *types.Operation {
+	op := &types.Operation{
+		VolumeName: volumeName,
+		Type:       opType,
+		HostID:     man.orc.GetCurrentHostID(),
+		Started:    util.Now(),
+		Steps:      []string{},
+	}
+	man.saveOperation(op)
+	return op
+}
+
+// checkpoint records the operation completed the step
+func (man *volumeManager) checkpoint(op *types.Operation, step string) {
+	op.Steps = append(op.Steps, step)
+	man.saveOperation(op)
+}
+
+func (man *volumeManager) saveOperation(op *types.Operation) {
+	if log, ok := man.orc.(types.OperationLog); ok {
+		if err := log.SetOperation(op); err != nil {
+			logrus.Warnf("%+v", errors.Wrapf(err, "failed to log %v of volume '%s'", op.Type, op.VolumeName))
+		}
+	}
+}
+
+func (man *volumeManager) endOperation(op *types.Operation) {
+	if log, ok := man.orc.(types.OperationLog); ok {
+		if err := log.DeleteOperation(op.VolumeName); err != nil {
+			logrus.Warnf("%+v", errors.Wrapf(err, "failed to remove the log of %v of volume '%s'", op.Type, op.VolumeName))
+		}
+	}
+}
+
+// rollback undoes the steps of a failed or interrupted operation. The log of
+// the operation is kept if it fails, to try again on the next recovery.
+func (man *volumeManager) rollback(op *types.Operation) error {
+	var err error
+	switch op.Type {
+	case types.OperationCreateFromBackup:
+		// the volume may be another one of the same name if creating it failed
+		if op.HasStep(types.OperationStepCreatedVolume) {
+			err = man.Delete(op.VolumeName)
+		}
+	default:
+		err = errors.Errorf("unknown operation")
+	}
+	if err != nil {
+		err = errors.Wrapf(err, "failed to roll back %v of volume '%s' after %v", op.Type, op.VolumeName, op.Steps)
+		logrus.Errorf("%+v", err)
+		return err
+	}
+	logrus.Infof("rolled back %v of volume '%s' after %v", op.Type, op.VolumeName, op.Steps)
+	man.endOperation(op)
+	return nil
+}
+
+// Recover completes or rolls back the operation on the volume interrupted by
+// a manager restart, if any
+func (man *volumeManager) Recover(volumeName string) error {
+	log, ok := man.orc.(types.OperationLog)
+	if !ok {
+		return nil
+	}
+	op, err := log.GetOperation(volumeName)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get the operation on volume '%s'", volumeName)
+	}
+	if op == nil {
+		return nil
+	}
+	if op.Type == types.OperationCreateFromBackup && op.LastStep() == types.OperationStepRestoredBackup {
+		volume, err := man.orc.GetVolume(volumeName)
+		if err != nil {
+			return errors.Wrapf(err, "unable to get volume '%s'", volumeName)
+		}
+		if volume != nil {
+			if err := man.finishRestore(volume); err != nil {
+				return errors.Wrapf(err, "failed to complete %v of volume '%s'", op.Type, volumeName)
+			}
+		}
+		logrus.Infof("completed interrupted %v of volume '%s'", op.Type, volumeName)
+		man.endOperation(op)
+		return nil
+	}
+	return man.rollback(op)
+}
+
+// recoverOperations recovers the operations this host was running when the
+// manager stopped
+func (man *volumeManager) recoverOperations() error {
+	log, ok := man.orc.(types.OperationLog)
+	if !ok {
+		return nil
+	}
+	ops, err := log.ListOperations()
+	if err != nil {
+		return errors.Wrap(err, "unable to list operations to recover")
+	}
+	for _, op := range ops {
+		if op.HostID != man.orc.GetCurrentHostID() {
+			continue
+		}
+		if err := man.Recover(op.VolumeName); err != nil {
+			logrus.Errorf("%+v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package manager
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+type fakeOperationOrc struct {
+	*fakeOrc
+
+	sync.Mutex
+	ops   map[string]*types.Operation
+	steps []string
+}
+
+func (orc *fakeOperationOrc) SetOperation(op *types.Operation) error {
+	orc.Lock()
+	defer orc.Unlock()
+	o := *op
+	o.Steps = append([]string{}, op.Steps...)
+	orc.ops[op.VolumeName] = &o
+	if step := op.LastStep(); step != "" {
+		orc.steps = append(orc.steps, step)
+	}
+	return nil
+}
+
+func (orc *fakeOperationOrc) GetOperation(volumeName string) (*types.Operation, error) {
+	orc.Lock()
+	defer orc.Unlock()
+	return orc.ops[volumeName], nil
+}
+
+func (orc *fakeOperationOrc) DeleteOperation(volumeName string) error {
+	orc.Lock()
+	defer orc.Unlock()
+	delete(orc.ops, volumeName)
+	return nil
+}
+
+func (orc *fakeOperationOrc) ListOperations() ([]*types.Operation, error) {
+	orc.Lock()
+	defer orc.Unlock()
+	ops := []*types.Operation{}
+	for _, op := range orc.ops {
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+func TestCreateFromBackupOperation(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	orc := &fakeOperationOrc{fakeOrc: env.orc, ops: map[string]*types.Operation{}}
+	env.man = env.newManager(orc)
+	backup := &types.BackupInfo{
+		URL:        "vfs:///var/lib/longhorn/backups/default?backup=backup-1&volume=vol1",
+		VolumeName: "vol1",
+		VolumeSize: "1048576",
+	}
+
+	_, err := env.man.createFromBackup(&types.VolumeInfo{Name: "vol1", NumberOfReplicas: 2}, backup)
+	assert.Nil(err)
+	assert.Equal([]string{
+		types.OperationStepCreatedVolume,
+		types.OperationStepCreatedReplicas,
+		types.OperationStepAttachedController,
+		types.OperationStepRestoredBackup,
+	}, orc.steps)
+	assert.Len(orc.ops, 0)
+
+	// a failed restore is rolled back
+	env.controller("vol2").restoreErr = errors.New("restore failed")
+	_, err = env.man.createFromBackup(&types.VolumeInfo{Name: "vol2", NumberOfReplicas: 2}, backup)
+	assert.NotNil(err)
+	volume, err := env.man.Get("vol2")
+	assert.Nil(err)
+	assert.Nil(volume)
+	assert.Len(orc.ops, 0)
+
+	// the volume of a concurrent create of the same name is kept
+	env.createVolume(t, "vol3", 2)
+	_, err = env.man.createFromBackup(&types.VolumeInfo{Name: "vol3", NumberOfReplicas: 2}, backup)
+	assert.NotNil(err)
+	volume, err = env.man.Get("vol3")
+	assert.Nil(err)
+	assert.NotNil(volume)
+	assert.Len(orc.ops, 0)
+}
+
+func TestRecover(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	orc := &fakeOperationOrc{fakeOrc: env.orc, ops: map[string]*types.Operation{}}
+	env.man = env.newManager(orc)
+	assert.Nil(env.man.Recover("vol1"))
+
+	// interrupted before the backup was restored
+	env.createVolume(t, "vol1", 2)
+	assert.Nil(env.man.Attach("vol1", ""))
+	orc.ops["vol1"] = &types.Operation{
+		VolumeName: "vol1",
+		Type:       types.OperationCreateFromBackup,
+		HostID:     testHostID,
+		Steps:      []string{types.OperationStepCreatedVolume, types.OperationStepCreatedReplicas, types.OperationStepAttachedController},
+	}
+
+	// interrupted after the backup was restored
+	env.createVolume(t, "vol2", 2)
+	env.orc.volumes["vol2"].Restoring = true
+	assert.Nil(env.man.Attach("vol2", ""))
+	orc.ops["vol2"] = &types.Operation{
+		VolumeName: "vol2",
+		Type:       types.OperationCreateFromBackup,
+		HostID:     testHostID,
+		Steps:      []string{types.OperationStepCreatedVolume, types.OperationStepCreatedReplicas, types.OperationStepAttachedController, types.OperationStepRestoredBackup},
+	}
+
+	// run by another host
+	env.createVolume(t, "vol3", 1)
+	orc.ops["vol3"] = &types.Operation{VolumeName: "vol3", Type: types.OperationCreateFromBackup, HostID: "host-2"}
+
+	// interrupted before the volume was created, vol4 is another create's
+	env.createVolume(t, "vol4", 1)
+	orc.ops["vol4"] = &types.Operation{VolumeName: "vol4", Type: types.OperationCreateFromBackup, HostID: testHostID}
+
+	assert.Nil(env.man.recoverOperations())
+
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Nil(volume)
+
+	volume, err = env.man.Get("vol2")
+	assert.Nil(err)
+	assert.False(volume.Restoring)
+	assert.Equal(types.VolumeStateDetached, volume.State)
+
+	volume, err = env.man.Get("vol3")
+	assert.Nil(err)
+	assert.NotNil(volume)
+	volume, err = env.man.Get("vol4")
+	assert.Nil(err)
+	assert.NotNil(volume)
+	assert.Len(orc.ops, 1)
+	assert.NotNil(orc.ops["vol3"])
+	assert.Empty(env.orc.locks)
+}
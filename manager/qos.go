@@ -0,0 +1,55 @@
+package manager
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+func validateQoS(qos types.VolumeQoS) error {
+	if qos.ReadIOPSMax < 0 || qos.WriteIOPSMax < 0 || qos.ReadBandwidthMax < 0 || qos.WriteBandwidthMax < 0 {
+		return errors.Errorf("invalid negative QoS limits %+v", qos)
+	}
+	return nil
+}
+
+// UpdateQoS sets the I/O limits of the volume. The controller only takes
+// them at launch, so the controller of an attached volume is restarted.
+func (man *volumeManager) UpdateQoS(name string, qos types.VolumeQoS) error {
+	if err := validateQoS(qos); err != nil {
+		return err
+	}
+	token, err := man.orc.LockVolume(name)
+	if err != nil {
+		return errors.Wrapf(err, "unable to lock volume '%s'", name)
+	}
+	defer man.unlockVolume(name, token)
+
+	volume, err := man.Get(name)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get volume '%s'", name)
+	}
+	if volume == nil {
+		return errors.Errorf("cannot find volume '%s'", name)
+	}
+	if volume.VolumeQoS == qos {
+		return nil
+	}
+	volume.VolumeQoS = qos
+	if err := man.orc.UpdateVolume(volume); err != nil {
+		return errors.Wrapf(err, "unable to update volume '%s'", name)
+	}
+	if volume.State != types.VolumeStateHealthy && volume.State != types.VolumeStateDegraded {
+		return nil
+	}
+
+	logrus.Infof("restarting the controller of volume '%s' with QoS limits %+v", name, qos)
+	if err := man.detach(volume); err != nil {
+		return errors.Wrapf(err, "fail to detach volume '%s' to update its QoS", name)
+	}
+	if err := man.attach(volume); err != nil {
+		return errors.Wrapf(err, "fail to attach volume '%s' with the updated QoS, the volume is left detached", name)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+var (
+	// FaultedRecoveryAttempts is how many times the manager tries to recover
+	// a faulted volume before leaving it faulted
+	FaultedRecoveryAttempts = 3
+	FaultedRecoveryInterval = 30 * time.Second
+)
+
+// recoverFaulted reattaches a faulted volume with the replica marked bad the
+// last, which has the most recent data, when the FaultedVolumeAutoRecovery
+// setting is on
+func (man *volumeManager) recoverFaulted(name string) error {
+	var err error
+	for attempt := 1; attempt <= FaultedRecoveryAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(FaultedRecoveryInterval)
+		}
+		var volume *types.VolumeInfo
+		if volume, err = man.tryRecoverFaulted(name); err == nil {
+			if volume != nil {
+				logrus.Infof("recovered faulted volume '%s'", name)
+				man.recordEvent(volume, types.EventTypeNormal, "VolumeRecovered", "recovered faulted volume after %v attempt(s)", attempt)
+			}
+			return nil
+		}
+		logrus.Warnf("%v", errors.Wrapf(err, "attempt %v/%v to recover faulted volume '%s' failed", attempt, FaultedRecoveryAttempts, name))
+	}
+	if volume, _ := man.Get(name); volume != nil {
+		man.recordEvent(volume, types.EventTypeWarning, "VolumeRecoveryFailed", "failed to recover faulted volume after %v attempts: %v", FaultedRecoveryAttempts, err)
+	}
+	return errors.Wrapf(err, "giving up recovering faulted volume '%s'", name)
+}
+
+// tryRecoverFaulted returns the recovered volume, or nil if the volume no
+// longer needs recovery
+func (man *volumeManager) tryRecoverFaulted(name string) (*types.VolumeInfo, error) {
+	token, err := man.orc.LockVolume(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to lock volume '%s' to recover", name)
+	}
+	defer man.unlockVolume(name, token)
+
+	volume, err := man.orc.GetVolume(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get volume '%s'", name)
+	}
+	if volume == nil || volumeState(volume) != types.VolumeStateFaulted {
+		return nil, nil
+	}
+	replica := mostRecentBadReplica(volume)
+	if replica == nil {
+		return nil, errors.Errorf("no replicas to recover volume '%s'", name)
+	}
+	if volume.Controller != nil {
+		if err := man.detach(volume); err != nil {
+			return nil, errors.Wrapf(err, "failed to detach faulted volume '%s'", name)
+		}
+	}
+
+	good := *replica
+	good.BadTimestamp = ""
+	if err := man.orc.UpdateReplica(&good); err != nil {
+		return nil, errors.Wrapf(err, "failed to clear bad replica '%s', volume '%s'", replica.Name, name)
+	}
+	// attach restarts the replica along with the controller
+	if volume, err = man.orc.GetVolume(name); err == nil && volume != nil {
+		err = man.attach(volume)
+	}
+	if err != nil {
+		if err := man.orc.MarkBadReplica(name, replica); err != nil {
+			logrus.Errorf("%+v", errors.Wrapf(err, "failed to mark replica '%s' bad again, volume '%s'", replica.Name, name))
+		}
+		return nil, errors.Wrapf(err, "failed to reattach volume '%s' with replica '%s'", name, replica.Name)
+	}
+	return volume, nil
+}
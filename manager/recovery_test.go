@@ -0,0 +1,60 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/longhorn-manager/types"
+	"github.com/rancher/longhorn-manager/util"
+)
+
+func TestRecoverFaulted(t *testing.T) {
+	assert := require.New(t)
+
+	defer func(interval time.Duration) { FaultedRecoveryInterval = interval }(FaultedRecoveryInterval)
+	FaultedRecoveryInterval = 0
+
+	env := newTestEnv()
+	orc := &fakeEventOrc{fakeOrc: env.orc}
+	env.man = env.newManager(orc)
+	env.createVolume(t, "vol1", 2)
+
+	now := time.Now()
+	var recent string
+	for name, replica := range env.orc.volumes["vol1"].Replicas {
+		badTime := now.Add(-time.Hour)
+		if recent == "" {
+			badTime = now.Add(-time.Minute)
+			recent = name
+		}
+		replica.BadTimestamp = util.FormatTimeZ(badTime)
+	}
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Equal(types.VolumeStateFaulted, volume.State)
+
+	assert.Nil(env.man.recoverFaulted("vol1"))
+	volume, err = env.man.Get("vol1")
+	assert.Nil(err)
+	assert.Equal(types.VolumeStateDegraded, volume.State)
+	assert.NotNil(volume.Controller)
+	assert.Equal("", volume.Replicas[recent].BadTimestamp)
+	assert.True(volume.Replicas[recent].Running)
+	assert.Equal([]string{"VolumeRecovered"}, orc.reasons)
+
+	// nothing to do for a volume that isn't faulted
+	orc.reasons = nil
+	assert.Nil(env.man.recoverFaulted("vol1"))
+	assert.Len(orc.reasons, 0)
+
+	// a faulted volume without replicas cannot be recovered
+	env.createVolume(t, "vol2", 1)
+	for name := range env.orc.volumes["vol2"].Replicas {
+		delete(env.orc.volumes["vol2"].Replicas, name)
+	}
+	assert.NotNil(env.man.recoverFaulted("vol2"))
+	assert.Equal([]string{"VolumeRecoveryFailed"}, orc.reasons)
+	assert.Empty(env.orc.locks)
+}
@@ -0,0 +1,35 @@
+//go:build integration
+// +build integration
+
+package manager
+
+import (
+	"github.com/pkg/errors"
+)
+
+// SimulateReplicaFailure marks the replica bad without going through the
+// engine, so integration tests can check CheckController recovers the volume
+// without killing the replica container
+func (man *volumeManager) SimulateReplicaFailure(volumeName, replicaName string) error {
+	token, err := man.orc.LockVolume(volumeName)
+	if err != nil {
+		return errors.Wrapf(err, "unable to lock volume '%s'", volumeName)
+	}
+	defer man.unlockVolume(volumeName, token)
+
+	volume, err := man.orc.GetVolume(volumeName)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get volume '%s'", volumeName)
+	}
+	if volume == nil {
+		return errors.Errorf("cannot find volume '%s'", volumeName)
+	}
+	replica := volume.Replicas[replicaName]
+	if replica == nil {
+		return errors.Errorf("cannot find replica '%s' of volume '%s'", replicaName, volumeName)
+	}
+	if err := man.orc.MarkBadReplica(volumeName, replica); err != nil {
+		return errors.Wrapf(err, "unable to mark replica '%s' bad, volume '%s'", replicaName, volumeName)
+	}
+	return nil
+}
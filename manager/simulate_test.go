@@ -0,0 +1,30 @@
+//go:build integration
+// +build integration
+
+package manager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulateReplicaFailure(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	volume := env.createVolume(t, "vol1", 2)
+	var replicaName string
+	for name := range volume.Replicas {
+		replicaName = name
+		break
+	}
+
+	assert.NotNil(env.man.SimulateReplicaFailure("nonexistent", replicaName))
+	assert.NotNil(env.man.SimulateReplicaFailure("vol1", "nonexistent"))
+
+	assert.Nil(env.man.SimulateReplicaFailure("vol1", replicaName))
+	volume, err := env.man.Get("vol1")
+	assert.Nil(err)
+	assert.NotEqual("", volume.Replicas[replicaName].BadTimestamp)
+}
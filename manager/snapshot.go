@@ -0,0 +1,292 @@
+package manager
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+
+	"github.com/rancher/longhorn-manager/controller"
+	"github.com/rancher/longhorn-manager/types"
+	"github.com/rancher/longhorn-manager/util"
+)
+
+// PurgeSnapshots removes the snapshots of the volume which are older than
+// retention, not backed up and not the volume head, then purges the removed snapshots. Zero
+// retention only purges the snapshots already removed.
+func (man *volumeManager) PurgeSnapshots(volumeName string, retention time.Duration) (*types.PurgeResult, error) {
+	snapOps, err := man.SnapshotOps(volumeName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting SnapshotOps for volume '%s'", volumeName)
+	}
+	before, err := snapOps.List()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing snapshots, volume '%s'", volumeName)
+	}
+
+	if retention > 0 {
+		backedUp, err := man.backedUpSnapshots(volumeName)
+		if err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(-retention)
+		for _, s := range before {
+			if s.Removed || backedUp[s.Name] || strings.HasPrefix(s.Name, controller.VolumeHeadName) {
+				continue
+			}
+			created, err := util.ParseTime(s.Created)
+			if err != nil {
+				logrus.Warnf("unable to parse creation time '%s' of snapshot '%s'", s.Created, s.Name)
+				continue
+			}
+			if created.After(deadline) {
+				continue
+			}
+			logrus.Infof("snapshot purge: removing snapshot '%s' created %v, volume '%s'", s.Name, s.Created, volumeName)
+			if err := snapOps.Delete(s.Name); err != nil {
+				return nil, errors.Wrapf(err, "error deleting snapshot '%s', volume '%s'", s.Name, volumeName)
+			}
+		}
+	}
+
+	if err := snapOps.Purge(); err != nil {
+		return nil, errors.Wrapf(err, "error purging snapshots, volume '%s'", volumeName)
+	}
+
+	after, err := snapOps.List()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing snapshots, volume '%s'", volumeName)
+	}
+	remaining := map[string]struct{}{}
+	for _, s := range after {
+		remaining[s.Name] = struct{}{}
+	}
+	result := &types.PurgeResult{}
+	for _, s := range before {
+		if _, ok := remaining[s.Name]; ok {
+			continue
+		}
+		result.Removed++
+		if size, err := strconv.ParseInt(s.Size, 10, 64); err == nil {
+			result.SpaceFreed += size
+		}
+	}
+	return result, nil
+}
+
+// EnforceMaxSnapshots removes the oldest snapshots of the volume beyond its
+// MaxSnapshots, skipping the backed up ones
+func (man *volumeManager) EnforceMaxSnapshots(volumeName string) error {
+	volume, err := man.Get(volumeName)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get volume '%s'", volumeName)
+	}
+	if volume == nil {
+		return errors.Errorf("cannot find volume '%s'", volumeName)
+	}
+	if volume.MaxSnapshots == 0 {
+		return nil
+	}
+	snapOps, err := man.SnapshotOps(volumeName)
+	if err != nil {
+		return errors.Wrapf(err, "error getting SnapshotOps for volume '%s'", volumeName)
+	}
+	all, err := snapOps.List()
+	if err != nil {
+		return errors.Wrapf(err, "error listing snapshots, volume '%s'", volumeName)
+	}
+	snapshots := []*types.SnapshotInfo{}
+	for _, s := range all {
+		if !s.Removed && !strings.HasPrefix(s.Name, controller.VolumeHeadName) {
+			snapshots = append(snapshots, s)
+		}
+	}
+	if len(snapshots) <= volume.MaxSnapshots {
+		return nil
+	}
+	backedUp, err := man.backedUpSnapshots(volumeName)
+	if err != nil {
+		return err
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Created < snapshots[j].Created })
+	count := len(snapshots)
+	for _, s := range snapshots {
+		if count <= volume.MaxSnapshots {
+			break
+		}
+		if backedUp[s.Name] {
+			continue
+		}
+		logrus.Infof("max snapshots: removing snapshot '%s' created %v, volume '%s'", s.Name, s.Created, volumeName)
+		if err := snapOps.Delete(s.Name); err != nil {
+			return errors.Wrapf(err, "error deleting snapshot '%s', volume '%s'", s.Name, volumeName)
+		}
+		count--
+	}
+	if count > volume.MaxSnapshots {
+		logrus.Warnf("volume '%s' keeps %v snapshots over its max %v, the rest are backed up", volumeName, count, volume.MaxSnapshots)
+	}
+	if err := snapOps.Purge(); err != nil {
+		return errors.Wrapf(err, "error purging snapshots, volume '%s'", volumeName)
+	}
+	return nil
+}
+
+// backedUpSnapshots returns the names of the snapshots of the volume with a
+// backup on the backup target
+func (man *volumeManager) backedUpSnapshots(volumeName string) (map[string]bool, error) {
+	backedUp := map[string]bool{}
+	settings, err := man.settings.GetSettings()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get settings to find backed up snapshots")
+	}
+	if settings == nil || settings.BackupTarget == "" {
+		return backedUp, nil
+	}
+	backups, err := man.getBackups(settings.BackupTarget).List(volumeName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing backups, volume '%s'", volumeName)
+	}
+	for _, b := range backups {
+		backedUp[b.SnapshotName] = true
+		backedUp[snapshotNameFromFile(b.SnapshotName)] = true
+	}
+	return backedUp, nil
+}
+
+// snapshotNameFromFile returns the snapshot name from the name of the
+// snapshot file, e.g. "volume-snap-snap1.img" for snapshot "snap1"
+func snapshotNameFromFile(file string) string {
+	const prefix, suffix = "volume-snap-", ".img"
+	if len(file) > len(prefix)+len(suffix) && file[:len(prefix)] == prefix && file[len(file)-len(suffix):] == suffix {
+		return file[len(prefix) : len(file)-len(suffix)]
+	}
+	return file
+}
+
+// CreateGroupSnapshot takes snapshots with the same name of all the volumes
+// while I/O of all of them is frozen, so the snapshots are consistent with
+// each other. The volumes should be attached.
+func (man *volumeManager) CreateGroupSnapshot(volumeNames []string, name string, labels map[string]string) (string, error) {
+	if len(volumeNames) == 0 {
+		return "", errors.New("no volumes to snapshot")
+	}
+	ctrls := []types.Controller{}
+	seen := map[string]bool{}
+	for _, volumeName := range volumeNames {
+		if seen[volumeName] {
+			return "", errors.Errorf("volume '%s' is listed more than once", volumeName)
+		}
+		seen[volumeName] = true
+		volume, err := man.Get(volumeName)
+		if err != nil {
+			return "", errors.Wrapf(err, "unable to get volume '%s'", volumeName)
+		}
+		if volume == nil {
+			return "", errors.Errorf("cannot find volume '%s'", volumeName)
+		}
+		ctrl := man.getController(volume)
+		if ctrl == nil {
+			return "", errors.Errorf("volume '%s' is not attached", volumeName)
+		}
+		ctrls = append(ctrls, ctrl)
+	}
+	if name == "" {
+		name = snapName("group")
+	}
+
+	frozen, err := forEachController(ctrls, func(ctrl types.Controller) error {
+		return ctrl.Freeze()
+	})
+	defer func() {
+		if _, err := forEachController(frozen, func(ctrl types.Controller) error {
+			return ctrl.Unfreeze()
+		}); err != nil {
+			logrus.Errorf("%+v", errors.Wrapf(err, "failed to unfreeze volumes after group snapshot '%s'", name))
+		}
+	}()
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to freeze volumes for group snapshot '%s'", name)
+	}
+
+	if _, err := forEachController(ctrls, func(ctrl types.Controller) error {
+		_, err := ctrl.SnapshotOps().Create(name, labels)
+		return err
+	}); err != nil {
+		return "", errors.Wrapf(err, "failed to create group snapshot '%s'", name)
+	}
+	return name, nil
+}
+
+// Quiesce freezes I/O of the attached volume, so a snapshot taken before
+// Unquiesce is consistent for the application
+func (man *volumeManager) Quiesce(volumeName string) error {
+	ctrl, err := man.attachedController(volumeName)
+	if err != nil {
+		return err
+	}
+	if err := ctrl.Freeze(); err != nil {
+		return errors.Wrapf(err, "failed to quiesce volume '%s'", volumeName)
+	}
+	return nil
+}
+
+// Unquiesce resumes I/O of the volume frozen by Quiesce
+func (man *volumeManager) Unquiesce(volumeName string) error {
+	ctrl, err := man.attachedController(volumeName)
+	if err != nil {
+		return err
+	}
+	if err := ctrl.Unfreeze(); err != nil {
+		return errors.Wrapf(err, "failed to unquiesce volume '%s'", volumeName)
+	}
+	return nil
+}
+
+func (man *volumeManager) attachedController(volumeName string) (types.Controller, error) {
+	volume, err := man.Get(volumeName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get volume '%s'", volumeName)
+	}
+	if volume == nil {
+		return nil, errors.Errorf("cannot find volume '%s'", volumeName)
+	}
+	ctrl := man.getController(volume)
+	if ctrl == nil {
+		return nil, errors.Errorf("volume '%s' is not attached", volumeName)
+	}
+	return ctrl, nil
+}
+
+// forEachController calls fn for all controllers at once, and returns the
+// controllers it succeeded for
+func forEachController(ctrls []types.Controller, fn func(ctrl types.Controller) error) ([]types.Controller, error) {
+	errs := make([]error, len(ctrls))
+	wg := &sync.WaitGroup{}
+	for i, ctrl := range ctrls {
+		wg.Add(1)
+		go func(i int, ctrl types.Controller) {
+			defer wg.Done()
+			errs[i] = fn(ctrl)
+		}(i, ctrl)
+	}
+	wg.Wait()
+
+	succeeded := []types.Controller{}
+	failed := Errs{}
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, errors.Wrapf(err, "controller '%s'", ctrls[i].Name()))
+			continue
+		}
+		succeeded = append(succeeded, ctrls[i])
+	}
+	if len(failed) > 0 {
+		return succeeded, failed
+	}
+	return succeeded, nil
+}
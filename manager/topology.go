@@ -0,0 +1,74 @@
+package manager
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+func (man *volumeManager) GetStorageTopology() (*types.StorageTopology, error) {
+	hosts, err := man.orc.ListHosts()
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to list hosts for storage topology")
+	}
+	volumes, err := man.List()
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to list volumes for storage topology")
+	}
+
+	topology := &types.StorageTopology{
+		Hosts:   []types.HostNode{},
+		Volumes: []types.VolumeNode{},
+		Edges:   []types.TopologyEdge{},
+	}
+	for _, host := range hosts {
+		topology.Hosts = append(topology.Hosts, types.HostNode{
+			UUID:    host.UUID,
+			Name:    host.Name,
+			Address: host.Address,
+		})
+	}
+	sort.Slice(topology.Hosts, func(i, j int) bool {
+		return topology.Hosts[i].UUID < topology.Hosts[j].UUID
+	})
+
+	sort.Slice(volumes, func(i, j int) bool {
+		return volumes[i].Name < volumes[j].Name
+	})
+	for _, volume := range volumes {
+		node := types.VolumeNode{
+			Name:     volume.Name,
+			State:    volume.State,
+			Replicas: []types.ReplicaNode{},
+		}
+		for _, replica := range volume.Replicas {
+			node.Replicas = append(node.Replicas, types.ReplicaNode{
+				Name:    replica.Name,
+				HostID:  replica.HostID,
+				Running: replica.Running,
+				Bad:     replica.BadTimestamp != "",
+			})
+		}
+		sort.Slice(node.Replicas, func(i, j int) bool {
+			return node.Replicas[i].Name < node.Replicas[j].Name
+		})
+		for _, replica := range node.Replicas {
+			topology.Edges = append(topology.Edges, types.TopologyEdge{
+				Type: types.TopologyEdgeTypeHasReplica,
+				From: volume.Name,
+				To:   replica.Name,
+			})
+			if replica.HostID != "" {
+				topology.Edges = append(topology.Edges, types.TopologyEdge{
+					Type: types.TopologyEdgeTypeHostedOn,
+					From: replica.Name,
+					To:   replica.HostID,
+				})
+			}
+		}
+		topology.Volumes = append(topology.Volumes, node)
+	}
+	return topology, nil
+}
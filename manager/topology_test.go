@@ -0,0 +1,46 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+func TestGetStorageTopology(t *testing.T) {
+	assert := require.New(t)
+
+	env := newTestEnv()
+	vol1 := env.createVolume(t, "vol1", 2)
+	vol2 := env.createVolume(t, "vol2", 1)
+	for _, replica := range env.orc.volumes["vol2"].Replicas {
+		replica.HostID = "host-2"
+	}
+
+	topology, err := env.man.GetStorageTopology()
+	assert.Nil(err)
+	assert.Len(topology.Hosts, 3)
+	assert.Equal("host-1", topology.Hosts[0].UUID)
+	assert.Len(topology.Volumes, 2)
+	assert.Equal("vol1", topology.Volumes[0].Name)
+	assert.Len(topology.Volumes[0].Replicas, 2)
+	assert.Equal("vol2", topology.Volumes[1].Name)
+	assert.Len(topology.Volumes[1].Replicas, 1)
+
+	edges := map[types.TopologyEdge]struct{}{}
+	for _, edge := range topology.Edges {
+		edges[edge] = struct{}{}
+	}
+	assert.Len(edges, 6)
+	assert.Len(topology.Edges, 6)
+
+	for volumeName, hostID := range map[string]string{vol1.Name: "host-1", vol2.Name: "host-2"} {
+		volume, err := env.man.Get(volumeName)
+		assert.Nil(err)
+		for _, replica := range volume.Replicas {
+			assert.Contains(edges, types.TopologyEdge{Type: types.TopologyEdgeTypeHasReplica, From: volumeName, To: replica.Name})
+			assert.Contains(edges, types.TopologyEdge{Type: types.TopologyEdgeTypeHostedOn, From: replica.Name, To: hostID})
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package manager
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+// WaitForHealthyPollInterval is how often WaitForHealthy gets the volume
+// between the notifications of Watch, which only come from the host
+// monitoring the volume
+var WaitForHealthyPollInterval = 5 * time.Second
+
+// volumeBus notifies the watchers of a volume it might have changed
+type volumeBus struct {
+	sync.Mutex
+	watchers map[string]map[chan struct{}]struct{} // volume -> watcher channels
+}
+
+func newVolumeBus() *volumeBus {
+	return &volumeBus{watchers: map[string]map[chan struct{}]struct{}{}}
+}
+
+func (b *volumeBus) subscribe(volumeName string) (<-chan struct{}, func()) {
+	b.Lock()
+	defer b.Unlock()
+	ch := make(chan struct{}, 1)
+	if b.watchers[volumeName] == nil {
+		b.watchers[volumeName] = map[chan struct{}]struct{}{}
+	}
+	b.watchers[volumeName][ch] = struct{}{}
+	return ch, func() {
+		b.Lock()
+		defer b.Unlock()
+		delete(b.watchers[volumeName], ch)
+		if len(b.watchers[volumeName]) == 0 {
+			delete(b.watchers, volumeName)
+		}
+	}
+}
+
+// publish doesn't block: a watcher yet to receive the previous notification
+// doesn't need another one
+func (b *volumeBus) publish(volumeName string) {
+	b.Lock()
+	defer b.Unlock()
+	for ch := range b.watchers[volumeName] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Watch notifies of possible changes of the volume: when its monitoring
+// starts or stops and after every check of its controller. Call the
+// returned func to stop watching.
+func (man *volumeManager) Watch(volumeName string) (<-chan struct{}, func()) {
+	return man.bus.subscribe(volumeName)
+}
+
+// WaitForHealthy blocks until the volume is healthy, or returns the error of
+// the context if it's done first
+func (man *volumeManager) WaitForHealthy(ctx context.Context, volumeName string) error {
+	changes, stop := man.Watch(volumeName)
+	defer stop()
+	ticker := time.NewTicker(WaitForHealthyPollInterval)
+	defer ticker.Stop()
+	for {
+		volume, err := man.Get(volumeName)
+		if err != nil {
+			return errors.Wrapf(err, "unable to get volume '%s'", volumeName)
+		}
+		if volume == nil {
+			return errors.Errorf("cannot find volume '%s'", volumeName)
+		}
+		if volume.State == types.VolumeStateHealthy {
+			return nil
+		}
+		select {
+		case <-changes:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "volume '%s' isn't healthy, state %v", volumeName, volume.State)
+		}
+	}
+}
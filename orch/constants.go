@@ -2,4 +2,16 @@ package orch
 
 const (
 	EngineImageParam = "engine-image"
+	NodeTagsParam    = "node-tags"
+
+	MaxVolumesPerNodeParam = "max-volumes-per-node"
+	BasePortParam          = "base-port"
+	ManagerPortParam       = "manager-port"
+	PeerAddressParam       = "peer-address"
+
+	EngineReplicaTimeoutParam = "engine-replica-timeout"
+
+	// DefaultEngineReplicaTimeout is the replica timeout of the engine in
+	// seconds, unless set with EngineReplicaTimeoutParam
+	DefaultEngineReplicaTimeout = 8
 )
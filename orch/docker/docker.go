@@ -1,10 +1,16 @@
 package docker
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
@@ -12,6 +18,7 @@ import (
 	"golang.org/x/net/context"
 
 	dTypes "github.com/docker/docker/api/types"
+	dFilters "github.com/docker/docker/api/types/filters"
 	dCli "github.com/docker/docker/client"
 
 	"github.com/rancher/longhorn-manager/api"
@@ -31,8 +38,13 @@ type dockerOrc struct {
 	EngineImage string
 	Network     string
 	IP          string
+	basePort    int
+	managerPort int // of the API, basePort unless set
+
+	engineReplicaTimeout int // seconds
 
 	currentHost *types.HostInfo
+	nodeTags    map[string]string
 
 	kv  *kvstore.KVStore
 	cli *dCli.Client
@@ -43,41 +55,149 @@ type dockerOrc struct {
 type dockerOrcConfig struct {
 	servers []string
 	prefix  string
+	tls     *tls.Config
 	image   string
 	network string
+	tags    map[string]string
+
+	maxVolumesPerNode int
+	basePort          int
+	managerPort       int
+	peerAddress       string
+
+	engineReplicaTimeout int
+}
+
+func init() {
+	orch.Register(OrcName, New)
 }
 
 func New(c *cli.Context) (types.Orchestrator, error) {
-	servers := c.StringSlice("etcd-servers")
+	servers := etcdServers(c.StringSlice("etcd-servers"))
 	if len(servers) == 0 {
 		return nil, fmt.Errorf("Unspecified etcd servers")
 	}
 	prefix := c.String("etcd-prefix")
+	etcdTLS, err := etcdTLSConfig(c.String("etcd-tls-cert"), c.String("etcd-tls-key"), c.String("etcd-tls-ca"))
+	if err != nil {
+		return nil, err
+	}
 	image := c.String(orch.EngineImageParam)
 	network := c.String("docker-network")
+	tags, err := util.ParseTags(c.String(orch.NodeTagsParam))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid --%v", orch.NodeTagsParam)
+	}
+	maxVolumesPerNode := c.Int(orch.MaxVolumesPerNodeParam)
+	if maxVolumesPerNode < 0 {
+		return nil, errors.Errorf("invalid --%v %v", orch.MaxVolumesPerNodeParam, maxVolumesPerNode)
+	}
+	engineReplicaTimeout := c.Int(orch.EngineReplicaTimeoutParam)
+	if engineReplicaTimeout < 1 {
+		return nil, errors.Errorf("invalid --%v %v", orch.EngineReplicaTimeoutParam, engineReplicaTimeout)
+	}
+	peerAddress := c.String(orch.PeerAddressParam)
+	if peerAddress != "" {
+		if _, _, err := net.SplitHostPort(peerAddress); err != nil {
+			return nil, errors.Wrapf(err, "invalid --%v %v", orch.PeerAddressParam, peerAddress)
+		}
+	}
 	return newDocker(&dockerOrcConfig{
 		servers: servers,
 		prefix:  prefix,
+		tls:     etcdTLS,
 		image:   image,
 		network: network,
+		tags:    tags,
+
+		maxVolumesPerNode: maxVolumesPerNode,
+		basePort:          c.Int(orch.BasePortParam),
+		managerPort:       c.Int(orch.ManagerPortParam),
+		peerAddress:       peerAddress,
+
+		engineReplicaTimeout: engineReplicaTimeout,
 	})
 }
 
+// etcdServers accepts the etcd servers both as repeated and comma separated
+// --etcd-servers, the etcd client fails over between all of them
+func etcdServers(flags []string) []string {
+	servers := []string{}
+	for _, flag := range flags {
+		for _, server := range strings.Split(flag, ",") {
+			if server = strings.TrimSpace(server); server != "" {
+				servers = append(servers, server)
+			}
+		}
+	}
+	return servers
+}
+
+// etcdTLSConfig loads the client certificate for etcd servers requiring
+// client authentication and the CA of the servers, nil if neither is set
+func etcdTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("Must specify both --etcd-tls-cert and --etcd-tls-key")
+	}
+	if certFile == "" && caFile == "" {
+		return nil, nil
+	}
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error loading etcd TLS certificate '%s' and key '%s'", certFile, keyFile)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		ca, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading etcd TLS CA '%s'", caFile)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.Errorf("no valid certificates found in etcd TLS CA '%s'", caFile)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
 func newDocker(cfg *dockerOrcConfig) (types.Orchestrator, error) {
-	etcdBackend, err := kvstore.NewETCDBackend(cfg.servers)
+	etcdBackend, err := kvstore.NewETCDBackend(cfg.servers, cfg.tls)
 	if err != nil {
 		return nil, err
 	}
-	kvStore, err := kvstore.NewKVStore(cfg.prefix, etcdBackend)
+	logrus.Infof("Using etcd servers %v", cfg.servers)
+	kvStore, err := kvstore.NewKVStore(cfg.prefix, &retryBackend{etcdBackend})
 	if err != nil {
 		return nil, err
 	}
 
 	docker := &dockerOrc{
 		EngineImage: cfg.image,
+		basePort:    cfg.basePort,
+		managerPort: cfg.managerPort,
+		nodeTags:    cfg.tags,
 		kv:          kvStore,
+
+		engineReplicaTimeout: cfg.engineReplicaTimeout,
+	}
+	if docker.basePort == 0 {
+		docker.basePort = api.DefaultPort
+	}
+	if docker.managerPort == 0 {
+		docker.managerPort = docker.basePort
 	}
-	docker.scheduler = scheduler.NewOrcScheduler(docker)
+	if docker.engineReplicaTimeout == 0 {
+		docker.engineReplicaTimeout = orch.DefaultEngineReplicaTimeout
+	}
+	orcScheduler := scheduler.NewOrcScheduler(docker)
+	orcScheduler.MaxReplicas = cfg.maxVolumesPerNode
+	docker.scheduler = orcScheduler
 
 	//Set Docker API to compatible with 1.12
 	os.Setenv("DOCKER_API_VERSION", "1.24")
@@ -96,7 +216,7 @@ func newDocker(cfg *dockerOrcConfig) (types.Orchestrator, error) {
 
 	logrus.Infof("Detected network is %s, IP is %s", docker.Network, docker.IP)
 
-	address := docker.IP + ":" + strconv.Itoa(api.DefaultPort)
+	address := docker.peerAddress(cfg.peerAddress)
 	logrus.Info("Local address is: ", address)
 
 	if err := docker.Register(address); err != nil {
@@ -106,6 +226,15 @@ func newDocker(cfg *dockerOrcConfig) (types.Orchestrator, error) {
 	return docker, nil
 }
 
+// peerAddress is the API address the other managers reach this one at,
+// the container IP unless advertised explicitly
+func (d *dockerOrc) peerAddress(advertised string) string {
+	if advertised != "" {
+		return advertised
+	}
+	return d.IP + ":" + strconv.Itoa(d.managerPort)
+}
+
 func getCurrentHost(address string) (*types.HostInfo, error) {
 	var err error
 
@@ -172,6 +301,7 @@ func (d *dockerOrc) Register(address string) error {
 	if err != nil {
 		return err
 	}
+	currentHost.Tags = d.nodeTags
 
 	if err := d.kv.SetHost(currentHost); err != nil {
 		return err
@@ -181,11 +311,91 @@ func (d *dockerOrc) Register(address string) error {
 }
 
 func (d *dockerOrc) GetHost(id string) (*types.HostInfo, error) {
-	return d.kv.GetHost(id)
+	host, err := d.kv.GetHost(id)
+	if err != nil || host == nil || id != d.currentHost.UUID {
+		return host, err
+	}
+	d.updateHostStorage(host)
+	return host, nil
 }
 
 func (d *dockerOrc) ListHosts() (map[string]*types.HostInfo, error) {
-	return d.kv.ListHosts()
+	hosts, err := d.kv.ListHosts()
+	if err != nil {
+		return nil, err
+	}
+	if host := hosts[d.currentHost.UUID]; host != nil {
+		d.updateHostStorage(host)
+	}
+	return hosts, nil
+}
+
+// updateHostStorage fills in the storage figures of the current host and
+// saves them for the other hosts, which see the last reported ones
+func (d *dockerOrc) updateHostStorage(host *types.HostInfo) {
+	total, used, replicas, err := d.hostStorage()
+	if err != nil {
+		logrus.Warnf("fail to get storage of host %v: %v", host.UUID, err)
+		return
+	}
+	if host.TotalStorage == total && host.UsedStorage == used && host.ReplicaCount == replicas {
+		return
+	}
+	host.TotalStorage, host.UsedStorage, host.ReplicaCount = total, used, replicas
+	if err := d.kv.SetHost(host); err != nil {
+		logrus.Warnf("fail to save storage of host %v: %v", host.UUID, err)
+	}
+}
+
+// hostStorage counts the replica containers on the current host and the space
+// provisioned for them. The total is the size of the filesystem the local
+// volume driver keeps the replica data on.
+func (d *dockerOrc) hostStorage() (total, used int64, replicas int, err error) {
+	filters := dFilters.NewArgs()
+	filters.Add("label", LabelInstanceType+"="+string(types.InstanceTypeReplica))
+	containers, err := d.cli.ContainerList(context.Background(), dTypes.ContainerListOptions{
+		All:     true,
+		Filters: filters,
+	})
+	if err != nil {
+		return 0, 0, 0, errors.Wrap(err, "fail to list replica containers")
+	}
+	sizes := map[string]int64{}
+	for _, c := range containers {
+		replicas++
+		volumeName := c.Labels[LabelVolumeName]
+		size, ok := sizes[volumeName]
+		if !ok {
+			volume, err := d.kv.GetVolume(volumeName)
+			if err != nil {
+				return 0, 0, 0, errors.Wrapf(err, "fail to get volume %v", volumeName)
+			}
+			if volume != nil {
+				size = volume.Size
+			}
+			sizes[volumeName] = size
+		}
+		used += size
+		if total == 0 {
+			total = localVolumeCapacity(c.Mounts)
+		}
+	}
+	return total, used, replicas, nil
+}
+
+func localVolumeCapacity(mounts []dTypes.MountPoint) int64 {
+	for _, m := range mounts {
+		if m.Destination != replicaDataDir || m.Driver != "local" || m.Source == "" {
+			continue
+		}
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(m.Source, &stat); err != nil {
+			logrus.Debugf("cannot stat replica data directory %v: %v", m.Source, err)
+			return 0
+		}
+		return int64(stat.Blocks) * int64(stat.Bsize)
+	}
+	return 0
 }
 
 func (d *dockerOrc) GetCurrentHostID() string {
@@ -203,6 +413,34 @@ func (d *dockerOrc) GetAddress(hostID string) (string, error) {
 	return host.Address, nil
 }
 
+func (d *dockerOrc) CampaignLeader(name, id string, ttl time.Duration) (string, error) {
+	return d.kv.CampaignLeader(name, id, ttl)
+}
+
+func (d *dockerOrc) GetLeader(name string) (string, error) {
+	return d.kv.GetLeader(name)
+}
+
+func (d *dockerOrc) ResignLeader(name, id string) error {
+	return d.kv.ResignLeader(name, id)
+}
+
+func (d *dockerOrc) SetOperation(op *types.Operation) error {
+	return d.kv.SetOperation(op)
+}
+
+func (d *dockerOrc) GetOperation(volumeName string) (*types.Operation, error) {
+	return d.kv.GetOperation(volumeName)
+}
+
+func (d *dockerOrc) DeleteOperation(volumeName string) error {
+	return d.kv.DeleteOperation(volumeName)
+}
+
+func (d *dockerOrc) ListOperations() ([]*types.Operation, error) {
+	return d.kv.ListOperations()
+}
+
 func (d *dockerOrc) CreateVolume(volume *types.VolumeInfo) (*types.VolumeInfo, error) {
 	v, err := d.kv.GetVolumeBase(volume.Name)
 	if err == nil && v != nil {
@@ -230,6 +468,17 @@ func (d *dockerOrc) UpdateVolume(volume *types.VolumeInfo) error {
 	return d.kv.SetVolumeBase(volume)
 }
 
+func (d *dockerOrc) RenameVolume(oldName string, volume *types.VolumeInfo) error {
+	v, err := d.kv.GetVolumeBase(volume.Name)
+	if err != nil {
+		return errors.Wrapf(err, "fail to rename volume %v", oldName)
+	}
+	if v != nil {
+		return errors.Errorf("cannot rename volume %v because volume %v already exists", oldName, volume.Name)
+	}
+	return d.kv.RenameVolume(oldName, volume)
+}
+
 func (d *dockerOrc) ListVolumes() ([]*types.VolumeInfo, error) {
 	return d.kv.ListVolumes()
 }
@@ -252,6 +501,29 @@ func (d *dockerOrc) MarkBadReplica(volumeName string, replica *types.ReplicaInfo
 	return nil
 }
 
+func (d *dockerOrc) UpdateReplica(replica *types.ReplicaInfo) error {
+	r, err := d.kv.GetVolumeReplica(replica.VolumeName, replica.Name)
+	if err != nil {
+		return errors.Wrapf(err, "fail to update replica %v", replica.Name)
+	}
+	if r == nil {
+		return errors.Errorf("cannot update replica %v of volume %v because it doesn't exist", replica.Name, replica.VolumeName)
+	}
+	return d.kv.SetVolumeReplica(replica)
+}
+
+func volumeLockName(volumeName string) string {
+	return "volume-" + volumeName
+}
+
+func (d *dockerOrc) LockVolume(volumeName string) (string, error) {
+	return d.kv.Lock(volumeLockName(volumeName), d.currentHost.UUID, kvstore.LockTimeout)
+}
+
+func (d *dockerOrc) UnlockVolume(volumeName, token string) error {
+	return d.kv.Unlock(volumeLockName(volumeName), token)
+}
+
 func (d *dockerOrc) GetSettings() (*types.SettingsInfo, error) {
 	settings, err := d.kv.GetSettings()
 	if err != nil {
@@ -259,8 +531,9 @@ func (d *dockerOrc) GetSettings() (*types.SettingsInfo, error) {
 	}
 	if settings == nil {
 		return &types.SettingsInfo{
-			BackupTarget: "",
-			EngineImage:  d.EngineImage,
+			BackupTarget:        "",
+			EngineImage:         d.EngineImage,
+			ReplicaAntiAffinity: types.ReplicaAntiAffinitySoft,
 		}, nil
 	}
 	return settings, nil
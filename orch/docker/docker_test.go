@@ -143,8 +143,8 @@ func (s *TestSuite) TestCreateVolume(c *C) {
 		InstanceName: ControllerName,
 		EngineImage:  volume.EngineImage,
 		ReplicaURLs: []string{
-			"tcp://" + replica1.Address + ":9502",
-			"tcp://" + replica2.Address + ":9502",
+			"tcp://" + replica1.Address + ":" + strconv.Itoa(s.d.replicaPort()),
+			"tcp://" + replica2.Address + ":" + strconv.Itoa(s.d.replicaPort()),
 		},
 	}
 	controller, err := s.d.createController(data)
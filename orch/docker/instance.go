@@ -14,13 +14,23 @@ import (
 
 	dTypes "github.com/docker/docker/api/types"
 	dContainer "github.com/docker/docker/api/types/container"
+	dFilters "github.com/docker/docker/api/types/filters"
 
+	"github.com/rancher/longhorn-manager/orch"
+	"github.com/rancher/longhorn-manager/scheduler"
 	"github.com/rancher/longhorn-manager/types"
 	"github.com/rancher/longhorn-manager/util"
 )
 
 const (
 	OrcName = "docker"
+
+	LabelVolumeName   = "io.rancher.longhorn.volume"
+	LabelInstanceType = "io.rancher.longhorn.instance-type"
+
+	// replicaDataDir is where replica containers keep the data, on a volume
+	// of the local driver
+	replicaDataDir = "/volume"
 )
 
 var (
@@ -33,8 +43,11 @@ type dockerScheduleData struct {
 	InstanceName string
 	VolumeName   string
 	VolumeSize   string
+	BaseImage    string
 	EngineImage  string
 	ReplicaURLs  []string
+
+	types.VolumeQoS
 }
 
 func (d *dockerOrc) ProcessSchedule(item *types.ScheduleItem) (*types.InstanceInfo, error) {
@@ -138,6 +151,7 @@ func (d *dockerOrc) prepareCreateController(volumeName, controllerName string, r
 		VolumeName:   volumeName,
 		EngineImage:  volume.EngineImage,
 		ReplicaURLs:  []string{},
+		VolumeQoS:    volume.VolumeQoS,
 	}
 	for _, name := range replicaNames {
 		replica := volume.Replicas[name]
@@ -147,7 +161,7 @@ func (d *dockerOrc) prepareCreateController(volumeName, controllerName string, r
 		if replica.Address == "" {
 			return nil, errors.Errorf("invalid empty address of replica %v", name)
 		}
-		data.ReplicaURLs = append(data.ReplicaURLs, "tcp://"+replica.Address+":9502")
+		data.ReplicaURLs = append(data.ReplicaURLs, fmt.Sprintf("tcp://%s:%d", replica.Address, d.replicaPort()))
 	}
 
 	bData, err := json.Marshal(data)
@@ -160,21 +174,45 @@ func (d *dockerOrc) prepareCreateController(volumeName, controllerName string, r
 	}, nil
 }
 
-func (d *dockerOrc) createController(data *dockerScheduleData) (instance *types.InstanceInfo, err error) {
+// controllerCmd is the command of the controller container, the replica
+// timeout and the QoS limits are only passed if set, so engines without the
+// options can still be launched
+func controllerCmd(data *dockerScheduleData, port, replicaTimeout int) []string {
 	cmd := []string{
 		"launch", "controller",
-		"--listen", "0.0.0.0:9501",
+		"--listen", fmt.Sprintf("0.0.0.0:%d", port),
 		"--frontend", "tgt",
 	}
+	if replicaTimeout != orch.DefaultEngineReplicaTimeout {
+		cmd = append(cmd, "--engine-replica-timeout", strconv.Itoa(replicaTimeout))
+	}
+	for _, limit := range []struct {
+		flag  string
+		value int64
+	}{
+		{"--read-iops-max", data.ReadIOPSMax},
+		{"--write-iops-max", data.WriteIOPSMax},
+		{"--read-bandwidth-max", data.ReadBandwidthMax},
+		{"--write-bandwidth-max", data.WriteBandwidthMax},
+	} {
+		if limit.value > 0 {
+			cmd = append(cmd, limit.flag, strconv.FormatInt(limit.value, 10))
+		}
+	}
 	for _, url := range data.ReplicaURLs {
 		cmd = append(cmd, "--replica", url)
 	}
-	cmd = append(cmd, data.VolumeName)
+	return append(cmd, data.VolumeName)
+}
+
+func (d *dockerOrc) createController(data *dockerScheduleData) (instance *types.InstanceInfo, err error) {
+	cmd := controllerCmd(data, d.controllerPort(), d.engineReplicaTimeout)
 
 	createBody, err := d.cli.ContainerCreate(context.Background(),
 		&dContainer.Config{
-			Image: data.EngineImage,
-			Cmd:   cmd,
+			Image:  data.EngineImage,
+			Cmd:    cmd,
+			Labels: instanceLabels(data.VolumeName, types.InstanceTypeController),
 		},
 		&dContainer.HostConfig{
 			Binds: []string{
@@ -209,7 +247,7 @@ func (d *dockerOrc) createController(data *dockerScheduleData) (instance *types.
 		return instance, errors.Wrap(err, "fail to start controller container")
 	}
 
-	url := "http://" + instance.Address + ":9501/v1"
+	url := fmt.Sprintf("http://%s:%d/v1", instance.Address, d.controllerPort())
 	if err := util.WaitForAPI(url, WaitAPITimeout); err != nil {
 		return instance, errors.Wrapf(err, "fail to wait for api endpoint at %v", url)
 	}
@@ -225,7 +263,7 @@ func (d *dockerOrc) getDeviceName(volumeName string) string {
 	return filepath.Join("/dev/longhorn/", volumeName)
 }
 
-func (d *dockerOrc) CreateReplica(volumeName, replicaName string) (*types.ReplicaInfo, error) {
+func (d *dockerOrc) CreateReplica(volumeName, replicaName, hostID string) (*types.ReplicaInfo, error) {
 	volume, err := d.kv.GetVolume(volumeName)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to create replica")
@@ -244,12 +282,16 @@ func (d *dockerOrc) CreateReplica(volumeName, replicaName string) (*types.Replic
 		Instance: types.ScheduleInstance{
 			ID:         replicaName,
 			Type:       types.InstanceTypeReplica,
+			HostID:     hostID,
 			VolumeName: volumeName,
 		},
 		Data: *data,
 	}
 
-	policy := d.prepareCreateReplicaPolicy(volume)
+	policy, err := d.prepareCreateReplicaPolicy(volume)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Fail to create replica for %v", volumeName)
+	}
 
 	instance, err := d.scheduler.Schedule(schedule, policy)
 	if err != nil {
@@ -260,17 +302,12 @@ func (d *dockerOrc) CreateReplica(volumeName, replicaName string) (*types.Replic
 	}, nil
 }
 
-func (d *dockerOrc) prepareCreateReplicaPolicy(volume *types.VolumeInfo) *types.SchedulePolicy {
-	policy := &types.SchedulePolicy{
-		Binding:   types.SchedulePolicyBindingSoftAntiAffinity,
-		HostIDMap: map[string]struct{}{},
-	}
-	for _, replica := range volume.Replicas {
-		if replica.BadTimestamp == "" {
-			policy.HostIDMap[replica.HostID] = struct{}{}
-		}
+func (d *dockerOrc) prepareCreateReplicaPolicy(volume *types.VolumeInfo) (*types.SchedulePolicy, error) {
+	settings, err := d.GetSettings()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get settings for replica anti-affinity")
 	}
-	return policy
+	return scheduler.ReplicaSchedulePolicy(settings.ReplicaAntiAffinity, volume), nil
 }
 
 func (d *dockerOrc) prepareCreateReplica(volume *types.VolumeInfo, replicaName string) (*types.ScheduleData, error) {
@@ -280,6 +317,7 @@ func (d *dockerOrc) prepareCreateReplica(volume *types.VolumeInfo, replicaName s
 	data := &dockerScheduleData{
 		VolumeName:   volume.Name,
 		VolumeSize:   strconv.FormatInt(volume.Size, 10),
+		BaseImage:    volume.BaseImage,
 		InstanceName: replicaName,
 		EngineImage:  volume.EngineImage,
 	}
@@ -293,20 +331,40 @@ func (d *dockerOrc) prepareCreateReplica(volume *types.VolumeInfo, replicaName s
 	}, nil
 }
 
-func (d *dockerOrc) createReplica(data *dockerScheduleData) (*types.InstanceInfo, error) {
+// controllerPort and replicaPort follow the manager API port, the replica
+// uses the two ports after its own as well
+func (d *dockerOrc) controllerPort() int {
+	return d.basePort + 1
+}
+
+func (d *dockerOrc) replicaPort() int {
+	return d.basePort + 2
+}
+
+// replicaCmd is the command of the replica container, the volume data is
+// layered on top of the base image if there is one
+func replicaCmd(data *dockerScheduleData, port int) []string {
 	cmd := []string{
 		"launch", "replica",
-		"--listen", "0.0.0.0:9502",
+		"--listen", fmt.Sprintf("0.0.0.0:%d", port),
 		"--size", data.VolumeSize,
-		"/volume",
 	}
+	if data.BaseImage != "" {
+		cmd = append(cmd, "--backing-image", data.BaseImage)
+	}
+	return append(cmd, replicaDataDir)
+}
+
+func (d *dockerOrc) createReplica(data *dockerScheduleData) (*types.InstanceInfo, error) {
+	cmd := replicaCmd(data, d.replicaPort())
 	createBody, err := d.cli.ContainerCreate(context.Background(),
 		&dContainer.Config{
 			Image: data.EngineImage,
 			Volumes: map[string]struct{}{
-				"/volume": {},
+				replicaDataDir: {},
 			},
-			Cmd: cmd,
+			Cmd:    cmd,
+			Labels: instanceLabels(data.VolumeName, types.InstanceTypeReplica),
 		},
 		&dContainer.HostConfig{
 			Privileged:  true,
@@ -339,15 +397,19 @@ func (d *dockerOrc) refreshInstanceInfo(instance *types.InstanceInfo) (*types.In
 		return nil, errors.Wrapf(err, "fail to inspect %v instance %v", instance.Type, instance.ID)
 	}
 	info := &types.InstanceInfo{
-		// It's weird that Docker put a forward slash to the container name
-		// So it become "/replica-1"
 		ID:         inspectJSON.ID,
 		Type:       instance.Type,
-		Name:       strings.TrimPrefix(inspectJSON.Name, "/"),
+		Name:       instance.Name,
 		HostID:     d.GetCurrentHostID(),
 		Running:    inspectJSON.State.Running,
 		VolumeName: instance.VolumeName,
 	}
+	if info.Name == "" {
+		// It's weird that Docker put a forward slash to the container name
+		// So it become "/replica-1". The container keeps its name when the
+		// volume is renamed, so the metadata name takes precedence.
+		info.Name = strings.TrimPrefix(inspectJSON.Name, "/")
+	}
 	if d.Network == "" {
 		info.Address = inspectJSON.NetworkSettings.IPAddress
 	} else {
@@ -465,6 +527,60 @@ func (d *dockerOrc) removeInstance(instance *types.InstanceInfo) (*types.Instanc
 	return instance, nil
 }
 
+func instanceLabels(volumeName string, instanceType types.InstanceType) map[string]string {
+	return map[string]string{
+		LabelVolumeName:   volumeName,
+		LabelInstanceType: string(instanceType),
+	}
+}
+
+// ListInstances lists the instances on the current host. Only the containers
+// labeled with the volume name are included.
+func (d *dockerOrc) ListInstances() ([]*types.InstanceInfo, error) {
+	filters := dFilters.NewArgs()
+	filters.Add("label", LabelVolumeName)
+	containers, err := d.cli.ContainerList(context.Background(), dTypes.ContainerListOptions{
+		All:     true,
+		Filters: filters,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to list containers")
+	}
+	instances := []*types.InstanceInfo{}
+	for _, c := range containers {
+		name := ""
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		instances = append(instances, &types.InstanceInfo{
+			ID:         c.ID,
+			Type:       types.InstanceType(c.Labels[LabelInstanceType]),
+			Name:       name,
+			HostID:     d.GetCurrentHostID(),
+			Running:    c.State == "running",
+			VolumeName: c.Labels[LabelVolumeName],
+		})
+	}
+	return instances, nil
+}
+
+// RemoveOrphanedInstance stops and removes an instance on the current host,
+// without touching the volume metadata
+func (d *dockerOrc) RemoveOrphanedInstance(instance *types.InstanceInfo) error {
+	if instance.HostID != d.GetCurrentHostID() {
+		return errors.Errorf("instance %v is on host %v, not on the current host", instance.ID, instance.HostID)
+	}
+	if instance.Running {
+		if err := d.stopContainer(instance.ID); err != nil {
+			return errors.Wrapf(err, "fail to stop instance %v", instance.ID)
+		}
+	}
+	if err := d.removeContainer(instance.ID); err != nil {
+		return errors.Wrapf(err, "fail to remove instance %v", instance.ID)
+	}
+	return nil
+}
+
 func (d *dockerOrc) removeContainer(id string) error {
 	return d.cli.ContainerRemove(context.Background(), id, dTypes.ContainerRemoveOptions{
 		RemoveVolumes: true,
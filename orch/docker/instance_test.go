@@ -0,0 +1,76 @@
+package docker
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/rancher/longhorn-manager/orch"
+)
+
+type InstanceSuite struct{}
+
+var _ = Suite(&InstanceSuite{})
+
+func (s *InstanceSuite) TestReplicaCmd(c *C) {
+	data := &dockerScheduleData{VolumeName: "vol1", VolumeSize: "1073741824"}
+	c.Assert(replicaCmd(data, 9502), DeepEquals, []string{
+		"launch", "replica", "--listen", "0.0.0.0:9502", "--size", "1073741824", "/volume",
+	})
+
+	data.BaseImage = "rancher/longhorn-base:ubuntu"
+	c.Assert(replicaCmd(data, 9502), DeepEquals, []string{
+		"launch", "replica", "--listen", "0.0.0.0:9502", "--size", "1073741824",
+		"--backing-image", "rancher/longhorn-base:ubuntu", "/volume",
+	})
+}
+
+func (s *InstanceSuite) TestPorts(c *C) {
+	d := &dockerOrc{basePort: 9600}
+	c.Assert(d.controllerPort(), Equals, 9601)
+	c.Assert(d.replicaPort(), Equals, 9602)
+	c.Assert(replicaCmd(&dockerScheduleData{VolumeSize: "1"}, d.replicaPort())[3], Equals, "0.0.0.0:9602")
+}
+
+func (s *InstanceSuite) TestPeerAddress(c *C) {
+	d := &dockerOrc{IP: "172.17.0.2", basePort: 9500, managerPort: 9500}
+	c.Assert(d.peerAddress(""), Equals, "172.17.0.2:9500")
+	d.managerPort = 7000
+	c.Assert(d.peerAddress(""), Equals, "172.17.0.2:7000")
+	c.Assert(d.peerAddress("10.0.0.5:9500"), Equals, "10.0.0.5:9500")
+}
+
+func (s *InstanceSuite) TestEtcdServers(c *C) {
+	c.Assert(etcdServers([]string{"http://etcd-1:2379, http://etcd-2:2379", "http://etcd-3:2379", ""}), DeepEquals,
+		[]string{"http://etcd-1:2379", "http://etcd-2:2379", "http://etcd-3:2379"})
+	c.Assert(etcdServers(nil), HasLen, 0)
+}
+
+func (s *InstanceSuite) TestEtcdTLSConfig(c *C) {
+	config, err := etcdTLSConfig("", "", "")
+	c.Assert(err, IsNil)
+	c.Assert(config, IsNil)
+
+	_, err = etcdTLSConfig("client.pem", "", "")
+	c.Assert(err, NotNil)
+	_, err = etcdTLSConfig("", "", "/nonexistent/ca.pem")
+	c.Assert(err, NotNil)
+}
+
+func (s *InstanceSuite) TestControllerCmd(c *C) {
+	data := &dockerScheduleData{VolumeName: "vol1", ReplicaURLs: []string{"tcp://10.42.0.2:9502"}}
+	c.Assert(controllerCmd(data, 9501, orch.DefaultEngineReplicaTimeout), DeepEquals, []string{
+		"launch", "controller", "--listen", "0.0.0.0:9501", "--frontend", "tgt",
+		"--replica", "tcp://10.42.0.2:9502", "vol1",
+	})
+	c.Assert(controllerCmd(data, 9501, 16), DeepEquals, []string{
+		"launch", "controller", "--listen", "0.0.0.0:9501", "--frontend", "tgt",
+		"--engine-replica-timeout", "16", "--replica", "tcp://10.42.0.2:9502", "vol1",
+	})
+
+	data.ReadIOPSMax = 1000
+	data.WriteBandwidthMax = 10 << 20
+	c.Assert(controllerCmd(data, 9501, orch.DefaultEngineReplicaTimeout), DeepEquals, []string{
+		"launch", "controller", "--listen", "0.0.0.0:9501", "--frontend", "tgt",
+		"--read-iops-max", "1000", "--write-bandwidth-max", "10485760",
+		"--replica", "tcp://10.42.0.2:9502", "vol1",
+	})
+}
@@ -0,0 +1,149 @@
+package docker
+
+import (
+	"math/rand"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	eCli "github.com/coreos/etcd/client"
+
+	"github.com/rancher/longhorn-manager/kvstore"
+)
+
+const (
+	etcdRetryAttempts = 5
+)
+
+var (
+	retryBaseInterval = 100 * time.Millisecond
+	retryMaxInterval  = 10 * time.Second
+)
+
+// retryWithBackoff calls fn until it succeeds, fails with an error which is
+// not retryable or maxAttempts is reached. The wait between attempts grows
+// exponentially from retryBaseInterval up to retryMaxInterval, with jitter.
+func retryWithBackoff(ctx context.Context, maxAttempts int, retryable func(error) bool, fn func() error) error {
+	interval := retryBaseInterval
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= maxAttempts || !retryable(err) {
+			return err
+		}
+
+		wait := interval/2 + time.Duration(rand.Int63n(int64(interval)/2+1))
+		logrus.Debugf("transient error, retrying in %v (attempt %v of %v): %v", wait, attempt, maxAttempts, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+
+		if interval *= 2; interval > retryMaxInterval {
+			interval = retryMaxInterval
+		}
+	}
+}
+
+// isTransientError is true for timeouts and refused connections
+func isTransientError(err error) bool {
+	return isCause(err, context.DeadlineExceeded, syscall.ECONNREFUSED)
+}
+
+// isUnsentError is true if the request never reached etcd. A timeout may come
+// after etcd applied the write, so only these errors are safe to retry for
+// the writes which aren't idempotent.
+func isUnsentError(err error) bool {
+	return isCause(err, syscall.ECONNREFUSED)
+}
+
+// isCause is true if err is caused by one of causes, etcd returns them
+// wrapped into a ClusterError if no endpoint could be reached
+func isCause(err error, causes ...error) bool {
+	switch err := err.(type) {
+	case *eCli.ClusterError:
+		for _, e := range err.Errors {
+			if isCause(e, causes...) {
+				return true
+			}
+		}
+		return false
+	case *url.Error:
+		return isCause(err.Err, causes...)
+	case *net.OpError:
+		return isCause(err.Err, causes...)
+	case *os.SyscallError:
+		return isCause(err.Err, causes...)
+	}
+	for _, cause := range causes {
+		if err == cause {
+			return true
+		}
+	}
+	return false
+}
+
+// retryBackend retries the operations of the kvstore backend failing with
+// transient errors
+type retryBackend struct {
+	kvstore.Backend
+}
+
+func (b *retryBackend) retry(fn func() error) error {
+	return retryWithBackoff(context.Background(), etcdRetryAttempts, isTransientError, fn)
+}
+
+func (b *retryBackend) retryUnsent(fn func() error) error {
+	return retryWithBackoff(context.Background(), etcdRetryAttempts, isUnsentError, fn)
+}
+
+func (b *retryBackend) Set(key string, obj interface{}) error {
+	return b.retry(func() error {
+		return b.Backend.Set(key, obj)
+	})
+}
+
+func (b *retryBackend) Get(key string, obj interface{}) error {
+	return b.retry(func() error {
+		return b.Backend.Get(key, obj)
+	})
+}
+
+func (b *retryBackend) Delete(key string) error {
+	return b.retry(func() error {
+		return b.Backend.Delete(key)
+	})
+}
+
+func (b *retryBackend) Keys(prefix string) ([]string, error) {
+	var keys []string
+	err := b.retry(func() error {
+		var err error
+		keys, err = b.Backend.Keys(prefix)
+		return err
+	})
+	return keys, err
+}
+
+func (b *retryBackend) Create(key string, obj interface{}, ttl time.Duration) error {
+	return b.retryUnsent(func() error {
+		return b.Backend.Create(key, obj, ttl)
+	})
+}
+
+func (b *retryBackend) CompareAndDelete(key string, obj interface{}) error {
+	return b.retryUnsent(func() error {
+		return b.Backend.CompareAndDelete(key, obj)
+	})
+}
+
+func (b *retryBackend) CompareAndRefresh(key string, obj interface{}, ttl time.Duration) error {
+	return b.retry(func() error {
+		return b.Backend.CompareAndRefresh(key, obj, ttl)
+	})
+}
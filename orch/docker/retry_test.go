@@ -0,0 +1,119 @@
+package docker
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
+
+	eCli "github.com/coreos/etcd/client"
+
+	"github.com/rancher/longhorn-manager/kvstore"
+
+	. "gopkg.in/check.v1"
+)
+
+type RetrySuite struct{}
+
+var _ = Suite(&RetrySuite{})
+
+func (s *RetrySuite) SetUpSuite(c *C) {
+	retryBaseInterval = time.Millisecond
+	retryMaxInterval = 4 * time.Millisecond
+}
+
+func (s *RetrySuite) TestIsTransientError(c *C) {
+	refused := &url.Error{Op: "Get", URL: "http://etcd:2379", Err: &net.OpError{
+		Op:  "dial",
+		Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED},
+	}}
+	c.Assert(isTransientError(refused), Equals, true)
+	c.Assert(isTransientError(context.DeadlineExceeded), Equals, true)
+	c.Assert(isTransientError(&eCli.ClusterError{Errors: []error{refused}}), Equals, true)
+	c.Assert(isTransientError(&eCli.ClusterError{Errors: []error{errors.New("bad")}}), Equals, false)
+	c.Assert(isTransientError(eCli.Error{Code: eCli.ErrorCodeKeyNotFound}), Equals, false)
+
+	c.Assert(isUnsentError(refused), Equals, true)
+	c.Assert(isUnsentError(&eCli.ClusterError{Errors: []error{refused}}), Equals, true)
+	c.Assert(isUnsentError(context.DeadlineExceeded), Equals, false)
+	c.Assert(isUnsentError(&eCli.ClusterError{Errors: []error{context.DeadlineExceeded}}), Equals, false)
+}
+
+func (s *RetrySuite) TestRetryWithBackoff(c *C) {
+	calls := 0
+	err := retryWithBackoff(context.Background(), 5, isTransientError, func() error {
+		if calls++; calls < 3 {
+			return context.DeadlineExceeded
+		}
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(calls, Equals, 3)
+
+	calls = 0
+	err = retryWithBackoff(context.Background(), 5, isTransientError, func() error {
+		calls++
+		return context.DeadlineExceeded
+	})
+	c.Assert(err, Equals, context.DeadlineExceeded)
+	c.Assert(calls, Equals, 5)
+
+	calls = 0
+	notFound := eCli.Error{Code: eCli.ErrorCodeKeyNotFound}
+	err = retryWithBackoff(context.Background(), 5, isTransientError, func() error {
+		calls++
+		return notFound
+	})
+	c.Assert(err, Equals, notFound)
+	c.Assert(calls, Equals, 1)
+
+	calls = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	err = retryWithBackoff(ctx, 5, isTransientError, func() error {
+		calls++
+		cancel()
+		return context.DeadlineExceeded
+	})
+	c.Assert(err, Equals, context.DeadlineExceeded)
+	c.Assert(calls, Equals, 1)
+}
+
+type timeoutBackend struct {
+	kvstore.Backend
+	calls int
+}
+
+func (b *timeoutBackend) Set(key string, obj interface{}) error {
+	b.calls++
+	return context.DeadlineExceeded
+}
+
+func (b *timeoutBackend) Create(key string, obj interface{}, ttl time.Duration) error {
+	b.calls++
+	return context.DeadlineExceeded
+}
+
+func (b *timeoutBackend) CompareAndDelete(key string, obj interface{}) error {
+	b.calls++
+	return context.DeadlineExceeded
+}
+
+func (s *RetrySuite) TestRetryBackendWrites(c *C) {
+	backend := &timeoutBackend{}
+	b := &retryBackend{backend}
+
+	c.Assert(b.Set("key", "value"), Equals, context.DeadlineExceeded)
+	c.Assert(backend.calls, Equals, etcdRetryAttempts)
+
+	// etcd may have applied them before timing out
+	backend.calls = 0
+	c.Assert(b.Create("key", "value", time.Second), Equals, context.DeadlineExceeded)
+	c.Assert(backend.calls, Equals, 1)
+	backend.calls = 0
+	c.Assert(b.CompareAndDelete("key", "value"), Equals, context.DeadlineExceeded)
+	c.Assert(backend.calls, Equals, 1)
+}
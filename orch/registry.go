@@ -0,0 +1,56 @@
+package orch
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+// OrchestratorFactory creates an orchestrator from the command line flags
+type OrchestratorFactory func(c *cli.Context) (types.Orchestrator, error)
+
+var (
+	factoriesLock sync.RWMutex
+	factories     = map[string]OrchestratorFactory{}
+)
+
+// Register makes an orchestrator available by name, usually from the init()
+// of its package. It panics if the name is already taken.
+func Register(name string, factory OrchestratorFactory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	if factory == nil {
+		panic("orch: nil factory for orchestrator " + name)
+	}
+	if _, ok := factories[name]; ok {
+		panic("orch: orchestrator " + name + " registered twice")
+	}
+	factories[name] = factory
+}
+
+// New creates the orchestrator registered under the name
+func New(name string, c *cli.Context) (types.Orchestrator, error) {
+	factoriesLock.RLock()
+	factory := factories[name]
+	factoriesLock.RUnlock()
+	if factory == nil {
+		return nil, errors.Errorf("invalid orchestrator %v, should be one of %v", name, Names())
+	}
+	return factory(c)
+}
+
+// Names returns the sorted names of the registered orchestrators
+func Names() []string {
+	factoriesLock.RLock()
+	defer factoriesLock.RUnlock()
+	names := []string{}
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
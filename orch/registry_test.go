@@ -0,0 +1,37 @@
+package orch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+func TestRegistry(t *testing.T) {
+	assert := require.New(t)
+
+	called := false
+	Register("test", func(c *cli.Context) (types.Orchestrator, error) {
+		called = true
+		return nil, nil
+	})
+	defer func() {
+		factoriesLock.Lock()
+		delete(factories, "test")
+		factoriesLock.Unlock()
+	}()
+	assert.Contains(Names(), "test")
+
+	_, err := New("test", nil)
+	assert.Nil(err)
+	assert.True(called)
+
+	_, err = New("missing", nil)
+	assert.NotNil(err)
+
+	assert.Panics(func() {
+		Register("test", func(c *cli.Context) (types.Orchestrator, error) { return nil, nil })
+	})
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/rancher/longhorn-manager/api"
 	"github.com/rancher/longhorn-manager/types"
+	"github.com/rancher/longhorn-manager/util"
 )
 
 type schedulerClient struct {
@@ -20,19 +21,20 @@ type schedulerClient struct {
 }
 
 func newSchedulerClient(host *types.HostInfo) *schedulerClient {
-	address := "http://" + host.Address + "/v1"
+	address := util.PeerScheme + "://" + host.Address + "/v1"
 	return &schedulerClient{
 		hostID:  host.UUID,
 		address: address,
 	}
 }
 
-func (c *schedulerClient) Schedule(item *types.ScheduleItem) (*types.InstanceInfo, error) {
+func (c *schedulerClient) Schedule(spec *types.ScheduleSpec, item *types.ScheduleItem) (*types.InstanceInfo, error) {
 	var output api.ScheduleOutput
 
 	input := &api.ScheduleInput{
 		Spec: types.ScheduleSpec{
-			HostID: c.hostID,
+			HostID:           c.hostID,
+			RequiredNodeTags: spec.RequiredNodeTags,
 		},
 		Item: *item,
 	}
@@ -64,8 +66,9 @@ func (c *schedulerClient) do(method, path string, req, resp interface{}) error {
 		return err
 	}
 	httpReq.Header.Set("Content-Type", bodyType)
+	util.SetPeerAuth(httpReq)
 
-	httpResp, err := http.DefaultClient.Do(httpReq)
+	httpResp, err := (&http.Client{Transport: util.PeerTransport}).Do(httpReq)
 	if err != nil {
 		return err
 	}
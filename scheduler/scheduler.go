@@ -1,6 +1,8 @@
 package scheduler
 
 import (
+	"strings"
+
 	"github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
 
@@ -9,6 +11,9 @@ import (
 
 type OrcScheduler struct {
 	ops types.ScheduleOps
+
+	// MaxReplicas limits the replicas on the current host, 0 for no limit
+	MaxReplicas int
 }
 
 func NewOrcScheduler(ops types.ScheduleOps) *OrcScheduler {
@@ -28,9 +33,14 @@ func (s *OrcScheduler) Schedule(item *types.ScheduleItem, policy *types.Schedule
 	if item.Instance.ID == "" || item.Instance.Type == types.InstanceTypeNone {
 		return nil, errors.Errorf("instance ID and type required for scheduling")
 	}
+	var requiredNodeTags map[string]string
+	if policy != nil {
+		requiredNodeTags = policy.RequiredNodeTags
+	}
 	if item.Instance.HostID != "" {
 		return s.ScheduleProcess(&types.ScheduleSpec{
-			HostID: item.Instance.HostID,
+			HostID:           item.Instance.HostID,
+			RequiredNodeTags: requiredNodeTags,
 		}, item)
 	}
 
@@ -39,37 +49,119 @@ func (s *OrcScheduler) Schedule(item *types.ScheduleItem, policy *types.Schedule
 		return nil, errors.Wrap(err, "fail to schedule")
 	}
 
+	priorityList, err := hostPriorityList(hosts, policy)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to schedule")
+	}
+
+	failures := []string{}
+	for _, id := range priorityList {
+		ret, err := s.ScheduleProcess(&types.ScheduleSpec{HostID: id, RequiredNodeTags: requiredNodeTags}, item)
+		if err == nil {
+			return ret, nil
+		}
+
+		logrus.Warnf("Fail to schedule %+v on host %v, trying on another one: %v",
+			hosts[id], item.Instance, err)
+		failures = append(failures, id+": "+err.Error())
+	}
+	if len(failures) == 0 {
+		return nil, errors.Errorf("unable to find suitable host for scheduling")
+	}
+	return nil, errors.Errorf("unable to find suitable host for scheduling: %v", strings.Join(failures, "; "))
+}
+
+// hostPriorityList returns the hosts to try scheduling on, in order. Hosts in
+// policy.HostIDMap are tried last with soft anti-affinity and not at all with
+// strict anti-affinity.
+func hostPriorityList(hosts map[string]*types.HostInfo, policy *types.SchedulePolicy) ([]string, error) {
 	normalPriorityList := []string{}
 	lowPriorityList := []string{}
 
 	for id := range hosts {
 		if policy != nil {
-			if policy.Binding == types.SchedulePolicyBindingSoftAntiAffinity {
+			switch policy.Binding {
+			case types.SchedulePolicyBindingSoftAntiAffinity:
 				if _, ok := policy.HostIDMap[id]; ok {
 					lowPriorityList = append(lowPriorityList, id)
 				} else {
 					normalPriorityList = append(normalPriorityList, id)
 				}
-			} else {
+			case types.SchedulePolicyBindingStrictAntiAffinity:
+				if _, ok := policy.HostIDMap[id]; !ok {
+					normalPriorityList = append(normalPriorityList, id)
+				}
+			default:
 				return nil, errors.Errorf("Unsupported schedule policy binding %v", policy.Binding)
 			}
 		} else {
 			normalPriorityList = append(normalPriorityList, id)
 		}
 	}
+	if len(normalPriorityList) == 0 && len(lowPriorityList) == 0 && len(hosts) > 0 {
+		return nil, errors.Errorf("no host satisfies schedule policy %v", policy.Binding)
+	}
+	if policy != nil && policy.PreferredHostID != "" {
+		for i, id := range normalPriorityList {
+			if id == policy.PreferredHostID {
+				normalPriorityList[0], normalPriorityList[i] = normalPriorityList[i], normalPriorityList[0]
+				break
+			}
+		}
+	}
 
-	priorityList := append(normalPriorityList, lowPriorityList...)
+	return append(normalPriorityList, lowPriorityList...), nil
+}
 
-	for _, id := range priorityList {
-		ret, err := s.ScheduleProcess(&types.ScheduleSpec{HostID: id}, item)
-		if err == nil {
-			return ret, nil
+// ReplicaSchedulePolicy is the policy to schedule a new replica of the
+// volume with the replica anti-affinity setting. With best-effort data
+// locality the host of the controller is preferred.
+func ReplicaSchedulePolicy(antiAffinity string, volume *types.VolumeInfo) *types.SchedulePolicy {
+	policy := &types.SchedulePolicy{
+		Binding:   types.SchedulePolicyBindingSoftAntiAffinity,
+		HostIDMap: map[string]struct{}{},
+	}
+	if antiAffinity == types.ReplicaAntiAffinityStrict {
+		policy.Binding = types.SchedulePolicyBindingStrictAntiAffinity
+	}
+	for _, replica := range volume.Replicas {
+		// pinned replicas stay on their host even when bad
+		if replica.BadTimestamp == "" || replica.PinnedHostID != "" {
+			policy.HostIDMap[replica.HostID] = struct{}{}
 		}
+	}
+	if volume.DataLocality == types.DataLocalityBestEffort && volume.Controller != nil {
+		policy.PreferredHostID = volume.Controller.HostID
+	}
+	return policy
+}
 
-		logrus.Warnf("Fail to schedule %+v on host %v, trying on another one: %v",
-			hosts[id], item.Instance, err)
+// PlanReplicas proposes the hosts for count new replicas scheduled one after
+// another with the policy, without scheduling anything. The proposal is what
+// Schedule would try first for each replica.
+func PlanReplicas(hosts map[string]*types.HostInfo, policy *types.SchedulePolicy, count int) ([]string, error) {
+	planned := &types.SchedulePolicy{
+		Binding:         policy.Binding,
+		HostIDMap:       map[string]struct{}{},
+		PreferredHostID: policy.PreferredHostID,
+	}
+	for id := range policy.HostIDMap {
+		planned.HostIDMap[id] = struct{}{}
+	}
+
+	hostIDs := []string{}
+	for i := 0; i < count; i++ {
+		priorityList, err := hostPriorityList(hosts, planned)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to plan replica %v of %v", i+1, count)
+		}
+		if len(priorityList) == 0 {
+			return nil, errors.Errorf("fail to plan replica %v of %v: no hosts available", i+1, count)
+		}
+		hostIDs = append(hostIDs, priorityList[0])
+		planned.HostIDMap[priorityList[0]] = struct{}{}
 	}
-	return nil, errors.Errorf("unable to find suitable host for scheduling")
+	return hostIDs, nil
 }
 
 func (s *OrcScheduler) ScheduleProcess(spec *types.ScheduleSpec, item *types.ScheduleItem) (*types.InstanceInfo, error) {
@@ -82,7 +174,7 @@ func (s *OrcScheduler) ScheduleProcess(spec *types.ScheduleSpec, item *types.Sch
 		return nil, errors.Wrapf(err, "cannot find host %v", spec.HostID)
 	}
 	client := newSchedulerClient(host)
-	ret, err := client.Schedule(item)
+	ret, err := client.Schedule(spec, item)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Fail to schedule on host %v(%v %v)", host.UUID, host.Name, host.Address)
 	}
@@ -94,6 +186,22 @@ func (s *OrcScheduler) Process(spec *types.ScheduleSpec, item *types.ScheduleIte
 	if s.ops.GetCurrentHostID() != spec.HostID {
 		return nil, errors.Errorf("wrong host routing, should be at %v", spec.HostID)
 	}
+	checkMaxReplicas := s.MaxReplicas > 0 && item.Action == types.ScheduleActionCreateReplica
+	if len(spec.RequiredNodeTags) > 0 || checkMaxReplicas {
+		host, err := s.ops.GetHost(spec.HostID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot find host %v", spec.HostID)
+		}
+		if host == nil {
+			return nil, errors.Errorf("cannot find host %v", spec.HostID)
+		}
+		if err := checkNodeTags(host, spec.RequiredNodeTags); err != nil {
+			return nil, err
+		}
+		if checkMaxReplicas && host.ReplicaCount >= s.MaxReplicas {
+			return nil, errors.Errorf("host %v has %v replicas, the maximum is %v", host.UUID, host.ReplicaCount, s.MaxReplicas)
+		}
+	}
 	instance, err := s.ops.ProcessSchedule(item)
 	if err != nil {
 		return nil, errors.Wrapf(err, "fail to process schedule request")
@@ -103,3 +211,12 @@ func (s *OrcScheduler) Process(spec *types.ScheduleSpec, item *types.ScheduleIte
 	}
 	return instance, nil
 }
+
+func checkNodeTags(host *types.HostInfo, required map[string]string) error {
+	for k, v := range required {
+		if value, ok := host.Tags[k]; !ok || value != v {
+			return errors.Errorf("host %v doesn't have required tag %v=%v", host.UUID, k, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package scheduler
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/longhorn-manager/types"
+)
+
+func TestHostPriorityList(t *testing.T) {
+	assert := require.New(t)
+
+	hosts := map[string]*types.HostInfo{
+		"host-1": {UUID: "host-1"},
+		"host-2": {UUID: "host-2"},
+		"host-3": {UUID: "host-3"},
+	}
+	hostIDMap := map[string]struct{}{
+		"host-1": {},
+		"host-2": {},
+	}
+
+	list, err := hostPriorityList(hosts, nil)
+	assert.Nil(err)
+	assert.Len(list, 3)
+
+	list, err = hostPriorityList(hosts, &types.SchedulePolicy{
+		Binding:   types.SchedulePolicyBindingSoftAntiAffinity,
+		HostIDMap: hostIDMap,
+	})
+	assert.Nil(err)
+	assert.Len(list, 3)
+	assert.Equal("host-3", list[0])
+	sort.Strings(list[1:])
+	assert.Equal([]string{"host-1", "host-2"}, list[1:])
+
+	list, err = hostPriorityList(hosts, &types.SchedulePolicy{
+		Binding:   types.SchedulePolicyBindingStrictAntiAffinity,
+		HostIDMap: hostIDMap,
+	})
+	assert.Nil(err)
+	assert.Equal([]string{"host-3"}, list)
+
+	hostIDMap["host-3"] = struct{}{}
+	list, err = hostPriorityList(hosts, &types.SchedulePolicy{
+		Binding:   types.SchedulePolicyBindingSoftAntiAffinity,
+		HostIDMap: hostIDMap,
+	})
+	assert.Nil(err)
+	assert.Len(list, 3)
+	_, err = hostPriorityList(hosts, &types.SchedulePolicy{
+		Binding:   types.SchedulePolicyBindingStrictAntiAffinity,
+		HostIDMap: hostIDMap,
+	})
+	assert.NotNil(err)
+
+	_, err = hostPriorityList(hosts, &types.SchedulePolicy{Binding: "unknown"})
+	assert.NotNil(err)
+}
+
+func TestPlanReplicas(t *testing.T) {
+	assert := require.New(t)
+
+	hosts := map[string]*types.HostInfo{
+		"host-1": {UUID: "host-1"},
+		"host-2": {UUID: "host-2"},
+		"host-3": {UUID: "host-3"},
+	}
+	volume := &types.VolumeInfo{Replicas: map[string]*types.ReplicaInfo{
+		"r1": {InstanceInfo: types.InstanceInfo{HostID: "host-1"}},
+		"r2": {InstanceInfo: types.InstanceInfo{HostID: "host-2"}, BadTimestamp: "2017-01-01T00:00:00Z"},
+	}}
+
+	policy := ReplicaSchedulePolicy(types.ReplicaAntiAffinitySoft, volume)
+	assert.Equal(types.SchedulePolicyBinding(types.SchedulePolicyBindingSoftAntiAffinity), policy.Binding)
+	assert.Equal(map[string]struct{}{"host-1": {}}, policy.HostIDMap)
+
+	hostIDs, err := PlanReplicas(hosts, policy, 2)
+	assert.Nil(err)
+	sort.Strings(hostIDs)
+	assert.Equal([]string{"host-2", "host-3"}, hostIDs)
+	assert.Len(policy.HostIDMap, 1)
+
+	hostIDs, err = PlanReplicas(hosts, policy, 4)
+	assert.Nil(err)
+	assert.Len(hostIDs, 4)
+	sort.Strings(hostIDs[:2])
+	assert.Equal([]string{"host-2", "host-3"}, hostIDs[:2])
+
+	policy = ReplicaSchedulePolicy(types.ReplicaAntiAffinityStrict, volume)
+	_, err = PlanReplicas(hosts, policy, 3)
+	assert.NotNil(err)
+
+	_, err = PlanReplicas(map[string]*types.HostInfo{}, policy, 1)
+	assert.NotNil(err)
+}
+
+func TestDataLocality(t *testing.T) {
+	assert := require.New(t)
+
+	hosts := map[string]*types.HostInfo{
+		"host-1": {UUID: "host-1"},
+		"host-2": {UUID: "host-2"},
+		"host-3": {UUID: "host-3"},
+	}
+	volume := &types.VolumeInfo{
+		DataLocality: types.DataLocalityBestEffort,
+		Controller:   &types.ControllerInfo{InstanceInfo: types.InstanceInfo{HostID: "host-3"}},
+		Replicas: map[string]*types.ReplicaInfo{
+			"r1": {InstanceInfo: types.InstanceInfo{HostID: "host-1"}},
+		},
+	}
+
+	policy := ReplicaSchedulePolicy(types.ReplicaAntiAffinitySoft, volume)
+	assert.Equal("host-3", policy.PreferredHostID)
+	for i := 0; i < 10; i++ {
+		priorityList, err := hostPriorityList(hosts, policy)
+		assert.Nil(err)
+		assert.Equal("host-3", priorityList[0])
+		assert.Equal("host-1", priorityList[2])
+	}
+	hostIDs, err := PlanReplicas(hosts, policy, 2)
+	assert.Nil(err)
+	assert.Equal("host-3", hostIDs[0])
+
+	// the controller host already has a replica
+	volume.Controller.HostID = "host-1"
+	policy = ReplicaSchedulePolicy(types.ReplicaAntiAffinitySoft, volume)
+	priorityList, err := hostPriorityList(hosts, policy)
+	assert.Nil(err)
+	assert.Equal("host-1", priorityList[2])
+
+	volume.DataLocality = types.DataLocalityDisabled
+	assert.Equal("", ReplicaSchedulePolicy(types.ReplicaAntiAffinitySoft, volume).PreferredHostID)
+}
+
+type fakeScheduleOps struct {
+	hosts map[string]*types.HostInfo
+}
+
+func (ops *fakeScheduleOps) ListHosts() (map[string]*types.HostInfo, error) {
+	return ops.hosts, nil
+}
+
+func (ops *fakeScheduleOps) GetHost(id string) (*types.HostInfo, error) {
+	return ops.hosts[id], nil
+}
+
+func (ops *fakeScheduleOps) GetCurrentHostID() string {
+	return "host-1"
+}
+
+func (ops *fakeScheduleOps) ProcessSchedule(item *types.ScheduleItem) (*types.InstanceInfo, error) {
+	return &types.InstanceInfo{ID: item.Instance.ID, Type: item.Instance.Type, HostID: "host-1"}, nil
+}
+
+func TestProcessRequiredNodeTags(t *testing.T) {
+	assert := require.New(t)
+
+	s := NewOrcScheduler(&fakeScheduleOps{hosts: map[string]*types.HostInfo{
+		"host-1": {UUID: "host-1", Tags: map[string]string{"rack": "A", "zone": "us-east-1a"}},
+	}})
+	item := &types.ScheduleItem{Instance: types.ScheduleInstance{ID: "r1", Type: types.InstanceTypeReplica}}
+
+	_, err := s.Process(&types.ScheduleSpec{HostID: "host-1"}, item)
+	assert.Nil(err)
+	_, err = s.Process(&types.ScheduleSpec{HostID: "host-1", RequiredNodeTags: map[string]string{"rack": "A"}}, item)
+	assert.Nil(err)
+	_, err = s.Process(&types.ScheduleSpec{HostID: "host-1", RequiredNodeTags: map[string]string{"rack": "B"}}, item)
+	assert.NotNil(err)
+	_, err = s.Process(&types.ScheduleSpec{HostID: "host-1", RequiredNodeTags: map[string]string{"rack": "A", "row": "1"}}, item)
+	assert.NotNil(err)
+}
+
+func TestProcessMaxReplicas(t *testing.T) {
+	assert := require.New(t)
+
+	ops := &fakeScheduleOps{hosts: map[string]*types.HostInfo{
+		"host-1": {UUID: "host-1", ReplicaCount: 2},
+	}}
+	s := NewOrcScheduler(ops)
+	item := &types.ScheduleItem{
+		Action:   types.ScheduleActionCreateReplica,
+		Instance: types.ScheduleInstance{ID: "r1", Type: types.InstanceTypeReplica},
+	}
+
+	_, err := s.Process(&types.ScheduleSpec{HostID: "host-1"}, item)
+	assert.Nil(err)
+
+	s.MaxReplicas = 3
+	_, err = s.Process(&types.ScheduleSpec{HostID: "host-1"}, item)
+	assert.Nil(err)
+
+	ops.hosts["host-1"].ReplicaCount = 3
+	_, err = s.Process(&types.ScheduleSpec{HostID: "host-1"}, item)
+	assert.NotNil(err)
+	_, err = s.Schedule(item, nil)
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "host-1: host host-1 has 3 replicas, the maximum is 3")
+
+	controller := &types.ScheduleItem{
+		Action:   types.ScheduleActionCreateController,
+		Instance: types.ScheduleInstance{ID: "c1", Type: types.InstanceTypeController},
+	}
+	_, err = s.Process(&types.ScheduleSpec{HostID: "host-1"}, controller)
+	assert.Nil(err)
+}
@@ -11,7 +11,8 @@ const (
 type SchedulePolicyBinding string
 
 const (
-	SchedulePolicyBindingSoftAntiAffinity = "soft.anti-affinity"
+	SchedulePolicyBindingSoftAntiAffinity   = "soft.anti-affinity"
+	SchedulePolicyBindingStrictAntiAffinity = "strict.anti-affinity"
 )
 
 type Scheduler interface {
@@ -41,7 +42,8 @@ type ScheduleInstance struct {
 }
 
 type ScheduleSpec struct {
-	HostID string
+	HostID           string
+	RequiredNodeTags map[string]string // the host must carry all of them
 }
 
 type ScheduleData struct {
@@ -50,6 +52,8 @@ type ScheduleData struct {
 }
 
 type SchedulePolicy struct {
-	Binding   SchedulePolicyBinding
-	HostIDMap map[string]struct{}
+	Binding          SchedulePolicyBinding
+	HostIDMap        map[string]struct{}
+	RequiredNodeTags map[string]string
+	PreferredHostID  string // tried first unless in HostIDMap
 }
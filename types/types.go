@@ -1,6 +1,7 @@
 package types
 
 import (
+	"context"
 	"io"
 	"time"
 )
@@ -8,12 +9,13 @@ import (
 type VolumeState string
 
 const (
-	VolumeStateNone     = VolumeState("")
-	VolumeStateCreated  = VolumeState("created")
-	VolumeStateDetached = VolumeState("detached")
-	VolumeStateFaulted  = VolumeState("faulted")
-	VolumeStateHealthy  = VolumeState("healthy")
-	VolumeStateDegraded = VolumeState("degraded")
+	VolumeStateNone      = VolumeState("")
+	VolumeStateCreated   = VolumeState("created")
+	VolumeStateDetached  = VolumeState("detached")
+	VolumeStateFaulted   = VolumeState("faulted")
+	VolumeStateHealthy   = VolumeState("healthy")
+	VolumeStateDegraded  = VolumeState("degraded")
+	VolumeStateRestoring = VolumeState("restoring")
 )
 
 type ReplicaMode string
@@ -24,6 +26,22 @@ const (
 	ReplicaModeERR = ReplicaMode("ERR")
 )
 
+type AccessMode string
+
+const (
+	AccessModeReadWriteOnce = AccessMode("rwo")
+	AccessModeReadWriteMany = AccessMode("rwx")
+)
+
+// DataLocality is whether to keep a replica of the volume on the host of
+// its controller
+type DataLocality string
+
+const (
+	DataLocalityDisabled   = DataLocality("disabled")
+	DataLocalityBestEffort = DataLocality("best-effort")
+)
+
 type InstanceType string
 
 const (
@@ -34,22 +52,51 @@ const (
 
 type VolumeManager interface {
 	Start() error
+	Started() bool
 	Create(volume *VolumeInfo) (*VolumeInfo, error)
 	Delete(name string) error
 	Get(name string) (*VolumeInfo, error)
 	List() ([]*VolumeInfo, error)
-	Attach(name string) error
+	Attach(name, hostID string) error
 	Detach(name string) error
+	Rename(oldName, newName string) error
+	Recover(volumeName string) error
 	UpdateRecurring(name string, jobs []*RecurringJob) error
+	RecurringJobBackfill(volumeName string, since time.Time) error
+	SnapshotSchedule(volumeName string, next int) ([]time.Time, error)
+	UpdateAutoScale(name string, enabled bool, readIOPSThreshold, scaleDownThreshold int64, maxReplicas int) error
+	CreateController(volumeName string, replicas map[string]*ReplicaInfo) (*ControllerInfo, error)
+	ReplicaAdd(volumeName, hostID string) error
+	Migrate(volumeName, hostID string) error
+	Evict(hostID string, timeout time.Duration) error
 	ReplicaRemove(volumeName, replicaName string) error
+	ReplicaStates(volumeName string) ([]*ReplicaInfo, error)
+	RebuildStatus(volumeName string) ([]*RebuildStatus, error) // of the replicas in WO mode
+	PinReplicaToHost(volumeName, replicaName, hostID string) error
+	UpdateLabels(name string, labels map[string]string) error
+	UpdateQoS(name string, qos VolumeQoS) error // restarts the controller of the attached volume
+	SetReplicaMode(volumeName, replicaName string, mode ReplicaMode) error
+	TakeEmergencySnapshot(name string) (*SnapshotInfo, error)
+	CreateGroupSnapshot(volumeNames []string, name string, labels map[string]string) (string, error)
+	Quiesce(volumeName string) error
+	Unquiesce(volumeName string) error
+	PurgeSnapshots(volumeName string, retention time.Duration) (*PurgeResult, error)
+	EnforceMaxSnapshots(volumeName string) error
+	Export(volumeName string) (io.ReadCloser, int64, error) // raw data of the attached volume and its size
+	RestoreFromBackup(volumeName, backupURL string) error
 
 	ListHosts() (map[string]*HostInfo, error)
 	GetHost(id string) (*HostInfo, error)
+	GetStorageTopology() (*StorageTopology, error)
+	ListEvents(sinceEventID int64) ([]*EventInfo, error) // the latest events after the one with the ID
 
 	CheckController(ctrl Controller, volume *VolumeInfo) error
+	MonitorStatus(volumeName string) (*MonitorStatus, error) // nil if the volume isn't monitored by the current host
 	Cleanup(volume *VolumeInfo) error
 
 	Controller(name string) (Controller, error)
+	Watch(volumeName string) (<-chan struct{}, func())
+	WaitForHealthy(ctx context.Context, volumeName string) error
 	SnapshotOps(name string) (SnapshotOps, error)
 	VolumeBackupOps(name string) (VolumeBackupOps, error)
 	Settings() Settings
@@ -70,10 +117,12 @@ type SnapshotOps interface {
 	Delete(name string) error
 	Revert(name string) error
 	Purge() error
+	Diff(from, to string) (*SnapshotDiff, error) // the blocks changed from snapshot from to snapshot to
 }
 
 type VolumeBackupOps interface {
-	StartBackup(snapName, backupTarget string) error
+	StartBackup(snapName, backupTarget string) (*BgTask, error)
+	Cancel(backup string) error // backup is the URL of the BackupBgTask in progress
 	Restore(backup string) error
 	DeleteBackup(backup string) error
 }
@@ -87,6 +136,7 @@ type ManagerBackupOps interface {
 
 	ListVolumes() ([]*BackupVolumeInfo, error)
 	GetVolume(volumeName string) (*BackupVolumeInfo, error)
+	DeleteVolume(volumeName string) error // all backups of the volume
 }
 
 type Event interface{}
@@ -106,9 +156,16 @@ type Controller interface {
 	GetReplicaStates() ([]*ReplicaInfo, error)
 	AddReplica(replica *ReplicaInfo) error
 	RemoveReplica(replica *ReplicaInfo) error
+	SetReplicaMode(replica *ReplicaInfo, mode ReplicaMode) error
+	IOStats() (*VolumeIOStats, error)
+	RebuildStatus() ([]*RebuildStatus, error) // ReplicaName is not set
+	Info() (*VolumeControllerInfo, error)
+	Freeze() error // pause I/O of the volume frontend
+	Unfreeze() error
 
 	BgTaskQueue() TaskQueue
 	LatestBgTasks() []*BgTask
+	CancelBgTask(num int64) error // cancels the running task or removes the queued one
 
 	SnapshotOps() SnapshotOps
 	BackupOps() VolumeBackupOps
@@ -120,15 +177,23 @@ type Orchestrator interface {
 	GetVolume(volumeName string) (*VolumeInfo, error)     // For non-existing volume, return (nil, nil)
 	ListVolumes() ([]*VolumeInfo, error)
 	MarkBadReplica(volumeName string, replica *ReplicaInfo) error // find replica by Address
+	UpdateReplica(replica *ReplicaInfo) error                     // find replica by VolumeName and Name
+
+	LockVolume(volumeName string) (string, error) // cluster-wide, blocks until the lock is acquired or times out, returns the token to unlock it with
+	UnlockVolume(volumeName, token string) error
 	UpdateVolume(volume *VolumeInfo) error
+	RenameVolume(oldName string, volume *VolumeInfo) error // moves all metadata of the volume under its new name
 
 	CreateController(volumeName, controllerName string, replicas map[string]*ReplicaInfo) (*ControllerInfo, error)
-	CreateReplica(volumeName, replicaName string) (*ReplicaInfo, error)
+	CreateReplica(volumeName, replicaName, hostID string) (*ReplicaInfo, error) // empty hostID lets the scheduler choose the host
 
 	StartInstance(instance *InstanceInfo) (*InstanceInfo, error)
 	StopInstance(instance *InstanceInfo) (*InstanceInfo, error)
 	RemoveInstance(instance *InstanceInfo) (*InstanceInfo, error)
 
+	ListInstances() ([]*InstanceInfo, error)             // instances on the current host
+	RemoveOrphanedInstance(instance *InstanceInfo) error // removes an instance on the current host, ignoring volume metadata
+
 	ListHosts() (map[string]*HostInfo, error)
 	GetHost(id string) (*HostInfo, error)
 
@@ -138,23 +203,126 @@ type Orchestrator interface {
 	Settings
 }
 
+// PVCResolver is implemented by orchestrators able to find the volume bound
+// to a PersistentVolumeClaim
+type PVCResolver interface {
+	GetVolumeNameForPVC(pvc string) (string, error)
+}
+
+// MonitorStatus is the state of the checks of the controller of an attached
+// volume by the manager of its host
+type MonitorStatus struct {
+	Interval          time.Duration
+	LastCheckTime     time.Time
+	LastCheckError    string
+	ConsecutiveErrors int
+}
+
+// EventInfo is an event kept in the event log of the manager
+type EventInfo struct {
+	ID        string `json:"id"`
+	Timestamp string `json:"timestamp"`
+	Type      string `json:"type"`     // e.g. ReplicaFailed
+	Resource  string `json:"resource"` // e.g. volume/vol1
+	Message   string `json:"message"`
+}
+
+// EventRecorder is implemented by orchestrators able to publish volume
+// events to their users, e.g. as Kubernetes events of the claim of the volume
+type EventRecorder interface {
+	RecordVolumeEvent(volume *VolumeInfo, eventType, reason, message string)
+}
+
+const (
+	EventTypeNormal  = "Normal"
+	EventTypeWarning = "Warning"
+)
+
+// OperationLog is implemented by orchestrators able to persist the progress
+// of multi-step volume operations, see VolumeManager.Recover
+type OperationLog interface {
+	SetOperation(op *Operation) error
+	GetOperation(volumeName string) (*Operation, error) // For no operation in progress, return (nil, nil)
+	DeleteOperation(volumeName string) error
+	ListOperations() ([]*Operation, error)
+}
+
+// Operation is a multi-step operation on a volume and the steps it completed
+type Operation struct {
+	VolumeName string   `json:"volumeName"`
+	Type       string   `json:"type"`
+	HostID     string   `json:"hostId"`
+	Started    string   `json:"started"`
+	Steps      []string `json:"steps"`
+}
+
+const (
+	OperationCreateFromBackup = "createFromBackup"
+
+	OperationStepCreatedVolume      = "created-volume"
+	OperationStepCreatedReplicas    = "created-replicas"
+	OperationStepAttachedController = "attached-controller"
+	OperationStepRestoredBackup     = "restored-backup"
+)
+
+// LastStep returns the last step the operation completed, empty if none
+func (op *Operation) LastStep() string {
+	if len(op.Steps) == 0 {
+		return ""
+	}
+	return op.Steps[len(op.Steps)-1]
+}
+
+func (op *Operation) HasStep(step string) bool {
+	for _, s := range op.Steps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
 type ServiceLocator interface {
 	GetCurrentHostID() string
 	GetAddress(hostID string) (string, error) // Return <host>:<port>
 }
 
 type SettingsInfo struct {
-	BackupTarget string `json:"backupTarget" mapstructure:"backupTarget"`
-	EngineImage  string `json:"engineImage" mapstructure:"engineImage"`
+	BackupTarget        string `json:"backupTarget" mapstructure:"backupTarget"`
+	BackupS3Endpoint    string `json:"backupS3Endpoint" mapstructure:"backupS3Endpoint"` // S3 compatible server, empty for AWS
+	EngineImage         string `json:"engineImage" mapstructure:"engineImage"`
+	ReplicaAntiAffinity string `json:"replicaAntiAffinity" mapstructure:"replicaAntiAffinity"`
+	SyslogTarget        string `json:"syslogTarget" mapstructure:"syslogTarget"`
+	// FaultedVolumeAutoRecovery restarts faulted volumes from their most
+	// recently failed replica
+	FaultedVolumeAutoRecovery bool `json:"faultedVolumeAutoRecovery" mapstructure:"faultedVolumeAutoRecovery"`
 }
 
+const (
+	// ReplicaAntiAffinitySoft prefers hosts without replicas of the volume
+	// and falls back to any host
+	ReplicaAntiAffinitySoft = "soft"
+	// ReplicaAntiAffinityStrict fails to schedule a replica if all hosts
+	// already have replicas of the volume
+	ReplicaAntiAffinityStrict = "strict"
+)
+
 type VolumeInfo struct {
 	Name                string
 	Size                int64
 	BaseImage           string
 	FromBackup          string
+	Restoring           bool // set until the backup is restored
+	FromSnapshot        string
+	FromVolume          string // clone a new snapshot of the volume
+	SourcePVC           string
+	AccessMode          AccessMode
+	DataLocality        DataLocality
+	FsType              string   // filesystem to format the volume with, for the node plugin
+	MountOptions        []string // options to mount the volume filesystem with
 	NumberOfReplicas    int
 	StaleReplicaTimeout time.Duration
+	MaxSnapshots        int // the oldest snapshots not backed up are removed beyond it, 0 for no limit
 	Controller          *ControllerInfo
 	Replicas            map[string]*ReplicaInfo //key is replicaName
 	State               VolumeState
@@ -162,6 +330,24 @@ type VolumeInfo struct {
 	Endpoint            string
 	Created             string
 	RecurringJobs       []*RecurringJob
+	Labels              map[string]string // user-defined metadata
+	DryRun              bool              // only validate and plan the creation, see VolumeManager.Create
+
+	AutoScaleReplicas           bool
+	AutoScaleReadIOPSThreshold  int64
+	AutoScaleScaleDownThreshold int64
+	MinAutoScaleReplicas        int
+	MaxAutoScaleReplicas        int
+
+	VolumeQoS
+}
+
+// VolumeQoS throttles the I/O of the volume in the engine, zero for no limit
+type VolumeQoS struct {
+	ReadIOPSMax       int64
+	WriteIOPSMax      int64
+	ReadBandwidthMax  int64 // bytes per second
+	WriteBandwidthMax int64 // bytes per second
 }
 
 type InstanceInfo struct {
@@ -183,6 +369,7 @@ type ReplicaInfo struct {
 
 	Mode         ReplicaMode
 	BadTimestamp string
+	PinnedHostID string
 }
 
 type SnapshotInfo struct {
@@ -196,12 +383,94 @@ type SnapshotInfo struct {
 	Labels      map[string]string `json:"labels"`
 }
 
+// BlockRange is a range of bytes of the volume
+type BlockRange struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+type SnapshotDiff struct {
+	ChangedBlocks []BlockRange `json:"changedBlocks"`
+	TotalChanged  int64        `json:"totalChanged"` // bytes
+}
+
+type PurgeResult struct {
+	Removed    int   `json:"removed"`
+	SpaceFreed int64 `json:"spaceFreed"`
+}
+
+type VolumeIOStats struct {
+	ReadIOPS       int64 `json:"readIOPS"`
+	WriteIOPS      int64 `json:"writeIOPS"`
+	ReadBandwidth  int64 `json:"readBandwidth"`  // bytes per second
+	WriteBandwidth int64 `json:"writeBandwidth"` // bytes per second
+	Latency        int64 `json:"latency"`        // average, in microseconds
+}
+
+type RebuildStatus struct {
+	ReplicaName string `json:"replicaName"`
+	Address     string `json:"address"`
+	Progress    int    `json:"progress"` // percent
+	State       string `json:"state"`
+}
+
+type VolumeControllerInfo struct {
+	Name         string `json:"name"`
+	ReplicaCount int    `json:"replicaCount"`
+	Endpoint     string `json:"endpoint"`
+}
+
 type HostInfo struct {
+	UUID    string            `json:"uuid"`
+	Name    string            `json:"name"`
+	Address string            `json:"address"`
+	Tags    map[string]string `json:"tags,omitempty"` // e.g. rack=A, zone=us-east-1a
+
+	TotalStorage int64 `json:"totalStorage,omitempty"`
+	UsedStorage  int64 `json:"usedStorage,omitempty"` // provisioned for the replicas on the host
+	ReplicaCount int   `json:"replicaCount,omitempty"`
+}
+
+type TopologyEdgeType string
+
+const (
+	TopologyEdgeTypeHasReplica = TopologyEdgeType("hasReplica")
+	TopologyEdgeTypeHostedOn   = TopologyEdgeType("hostedOn")
+)
+
+type StorageTopology struct {
+	Hosts   []HostNode     `json:"hosts"`
+	Volumes []VolumeNode   `json:"volumes"`
+	Edges   []TopologyEdge `json:"edges"`
+}
+
+type HostNode struct {
 	UUID    string `json:"uuid"`
 	Name    string `json:"name"`
 	Address string `json:"address"`
 }
 
+type VolumeNode struct {
+	Name     string        `json:"name"`
+	State    VolumeState   `json:"state"`
+	Replicas []ReplicaNode `json:"replicas"`
+}
+
+type ReplicaNode struct {
+	Name    string `json:"name"`
+	HostID  string `json:"hostId"`
+	Running bool   `json:"running"`
+	Bad     bool   `json:"bad"`
+}
+
+// TopologyEdge links a volume to its replica (hasReplica), or a replica to
+// the host it's on (hostedOn)
+type TopologyEdge struct {
+	Type TopologyEdgeType `json:"type"`
+	From string           `json:"from"`
+	To   string           `json:"to"`
+}
+
 type BackupInfo struct {
 	Name            string `json:"name,omitempty"`
 	URL             string `json:"url,omitempty"`
@@ -219,6 +488,7 @@ type TaskQueue interface {
 	List() []*BgTask
 	Put(*BgTask)
 	Take() *BgTask
+	Remove(num int64) *BgTask // nil if the task isn't queued
 }
 
 type BgTask struct {
@@ -227,20 +497,41 @@ type BgTask struct {
 	Finished  string      `json:"finished"`
 	Started   string      `json:"started"`
 	Submitted string      `json:"submitted"`
+	Progress  int         `json:"progress"` // percent
 	Task      interface{} `json:"task"`
 }
 
 type BackupBgTask struct {
 	Snapshot     string `json:"snapshot"`
 	BackupTarget string `json:"backupTarget"`
+	URL          string `json:"url"`       // identifies the backup while in progress, see VolumeBackupOps.Cancel
+	BackupURL    string `json:"backupUrl"` // of the created backup
 
 	CleanupHook func() error `json:"-"`
 }
 
+type BackupIntegrityBgTask struct {
+	BackupTarget string                 `json:"backupTarget"`
+	VolumeName   string                 `json:"volumeName"`
+	Report       *BackupIntegrityReport `json:"report"`
+}
+
+// BackupIntegrityReport lists the URLs of the corrupted backups. The blocks
+// are <volume>/<checksum>, they are only checked on vfs and nfs backup
+// targets.
+type BackupIntegrityReport struct {
+	Volumes          int      `json:"volumes"`
+	CheckedBackups   int      `json:"checkedBackups"`
+	CorruptedBackups []string `json:"corruptedBackups"`
+	MissingBlocks    []string `json:"missingBlocks"`
+	OrphanedBlocks   []string `json:"orphanedBlocks"`
+}
+
 type BackupVolumeInfo struct {
-	Name    string `json:"name"`
-	Size    string `json:"size"`
-	Created string `json:"created"`
+	Name        string `json:"name"`
+	Size        string `json:"size"`
+	Created     string `json:"created"`
+	BackupCount int    `json:"backupCount"`
 }
 
 const (
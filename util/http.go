@@ -13,3 +13,25 @@ func CopyReq(req *http.Request) *http.Request {
 	r.Body = ioutil.NopCloser(bytes.NewBuffer(buf))
 	return &r
 }
+
+// PeerScheme and PeerTransport are used for the requests to the API of the
+// other managers, https with the client certificate if the API serves TLS
+var (
+	PeerScheme                      = "http"
+	PeerTransport http.RoundTripper = http.DefaultTransport
+)
+
+// PeerUser and PeerPassword are the basic auth credentials of the requests to
+// the API of the other managers, empty if it doesn't require auth
+var PeerUser, PeerPassword string
+
+// SetPeerAuth sets the peer credentials on a request to another manager,
+// unless it already carries credentials
+func SetPeerAuth(req *http.Request) {
+	if PeerUser == "" {
+		return
+	}
+	if _, _, ok := req.BasicAuth(); !ok {
+		req.SetBasicAuth(PeerUser, PeerPassword)
+	}
+}
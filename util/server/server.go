@@ -1,9 +1,12 @@
 package server
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"github.com/Sirupsen/logrus"
 	"github.com/docker/go-connections/sockets"
 	"github.com/pkg/errors"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -35,15 +38,84 @@ func (s *UnixServer) Serve(handler http.Handler) {
 }
 
 type TCPServer struct {
-	addr string
+	addr      string
+	tlsConfig *tls.Config
 }
 
 func NewTCPServer(addrPort string) *TCPServer {
-	return &TCPServer{addrPort}
+	return &TCPServer{addr: addrPort}
+}
+
+// NewTLSServer returns a TCP server accepting HTTPS connections only
+func NewTLSServer(addrPort string, tlsConfig *tls.Config) *TCPServer {
+	return &TCPServer{addr: addrPort, tlsConfig: tlsConfig}
 }
 
 func (s *TCPServer) Serve(handler http.Handler) {
-	logrus.Infof("TCP server listening at %v", s.addr)
-	err := http.ListenAndServe(s.addr, handler)
-	logrus.Fatalf("http.ListenAndServe returned error: %+v", errors.Wrap(err, "http server error"))
+	if s.tlsConfig == nil {
+		logrus.Infof("TCP server listening at %v", s.addr)
+		err := http.ListenAndServe(s.addr, handler)
+		logrus.Fatalf("http.ListenAndServe returned error: %+v", errors.Wrap(err, "http server error"))
+	}
+	listener, err := tls.Listen("tcp", s.addr, s.tlsConfig)
+	if err != nil {
+		logrus.Fatalf("%+v", errors.Wrapf(err, "error listening at '%s'", s.addr))
+	}
+	logrus.Infof("TLS server listening at %v", s.addr)
+	err = http.Serve(listener, handler)
+	logrus.Fatalf("http.Serve returned error: %+v", errors.Wrap(err, "https server error"))
+}
+
+// TLSConfig loads the server certificate and key. If caFile is not empty,
+// clients are required to present a certificate signed by the CA.
+func TLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading TLS certificate '%s' and key '%s'", certFile, keyFile)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if caFile != "" {
+		pool, err := loadCA(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// ClientTLSConfig is TLSConfig for the requests to the other managers: the
+// certificate is presented as the client certificate and, if caFile is not
+// empty, the servers are verified with the CA instead of the system roots.
+func ClientTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading TLS certificate '%s' and key '%s'", certFile, keyFile)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if caFile != "" {
+		if config.RootCAs, err = loadCA(caFile); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+func loadCA(caFile string) (*x509.CertPool, error) {
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading TLS CA '%s'", caFile)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.Errorf("no valid certificates found in TLS CA '%s'", caFile)
+	}
+	return pool, nil
 }
@@ -64,12 +64,41 @@ func ReplicaAddress(name, volumeName string) string {
 	return fmt.Sprintf("%s.rancher.internal", name)
 }
 
+// BasePort is the base port of the cluster, and of the manager API unless
+// it's set apart. Controllers listen on the port after it and replicas on the
+// one after that.
+var BasePort = 9500
+
+func ControllerPort() int {
+	return BasePort + 1
+}
+
+func ReplicaPort() int {
+	return BasePort + 2
+}
+
 func ReplicaName(address, volumeName string) string {
-	s := strings.TrimSuffix(strings.TrimPrefix(address, "tcp://"), ":9502")
+	s := strings.TrimSuffix(strings.TrimPrefix(address, "tcp://"), fmt.Sprintf(":%d", ReplicaPort()))
 	s = strings.TrimSuffix(s, ".rancher.internal")
 	return strings.TrimSuffix(s, "."+VolumeStackName(volumeName))
 }
 
+// ParseTags parses comma separated key=value pairs
+func ParseTags(s string) (map[string]string, error) {
+	tags := map[string]string{}
+	if strings.TrimSpace(s) == "" {
+		return tags, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, errors.Errorf("invalid tag '%s', should be key=value", pair)
+		}
+		tags[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return tags, nil
+}
+
 func ConvertSize(size interface{}) (int64, error) {
 	switch size := size.(type) {
 	case int64:
@@ -34,4 +34,25 @@ func TestReplicaName(t *testing.T) {
 	assert.Equal("replica-XX", ReplicaName("tcp://replica-XX:9502", "tt"))
 	assert.Equal("replica-XX", ReplicaName("tcp://replica-XX.rancher.internal:9502", "tt"))
 	assert.Equal("replica-XX", ReplicaName("tcp://replica-XX.volume-tt:9502", "tt"))
+
+	defer func(port int) { BasePort = port }(BasePort)
+	BasePort = 9600
+	assert.Equal("replica-XX", ReplicaName("tcp://replica-XX:9602", "tt"))
+}
+
+func TestParseTags(t *testing.T) {
+	assert := require.New(t)
+
+	tags, err := ParseTags("rack=A, zone=us-east-1a")
+	assert.Nil(err)
+	assert.Equal(map[string]string{"rack": "A", "zone": "us-east-1a"}, tags)
+
+	tags, err = ParseTags("")
+	assert.Nil(err)
+	assert.Len(tags, 0)
+
+	_, err = ParseTags("rack")
+	assert.NotNil(err)
+	_, err = ParseTags("=A")
+	assert.NotNil(err)
 }